@@ -0,0 +1,188 @@
+// Package analog conditions noisy analog inputs such as the speed
+// potentiometer.
+//
+// analogパッケージは、速度調整用のポテンショメータのようなノイズの多いア
+// ナログ入力を整える。
+package analog
+
+// FullScale is the full-scale reading of a 16-bit analog input.
+//
+// FullScaleは、16ビットのアナログ入力のフルスケールの値。
+const FullScale = 0xFFFF
+
+// Reader reads a 16-bit analog value. machine.ADC satisfies it.
+//
+// Readerは、16ビットのアナログ値を読む。machine.ADCはこれを満たす。
+type Reader interface {
+	Get() uint16
+}
+
+// Config holds the settings of a Conditioner.
+//
+// Configは、Conditionerの設定を持つ。
+type Config struct {
+	// Number of raw samples averaged per reading.
+	// 1回の読み取りで平均する生のサンプル数
+	Samples int
+	// Changes of the averaged value up to this size are ignored.
+	// 平均した値のこの大きさまでの変化は無視する。
+	Hysteresis uint16
+	// The learned low endpoint starts here and only moves down, and the
+	// high endpoint starts at MinHigh and only moves up. A worn pot that
+	// never gets past them still reaches 0 and full scale.
+	// 学習する下端はここから始まって下にだけ動き、上端はMinHighから始まっ
+	// て上にだけ動く。ここまで届かない劣化したポットでも0とフルスケールに
+	// 届く。
+	MaxLow, MinHigh uint16
+	// Readings within EndMargin of a learned endpoint snap to it, so noise
+	// at the end stops does not keep the output off 0 or full scale.
+	// 学習した端点からEndMargin以内の値は端点に吸着させる。これで端での
+	// ノイズのせいで0やフルスケールから外れない。
+	EndMargin uint16
+}
+
+// DefaultConfig returns settings suited to a 10kΩ pot on the RP2040 ADC.
+//
+// DefaultConfigは、RP2040のADCにつないだ10kΩのポットに合った設定を返す。
+func DefaultConfig() Config {
+	return Config{
+		Samples:    8,
+		Hysteresis: 256,
+		MaxLow:     FullScale / 20,           // 5%
+		MinHigh:    FullScale - FullScale/20, // 95%
+		EndMargin:  256,
+	}
+}
+
+// Conditioner wraps a Reader with oversampling, hysteresis and endpoint
+// calibration. It is itself a Reader.
+//
+// Conditionerは、Readerにオーバーサンプリング、ヒステリシス、端点の較正を
+// 加える。Conditioner自体もReader。
+type Conditioner struct {
+	Config Config
+	src    Reader
+
+	low, high uint16
+	// The averaged value last accepted by the hysteresis.
+	// ヒステリシスが最後に受け入れた平均値
+	held   uint16
+	primed bool
+}
+
+// NewConditioner creates a Conditioner reading from src.
+//
+// NewConditionerは、srcから読むConditionerを作る。
+func NewConditioner(src Reader, cfg Config) *Conditioner {
+	c := &Conditioner{
+		Config: cfg,
+		src:    src,
+	}
+	c.ResetEndpoints()
+	return c
+}
+
+// Endpoints returns the learned low and high endpoints in raw counts.
+//
+// Endpointsは、学習した下端と上端を生の値で返す。
+func (c *Conditioner) Endpoints() (uint16, uint16) {
+	return c.low, c.high
+}
+
+// SetEndpoints restores previously learned endpoints, e.g. from saved
+// settings. Learning continues from them.
+//
+// SetEndpointsは、保存した設定などから以前に学習した端点を戻す。学習はそ
+// こから続ける。
+func (c *Conditioner) SetEndpoints(low, high uint16) {
+	if low > high {
+		low, high = high, low
+	}
+	c.low, c.high = low, high
+}
+
+// ResetEndpoints forgets the learned endpoints.
+//
+// ResetEndpointsは、学習した端点を忘れる。
+func (c *Conditioner) ResetEndpoints() {
+	c.SetEndpoints(c.Config.MaxLow, c.Config.MinHigh)
+}
+
+// Raw returns the averaged value last accepted by the hysteresis, before
+// endpoint scaling.
+//
+// Rawは、ヒステリシスが最後に受け入れた、端点で伸縮する前の平均値を返す。
+func (c *Conditioner) Raw() uint16 {
+	return c.held
+}
+
+// Get takes a conditioned reading scaled so the learned endpoints map to
+// 0 and FullScale.
+//
+// Getは、整えた値を読み取る。学習した端点が0とFullScaleになるよう伸縮す
+// る。
+func (c *Conditioner) Get() uint16 {
+	avg := c.average()
+
+	if avg < c.low {
+		c.low = avg
+	}
+	if avg > c.high {
+		c.high = avg
+	}
+
+	if !c.primed || diff(avg, c.held) > c.Config.Hysteresis {
+		c.held = avg
+		c.primed = true
+	}
+	return c.scale(c.held)
+}
+
+// average reads and averages Config.Samples raw samples.
+//
+// averageは、Config.Samples個の生のサンプルを読んで平均する。
+func (c *Conditioner) average() uint16 {
+	n := c.Config.Samples
+	if n < 1 {
+		n = 1
+	}
+	var sum uint32
+	for i := 0; i < n; i++ {
+		sum += uint32(c.src.Get())
+	}
+	return uint16((sum + uint32(n)/2) / uint32(n))
+}
+
+// scale maps v from the learned endpoints (less the margins) to
+// 0-FullScale.
+//
+// scaleは、vを学習した端点(マージンを除く)から0-FullScaleに伸縮する。
+func (c *Conditioner) scale(v uint16) uint16 {
+	low := uint32(c.low) + uint32(c.Config.EndMargin)
+	high := uint32(c.high)
+	if high > uint32(c.Config.EndMargin) {
+		high -= uint32(c.Config.EndMargin)
+	}
+	switch {
+	case high <= low:
+		// Endpoints closer than the margins: treat as a switch.
+		// 端点がマージンより近い場合はスイッチとして扱う。
+		if uint32(v) > low {
+			return FullScale
+		}
+		return 0
+	case uint32(v) <= low:
+		return 0
+	case uint32(v) >= high:
+		return FullScale
+	}
+	span := high - low
+	return uint16(((uint32(v)-low)*FullScale + span/2) / span)
+}
+
+func diff(a, b uint16) uint16 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,172 @@
+package analog
+
+import (
+	"testing"
+)
+
+// Note: tinygo test ./analog
+
+// 記録したサンプル列を順に返すReader。最後まで行ったら最後の値を返し続ける。
+type recordedReader struct {
+	samples []uint16
+	next    int
+}
+
+func (r *recordedReader) Get() uint16 {
+	v := r.samples[r.next]
+	if r.next < len(r.samples)-1 {
+		r.next++
+	}
+	return v
+}
+
+// 同じ値を返し続けるReader
+type constReader uint16
+
+func (r constReader) Get() uint16 { return uint16(r) }
+
+// 較正しやすいよう、端点が最初から全範囲のConfig
+func wideConfig() Config {
+	cfg := DefaultConfig()
+	cfg.MaxLow = 0
+	cfg.MinHigh = FullScale
+	cfg.EndMargin = 0
+	return cfg
+}
+
+func TestConditioner_Oversampling(t *testing.T) {
+	cfg := wideConfig()
+	cfg.Samples = 4
+	cfg.Hysteresis = 0
+	src := &recordedReader{samples: []uint16{
+		30000, 30400, 29600, 30000, // 平均 30000
+		31000, 31000, 31002, 31000, // 平均 31000.5 -> 31001
+	}}
+	c := NewConditioner(src, cfg)
+
+	if got := c.Get(); got != 30000 {
+		t.Errorf("期待する値は 30000 、実際は %d で異なる", got)
+	}
+	if got := c.Get(); got != 31001 {
+		t.Errorf("期待する値は 31001 、実際は %d で異なる", got)
+	}
+}
+
+// ヒステリシスより小さい揺れは無視し、大きな変化には追従する
+func TestConditioner_Hysteresis(t *testing.T) {
+	cfg := wideConfig()
+	cfg.Samples = 1
+	cfg.Hysteresis = 100
+
+	// ポットを動かさずに読んだときの揺れを記録した値
+	noisy := []uint16{20000, 20040, 19950, 20090, 19910, 20010, 19990}
+	src := &recordedReader{samples: append(noisy, 20500, 20480, 20520)}
+	c := NewConditioner(src, cfg)
+
+	for i := range noisy {
+		if got := c.Get(); got != 20000 {
+			t.Errorf("%d番目の期待する値は 20000 、実際は %d で異なる", i, got)
+		}
+	}
+	if got := c.Get(); got != 20500 {
+		t.Errorf("動かしたときの期待する値は 20500 、実際は %d で異なる", got)
+	}
+	for i := 0; i < 2; i++ {
+		if got := c.Get(); got != 20500 {
+			t.Errorf("動かした後の期待する値は 20500 、実際は %d で異なる", got)
+		}
+	}
+}
+
+// 劣化して端まで届かないポットでも、一度端まで回せば0とフルスケールに届く
+func TestConditioner_EndpointLearning(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Samples = 1
+	cfg.Hysteresis = 0
+	cfg.EndMargin = 0
+	src := &recordedReader{}
+	c := NewConditioner(src, cfg)
+
+	read := func(v uint16) uint16 {
+		src.samples = []uint16{v}
+		src.next = 0
+		return c.Get()
+	}
+
+	// 最初は下端5%、上端95%を仮定しているので、その外は端になる
+	if got := read(2000); got != 0 {
+		t.Errorf("期待する値は 0 、実際は %d で異なる", got)
+	}
+	if got := read(63000); got != FullScale {
+		t.Errorf("期待する値は %d 、実際は %d で異なる", FullScale, got)
+	}
+	// 上の2回で端点を学習した
+	if low, high := c.Endpoints(); low != 2000 || high != 63000 {
+		t.Errorf("期待する端点は 2000/63000 、実際は %d/%d で異なる", low, high)
+	}
+	if got := read(32500); got != 32768 {
+		t.Errorf("期待する値は 32768 、実際は %d で異なる", got)
+	}
+
+	// 端点は広がるだけで、内側には戻らない
+	read(40000)
+	if low, high := c.Endpoints(); low != 2000 || high != 63000 {
+		t.Errorf("期待する端点は 2000/63000 、実際は %d/%d で異なる", low, high)
+	}
+
+	c.ResetEndpoints()
+	if low, high := c.Endpoints(); low != cfg.MaxLow || high != cfg.MinHigh {
+		t.Errorf("リセット後の期待する端点は %d/%d 、実際は %d/%d で異なる", cfg.MaxLow, cfg.MinHigh, low, high)
+	}
+}
+
+// 端点の近くのノイズでも0とフルスケールを保つ
+func TestConditioner_EndMargin(t *testing.T) {
+	cfg := wideConfig()
+	cfg.Samples = 1
+	cfg.Hysteresis = 0
+	cfg.EndMargin = 300
+	c := NewConditioner(constReader(0), cfg)
+	c.SetEndpoints(1000, 64000)
+
+	testCases := []struct {
+		raw      uint16
+		expected uint16
+	}{
+		{raw: 1000, expected: 0},
+		{raw: 1300, expected: 0},
+		{raw: 32500, expected: 32768},
+		{raw: 63700, expected: FullScale},
+		{raw: 64000, expected: FullScale},
+	}
+	for _, tc := range testCases {
+		c.src = constReader(tc.raw)
+		if got := c.Get(); got != tc.expected {
+			t.Errorf("生の値 %d で期待する値は %d 、実際は %d で異なる", tc.raw, tc.expected, got)
+		}
+	}
+}
+
+func TestConditioner_SetEndpoints(t *testing.T) {
+	c := NewConditioner(constReader(0), DefaultConfig())
+	c.SetEndpoints(60000, 1000)
+	if low, high := c.Endpoints(); low != 1000 || high != 60000 {
+		t.Errorf("期待する端点は 1000/60000 、実際は %d/%d で異なる", low, high)
+	}
+}
+
+// 端点が近すぎるときはスイッチのように振る舞う
+func TestConditioner_DegenerateEndpoints(t *testing.T) {
+	cfg := wideConfig()
+	cfg.Samples = 1
+	cfg.EndMargin = 100
+	c := NewConditioner(constReader(30050), cfg)
+	c.SetEndpoints(30000, 30100)
+
+	if got := c.Get(); got != 0 {
+		t.Errorf("期待する値は 0 、実際は %d で異なる", got)
+	}
+	if c.Raw() != 30050 {
+		t.Errorf("期待する生の値は 30050 、実際は %d で異なる", c.Raw())
+	}
+}
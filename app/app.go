@@ -0,0 +1,804 @@
+// Package app is the platform-independent core of the fan controller.
+// It owns the boot sequence, the RPM and PWM ticks and the display
+// updates, and only talks to the hardware through small interfaces, so
+// the whole controller can run in host tests.
+//
+// appパッケージは、ファンコントローラーのプラットフォームに依存しない中核。
+// 起動シーケンス、RPMとPWMの周期処理、ディスプレイの更新を受け持ち、ハード
+// ウェアとは小さなインターフェースを通してのみやり取りする。これでコント
+// ローラー全体をホストのテストで動かせる。
+package app
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/analog"
+	"github.com/kou-tkbys/tk-fancon2/calib"
+	"github.com/kou-tkbys/tk-fancon2/console"
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/curve"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/ht16k33"
+	"github.com/kou-tkbys/tk-fancon2/protocol"
+	"github.com/kou-tkbys/tk-fancon2/settings"
+	"github.com/kou-tkbys/tk-fancon2/telemetry"
+)
+
+// ErrNoStorage is returned by SaveSettings before LoadSettings was called.
+//
+// ErrNoStorageは、LoadSettingsを呼ぶ前のSaveSettingsが返す。
+var ErrNoStorage = errors.New("app: no settings storage")
+
+// ErrCalibrating is returned by Calibrate while a calibration runs.
+//
+// ErrCalibratingは、特性測定の実行中にCalibrateが返す。
+var ErrCalibrating = errors.New("app: calibration running")
+
+// ErrCalibrationFault ends a calibration stopped by a fan fault.
+//
+// ErrCalibrationFaultは、ファンの異常で止めた特性測定を終わらせる。
+var ErrCalibrationFault = errors.New("app: calibration stopped by a fault")
+
+// Config holds the timing and addresses used by the App.
+//
+// Configは、Appが使うタイミングとアドレスを持つ。
+type Config struct {
+	// How often the RPMs are measured and displayed.
+	// RPMを計測して表示する間隔
+	RPMInterval time.Duration
+	// How often the duty is updated.
+	// デューティを更新する間隔
+	PWMInterval time.Duration
+	// I2C address of the HT16K33 driving both displays.
+	// 両方のディスプレイを駆動するHT16K33のI2Cアドレス
+	DisplayAddress uint8
+	// Retries and holdoff of the display bus when the display does not
+	// answer.
+	// ディスプレイが応答しないときの、ディスプレイのバスの再試行と待ち
+	DisplayRecovery ht16k33.RecoveryConfig
+	// Oversampling, hysteresis and endpoint learning of the
+	// potentiometer.
+	// ポテンショメータのオーバーサンプリング、ヒステリシス、端点の学習
+	PotInput analog.Config
+	// Maps the potentiometer reading to a duty.
+	// ポテンショメータの値をデューティに変換する。
+	PotCurve curve.Curve
+	// Slew rates and soft start of the duty outputs.
+	// デューティ出力の変化率とソフトスタート
+	Ramp control.RampConfig
+	// Kick-start and minimum running duty of the front and rear fans.
+	// 前側と後ろ側のファンのキックスタートと最低運転デューティ
+	FrontStart, RearStart control.StartConfig
+	// Gains of the front rotor speed loop used in closed-loop mode.
+	// 閉ループモードで使う前側ローターの速度ループのゲイン
+	SpeedPID control.PID
+	// Steps and settling of the characterization sweep.
+	// 特性測定のスイープのステップと整定
+	Calibration calib.Config
+	// Format, fields and rate of the telemetry stream.
+	// テレメトリーの符号化方式、フィールド、頻度
+	Telemetry telemetry.Config
+}
+
+// DefaultConfig returns the configuration of the original firmware.
+//
+// DefaultConfigは、元のファームウェアの設定を返す。
+func DefaultConfig() Config {
+	return Config{
+		RPMInterval:     1 * time.Second,
+		PWMInterval:     50 * time.Millisecond,
+		DisplayAddress:  0x70,
+		DisplayRecovery: ht16k33.DefaultRecoveryConfig(),
+		PotInput:        analog.DefaultConfig(),
+		PotCurve:        curve.Default(),
+		Ramp:            control.DefaultRampConfig(),
+		FrontStart:      control.DefaultStartConfig(),
+		RearStart:       control.DefaultStartConfig(),
+		SpeedPID:        *control.NewPID(4, 8, 0.5),
+		Calibration:     calib.DefaultConfig(),
+		Telemetry:       telemetry.DefaultConfig(),
+	}
+}
+
+// App is the fan controller application.
+//
+// Appは、ファンコントローラーのアプリケーション。
+type App struct {
+	Config Config
+	// Available after Boot.
+	// Bootの後で使える。
+	Fans    *fan.DualFan
+	Pot     *analog.Conditioner
+	Display ht16k33.Device
+	// Nil until StartTelemetry.
+	// StartTelemetryまではnil。
+	Telemetry *telemetry.Stream
+	// Where the telemetry goes, kept so the console can restart it.
+	// テレメトリーの送り先。コンソールがやり直せるよう覚えておく。
+	telemetryOut io.Writer
+	// The command console, its input and output, and the splitter
+	// passing protocol frames from the input to handleMessage. Nil until
+	// StartConsole.
+	// コマンドコンソール、その入力と出力、入力からプロトコルのフレームを
+	// handleMessageに渡す振り分け器。StartConsoleまではnil。
+	console    *console.Shell
+	consoleIn  io.Reader
+	consoleOut io.Writer
+	demux      *protocol.Demux
+	// Buffers reused for protocol replies.
+	// プロトコルの返答に使い回すバッファ
+	reply, frame []byte
+
+	led   StatusLED
+	ledOn bool
+	clock Clock
+	out   DutyOutput
+
+	// Limit how fast the front and rear duties change.
+	// 前側と後ろ側のデューティが変化する速さを制限する。
+	rampF, rampR *control.Ramp
+	// Kick the fans off zero and hold their minimum running duty.
+	// ファンを0からキックし、最低運転デューティを保つ。
+	startF, startR *control.Starter
+	// Whether a fault was present on the last PWM tick, to soft start
+	// once it clears.
+	// 解除時にソフトスタートするため、前回のPWM周期で異常があったかどうか
+	faulted bool
+	// In closed-loop mode, the speed loop drives the front rotor and the
+	// ratio loop keeps the rear one in step. loopF and loopR are their
+	// last outputs.
+	// 閉ループモードでは、速度ループが前側ローターを駆動し、比のループが後ろ
+	// 側をそれに合わせる。loopFとloopRはそれぞれの直近の出力。
+	speed        *control.SpeedController
+	ratio        *control.RatioController
+	loopF, loopR uint32
+	// Duties set by SetManualDuty, used instead of the potentiometer in
+	// open-loop mode while manual is set.
+	// SetManualDutyで設定したデューティ。manualが設定されている間は、開ルー
+	// プモードでポテンショメータの代わりに使う。
+	manual           bool
+	manualF, manualR uint32
+
+	// The duties last written to the outputs.
+	// 出力に最後に書き込んだデューティ
+	dutyF, dutyR uint32
+	// When the last PWM and RPM ticks ran.
+	// 前回のPWM周期とRPM周期の実行時刻
+	lastPWM, lastRPM time.Time
+	// When Boot finished, and the longest tick run time and delay since
+	// the last telemetry record.
+	// Bootが終わった時刻と、前回のテレメトリーのレコード以降で最長の周期
+	// 処理の実行時間と遅れ
+	booted        time.Time
+	loopMax, late time.Duration
+
+	// The bus of the display, and the error of the last command sent to
+	// it, nil once it answers again. A display failure never stops the
+	// fans.
+	// ディスプレイのバスと、最後に送ったコマンドのエラー。再び応答すれば
+	// nil。ディスプレイの失敗でファンが止まることはない。
+	displayBus *ht16k33.RecoveringBus
+	displayErr error
+
+	// Where the settings are kept, and the settings with no other home
+	// yet.
+	// 設定の保存先と、まだ他に置き場所の無い設定
+	storage    settings.Storage
+	brightness uint8
+	// The target RPM of closed-loop mode, kept while in open-loop mode.
+	// 閉ループモードの目標RPM。開ループモードの間も覚えておく。
+	targetRPM uint32
+	// When the next ticks are due.
+	// 次の周期処理の予定時刻
+	nextRPM, nextPWM time.Time
+
+	// The calibration in progress: the sweep of the rotor being
+	// measured, whether it is the rear one, the result of the front one,
+	// and where the CSV and the end go. sweep is nil when none runs.
+	// 実行中の特性測定：測っているローターのスイープ、それが後ろ側かどう
+	// か、前側の結果、CSVと終わりの知らせ先。実行していなければsweepはnil。
+	sweep      *calib.Sweeper
+	sweepRear  bool
+	sweepFront *fan.Characterization
+	sweepOut   io.Writer
+	sweepDone  func(err error)
+}
+
+// New creates an App. Call Boot before Step or Run.
+//
+// Newは、Appを作る。StepやRunの前にBootを呼ぶこと。
+func New(cfg Config, led StatusLED, clock Clock) *App {
+	pid := cfg.SpeedPID
+	return &App{
+		Config:     cfg,
+		led:        led,
+		clock:      clock,
+		brightness: 15,
+		rampF:      control.NewRamp(cfg.Ramp),
+		rampR:      control.NewRamp(cfg.Ramp),
+		startF:     control.NewStarter(cfg.FrontStart),
+		startR:     control.NewStarter(cfg.RearStart),
+		speed:      control.NewSpeedController(&pid),
+		ratio:      control.NewRatioController(),
+	}
+}
+
+// Boot runs the start-up sequence. It blinks the LED slowly three times,
+// brings up the fan hardware, lights the LED for a second, then brings up
+// and configures the display. The fans then soft start from off. It
+// returns the error from setupFans; a display whose bus or configuration
+// fails is reported on the console and by DisplayErr, and the fans run
+// without it.
+//
+// Bootは、起動シーケンスを実行する。LEDをゆっくり3回点滅させ、ファンのハー
+// ドウェアを立ち上げ、LEDを1秒点灯し、それからディスプレイを立ち上げて設
+// 定する。その後、ファンは停止状態からソフトスタートする。setupFansのエ
+// ラーを返す。ディスプレイのバスか設定が失敗したらコンソールとDisplayErr
+// で知らせ、ファンはディスプレイ無しで回す。
+func (a *App) Boot(setupFans func() (FanHardware, error), setupDisplay DisplaySetup) error {
+	// 1. Start-up check: blink slowly three times.
+	// 1. 起動確認：ゆっくり3回点滅
+	for i := 0; i < 3; i++ {
+		a.setLED(true)
+		a.clock.Sleep(300 * time.Millisecond)
+		a.setLED(false)
+		a.clock.Sleep(300 * time.Millisecond)
+	}
+
+	// 2. Bring up the fans. A failure here points at the wiring or the
+	// GPIO setup.
+	// 2. ファンの初期化。ここで失敗するなら、配線かGPIO周りの初期化に問題
+	// がある。
+	hw, err := setupFans()
+	if err != nil {
+		return err
+	}
+	a.out = hw.Output
+	a.Pot = analog.NewConditioner(hw.Pot, a.Config.PotInput)
+	a.Fans = fan.NewDualFan(hw.Name, hw.Front, hw.Rear)
+	a.Fans.SetClock(a.clock)
+	// Smooth the displayed RPMs; the raw values stay available.
+	// 表示用のRPMを平滑化する。生の値はそのまま取れる。
+	a.Fans.SetFilters(fan.NewEMA(0.3), fan.NewEMA(0.3))
+	// Below the minimum running duty of the starters a fan may only hum,
+	// so the fault detectors do not call it stalled there.
+	// Starterの最低運転デューティ未満ではファンは唸るだけかもしれないので、
+	// 異常検出器はそこで停止とはみなさない。
+	if m := a.Config.FrontStart.MinRunDuty; m > 0 {
+		a.Fans.Front.FaultDetector().Config.MinRunDuty = m
+	}
+	if m := a.Config.RearStart.MinRunDuty; m > 0 {
+		a.Fans.Rear.FaultDetector().Config.MinRunDuty = m
+	}
+
+	// 3. Success: keep the LED on for a second.
+	// 3. 初期化成功：点灯しっぱなしで1秒待機
+	a.setLED(true)
+	a.clock.Sleep(1 * time.Second)
+	a.setLED(false)
+
+	// Initialize the dual display controlled by a single HT16K33 IC. Its
+	// bus retries, clears itself if it can, and configures the display
+	// again when it comes back.
+	// 2つのディスプレイを1つのICで制御。そのバスは再試行し、できればバスを
+	// クリアし、ディスプレイが戻ったら設定し直す。
+	bus, err := setupDisplay()
+	a.displayBus = ht16k33.NewRecoveringBus(bus, a.clock, a.Config.DisplayRecovery)
+	if c, ok := bus.(BusClearer); ok {
+		a.displayBus.SetBusClear(c.ClearBus)
+	}
+	a.Display = ht16k33.New(a.displayBus, a.Config.DisplayAddress)
+	a.displayBus.SetReconfigure(a.Display.Configure)
+	// Configure even when the bus failed to come up; the first error is
+	// the one reported.
+	// バスの立ち上げに失敗しても設定を試す。知らせるのは最初のエラー。
+	if cerr := a.Display.Configure(); err == nil {
+		err = cerr
+	}
+	a.displayErr = err
+
+	a.rampF.StartSoft()
+	a.rampR.StartSoft()
+
+	now := a.clock.Now()
+	a.booted = now
+	a.lastPWM = now
+	a.lastRPM = now
+	a.nextRPM = now.Add(a.Config.RPMInterval)
+	a.nextPWM = now.Add(a.Config.PWMInterval)
+	return nil
+}
+
+// StartTelemetry starts streaming telemetry records to w, such as the
+// serial console, as set by Config.Telemetry.
+//
+// StartTelemetryは、Config.Telemetryの設定で、シリアルコンソールなどのw
+// にテレメトリーのレコードを送り始める。
+func (a *App) StartTelemetry(w io.Writer) {
+	a.telemetryOut = w
+	a.Telemetry = telemetry.NewStream(w, a.Config.Telemetry)
+}
+
+// Halt blinks the LED fast forever. Use it when Boot fails.
+//
+// Haltは、LEDをずっと高速点滅させる。Bootが失敗したときに使う。
+func (a *App) Halt() {
+	for {
+		a.setLED(!a.ledOn)
+		a.clock.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Run runs the main loop forever.
+//
+// Runは、メインループをずっと実行する。
+func (a *App) Run() {
+	for {
+		a.Step()
+		if wait := a.untilNextTick(); wait > 0 {
+			a.clock.Sleep(wait)
+		}
+	}
+}
+
+// Step runs the commands received by the console and the ticks that are
+// due at the current time, then writes a telemetry record if one is due.
+//
+// Stepは、コンソールが受信したコマンドと、現在時刻で予定になっている周期
+// 処理を実行し、テレメトリーのレコードが予定になっていればそれを書く。
+func (a *App) Step() {
+	a.pollConsole()
+	now := a.clock.Now()
+	ran := false
+	if a.sweep != nil && !now.Before(a.sweep.Next()) {
+		a.updateSweep(now)
+		ran = true
+	}
+	if !now.Before(a.nextPWM) {
+		a.noteLate(now.Sub(a.nextPWM))
+		a.nextPWM = nextTick(a.nextPWM, now, a.Config.PWMInterval)
+		a.updatePWM()
+		ran = true
+	}
+	if !now.Before(a.nextRPM) {
+		a.noteLate(now.Sub(a.nextRPM))
+		a.nextRPM = nextTick(a.nextRPM, now, a.Config.RPMInterval)
+		a.updateRPM()
+		ran = true
+	}
+	if ran {
+		if d := a.clock.Now().Sub(now); d > a.loopMax {
+			a.loopMax = d
+		}
+	}
+
+	if a.Telemetry != nil && a.Telemetry.Due(now) {
+		a.Telemetry.Write(a.Record())
+		a.loopMax, a.late = 0, 0
+	}
+}
+
+// Record returns a telemetry record of the current state.
+//
+// Recordは、現在の状態のテレメトリーのレコードを返す。
+func (a *App) Record() telemetry.Record {
+	frontFault, rearFault := a.Fans.Faults()
+	return telemetry.Record{
+		Time:       a.clock.Now().Sub(a.booted),
+		FrontRPM:   a.Fans.Front.RPM(),
+		RearRPM:    a.Fans.Rear.RPM(),
+		FrontDuty:  a.dutyF,
+		RearDuty:   a.dutyR,
+		FrontFault: frontFault,
+		RearFault:  rearFault,
+		Mode:       a.speed.Mode(),
+		Loop:       a.loopMax,
+		Late:       a.late,
+	}
+}
+
+func (a *App) noteLate(d time.Duration) {
+	if d > a.late {
+		a.late = d
+	}
+}
+
+// Duties returns the duties last written to the front and rear outputs.
+//
+// Dutiesは、前側と後ろ側の出力に最後に書き込んだデューティを返す。
+func (a *App) Duties() (uint32, uint32) {
+	return a.dutyF, a.dutyR
+}
+
+// DisplayErr returns the error of the last command sent to the display,
+// such as a missing ACK from a loose cable, or nil if it succeeded.
+//
+// DisplayErrは、ディスプレイに最後に送ったコマンドのエラー(ケーブルが緩ん
+// でACKが返らないなど)を返す。成功していればnil。
+func (a *App) DisplayErr() error {
+	return a.displayErr
+}
+
+// DisplayStats returns the error counts of the display bus.
+//
+// DisplayStatsは、ディスプレイのバスのエラーの回数を返す。
+func (a *App) DisplayStats() ht16k33.BusStats {
+	return a.displayBus.Stats()
+}
+
+// Mode returns the control mode and the target RPM of closed-loop mode.
+//
+// Modeは、制御モードと閉ループモードの目標RPMを返す。
+func (a *App) Mode() (control.Mode, uint32) {
+	return a.speed.Mode(), a.targetRPM
+}
+
+// SetMode switches between the potentiometer (open loop) and holding
+// targetRPM on the front rotor (closed loop), without a bump in the
+// duties. It also ends manual duties. Call it after Boot.
+//
+// SetModeは、ポテンショメータ(開ループ)と、前側ローターをtargetRPMに保つ
+// 制御(閉ループ)を、デューティを跳ねさせずに切り替える。手動のデューティ
+// も終わらせる。Bootの後で呼ぶこと。
+func (a *App) SetMode(mode control.Mode, targetRPM uint32) {
+	a.manual = false
+	a.targetRPM = targetRPM
+	if mode != control.ModeClosedLoop {
+		a.speed.SetOpenLoop()
+		return
+	}
+	a.speed.SetClosedLoop(targetRPM)
+	a.ratio.Reset()
+	a.loopF, a.loopR = a.speed.Output(), a.dutyR
+}
+
+// SetManualDuty drives the fans at fixed duties (0-fan.MaxDuty) instead of
+// the potentiometer, in open-loop mode, until SetMode is called. The
+// duties still ramp and faults still force full speed.
+//
+// SetManualDutyは、SetModeを呼ぶまで、開ループモードでポテンショメータの
+// 代わりに固定のデューティ(0-fan.MaxDuty)でファンを駆動する。デューティは
+// 引き続きランプし、異常時は全速になる。
+func (a *App) SetManualDuty(front, rear uint32) {
+	a.speed.SetOpenLoop()
+	a.manual = true
+	a.manualF, a.manualR = min(front, fan.MaxDuty), min(rear, fan.MaxDuty)
+}
+
+// updatePWM picks the duties from the current control source and ramps
+// both fans towards them, kicking them when they start from rest.
+//
+// updatePWMは、現在の制御元からデューティを選び、両方のファンをそこに向け
+// てランプさせる。停止から動き出すときはキックする。
+func (a *App) updatePWM() {
+	now := a.clock.Now()
+	dt := now.Sub(a.lastPWM)
+	a.lastPWM = now
+
+	// The duties come from the speed loops, the manual duties or the
+	// potentiometer; on a fault both fans are forced to full speed
+	// instead. Once the fault clears, they soft start again as at
+	// power-up, but ramp down from the duty they run at.
+	// デューティは速度ループ、手動のデューティ、ポテンショメータのいずれか
+	// から決まる。異常時は代わりに両方のファンを全速にする。異常が解除され
+	// たら、起動時と同じくソフトスタートし直すが、回っているデューティから
+	// 下げていく。
+	duty := a.Config.PotCurve.Map(a.Pot.Get())
+	dutyF, dutyR := duty, duty
+	faulted := a.Fans.HasFault()
+	switch {
+	case faulted:
+		dutyF, dutyR = fan.MaxDuty, fan.MaxDuty
+	case a.speed.Mode() == control.ModeClosedLoop:
+		dutyF, dutyR = a.loopF, a.loopR
+	case a.manual:
+		dutyF, dutyR = a.manualF, a.manualR
+	}
+	if !faulted && a.faulted {
+		a.rampF.StartSoftFrom(a.dutyF)
+		a.rampR.StartSoftFrom(a.dutyR)
+	}
+	// The displays blink while a fault lasts; the HT16K33 does the
+	// blinking by itself.
+	// 異常が続く間はディスプレイを点滅させる。点滅はHT16K33が自分で行う。
+	if faulted != a.faulted {
+		blink := ht16k33.BlinkOff
+		if faulted {
+			blink = ht16k33.Blink2Hz
+		}
+		a.displayErr = a.Display.SetBlink(blink)
+	}
+	a.faulted = faulted
+
+	// A calibration sets the duties itself, until a fault stops it.
+	// 特性測定は自分でデューティを設定する。異常で止まるまで。
+	if a.sweep != nil {
+		if !faulted {
+			a.setLED(!a.ledOn)
+			return
+		}
+		a.endCalibration(ErrCalibrationFault)
+	}
+
+	// The ramps smooth the request; the starters then kick the fans off
+	// zero, rising no faster than the ramps during a soft start.
+	// ランプで要求を滑らかにし、その後Starterがファンを0からキックする。ソ
+	// フトスタート中のキックはランプより速く上げない。
+	a.startF.SetSoftStart(softRate(a.rampF))
+	a.startR.SetSoftStart(softRate(a.rampR))
+	front := a.startF.Update(a.rampF.Update(dutyF, dt), dt)
+	rear := a.startR.Update(a.rampR.Update(dutyR, dt), dt)
+	a.setDuty(front, rear)
+	a.setLED(!a.ledOn)
+}
+
+// softRate returns the rate a kick may rise at while ramp soft starts, or
+// 0 for no limit.
+//
+// softRateは、rampがソフトスタート中にキックが上がってよい変化率を返す。
+// 制限が無ければ0を返す。
+func softRate(ramp *control.Ramp) uint32 {
+	if !ramp.SoftStarting() {
+		return 0
+	}
+	return ramp.RiseRate()
+}
+
+// updateRPM measures both fans, shows the RPMs, checks for faults and
+// advances the speed loops.
+//
+// updateRPMは、両方のファンを計測し、RPMを表示して異常を点検し、速度ルー
+// プを進める。
+func (a *App) updateRPM() {
+	now := a.clock.Now()
+	dt := now.Sub(a.lastRPM)
+	a.lastRPM = now
+
+	// During a calibration the sweep takes the readings of the rotor it
+	// measures.
+	// 特性測定の間は、測っているローターの読み取りはスイープが行う。
+	var rpmF, rpmR uint32
+	switch {
+	case a.sweep == nil:
+		rpmF, rpmR = a.Fans.CalculateRPMs()
+	case a.sweepRear:
+		rpmF, rpmR = a.Fans.Front.CalculateRPM(), a.Fans.Rear.RPM()
+	default:
+		rpmF, rpmR = a.Fans.Front.RPM(), a.Fans.Rear.CalculateRPM()
+	}
+	// The starters confirm a start against the fresh readings.
+	// Starterは新しい計測値で起動を確認する。
+	a.startF.Observe(rpmF)
+	a.startR.Observe(rpmR)
+
+	// Write the smoothed RPMs to displays 0 and 1 on the single device,
+	// right-aligned so the digits stay put as the count changes.
+	// 1つのデバイスに、ディスプレイ0と1を指定して平滑化したRPMを書き込む。
+	// 桁数が変わっても数字が動かないよう右揃えにする。
+	smooth1, smooth2 := a.Fans.FilteredRPMs()
+	a.Display.WriteInt(0, int(smooth1), ht16k33.NumberFormat{})
+	a.Display.WriteInt(1, int(smooth2), ht16k33.NumberFormat{})
+	// Transfer the buffer to the display driver all at once.
+	// 最後にまとめて転送
+	a.displayErr = a.Display.Display()
+
+	// Check both rotors against the commanded duty. On any fault, the
+	// next PWM tick runs them at full speed to maximise the airflow left.
+	// The faults show up in the telemetry.
+	// 指令デューティと比べて両ローターを点検する。異常があれば、残った風量
+	// を最大にするため次のPWM周期から全速で回す。異常はテレメトリーに出る。
+	// A sweep may stop its rotor on purpose, so its duty only counts once
+	// the rotor must be running.
+	// スイープはわざとローターを止めることがあるので、そのデューティはロー
+	// ターが回っているはずのときだけ数える。
+	dutyF, dutyR := a.dutyF, a.dutyR
+	if a.sweep != nil && !a.sweep.Driven() {
+		dutyF, dutyR = 0, 0
+	}
+	frontFault, rearFault := a.Fans.CheckFaults(dutyF, dutyR)
+	if a.sweep != nil {
+		return
+	}
+
+	// In open-loop mode the speed loop just tracks the front duty, so
+	// switching to closed loop starts from it.
+	// 開ループモードでは速度ループは前側のデューティを追従するだけなので、
+	// 閉ループに切り替えるとそこから始まる。
+	a.loopF = a.speed.Update(a.dutyF, rpmF, dt)
+	if a.speed.Mode() == control.ModeClosedLoop {
+		a.loopR = a.ratio.Update(a.loopF, rpmF, rpmR, frontFault, rearFault, dt)
+	}
+}
+
+// Calibrate starts characterizing the front rotor and then the rear one
+// while the other is held off. The main loop runs the sweep, which takes
+// minutes, and keeps the console, display and fault detectors going; a
+// fault stops the sweep and the fans run at full speed. At the end the
+// results are stored on Fans and written to w as CSV, done is called with
+// the error if any, and the fans soft start back to the control source.
+// It returns ErrCalibrating while a calibration runs.
+//
+// Calibrateは、もう一方を止めたまま前側、後ろ側の順にローターの特性を測り
+// 始める。数分かかるスイープはメインループが実行し、その間もコンソール、
+// ディスプレイ、異常検出器は動き続ける。異常があればスイープを止め、ファ
+// ンは全速で回る。終わったら結果をFansに保存してCSVでwに書き出し、エラー
+// があればそれを渡してdoneを呼び、ファンはソフトスタートで制御元の値に戻
+// る。特性測定の実行中はErrCalibratingを返す。
+func (a *App) Calibrate(w io.Writer, done func(err error)) error {
+	if a.sweep != nil {
+		return ErrCalibrating
+	}
+	a.sweepOut, a.sweepDone = w, done
+	a.sweepRear = false
+	a.sweep = calib.NewSweeper(a.Fans.Front, a.Config.Calibration, a.clock.Now())
+	a.setSweepDuty()
+	return nil
+}
+
+// Calibrating reports whether a calibration runs.
+//
+// Calibratingは、特性測定を実行中かどうかを返す。
+func (a *App) Calibrating() bool {
+	return a.sweep != nil
+}
+
+// updateSweep takes the reading of the sweep due at now, and moves on to
+// the rear rotor or ends the calibration once a sweep is done.
+//
+// updateSweepは、nowに予定のスイープの読み取りを行い、スイープが終わった
+// ら後ろ側のローターに進むか、特性測定を終える。
+func (a *App) updateSweep(now time.Time) {
+	a.sweep.Update(now)
+	switch {
+	case !a.sweep.Done():
+	case !a.sweepRear:
+		a.sweepFront = a.sweep.Result()
+		a.sweepRear = true
+		a.sweep = calib.NewSweeper(a.Fans.Rear, a.Config.Calibration, now)
+	default:
+		a.Fans.Front.SetCharacterization(a.sweepFront)
+		a.Fans.Rear.SetCharacterization(a.sweep.Result())
+		a.endCalibration(nil)
+		return
+	}
+	a.setSweepDuty()
+}
+
+// setSweepDuty drives the rotor being measured at the duty of the sweep,
+// and the other one not at all.
+//
+// setSweepDutyは、測っているローターをスイープのデューティで駆動し、もう
+// 一方は止める。
+func (a *App) setSweepDuty() {
+	if a.sweepRear {
+		a.setDuty(0, a.sweep.Duty())
+	} else {
+		a.setDuty(a.sweep.Duty(), 0)
+	}
+}
+
+// endCalibration ends the calibration with err, or writes its results if
+// err is nil, and calls done.
+//
+// endCalibrationは、特性測定をerrで終える。errがnilなら結果を書き出す。そ
+// してdoneを呼ぶ。
+func (a *App) endCalibration(err error) {
+	a.sweep, a.sweepFront = nil, nil
+	if err == nil {
+		// The detectors did not look for stalls below the start duties,
+		// so start them afresh.
+		// 検出器は起動デューティ未満では停止を見ていないので、やり直す。
+		a.Fans.ClearFaults()
+		a.rampF.StartSoft()
+		a.rampR.StartSoft()
+		err = a.Fans.WriteCharacterizationCSV(a.sweepOut)
+	}
+	done := a.sweepDone
+	a.sweepOut, a.sweepDone = nil, nil
+	if done != nil {
+		done(err)
+	}
+}
+
+// Settings returns the current persistent settings. Call it after Boot.
+//
+// Settingsは、現在の永続的な設定を返す。Bootの後で呼ぶこと。
+func (a *App) Settings() settings.Settings {
+	front, rear := a.Fans.Characterizations()
+	return settings.Settings{
+		PotCurve:         a.Config.PotCurve,
+		FrontProfile:     a.Fans.Front.Profile(),
+		RearProfile:      a.Fans.Rear.Profile(),
+		Brightness:       a.brightness,
+		Mode:             a.speed.Mode(),
+		TargetRPM:        a.targetRPM,
+		FrontCalibration: front,
+		RearCalibration:  rear,
+	}
+}
+
+// ApplySettings puts s into effect. Call it after Boot.
+//
+// ApplySettingsは、sを反映する。Bootの後で呼ぶこと。
+func (a *App) ApplySettings(s settings.Settings) {
+	a.Config.PotCurve = s.PotCurve
+	a.Fans.Front.SetProfile(s.FrontProfile)
+	a.Fans.Rear.SetProfile(s.RearProfile)
+	// Keep the brightness within what the display takes, so what is
+	// reported and saved is what is shown.
+	// 表示されている値を報告・保存するよう、明るさをディスプレイが受け付け
+	// る範囲に収める。
+	if s.Brightness > 15 {
+		s.Brightness = 15
+	}
+	a.brightness = s.Brightness
+	a.displayErr = a.Display.SetBrightness(s.Brightness)
+	a.targetRPM = s.TargetRPM
+	a.SetMode(s.Mode, s.TargetRPM)
+	a.Fans.Front.SetCharacterization(s.FrontCalibration)
+	a.Fans.Rear.SetCharacterization(s.RearCalibration)
+}
+
+// LoadSettings loads the settings from st, puts them into effect and keeps
+// st for SaveSettings. If st holds no usable settings, the defaults are
+// applied and the error is returned. Call it after Boot.
+//
+// LoadSettingsは、stから設定を読み込んで反映し、SaveSettingsのためにstを
+// 覚えておく。stに使える設定が無ければ既定値を反映してエラーを返す。Boot
+// の後で呼ぶこと。
+func (a *App) LoadSettings(st settings.Storage) error {
+	a.storage = st
+	s, err := settings.Load(st)
+	a.ApplySettings(s)
+	return err
+}
+
+// SaveSettings writes the current settings to the storage given to
+// LoadSettings.
+//
+// SaveSettingsは、現在の設定をLoadSettingsに渡した保存先に書き込む。
+func (a *App) SaveSettings() error {
+	if a.storage == nil {
+		return ErrNoStorage
+	}
+	return settings.Save(a.storage, a.Settings())
+}
+
+func (a *App) setDuty(front, rear uint32) {
+	a.dutyF, a.dutyR = front, rear
+	a.out.SetDuty(front, rear)
+}
+
+func (a *App) setLED(on bool) {
+	a.ledOn = on
+	a.led.Set(on)
+}
+
+// untilNextTick returns the time left until the next tick is due.
+//
+// untilNextTickは、次の周期処理までの残り時間を返す。
+func (a *App) untilNextTick() time.Duration {
+	next := a.nextPWM
+	if a.nextRPM.Before(next) {
+		next = a.nextRPM
+	}
+	if a.sweep != nil && a.sweep.Next().Before(next) {
+		next = a.sweep.Next()
+	}
+	return next.Sub(a.clock.Now())
+}
+
+// nextTick returns the tick after due. Like time.Ticker, ticks missed
+// while running late are dropped rather than run in a burst.
+//
+// nextTickは、dueの次の周期処理の時刻を返す。time.Tickerと同じく、遅れて
+// いる間に逃した周期処理はまとめて実行せずに捨てる。
+func nextTick(due, now time.Time, interval time.Duration) time.Time {
+	next := due.Add(interval)
+	if !next.After(now) {
+		next = now.Add(interval)
+	}
+	return next
+}
@@ -0,0 +1,629 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/curve"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/ht16k33"
+	"github.com/kou-tkbys/tk-fancon2/settings"
+	"github.com/kou-tkbys/tk-fancon2/telemetry"
+)
+
+// Note: tinygo test ./app
+
+// 仮想時間のクロック。Sleepは時間を進めるだけ。
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time        { return c.now }
+func (c *fakeClock) Sleep(d time.Duration) { c.now = c.now.Add(d) }
+
+// 点灯状態の変化を記録するLED
+type fakeLED struct {
+	history []bool
+}
+
+func (l *fakeLED) Set(on bool) { l.history = append(l.history, on) }
+
+// 固定値を返すポテンショメータ
+type fakePot struct {
+	value uint16
+}
+
+func (p *fakePot) Get() uint16 { return p.value }
+
+// 書き込まれたデューティを記録する出力
+type fakeOutput struct {
+	front, rear uint32
+	writes      int
+}
+
+func (o *fakeOutput) SetDuty(front, rear uint32) {
+	o.front, o.rear = front, rear
+	o.writes++
+}
+
+// 1回の読み取りごとに固定のパルス数を返すカウンター
+type fakeCounter struct {
+	pulses uint32
+}
+
+func (c *fakeCounter) ReadAndReset() uint32 { return c.pulses }
+
+// 送信された内容をすべて記録するI2Cバス。errを設定すると、送信せずにそれ
+// を返す。
+type fakeBus struct {
+	writes [][]byte
+	err    error
+}
+
+func (b *fakeBus) Tx(addr uint16, w, r []byte) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.writes = append(b.writes, append([]byte(nil), w...))
+	return nil
+}
+
+func (b *fakeBus) last() []byte {
+	if len(b.writes) == 0 {
+		return nil
+	}
+	return b.writes[len(b.writes)-1]
+}
+
+// テスト用のハードウェア一式
+type testRig struct {
+	clock  *fakeClock
+	led    *fakeLED
+	pot    *fakePot
+	out    *fakeOutput
+	front  *fakeCounter
+	rear   *fakeCounter
+	bus    *fakeBus
+	app    *App
+	booted time.Time
+}
+
+// newTestRig boots an App with the default configuration, except that the
+// duty ramps and kick-starts are disabled so each PWM tick writes its
+// target directly.
+func newTestRig(t *testing.T) *testRig {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.Ramp = control.RampConfig{}
+	cfg.FrontStart = control.StartConfig{}
+	cfg.RearStart = control.StartConfig{}
+	return newTestRigWith(t, cfg)
+}
+
+func newTestRigWith(t *testing.T, cfg Config) *testRig {
+	t.Helper()
+	r := &testRig{
+		clock: newFakeClock(),
+		led:   &fakeLED{},
+		pot:   &fakePot{},
+		out:   &fakeOutput{},
+		front: &fakeCounter{},
+		rear:  &fakeCounter{},
+		bus:   &fakeBus{},
+	}
+	r.app = New(cfg, r.led, r.clock)
+	err := r.app.Boot(func() (FanHardware, error) {
+		return FanHardware{Name: "Test", Output: r.out, Pot: r.pot, Front: r.front, Rear: r.rear}, nil
+	}, func() (ht16k33.I2CBus, error) {
+		return r.bus, nil
+	})
+	if err != nil {
+		t.Fatalf("Bootが失敗した: %v", err)
+	}
+	r.booted = r.clock.Now()
+	return r
+}
+
+// run advances virtual time by d, running every tick on the way.
+func (r *testRig) run(d time.Duration) {
+	end := r.clock.Now().Add(d)
+	for r.clock.Now().Before(end) {
+		r.app.Step()
+		wait := r.app.untilNextTick()
+		if rest := end.Sub(r.clock.Now()); wait > rest {
+			wait = rest
+		}
+		r.clock.Sleep(wait)
+	}
+	r.app.Step()
+}
+
+func TestApp_Boot(t *testing.T) {
+	r := newTestRig(t)
+
+	expectedLED := []bool{true, false, true, false, true, false, true, false}
+	if len(r.led.history) != len(expectedLED) {
+		t.Fatalf("期待するLEDの変化は %v 、実際は %v で異なる", expectedLED, r.led.history)
+	}
+	for i := range expectedLED {
+		if r.led.history[i] != expectedLED[i] {
+			t.Fatalf("期待するLEDの変化は %v 、実際は %v で異なる", expectedLED, r.led.history)
+		}
+	}
+
+	// 300ms x 6 + 1s
+	if elapsed := r.booted.Sub(newFakeClock().now); elapsed != 2800*time.Millisecond {
+		t.Errorf("期待する起動時間は 2.8s 、実際は %v で異なる", elapsed)
+	}
+
+	// オシレーターON、ディスプレイON、明るさ最大
+	expectedWrites := [][]byte{{0x21}, {0x81}, {0xEF}}
+	if len(r.bus.writes) != len(expectedWrites) {
+		t.Fatalf("期待するI2C送信は %x 、実際は %x で異なる", expectedWrites, r.bus.writes)
+	}
+	for i := range expectedWrites {
+		if !bytes.Equal(r.bus.writes[i], expectedWrites[i]) {
+			t.Errorf("期待するI2C送信は %x 、実際は %x で異なる", expectedWrites, r.bus.writes)
+		}
+	}
+}
+
+func TestApp_BootFailure(t *testing.T) {
+	clock := newFakeClock()
+	a := New(DefaultConfig(), &fakeLED{}, clock)
+	setupErr := errors.New("PWM設定失敗")
+	displayCalled := false
+
+	err := a.Boot(func() (FanHardware, error) {
+		return FanHardware{}, setupErr
+	}, func() (ht16k33.I2CBus, error) {
+		displayCalled = true
+		return &fakeBus{}, nil
+	})
+
+	if !errors.Is(err, setupErr) {
+		t.Errorf("期待するエラーは %v 、実際は %v で異なる", setupErr, err)
+	}
+	if displayCalled || a.Fans != nil {
+		t.Error("失敗したらディスプレイもファンも立ち上げないはず")
+	}
+}
+
+// ディスプレイのバスの立ち上げに失敗してもファンは起動し、エラーはDisplayErrで分かる
+func TestApp_DisplaySetupFailure(t *testing.T) {
+	clock := newFakeClock()
+	a := New(DefaultConfig(), &fakeLED{}, clock)
+	setupErr := errors.New("I2C設定失敗")
+	bus := &fakeBus{}
+
+	err := a.Boot(func() (FanHardware, error) {
+		return FanHardware{Name: "Test", Output: &fakeOutput{}, Pot: &fakePot{}, Front: &fakeCounter{}, Rear: &fakeCounter{}}, nil
+	}, func() (ht16k33.I2CBus, error) {
+		return bus, setupErr
+	})
+
+	if err != nil {
+		t.Fatalf("Bootが失敗した: %v", err)
+	}
+	if err := a.DisplayErr(); !errors.Is(err, setupErr) {
+		t.Errorf("期待するエラーは %v 、実際は %v で異なる", setupErr, err)
+	}
+	// それでもディスプレイの設定は試す
+	if len(bus.writes) == 0 {
+		t.Error("バスが返されたらディスプレイの設定を試すはず")
+	}
+}
+
+// PWM周期ごとにポテンショメータの値がデューティとして両方に書き込まれる
+func TestApp_PWMTick(t *testing.T) {
+	testCases := []struct {
+		name     string
+		pot      uint16
+		expected uint32
+	}{
+		{name: "最大", pot: 65535, expected: fan.MaxDuty},
+		{name: "半分", pot: 32768, expected: 10000},
+		{name: "デッドゾーン", pot: 1999, expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestRig(t)
+			r.pot.value = tc.pot
+			ledChanges := len(r.led.history)
+
+			r.run(100 * time.Millisecond)
+
+			if r.out.writes != 2 {
+				t.Errorf("期待する書き込み回数は 2 、実際は %d で異なる", r.out.writes)
+			}
+			if r.out.front != tc.expected || r.out.rear != tc.expected {
+				t.Errorf("期待するデューティは %d 、実際は %d/%d で異なる", tc.expected, r.out.front, r.out.rear)
+			}
+			if front, rear := r.app.Duties(); front != tc.expected || rear != tc.expected {
+				t.Errorf("Dutiesの期待値は %d 、実際は %d/%d で異なる", tc.expected, front, rear)
+			}
+			// PWM周期ごとにLEDが反転する
+			if changes := len(r.led.history) - ledChanges; changes != 2 {
+				t.Errorf("期待するLEDの変化回数は 2 、実際は %d で異なる", changes)
+			}
+		})
+	}
+}
+
+// RPM周期ごとに両方のRPMがディスプレイに送られる
+func TestApp_RPMTick(t *testing.T) {
+	r := newTestRig(t)
+	r.pot.value = 65535
+	r.front.pulses = 120 // 3600 RPM
+	r.rear.pulses = 60   // 1800 RPM
+
+	r.run(time.Second)
+
+	expectedBus := &fakeBus{}
+	expected := ht16k33.New(expectedBus, 0x70)
+	// 右揃え
+	expected.WriteString(0, "    3600")
+	expected.WriteString(1, "    1800")
+	expected.Display()
+
+	if !bytes.Equal(r.bus.last(), expectedBus.last()) {
+		t.Errorf("期待する表示データは %x 、実際は %x で異なる", expectedBus.last(), r.bus.last())
+	}
+	if front, rear := r.app.Fans.Front.RPM(), r.app.Fans.Rear.RPM(); front != 3600 || rear != 1800 {
+		t.Errorf("期待するRPMは 3600/1800 、実際は %d/%d で異なる", front, rear)
+	}
+}
+
+// ディスプレイが応答しなくてもファンは回り続け、エラーはDisplayErrで分かる
+func TestApp_DisplayOffline(t *testing.T) {
+	r := newTestRig(t)
+	r.pot.value = 65535
+	r.front.pulses = 30
+	r.rear.pulses = 30
+	nack := errors.New("i2c: nack")
+	r.bus.err = nack
+
+	r.run(2 * time.Second)
+	if err := r.app.DisplayErr(); !errors.Is(err, nack) {
+		t.Errorf("期待するエラーは %v 、実際は %v で異なる", nack, err)
+	}
+	if r.out.front != fan.MaxDuty {
+		t.Errorf("期待するデューティは %d 、実際は %d で異なる", fan.MaxDuty, r.out.front)
+	}
+
+	// 2回の表示が再試行を含めてすべて失敗し、その後は待っている
+	stats := r.app.DisplayStats()
+	if stats.Failures != 2 || stats.Errors != 4 {
+		t.Errorf("期待する失敗とエラーは 2/4 、実際は %d/%d で異なる", stats.Failures, stats.Errors)
+	}
+
+	r.bus.err = nil
+	r.run(time.Second)
+	if err := r.app.DisplayErr(); err != nil {
+		t.Errorf("復旧後のエラーは nil のはず、実際は %v", err)
+	}
+	// 復旧したらディスプレイを設定し直す
+	if stats := r.app.DisplayStats(); stats.Recoveries != 1 {
+		t.Errorf("期待する復旧の回数は 1 、実際は %d で異なる", stats.Recoveries)
+	}
+	if n := len(r.bus.writes); n < 4 || !bytes.Equal(r.bus.writes[n-3], []byte{0x21}) {
+		t.Errorf("復旧後に設定し直すはず、実際の送信は %x", r.bus.writes)
+	}
+}
+
+// タコ信号が来なければ異常となり、全速で回す
+func TestApp_FaultForcesFullSpeed(t *testing.T) {
+	r := newTestRig(t)
+	r.pot.value = 32768
+	r.front.pulses = 30
+	r.rear.pulses = 0
+
+	r.run(2 * time.Second)
+	if r.out.front != 10000 {
+		t.Fatalf("異常前の期待するデューティは 10000 、実際は %d で異なる", r.out.front)
+	}
+
+	r.run(3 * time.Second)
+	_, rearFault := r.app.Fans.Faults()
+	if rearFault != fan.FaultTachMissing {
+		t.Errorf("期待する異常は %v 、実際は %v で異なる", fan.FaultTachMissing, rearFault)
+	}
+	if r.out.front != fan.MaxDuty || r.out.rear != fan.MaxDuty {
+		t.Errorf("異常時の期待するデューティは %d 、実際は %d/%d で異なる", fan.MaxDuty, r.out.front, r.out.rear)
+	}
+	if blink := r.app.Display.Blink(); blink != ht16k33.Blink2Hz {
+		t.Errorf("異常時の期待する点滅は %d 、実際は %d で異なる", ht16k33.Blink2Hz, blink)
+	}
+}
+
+// ポテンショメータの応答曲線は設定で差し替えられる
+func TestApp_PotCurve(t *testing.T) {
+	r := newTestRig(t)
+	r.app.Config.PotCurve = curve.Curve{Shape: curve.Linear, OutMin: 8000}
+	r.pot.value = 0
+
+	r.run(50 * time.Millisecond)
+
+	if r.out.front != 8000 {
+		t.Errorf("期待するデューティは 8000 、実際は %d で異なる", r.out.front)
+	}
+}
+
+// ポテンショメータの小さな揺れではデューティが変わらない
+func TestApp_PotJitter(t *testing.T) {
+	r := newTestRig(t)
+	r.pot.value = 32768
+	r.run(50 * time.Millisecond)
+	duty := r.out.front
+
+	for _, v := range []uint16{32800, 32700, 32850, 32768} {
+		r.pot.value = v
+		r.run(50 * time.Millisecond)
+		if r.out.front != duty {
+			t.Errorf("ポット %d で期待するデューティは %d 、実際は %d で異なる", v, duty, r.out.front)
+		}
+	}
+}
+
+// 遅れたRPM周期では、速度ループは実際に経った時間だけ積分する
+func TestApp_LateRPMTick(t *testing.T) {
+	onTime, late := newTestRig(t), newTestRig(t)
+	for _, r := range []*testRig{onTime, late} {
+		r.app.SetMode(control.ModeClosedLoop, 600)
+	}
+	onTime.run(time.Second)
+	late.clock.Sleep(3 * time.Second)
+	late.app.Step()
+
+	if onTime.app.loopF >= late.app.loopF {
+		t.Errorf("3秒遅れた周期の出力 %d は、1秒の周期の出力 %d より大きいはず", late.app.loopF, onTime.app.loopF)
+	}
+}
+
+// 保存した設定を読み込んで反映し、変更を保存し直せる
+func TestApp_Settings(t *testing.T) {
+	flash := settings.NewMemFlash(4*4096, 256, 4096)
+	saved := settings.Default()
+	saved.PotCurve = curve.Curve{Shape: curve.Linear, OutMin: 8000}
+	saved.RearProfile = fan.Profile{PulsesPerRevolution: 4}
+	saved.Brightness = 8
+	if err := settings.Save(settings.NewLogStore(flash, 4), saved); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestRig(t)
+	if err := r.app.LoadSettings(settings.NewLogStore(flash, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r.bus.last(), []byte{0xE8}) {
+		t.Errorf("期待する明るさの設定は e8 、実際は %x で異なる", r.bus.last())
+	}
+	if ppr := r.app.Fans.Rear.Profile().PulsesPerRevolution; ppr != 4 {
+		t.Errorf("期待する後ろ側のPPRは 4 、実際は %d で異なる", ppr)
+	}
+	r.pot.value = 0
+	r.run(50 * time.Millisecond)
+	if r.out.front != 8000 {
+		t.Errorf("期待するデューティは 8000 、実際は %d で異なる", r.out.front)
+	}
+
+	r.app.Fans.Front.SetProfile(fan.Profile{PulsesPerRevolution: 1})
+	if err := r.app.SaveSettings(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := settings.Load(settings.NewLogStore(flash, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FrontProfile.PulsesPerRevolution != 1 || got.Brightness != 8 {
+		t.Errorf("期待する保存内容は PPR 1 、明るさ 8 、実際は %d 、 %d で異なる", got.FrontProfile.PulsesPerRevolution, got.Brightness)
+	}
+}
+
+// 設定が無ければ既定値を使う
+func TestApp_SettingsMissing(t *testing.T) {
+	r := newTestRig(t)
+	if err := r.app.SaveSettings(); !errors.Is(err, ErrNoStorage) {
+		t.Errorf("期待するエラーは %v 、実際は %v で異なる", ErrNoStorage, err)
+	}
+
+	flash := settings.NewMemFlash(4*4096, 256, 4096)
+	if err := r.app.LoadSettings(settings.NewLogStore(flash, 4)); !errors.Is(err, settings.ErrNotFound) {
+		t.Errorf("期待するエラーは %v 、実際は %v で異なる", settings.ErrNotFound, err)
+	}
+	if s := r.app.Settings(); s.Brightness != 15 || s.PotCurve.Shape != curve.Square {
+		t.Errorf("既定値のはずが %+v", s)
+	}
+	if err := r.app.SaveSettings(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 範囲外の明るさは、ディスプレイに送る値に揃えて報告する
+func TestApp_ApplySettingsClampsBrightness(t *testing.T) {
+	r := newTestRig(t)
+	s := r.app.Settings()
+	s.Brightness = 200
+	r.app.ApplySettings(s)
+	if !bytes.Equal(r.bus.last(), []byte{0xEF}) {
+		t.Errorf("期待する明るさの設定は ef 、実際は %x で異なる", r.bus.last())
+	}
+	if got := r.app.Settings().Brightness; got != 15 {
+		t.Errorf("期待する明るさは 15 、実際は %d で異なる", got)
+	}
+}
+
+// 設定した頻度とフィールドでテレメトリーを送る
+func TestApp_Telemetry(t *testing.T) {
+	r := newTestRig(t)
+	r.app.Config.Telemetry = telemetry.Config{
+		Format:   telemetry.FormatCSV,
+		Fields:   telemetry.FieldTime | telemetry.FieldFrontRPM | telemetry.FieldRearRPM | telemetry.FieldFrontDuty | telemetry.FieldRearFault,
+		Interval: time.Second,
+	}
+	var out bytes.Buffer
+	r.app.StartTelemetry(&out)
+	r.pot.value = 65535
+	r.front.pulses = 120
+	r.rear.pulses = 0
+
+	r.run(5 * time.Second)
+
+	expected := "time_ms,front_rpm,rear_rpm,front_duty,rear_fault\n" +
+		"0,0,0,0,none\n" +
+		"1000,3600,0,40000,none\n" +
+		"2000,3600,0,40000,none\n" +
+		"3000,3600,0,40000,none\n" +
+		"4000,3600,0,40000,tach-missing\n" +
+		"5000,3600,0,40000,tach-missing\n"
+	if out.String() != expected {
+		t.Errorf("期待する出力は\n%s実際は\n%sで異なる", expected, out.String())
+	}
+}
+
+// キックスタートを外した既定の設定
+func rampOnlyConfig() Config {
+	cfg := DefaultConfig()
+	cfg.FrontStart = control.StartConfig{}
+	cfg.RearStart = control.StartConfig{}
+	return cfg
+}
+
+// 起動後はソフトスタートでデューティが上がる
+func TestApp_SoftStartAtBoot(t *testing.T) {
+	r := newTestRigWith(t, rampOnlyConfig())
+	r.pot.value = 65535
+	r.front.pulses = 60
+	r.rear.pulses = 60
+
+	// 毎秒8000
+	r.run(time.Second)
+	if r.out.front != 8000 || r.out.rear != 8000 {
+		t.Errorf("1秒後の期待するデューティは 8000 、実際は %d/%d で異なる", r.out.front, r.out.rear)
+	}
+	r.run(4 * time.Second)
+	if r.out.front != fan.MaxDuty {
+		t.Errorf("5秒後の期待するデューティは %d 、実際は %d で異なる", fan.MaxDuty, r.out.front)
+	}
+}
+
+// 起動時のキックもソフトスタートの上昇率を超えず、全速に跳ね上がらない
+func TestApp_SoftStartLimitsKick(t *testing.T) {
+	r := newTestRigWith(t, DefaultConfig())
+	r.pot.value = 65535
+	r.front.pulses = 60
+	r.rear.pulses = 60
+
+	// ランプは毎秒8000、キックはそこからさらに毎秒8000まで
+	highest := uint32(0)
+	for i := 0; i < 20; i++ {
+		r.run(50 * time.Millisecond)
+		highest = max(highest, r.out.front)
+	}
+	if highest > 16000 {
+		t.Errorf("1秒間の期待する最大デューティは 16000 以下、実際は %d で異なる", highest)
+	}
+	r.run(4 * time.Second)
+	if r.out.front != fan.MaxDuty {
+		t.Errorf("5秒後の期待するデューティは %d 、実際は %d で異なる", fan.MaxDuty, r.out.front)
+	}
+}
+
+// 異常が解除されたら、全速から止まらずに下げていく
+func TestApp_SoftStartAfterFault(t *testing.T) {
+	r := newTestRigWith(t, rampOnlyConfig())
+	r.pot.value = 32768
+	r.front.pulses = 30
+	r.rear.pulses = 0
+
+	r.run(5 * time.Second)
+	if !r.app.Fans.HasFault() {
+		t.Fatal("後ろ側のファンは異常のはず")
+	}
+	// 下降は毎秒40000、上昇は毎秒20000で全速へ
+	r.run(2 * time.Second)
+	if r.out.front != fan.MaxDuty {
+		t.Fatalf("異常時の期待するデューティは %d 、実際は %d で異なる", fan.MaxDuty, r.out.front)
+	}
+
+	r.rear.pulses = 30
+	for r.app.Fans.HasFault() {
+		r.run(50 * time.Millisecond)
+	}
+	// 下降は毎秒40000
+	r.run(50 * time.Millisecond)
+	if r.out.front != 38000 || r.out.rear != 38000 {
+		t.Errorf("解除直後の期待するデューティは 38000 、実際は %d/%d で異なる", r.out.front, r.out.rear)
+	}
+	r.run(time.Second)
+	if r.out.front != 10000 || r.out.rear != 10000 {
+		t.Errorf("1秒後の期待するデューティは 10000 、実際は %d/%d で異なる", r.out.front, r.out.rear)
+	}
+	if blink := r.app.Display.Blink(); blink != ht16k33.BlinkOff {
+		t.Errorf("解除後の期待する点滅は %d 、実際は %d で異なる", ht16k33.BlinkOff, blink)
+	}
+}
+
+// 特性測定の間も異常検出は動き、回っているはずのローターが止まれば測定を
+// 止めて全速で回す
+func TestApp_CalibrationStoppedByFault(t *testing.T) {
+	r := newTestRig(t)
+	r.pot.value = 32768
+	r.front.pulses = 30
+	r.rear.pulses = 30
+	r.run(2 * time.Second)
+
+	var result error
+	if err := r.app.Calibrate(io.Discard, func(err error) { result = err }); err != nil {
+		t.Fatal(err)
+	}
+	// 止まるのを30秒待った後、最初のステップで回り出したことになる
+	r.run(40 * time.Second)
+	if !r.app.Calibrating() {
+		t.Fatal("特性測定の途中のはず")
+	}
+	if front, rear := r.app.Duties(); front == 0 || rear != 0 {
+		t.Errorf("前側だけを駆動するはず、実際は %d/%d", front, rear)
+	}
+
+	r.front.pulses = 0
+	r.run(5 * time.Second)
+	if !errors.Is(result, ErrCalibrationFault) || r.app.Calibrating() {
+		t.Fatalf("期待するエラーは %v 、実際は %v で異なる", ErrCalibrationFault, result)
+	}
+	r.run(2 * time.Second)
+	if r.out.front != fan.MaxDuty || r.out.rear != fan.MaxDuty {
+		t.Errorf("異常時の期待するデューティは %d 、実際は %d/%d で異なる", fan.MaxDuty, r.out.front, r.out.rear)
+	}
+}
+
+// 遅れて逃した周期処理はまとめて実行しない
+func TestNextTick(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		now      time.Duration
+		expected time.Duration
+	}{
+		{name: "予定通り", now: 0, expected: time.Second},
+		{name: "少し遅れた", now: 300 * time.Millisecond, expected: time.Second},
+		{name: "大きく遅れた", now: 2500 * time.Millisecond, expected: 3500 * time.Millisecond},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := nextTick(base, base.Add(tc.now), time.Second)
+			if want := base.Add(tc.expected); !got.Equal(want) {
+				t.Errorf("期待する次の時刻は %v 、実際は %v で異なる", tc.expected, got.Sub(base))
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package app
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/console"
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/curve"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/protocol"
+	"github.com/kou-tkbys/tk-fancon2/settings"
+	"github.com/kou-tkbys/tk-fancon2/telemetry"
+)
+
+// maxRPM bounds the RPMs accepted by the console.
+//
+// maxRPMは、コンソールが受け付けるRPMの上限。
+const maxRPM = 65535
+
+// StartConsole starts a command console reading from r and replying to w,
+// such as the serial port, and returns its shell so echo can be turned
+// on. Protocol frames mixed into r are answered on w too. Step polls r,
+// so its Read must not block when nothing has arrived.
+//
+// StartConsoleは、シリアルポートなどのrから読み取ってwに返答するコマンド
+// コンソールを始め、エコーを有効にできるようそのシェルを返す。rに混ざった
+// プロトコルのフレームにもwで返答する。Stepがrをポーリングするので、何も
+// 届いていないときにReadがブロックしてはならない。
+func (a *App) StartConsole(r io.Reader, w io.Writer) *console.Shell {
+	s := console.New(w)
+	for _, c := range []console.Command{
+		{Name: "get", Args: "rpm|duty|fault|mode", Help: "show front and rear values", Run: a.cmdGet},
+		{Name: "set", Args: "duty front|rear|both <duty|n%>", Help: "drive the fans at a fixed duty", Run: a.cmdSet},
+		{Name: "mode", Args: "[open|pid <rpm>]", Help: "follow the knob or hold the front rpm", Run: a.cmdMode},
+		{Name: "config", Args: "get [key]|set <key> <value> [front|rear]|save|load|reset", Help: "ppr, maxrpm, stallrpm, curve, deadzone", Run: a.cmdConfig},
+		{Name: "brightness", Args: "[0-15]", Help: "show or set the display brightness", Run: a.cmdBrightness},
+		{Name: "fault", Args: "[clear]", Help: "show or clear the fan faults", Run: a.cmdFault},
+		{Name: "display", Help: "show the display bus state and error counts", Run: a.cmdDisplay},
+		{Name: "calibrate", Help: "sweep both rotors, printing the results when done", Run: a.cmdCalibrate},
+		{Name: "telemetry", Args: "on|off|format <f>|fields <list>|rate <ms>", Help: "control the telemetry stream", Run: a.cmdTelemetry},
+	} {
+		s.Register(c)
+	}
+	a.console = s
+	a.consoleIn = r
+	a.consoleOut = w
+	a.demux = protocol.NewDemux(s.Feed, a.handleMessage)
+	if a.telemetryOut == nil {
+		a.telemetryOut = w
+	}
+	return s
+}
+
+// pollConsole feeds whatever has arrived to the console and the protocol.
+//
+// pollConsoleは、届いているものをコンソールとプロトコルにFeedする。
+func (a *App) pollConsole() {
+	if a.console == nil {
+		return
+	}
+	var buf [64]byte
+	for {
+		n, err := a.consoleIn.Read(buf[:])
+		a.demux.Feed(buf[:n])
+		if n < len(buf) || err != nil {
+			return
+		}
+	}
+}
+
+func (a *App) cmdGet(w io.Writer, args []string) error {
+	if len(args) != 2 {
+		return console.ErrUsage
+	}
+	var front, rear string
+	switch args[1] {
+	case "rpm":
+		front, rear = strconv.Itoa(int(a.Fans.Front.RPM())), strconv.Itoa(int(a.Fans.Rear.RPM()))
+	case "duty":
+		front, rear = strconv.Itoa(int(a.dutyF)), strconv.Itoa(int(a.dutyR))
+	case "fault":
+		return a.cmdFault(w, args[:1])
+	case "mode":
+		return a.cmdMode(w, args[:1])
+	default:
+		return console.ErrUsage
+	}
+	_, err := io.WriteString(w, front+" "+rear+"\r\n")
+	return err
+}
+
+func (a *App) cmdSet(w io.Writer, args []string) error {
+	if len(args) != 4 || args[1] != "duty" {
+		return console.ErrUsage
+	}
+	duty, err := console.ParseDuty(args[3])
+	if err != nil {
+		return err
+	}
+	// Keep the other rotor where it is.
+	// もう一方のローターはそのままにする。
+	front, rear := a.manualF, a.manualR
+	if !a.manual {
+		front, rear = a.dutyF, a.dutyR
+	}
+	switch args[2] {
+	case "front":
+		front = duty
+	case "rear":
+		rear = duty
+	case "both":
+		front, rear = duty, duty
+	default:
+		return console.ErrUsage
+	}
+	a.SetManualDuty(front, rear)
+	return console.OK(w)
+}
+
+func (a *App) cmdMode(w io.Writer, args []string) error {
+	switch {
+	case len(args) == 1:
+		mode, target := a.Mode()
+		reply := "open"
+		if mode == control.ModeClosedLoop {
+			reply = "pid " + strconv.Itoa(int(target))
+		} else if a.manual {
+			reply = "manual"
+		}
+		_, err := io.WriteString(w, reply+"\r\n")
+		return err
+	case len(args) == 2 && args[1] == "open":
+		a.SetMode(control.ModeOpenLoop, a.targetRPM)
+	case len(args) == 3 && args[1] == "pid":
+		rpm, err := console.ParseUint(args[2], maxRPM)
+		if err != nil {
+			return err
+		}
+		a.SetMode(control.ModeClosedLoop, rpm)
+	default:
+		return console.ErrUsage
+	}
+	return console.OK(w)
+}
+
+// configKeys are the keys of the config command, in the order listed.
+//
+// configKeysは、configコマンドのキー。一覧に出す順に並ぶ。
+var configKeys = []string{"ppr", "maxrpm", "stallrpm", "curve", "deadzone"}
+
+func (a *App) cmdConfig(w io.Writer, args []string) error {
+	if len(args) < 2 {
+		return console.ErrUsage
+	}
+	switch {
+	case args[1] == "get" && len(args) == 2:
+		for _, key := range configKeys {
+			v, _ := a.configValue(key)
+			io.WriteString(w, key+" "+v+"\r\n")
+		}
+		return nil
+	case args[1] == "get" && len(args) == 3:
+		v, ok := a.configValue(args[2])
+		if !ok {
+			return errors.New("unknown key: " + args[2])
+		}
+		_, err := io.WriteString(w, v+"\r\n")
+		return err
+	case args[1] == "set" && (len(args) == 4 || len(args) == 5):
+		front, rear := true, true
+		if len(args) == 5 {
+			switch args[4] {
+			case "front":
+				rear = false
+			case "rear":
+				front = false
+			default:
+				return console.ErrUsage
+			}
+		}
+		if err := a.setConfig(args[2], args[3], front, rear); err != nil {
+			return err
+		}
+	case args[1] == "save" && len(args) == 2:
+		if err := a.SaveSettings(); err != nil {
+			return err
+		}
+	case args[1] == "load" && len(args) == 2:
+		if a.storage == nil {
+			return ErrNoStorage
+		}
+		if err := a.LoadSettings(a.storage); err != nil {
+			return err
+		}
+	case args[1] == "reset" && len(args) == 2:
+		a.ApplySettings(settings.Default())
+	default:
+		return console.ErrUsage
+	}
+	return console.OK(w)
+}
+
+// configValue returns the value of a config key, with the front and rear
+// values of the per-rotor keys separated by a space.
+//
+// configValueは、configのキーの値を返す。ローターごとのキーは前側と後ろ側
+// の値を空白で区切って返す。
+func (a *App) configValue(key string) (string, bool) {
+	front, rear := a.Fans.Front.Profile(), a.Fans.Rear.Profile()
+	pair := func(f, r uint32) string {
+		return strconv.Itoa(int(f)) + " " + strconv.Itoa(int(r))
+	}
+	switch key {
+	case "ppr":
+		return pair(front.PulsesPerRevolution, rear.PulsesPerRevolution), true
+	case "maxrpm":
+		return pair(front.MaxRPM, rear.MaxRPM), true
+	case "stallrpm":
+		return pair(front.StallRPM, rear.StallRPM), true
+	case "curve":
+		return a.Config.PotCurve.Shape.String(), true
+	case "deadzone":
+		return strconv.Itoa(int(a.Config.PotCurve.Deadzone)), true
+	default:
+		return "", false
+	}
+}
+
+// setConfig sets a config key. Per-rotor keys are set on the front
+// and/or rear rotor as selected.
+//
+// setConfigは、configのキーを設定する。ローターごとのキーは、選ばれた前側
+// と後ろ側のローターに設定する。
+func (a *App) setConfig(key, value string, front, rear bool) error {
+	switch key {
+	case "curve":
+		shape, ok := curve.ParseShape(value)
+		if !ok {
+			return errors.New("unknown curve: " + value)
+		}
+		a.Config.PotCurve.Shape = shape
+		return nil
+	case "deadzone":
+		v, err := console.ParseUint(value, curve.MaxInput)
+		if err != nil {
+			return err
+		}
+		a.Config.PotCurve.Deadzone = uint16(v)
+		return nil
+	}
+
+	var set func(p *fan.Profile, v uint32)
+	limit := uint32(maxRPM)
+	switch key {
+	case "ppr":
+		set = func(p *fan.Profile, v uint32) { p.PulsesPerRevolution = v }
+		limit = 255
+	case "maxrpm":
+		set = func(p *fan.Profile, v uint32) { p.MaxRPM = v }
+	case "stallrpm":
+		set = func(p *fan.Profile, v uint32) { p.StallRPM = v }
+	default:
+		return errors.New("unknown key: " + key)
+	}
+	v, err := console.ParseUint(value, limit)
+	if err != nil {
+		return err
+	}
+	if key == "ppr" && v == 0 {
+		return errors.New("invalid number: " + value)
+	}
+	update := func(f *fan.Fan) {
+		p := f.Profile()
+		set(&p, v)
+		f.SetProfile(p)
+	}
+	if front {
+		update(a.Fans.Front)
+	}
+	if rear {
+		update(a.Fans.Rear)
+	}
+	return nil
+}
+
+func (a *App) cmdBrightness(w io.Writer, args []string) error {
+	switch len(args) {
+	case 1:
+		_, err := io.WriteString(w, strconv.Itoa(int(a.brightness))+"\r\n")
+		return err
+	case 2:
+		v, err := console.ParseUint(args[1], 15)
+		if err != nil {
+			return err
+		}
+		a.brightness = uint8(v)
+		if a.displayErr = a.Display.SetBrightness(a.brightness); a.displayErr != nil {
+			return a.displayErr
+		}
+		return console.OK(w)
+	default:
+		return console.ErrUsage
+	}
+}
+
+func (a *App) cmdFault(w io.Writer, args []string) error {
+	switch {
+	case len(args) == 1:
+		front, rear := a.Fans.Faults()
+		_, err := io.WriteString(w, front.String()+" "+rear.String()+"\r\n")
+		return err
+	case len(args) == 2 && args[1] == "clear":
+		a.Fans.ClearFaults()
+		return console.OK(w)
+	default:
+		return console.ErrUsage
+	}
+}
+
+func (a *App) cmdDisplay(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return console.ErrUsage
+	}
+	state := "online"
+	if !a.displayBus.Online() {
+		state = "offline"
+	}
+	st := a.displayBus.Stats()
+	_, err := io.WriteString(w, state+
+		" errors="+strconv.Itoa(int(st.Errors))+
+		" retries="+strconv.Itoa(int(st.Retries))+
+		" failures="+strconv.Itoa(int(st.Failures))+
+		" skipped="+strconv.Itoa(int(st.Skipped))+
+		" clears="+strconv.Itoa(int(st.BusClears))+
+		" recoveries="+strconv.Itoa(int(st.Recoveries))+"\r\n")
+	return err
+}
+
+func (a *App) cmdCalibrate(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return console.ErrUsage
+	}
+	// The results follow in a few minutes, while the console stays up.
+	// 結果は数分後に出る。その間もコンソールは使える。
+	return a.Calibrate(w, func(err error) {
+		if err != nil {
+			io.WriteString(w, "error: "+err.Error()+"\r\n")
+			return
+		}
+		console.OK(w)
+	})
+}
+
+func (a *App) cmdTelemetry(w io.Writer, args []string) error {
+	cfg := &a.Config.Telemetry
+	switch {
+	case len(args) == 2 && args[1] == "on":
+		a.StartTelemetry(a.telemetryOut)
+		return console.OK(w)
+	case len(args) == 2 && args[1] == "off":
+		a.Telemetry = nil
+		return console.OK(w)
+	case len(args) != 3:
+		return console.ErrUsage
+	}
+	switch args[1] {
+	case "format":
+		f, ok := telemetry.ParseFormat(args[2])
+		if !ok {
+			return errors.New("unknown format: " + args[2])
+		}
+		cfg.Format = f
+	case "fields":
+		f, ok := telemetry.ParseFields(args[2])
+		if !ok || f == 0 {
+			return errors.New("unknown fields: " + args[2])
+		}
+		cfg.Fields = f
+	case "rate":
+		ms, err := console.ParseUint(args[2], 3600000)
+		if err != nil {
+			return err
+		}
+		cfg.Interval = time.Duration(ms) * time.Millisecond
+	default:
+		return console.ErrUsage
+	}
+	// Restart a running stream so a CSV header for the new fields is
+	// written.
+	// 新しいフィールドのCSVヘッダーを書くよう、動いているストリームはやり直す。
+	if a.Telemetry != nil {
+		a.StartTelemetry(a.telemetryOut)
+	}
+	return console.OK(w)
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/curve"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/settings"
+)
+
+// コマンドを1行ずつ送り、Stepで実行させて返答を返す
+func (r *testRig) exec(in, out *bytes.Buffer, line string) string {
+	out.Reset()
+	in.WriteString(line + "\n")
+	r.app.Step()
+	return out.String()
+}
+
+func TestConsole_Commands(t *testing.T) {
+	testCases := []struct {
+		name     string
+		lines    []string
+		expected string
+		check    func(t *testing.T, r *testRig)
+	}{
+		{name: "RPM", lines: []string{"get rpm"}, expected: "900 450\r\n"},
+		{name: "デューティ", lines: []string{"get duty"}, expected: "40000 40000\r\n"},
+		{name: "異常", lines: []string{"get fault"}, expected: "none none\r\n"},
+		{name: "モード", lines: []string{"get mode"}, expected: "open\r\n"},
+		{name: "知らない値", lines: []string{"get temp"}, expected: "usage: get rpm|duty|fault|mode\r\n"},
+		{
+			name: "前側のデューティ", lines: []string{"set duty front 30%", "get mode"}, expected: "manual\r\n",
+			check: func(t *testing.T, r *testRig) {
+				if f, rr := r.app.Duties(); f != 12000 || rr != fan.MaxDuty {
+					t.Errorf("期待するデューティは 12000/40000 、実際は %d/%d で異なる", f, rr)
+				}
+			},
+		},
+		{
+			name: "両方のデューティ", lines: []string{"set duty both 1000", "set duty rear 2000"}, expected: "ok\r\n",
+			check: func(t *testing.T, r *testRig) {
+				if f, rr := r.app.Duties(); f != 1000 || rr != 2000 {
+					t.Errorf("期待するデューティは 1000/2000 、実際は %d/%d で異なる", f, rr)
+				}
+			},
+		},
+		{name: "範囲外のデューティ", lines: []string{"set duty front 101%"}, expected: "error: invalid duty: 101%\r\n"},
+		{name: "開ループに戻す", lines: []string{"set duty both 0", "mode open", "get duty"}, expected: "40000 40000\r\n"},
+		{
+			name: "閉ループ", lines: []string{"mode pid 2400", "mode"}, expected: "pid 2400\r\n",
+			check: func(t *testing.T, r *testRig) {
+				if mode, target := r.app.Mode(); mode != control.ModeClosedLoop || target != 2400 {
+					t.Errorf("期待するモードは closed/2400 、実際は %v/%d で異なる", mode, target)
+				}
+			},
+		},
+		{name: "目標RPMが無い", lines: []string{"mode pid"}, expected: "usage: mode [open|pid <rpm>]\r\n"},
+		{name: "設定の一覧", lines: []string{"config get"}, expected: "ppr 2 2\r\nmaxrpm 0 0\r\nstallrpm 0 0\r\ncurve square\r\ndeadzone 2000\r\n"},
+		{name: "前側だけ設定", lines: []string{"config set ppr 4 front", "config get ppr"}, expected: "4 2\r\n"},
+		{name: "両方に設定", lines: []string{"config set stallrpm 300", "config get stallrpm"}, expected: "300 300\r\n"},
+		{name: "曲線", lines: []string{"config set curve log", "config get curve"}, expected: "log\r\n"},
+		{name: "知らない曲線", lines: []string{"config set curve zigzag"}, expected: "error: unknown curve: zigzag\r\n"},
+		{name: "PPRは0にできない", lines: []string{"config set ppr 0"}, expected: "error: invalid number: 0\r\n"},
+		{name: "知らないキー", lines: []string{"config get color"}, expected: "error: unknown key: color\r\n"},
+		{name: "保存先が無い", lines: []string{"config save"}, expected: "error: app: no settings storage\r\n"},
+		{
+			name: "既定値に戻す", lines: []string{"config set deadzone 0", "config reset", "config get deadzone"}, expected: "2000\r\n",
+		},
+		{
+			name: "明るさ", lines: []string{"brightness 8", "brightness"}, expected: "8\r\n",
+			check: func(t *testing.T, r *testRig) {
+				if !bytes.Equal(r.bus.last(), []byte{0xE8}) {
+					t.Errorf("期待する明るさの設定は e8 、実際は %x で異なる", r.bus.last())
+				}
+			},
+		},
+		{name: "明るすぎる", lines: []string{"brightness 16"}, expected: "error: invalid number: 16\r\n"},
+		{name: "ディスプレイ", lines: []string{"display"}, expected: "online errors=0 retries=0 failures=0 skipped=0 clears=0 recoveries=0\r\n"},
+		{name: "異常の解除", lines: []string{"fault clear", "fault"}, expected: "none none\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestRig(t)
+			r.pot.value = 65535
+			r.front.pulses = 30
+			r.rear.pulses = 15
+			r.run(time.Second)
+
+			var in, out bytes.Buffer
+			r.app.StartConsole(&in, &out)
+			var got string
+			for _, line := range tc.lines {
+				got = r.exec(&in, &out, line)
+				r.run(50 * time.Millisecond)
+			}
+			if got != tc.expected {
+				t.Errorf("期待する返答は %q 、実際は %q で異なる", tc.expected, got)
+			}
+			if tc.check != nil {
+				tc.check(t, r)
+			}
+		})
+	}
+}
+
+// コンソールから設定を変えて保存し、読み込み直せる
+func TestConsole_ConfigSaveLoad(t *testing.T) {
+	r := newTestRig(t)
+	flash := settings.NewMemFlash(4*4096, 256, 4096)
+	r.app.LoadSettings(settings.NewLogStore(flash, 4))
+	var in, out bytes.Buffer
+	r.app.StartConsole(&in, &out)
+
+	for _, line := range []string{"config set curve cubic", "config set maxrpm 3000 rear", "mode pid 1800", "config save", "config reset"} {
+		if got := r.exec(&in, &out, line); got != "ok\r\n" {
+			t.Fatalf("%s: 期待する返答は ok 、実際は %q で異なる", line, got)
+		}
+	}
+	if r.app.Config.PotCurve.Shape != curve.Square {
+		t.Errorf("既定値に戻っていない: %v", r.app.Config.PotCurve.Shape)
+	}
+
+	if got := r.exec(&in, &out, "config load"); got != "ok\r\n" {
+		t.Fatalf("期待する返答は ok 、実際は %q で異なる", got)
+	}
+	if r.app.Config.PotCurve.Shape != curve.Cubic || r.app.Fans.Rear.Profile().MaxRPM != 3000 {
+		t.Errorf("期待する設定は cubic/3000 、実際は %v/%d で異なる", r.app.Config.PotCurve.Shape, r.app.Fans.Rear.Profile().MaxRPM)
+	}
+	if got := r.exec(&in, &out, "mode"); got != "pid 1800\r\n" {
+		t.Errorf("期待するモードは %q 、実際は %q で異なる", "pid 1800\r\n", got)
+	}
+}
+
+// コンソールからテレメトリーを始め、設定を変えられる
+func TestConsole_Telemetry(t *testing.T) {
+	r := newTestRig(t)
+	var in, out bytes.Buffer
+	r.app.StartConsole(&in, &out)
+
+	for _, line := range []string{"telemetry fields time_ms,front_duty", "telemetry rate 500"} {
+		if got := r.exec(&in, &out, line); got != "ok\r\n" {
+			t.Fatalf("%s: 期待する返答は ok 、実際は %q で異なる", line, got)
+		}
+	}
+	// 最初のレコードはすぐに出る
+	expected := "ok\r\ntime_ms,front_duty\n0,0\n"
+	if got := r.exec(&in, &out, "telemetry on"); got != expected {
+		t.Fatalf("期待する出力は %q 、実際は %q で異なる", expected, got)
+	}
+	out.Reset()
+	r.run(time.Second)
+	expected = "500,0\n1000,0\n"
+	if out.String() != expected {
+		t.Errorf("期待する出力は %q 、実際は %q で異なる", expected, out.String())
+	}
+
+	if got := r.exec(&in, &out, "telemetry off"); got != "ok\r\n" {
+		t.Fatalf("期待する返答は ok 、実際は %q で異なる", got)
+	}
+	out.Reset()
+	r.run(time.Second)
+	if out.Len() != 0 {
+		t.Errorf("止めた後は何も出ないはず: %q", out.String())
+	}
+	if got := r.exec(&in, &out, "telemetry format yaml"); got != "error: unknown format: yaml\r\n" {
+		t.Errorf("期待する返答は %q 、実際は %q で異なる", "error: unknown format: yaml\r\n", got)
+	}
+}
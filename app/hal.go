@@ -0,0 +1,86 @@
+package app
+
+import (
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/ht16k33"
+)
+
+// DutyOutput drives the PWM outputs of the front and rear fans.
+//
+// DutyOutputは、前側と後ろ側のファンのPWM出力を駆動する。
+type DutyOutput interface {
+	// SetDuty writes the front and rear duties (0-fan.MaxDuty).
+	//
+	// SetDutyは、前側と後ろ側のデューティ(0-fan.MaxDuty)を書き込む。
+	SetDuty(front, rear uint32)
+}
+
+// AnalogInput reads a 16-bit analog value, such as the potentiometer.
+// machine.ADC satisfies it.
+//
+// AnalogInputは、ポテンショメータなどの16ビットのアナログ値を読む。
+// machine.ADCはこれを満たす。
+type AnalogInput interface {
+	Get() uint16
+}
+
+// StatusLED is the on-board status LED. machine.Pin satisfies it.
+//
+// StatusLEDは、基板上の状態表示LED。machine.Pinはこれを満たす。
+type StatusLED interface {
+	Set(on bool)
+}
+
+// Clock provides the current time and a way to wait. It satisfies
+// fan.Clock.
+//
+// Clockは、現在時刻と待つ手段を提供する。fan.Clockを満たす。
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time        { return time.Now() }
+func (systemClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// SystemClock is the Clock backed by the time package.
+//
+// SystemClockは、timeパッケージを使うClock。
+var SystemClock Clock = systemClock{}
+
+// FanHardware is the fan-side hardware brought up by the platform.
+//
+// FanHardwareは、プラットフォームが立ち上げるファン側のハードウェア。
+type FanHardware struct {
+	// Name of the fan unit.
+	// ファンユニットの名前
+	Name   string
+	Output DutyOutput
+	Pot    AnalogInput
+	// Tach pulse counters of the front and rear fans.
+	// 前側と後ろ側のファンのタコパルスカウンター
+	Front, Rear fan.PulseCounter
+}
+
+// DisplaySetup brings up the I2C bus of the display. It returns the bus
+// even when it also returns an error, so the display can be tried again.
+//
+// DisplaySetupは、ディスプレイのI2Cバスを立ち上げる。エラーを返すときも、
+// ディスプレイを再び試せるようにバスを返す。
+type DisplaySetup func() (ht16k33.I2CBus, error)
+
+// BusClearer is implemented by display buses that can free a bus the
+// display holds stuck, such as SDA held low after a brown-out. When the
+// bus from DisplaySetup implements it, ClearBus runs after the display
+// fails to answer.
+//
+// BusClearerは、ディスプレイが止めたバス(ブラウンアウト後にSDAがLowのまま
+// など)を解放できるディスプレイのバスが実装する。DisplaySetupのバスがこれ
+// を実装していれば、ディスプレイが応答しなかった後にClearBusを実行する。
+type BusClearer interface {
+	ClearBus() error
+}
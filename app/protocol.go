@@ -0,0 +1,138 @@
+package app
+
+import (
+	"errors"
+	"io"
+
+	"github.com/kou-tkbys/tk-fancon2/protocol"
+	"github.com/kou-tkbys/tk-fancon2/settings"
+	"github.com/kou-tkbys/tk-fancon2/telemetry"
+)
+
+// handleMessage answers one protocol request on the console output.
+//
+// handleMessageは、プロトコルのリクエスト1つにコンソールの出力で返答する。
+func (a *App) handleMessage(m protocol.Message) {
+	if m.Type&protocol.Reply != 0 {
+		// Not ours to answer.
+		// 返答するものではない。
+		return
+	}
+	payload, err := a.serve(m, a.reply[:0])
+	if err == errReplyLater {
+		return
+	}
+	a.send(m, payload, err)
+}
+
+// send writes the reply to m on the console output: payload, or the error
+// reply if err is set.
+//
+// sendは、mへの返答をコンソールの出力に書く。errが設定されていればエラー
+// の返答、そうでなければpayload。
+func (a *App) send(m protocol.Message, payload []byte, err error) {
+	reply := protocol.ReplyTo(m, payload)
+	if err != nil {
+		reply = protocol.ErrorTo(m, errorReply(err), payload[:0])
+	}
+	a.reply = reply.Payload
+
+	frame, err := protocol.AppendFrame(a.frame[:0], reply)
+	if err != nil {
+		frame, _ = protocol.AppendFrame(a.frame[:0], protocol.ErrorTo(m, errorReply(err), nil))
+	}
+	a.frame = frame
+	a.consoleOut.Write(frame)
+}
+
+// errUnknownType is returned by serve for a type it does not handle.
+//
+// errUnknownTypeは、扱わない種類に対してserveが返す。
+var errUnknownType = errors.New("unknown type")
+
+// errReplyLater is returned by serve for a request answered later, by
+// send.
+//
+// errReplyLaterは、後からsendで返答するリクエストに対してserveが返す。
+var errReplyLater = errors.New("reply later")
+
+// errorReply returns the error reply for err.
+//
+// errorReplyは、errに対するエラーの返答を返す。
+func errorReply(err error) *protocol.ErrorReply {
+	switch {
+	case errors.Is(err, errUnknownType):
+		return &protocol.ErrorReply{Code: protocol.ErrCodeUnknownType}
+	case errors.Is(err, protocol.ErrBadPayload):
+		return &protocol.ErrorReply{Code: protocol.ErrCodeBadPayload}
+	default:
+		return &protocol.ErrorReply{Code: protocol.ErrCodeFailed, Message: err.Error()}
+	}
+}
+
+// serve runs request m and appends the payload of its reply to b.
+//
+// serveは、リクエストmを実行し、その返答のペイロードをbに追加する。
+func (a *App) serve(m protocol.Message, b []byte) ([]byte, error) {
+	switch m.Type {
+	case protocol.TypeVersion:
+		v := protocol.VersionInfo{Protocol: protocol.Version, Settings: settings.Version, Name: a.Fans.Name}
+		return v.Append(b), nil
+	case protocol.TypeTelemetry:
+		req, err := protocol.ParseTelemetryRequest(m.Payload)
+		if err != nil {
+			return b, err
+		}
+		return telemetry.AppendValues(b, a.Record(), req.Fields), nil
+	case protocol.TypeSetDuty:
+		d, err := protocol.ParseDuty(m.Payload)
+		if err != nil {
+			return b, err
+		}
+		a.SetManualDuty(d.Front, d.Rear)
+		return b, nil
+	case protocol.TypeSetMode:
+		s, err := protocol.ParseModeSetting(m.Payload)
+		if err != nil {
+			return b, err
+		}
+		a.SetMode(s.Mode, s.TargetRPM)
+		return b, nil
+	case protocol.TypeReadConfig:
+		s := a.Settings()
+		data, err := s.Marshal()
+		return append(b, data...), err
+	case protocol.TypeWriteConfig:
+		c, err := protocol.ParseWriteConfig(m.Payload)
+		if err != nil {
+			return b, err
+		}
+		// Keys missing from the blob keep their current values.
+		// 送られてきた設定に無いキーは、現在の値のまま残す。
+		s := a.Settings()
+		if err := s.Unmarshal(c.Settings); err != nil {
+			return b, err
+		}
+		a.ApplySettings(s)
+		if c.Flags&protocol.ConfigSave != 0 {
+			return b, a.SaveSettings()
+		}
+		return b, nil
+	case protocol.TypeFaults:
+		front, rear := a.Fans.Faults()
+		return protocol.Faults{Front: front, Rear: rear}.Append(b), nil
+	case protocol.TypeClearFaults:
+		a.Fans.ClearFaults()
+		return b, nil
+	case protocol.TypeCalibrate:
+		// The reply waits for the end of the sweep, minutes later.
+		// 返答は数分後、スイープが終わるまで待つ。
+		req := protocol.Message{Type: m.Type, ID: m.ID}
+		if err := a.Calibrate(io.Discard, func(err error) { a.send(req, nil, err) }); err != nil {
+			return b, err
+		}
+		return b, errReplyLater
+	default:
+		return b, errUnknownType
+	}
+}
@@ -0,0 +1,199 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/curve"
+	"github.com/kou-tkbys/tk-fancon2/protocol"
+	"github.com/kou-tkbys/tk-fancon2/settings"
+	"github.com/kou-tkbys/tk-fancon2/telemetry"
+)
+
+// リクエストを送り、Stepで実行させて返答を1つ返す
+func (r *testRig) request(t *testing.T, in, out *bytes.Buffer, m protocol.Message) protocol.Message {
+	t.Helper()
+	out.Reset()
+	frame, err := protocol.AppendFrame(nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.Write(frame)
+	r.app.Step()
+
+	var replies []protocol.Message
+	d := protocol.NewDemux(nil, func(m protocol.Message) {
+		m.Payload = append([]byte(nil), m.Payload...)
+		replies = append(replies, m)
+	})
+	d.Feed(out.Bytes())
+	if len(replies) != 1 {
+		t.Fatalf("期待する返答の数は 1 、実際は %d で異なる: %q", len(replies), out.Bytes())
+	}
+	if replies[0].ID != m.ID {
+		t.Errorf("期待するIDは %d 、実際は %d で異なる", m.ID, replies[0].ID)
+	}
+	return replies[0]
+}
+
+func TestProtocol_Requests(t *testing.T) {
+	r := newTestRig(t)
+	r.pot.value = 65535
+	r.front.pulses = 30
+	r.rear.pulses = 15
+	r.run(time.Second)
+	var in, out bytes.Buffer
+	r.app.StartConsole(&in, &out)
+
+	reply := r.request(t, &in, &out, protocol.Message{Type: protocol.TypeVersion, ID: 1})
+	if v, err := protocol.ParseVersionInfo(reply.Payload); err != nil || v != (protocol.VersionInfo{Protocol: protocol.Version, Settings: settings.Version, Name: "Test"}) {
+		t.Errorf("バージョン: %+v, %v", v, err)
+	}
+
+	reply = r.request(t, &in, &out, protocol.Message{Type: protocol.TypeTelemetry, ID: 2, Payload: protocol.TelemetryRequest{Fields: telemetry.FieldFrontRPM | telemetry.FieldRearDuty}.Append(nil)})
+	if rec, _, err := protocol.ParseTelemetry(reply.Payload); err != nil || rec.FrontRPM != 900 || rec.RearDuty != 40000 {
+		t.Errorf("テレメトリー: %+v, %v", rec, err)
+	}
+
+	reply = r.request(t, &in, &out, protocol.Message{Type: protocol.TypeSetDuty, ID: 3, Payload: protocol.Duty{Front: 10000, Rear: 20000}.Append(nil)})
+	if reply.Type != protocol.TypeSetDuty|protocol.Reply {
+		t.Errorf("期待する返答は %v 、実際は %v で異なる", protocol.TypeSetDuty|protocol.Reply, reply.Type)
+	}
+	r.run(50 * time.Millisecond)
+	if f, rr := r.app.Duties(); f != 10000 || rr != 20000 {
+		t.Errorf("期待するデューティは 10000/20000 、実際は %d/%d で異なる", f, rr)
+	}
+
+	r.request(t, &in, &out, protocol.Message{Type: protocol.TypeSetMode, ID: 4, Payload: protocol.ModeSetting{Mode: control.ModeClosedLoop, TargetRPM: 1500}.Append(nil)})
+	if mode, target := r.app.Mode(); mode != control.ModeClosedLoop || target != 1500 {
+		t.Errorf("期待するモードは closed/1500 、実際は %v/%d で異なる", mode, target)
+	}
+
+	reply = r.request(t, &in, &out, protocol.Message{Type: protocol.TypeFaults, ID: 5})
+	if f, err := protocol.ParseFaults(reply.Payload); err != nil || f != (protocol.Faults{}) {
+		t.Errorf("異常: %+v, %v", f, err)
+	}
+}
+
+func TestProtocol_Errors(t *testing.T) {
+	r := newTestRig(t)
+	var in, out bytes.Buffer
+	r.app.StartConsole(&in, &out)
+
+	testCases := []struct {
+		name     string
+		msg      protocol.Message
+		expected protocol.ErrorReply
+	}{
+		{name: "知らない種類", msg: protocol.Message{Type: 0x42, ID: 1}, expected: protocol.ErrorReply{Code: protocol.ErrCodeUnknownType}},
+		{name: "壊れたペイロード", msg: protocol.Message{Type: protocol.TypeSetDuty, ID: 2, Payload: []byte{1}}, expected: protocol.ErrorReply{Code: protocol.ErrCodeBadPayload}},
+		{
+			name:     "保存先が無い",
+			msg:      protocol.Message{Type: protocol.TypeWriteConfig, ID: 3, Payload: protocol.WriteConfig{Flags: protocol.ConfigSave, Settings: marshal(t, settings.Default())}.Append(nil)},
+			expected: protocol.ErrorReply{Code: protocol.ErrCodeFailed, Message: ErrNoStorage.Error()},
+		},
+		{
+			name:     "壊れた設定",
+			msg:      protocol.Message{Type: protocol.TypeWriteConfig, ID: 4, Payload: protocol.WriteConfig{Settings: []byte{1, 2, 3, 4, 5}}.Append(nil)},
+			expected: protocol.ErrorReply{Code: protocol.ErrCodeFailed, Message: settings.ErrCorrupt.Error()},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			reply := r.request(t, &in, &out, tc.msg)
+			if reply.Type != protocol.TypeError|protocol.Reply {
+				t.Fatalf("期待する返答は %v 、実際は %v で異なる", protocol.TypeError|protocol.Reply, reply.Type)
+			}
+			e, err := protocol.ParseErrorReply(reply.Payload)
+			if err != nil || *e != tc.expected {
+				t.Errorf("期待するエラーは %+v 、実際は %+v で異なる", tc.expected, e)
+			}
+		})
+	}
+}
+
+func marshal(t *testing.T, s settings.Settings) []byte {
+	t.Helper()
+	data, err := s.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// 設定を読み出し、書き換えて保存できる。テキストのコマンドと混ぜても良い。
+func TestProtocol_Config(t *testing.T) {
+	r := newTestRig(t)
+	flash := settings.NewMemFlash(4*4096, 256, 4096)
+	r.app.LoadSettings(settings.NewLogStore(flash, 4))
+	var in, out bytes.Buffer
+	r.app.StartConsole(&in, &out)
+
+	reply := r.request(t, &in, &out, protocol.Message{Type: protocol.TypeReadConfig, ID: 1})
+	var s settings.Settings
+	if err := s.Unmarshal(reply.Payload); err != nil {
+		t.Fatal(err)
+	}
+	if s.PotCurve.Shape != curve.Square {
+		t.Errorf("期待する曲線は square 、実際は %v で異なる", s.PotCurve.Shape)
+	}
+
+	s.PotCurve.Shape = curve.Linear
+	s.Brightness = 3
+	r.request(t, &in, &out, protocol.Message{Type: protocol.TypeWriteConfig, ID: 2, Payload: protocol.WriteConfig{Flags: protocol.ConfigSave, Settings: marshal(t, s)}.Append(nil)})
+	if got := r.exec(&in, &out, "config get curve"); got != "linear\r\n" {
+		t.Errorf("期待する曲線は %q 、実際は %q で異なる", "linear\r\n", got)
+	}
+	saved, err := settings.Load(settings.NewLogStore(flash, 4))
+	if err != nil || saved.Brightness != 3 {
+		t.Errorf("期待する保存された明るさは 3 、実際は %d (%v) で異なる", saved.Brightness, err)
+	}
+}
+
+// 迷い込んだ0x00の後も、テキストのコマンドはシェルに届く
+func TestProtocol_StrayZero(t *testing.T) {
+	r := newTestRig(t)
+	var in, out bytes.Buffer
+	r.app.StartConsole(&in, &out)
+
+	in.WriteByte(0)
+	if got := r.exec(&in, &out, "get fault"); got != "none none\r\n" {
+		t.Errorf("期待する返答は %q 、実際は %q で異なる", "none none\r\n", got)
+	}
+	reply := r.request(t, &in, &out, protocol.Message{Type: protocol.TypeFaults, ID: 7})
+	if reply.Type != protocol.TypeFaults|protocol.Reply || reply.ID != 7 {
+		t.Errorf("期待する返答は %v/7 、実際は %v/%d で異なる", protocol.TypeFaults|protocol.Reply, reply.Type, reply.ID)
+	}
+}
+
+// 一部のキーだけの設定を書き込んでも、他のキーは今の値のまま残る
+func TestProtocol_PartialConfig(t *testing.T) {
+	r := newTestRig(t)
+	var in, out bytes.Buffer
+	r.app.StartConsole(&in, &out)
+	before := r.app.Settings()
+
+	// バージョン、キー"control.target_rpm"と値2000だけ、CRC-32
+	key := "control.target_rpm"
+	blob := append([]byte{settings.Version, byte(len(key))}, key...)
+	blob = append(blob, 4)
+	blob = binary.LittleEndian.AppendUint32(blob, 2000)
+	blob = binary.LittleEndian.AppendUint32(blob, crc32.ChecksumIEEE(blob))
+
+	reply := r.request(t, &in, &out, protocol.Message{Type: protocol.TypeWriteConfig, ID: 1, Payload: protocol.WriteConfig{Settings: blob}.Append(nil)})
+	if reply.Type != protocol.TypeWriteConfig|protocol.Reply {
+		t.Fatalf("期待する返答は %v 、実際は %v で異なる", protocol.TypeWriteConfig|protocol.Reply, reply.Type)
+	}
+	after := r.app.Settings()
+	if after.TargetRPM != 2000 {
+		t.Errorf("期待する目標RPMは 2000 、実際は %d で異なる", after.TargetRPM)
+	}
+	if after.Brightness != before.Brightness || after.PotCurve.Shape != before.PotCurve.Shape || after.FrontProfile != before.FrontProfile {
+		t.Errorf("他の設定は残るはず、前は %+v 、後は %+v", before, after)
+	}
+}
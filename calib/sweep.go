@@ -0,0 +1,392 @@
+// Package calib characterizes a fan by sweeping its duty and measuring
+// the steady RPM at each step. It only needs a fan.Fan, a function that
+// sets the duty of that fan and a clock, so it runs the same against the
+// real hardware and the simulator.
+//
+// calibパッケージは、デューティをスイープして各ステップの定常RPMを計測し、
+// ファンの特性を測る。必要なのはfan.Fan、そのファンのデューティを設定する
+// 関数、クロックだけなので、実機でもシミュレーターでも同じように動く。
+package calib
+
+import (
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// Clock tells the time and waits. The fan being swept must use the same
+// clock.
+//
+// Clockは、時刻を知らせて待機する。スイープするファンも同じクロックを使う
+// こと。
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// Config holds the step count and settling rules of a sweep.
+//
+// Configは、スイープのステップ数と整定の判定方法を持つ。
+type Config struct {
+	// Number of duty steps between off and full duty.
+	// 停止から全デューティまでのデューティのステップ数
+	Steps int
+	// Measurement window of each RPM reading.
+	// 各RPM読み取りの計測時間
+	Window time.Duration
+	// Each step waits at least MinSettle before measuring, and gives up
+	// settling after MaxSettle.
+	// 各ステップは計測前に最低MinSettle待ち、MaxSettleを過ぎたら整定を諦め
+	// る。
+	MinSettle time.Duration
+	MaxSettle time.Duration
+	// The RPM has settled when consecutive readings differ by no more
+	// than TolerancePercent of the RPM, or TolerantRPM, whichever is
+	// larger.
+	// 連続した読み取りの差が、RPMのTolerancePercent(%)かTolerantRPMの大き
+	// い方以下なら整定したとみなす。
+	TolerancePercent uint32
+	TolerantRPM      uint32
+	// A rotor at or above RunningRPM counts as running.
+	// RunningRPM以上のローターは回っているとみなす。
+	RunningRPM uint32
+	// Longest wait for the rotor to coast to a stop before the sweep.
+	// スイープ前にローターが惰性で止まるのを待つ最長の時間
+	StopTimeout time.Duration
+	// A PPR check fails when the measured maximum RPM differs from
+	// Profile.MaxRPM by more than this percentage.
+	// 計測した最大RPMがProfile.MaxRPMとこの割合(%)より大きく違えば、PPRの
+	// 確認は失敗する。
+	PPRTolerancePercent uint32
+}
+
+// DefaultConfig returns a 16-step sweep with one-second readings.
+//
+// DefaultConfigは、1秒ごとに読み取る16ステップのスイープの設定を返す。
+func DefaultConfig() Config {
+	return Config{
+		Steps:               16,
+		Window:              1 * time.Second,
+		MinSettle:           1 * time.Second,
+		MaxSettle:           10 * time.Second,
+		TolerancePercent:    2,
+		TolerantRPM:         10,
+		RunningRPM:          100,
+		StopTimeout:         30 * time.Second,
+		PPRTolerancePercent: 30,
+	}
+}
+
+// MaxDuration returns the longest a sweep of one rotor can take: the wait
+// for it to stop, and each step of the way up and down taking MaxSettle
+// and one more reading.
+//
+// MaxDurationは、1つのローターのスイープにかかる最長の時間を返す。止まる
+// までの待ちと、上昇と下降の各ステップがMaxSettleと1回分の読み取りだけか
+// かった場合の合計。
+func (cfg Config) MaxDuration() time.Duration {
+	steps := max(cfg.Steps, 1)
+	settle := max(cfg.MinSettle, cfg.MaxSettle) + cfg.Window
+	return cfg.StopTimeout + time.Duration(2*steps)*settle
+}
+
+// Sweep characterizes f. It stops the rotor, steps the duty up to full
+// and back down through setDuty, and derives the start and sustain duties,
+// the maximum RPM and the PPR checks. The duty is left at 0. It blocks
+// for the whole sweep; Sweeper runs the same sweep from a control loop.
+//
+// Sweepは、fの特性を測る。ローターを止め、setDutyでデューティを全デュー
+// ティまで段階的に上げてから下げ、起動と維持のデューティ、最大RPM、PPRの
+// 確認結果を求める。デューティは0のまま残す。スイープの間はブロックする。
+// Sweeperは同じスイープを制御ループから実行する。
+func Sweep(f *fan.Fan, setDuty func(duty uint32), clock Clock, cfg Config) *fan.Characterization {
+	s := NewSweeper(f, cfg, clock.Now())
+	setDuty(s.Duty())
+	for !s.Done() {
+		clock.Sleep(s.Next().Sub(clock.Now()))
+		s.Update(clock.Now())
+		setDuty(s.Duty())
+	}
+	return s.Result()
+}
+
+// sweepPhase is the part of the sweep a Sweeper is in.
+type sweepPhase uint8
+
+const (
+	sweepStopping sweepPhase = iota
+	sweepUp
+	sweepDown
+	sweepDone
+)
+
+// Sweeper runs the sweep of Sweep one reading at a time, so the control
+// loop that calls Update keeps running in between: the readings take
+// minutes in all. The caller drives the fan at Duty after each Update.
+//
+// Sweeperは、Sweepのスイープを1回の読み取りずつ実行する。全体で数分かか
+// る読み取りの合間も、Updateを呼ぶ制御ループは動き続けられる。呼び出し側
+// はUpdateのたびにファンをDutyで駆動する。
+type Sweeper struct {
+	f       *fan.Fan
+	cfg     Config
+	profile fan.Profile
+	c       *fan.Characterization
+
+	phase sweepPhase
+	// The current step and its duty, and when the wait for the rotor to
+	// stop gives up.
+	// 現在のステップとそのデューティ、ローターが止まるのを待つのを諦める
+	// 時刻
+	step     int
+	duty     uint32
+	deadline time.Time
+
+	// The settling of the current step: when it began, when the next
+	// reading is due, the readings so far (-1 before the first one, which
+	// is dropped) and the run of readings within tolerance.
+	// 現在のステップの整定：始めた時刻、次の読み取りの時刻、これまでの読み
+	// 取りの数(捨てる最初の1回の前は-1)、許容範囲内で続いた読み取り
+	settleStart, next time.Time
+	readings          int
+	prev, sum         uint32
+	stable            int
+}
+
+// NewSweeper starts a sweep of f at now, with the duty at 0.
+//
+// NewSweeperは、デューティを0にしてnowにfのスイープを始める。
+func NewSweeper(f *fan.Fan, cfg Config, now time.Time) *Sweeper {
+	if cfg.Steps < 1 {
+		cfg.Steps = 1
+	}
+	profile := f.Profile()
+	s := &Sweeper{
+		f:       f,
+		cfg:     cfg,
+		profile: profile,
+		c: &fan.Characterization{
+			Points: make([]fan.SweepPoint, 0, cfg.Steps+1),
+			PPR:    profile.PulsesPerRevolution,
+		},
+		// A rotor still coasting, or windmilling in the airflow of its
+		// neighbour, would keep running at any duty, so wait for it to
+		// stop.
+		// 惰性で回っていたり、隣の風で空転していたりするローターはどの
+		// デューティでも回り続けてしまうので、止まるのを待つ。
+		deadline: now.Add(cfg.StopTimeout),
+	}
+	s.startSettle(now)
+	return s
+}
+
+// Duty returns the duty to drive the fan at.
+//
+// Dutyは、ファンを駆動するデューティを返す。
+func (s *Sweeper) Duty() uint32 {
+	return s.duty
+}
+
+// Next returns when Update has work to do next.
+//
+// Nextは、Updateが次にすることのある時刻を返す。
+func (s *Sweeper) Next() time.Time {
+	return s.next
+}
+
+// Done reports whether the sweep has finished.
+//
+// Doneは、スイープが終わったかどうかを返す。
+func (s *Sweeper) Done() bool {
+	return s.phase == sweepDone
+}
+
+// Result returns the characterization once Done.
+//
+// Resultは、Doneになった後で特性を返す。
+func (s *Sweeper) Result() *fan.Characterization {
+	return s.c
+}
+
+// Driven reports whether the rotor is expected to run at the current
+// duty: on the way up once it has started. Elsewhere it may stop as part
+// of the sweep, so a stall there is no fault.
+//
+// Drivenは、現在のデューティでローターが回っているはずかどうかを返す。上
+// 昇中に一度回り出した後がそれにあたる。それ以外ではスイープの一部として
+// 止まることがあるので、停止は異常ではない。
+func (s *Sweeper) Driven() bool {
+	return s.phase == sweepUp && s.c.MinStartDuty != 0
+}
+
+// Update takes the reading due at now, if any, and moves on to the next
+// step once the RPM has settled.
+//
+// Updateは、nowに予定の読み取りがあればそれを行い、RPMが整定したら次の
+// ステップに進む。
+func (s *Sweeper) Update(now time.Time) {
+	if s.phase == sweepDone || now.Before(s.next) {
+		return
+	}
+	s.next = now.Add(s.cfg.Window)
+	rpm := s.f.CalculateRPM()
+	if s.readings < 0 {
+		// Drop the pulses counted while the duty changed.
+		// デューティが変わる間に数えたパルスは捨てる。
+		s.readings = 0
+		return
+	}
+
+	// The settled RPM is the average of the settled readings, which is
+	// finer than the count resolution of one.
+	// 整定したRPMは整定した読み取りの平均で、1回の読み取りのカウント分解
+	// 能より細かい。
+	if s.readings > 0 && within(rpm, s.prev, s.cfg) {
+		if s.stable == 0 {
+			s.sum = s.prev
+		}
+		s.stable++
+		s.sum += rpm
+		if s.stable >= 2 {
+			s.settled(now, (s.sum+1)/3)
+			return
+		}
+	} else {
+		s.stable = 0
+	}
+	s.readings++
+	s.prev = rpm
+	if now.Sub(s.settleStart) >= s.cfg.MaxSettle {
+		s.settled(now, rpm)
+	}
+}
+
+// startSettle waits for the RPM at the current duty to settle.
+func (s *Sweeper) startSettle(now time.Time) {
+	s.settleStart = now
+	s.next = now.Add(s.cfg.MinSettle)
+	s.readings = -1
+	s.stable = 0
+}
+
+// settled records the settled rpm of the current step and moves on.
+//
+// settledは、現在のステップの整定したrpmを記録して先に進む。
+func (s *Sweeper) settled(now time.Time, rpm uint32) {
+	c, cfg := s.c, s.cfg
+	switch s.phase {
+	case sweepStopping:
+		if rpm >= cfg.RunningRPM && now.Before(s.deadline) {
+			s.startSettle(now)
+			return
+		}
+		c.Points = append(c.Points, fan.SweepPoint{Duty: 0, RPM: rpm})
+		s.phase = sweepUp
+		s.step = 1
+
+	case sweepUp:
+		// Up from rest: the first running step is the start duty.
+		// 停止から上昇：最初に回ったステップが起動デューティ。
+		c.Points = append(c.Points, fan.SweepPoint{Duty: s.duty, RPM: rpm})
+		if c.MinStartDuty == 0 && rpm >= cfg.RunningRPM {
+			c.MinStartDuty = s.duty
+		}
+		if s.step < cfg.Steps {
+			s.step++
+			break
+		}
+		c.MaxRPM = rpm
+		if c.MinStartDuty == 0 {
+			s.finish()
+			return
+		}
+		// Down from full: the last running step is the sustain duty.
+		// 全デューティから下降：最後に回っていたステップが維持デューティ。
+		c.MinSustainDuty = c.MinStartDuty
+		s.phase = sweepDown
+		s.step = cfg.Steps - 1
+
+	case sweepDown:
+		if rpm < cfg.RunningRPM {
+			s.finish()
+			return
+		}
+		if s.duty < c.MinSustainDuty {
+			c.MinSustainDuty = s.duty
+		}
+		s.step--
+	}
+
+	if s.step < 1 {
+		s.finish()
+		return
+	}
+	s.duty = stepDuty(s.step, cfg.Steps)
+	s.startSettle(now)
+}
+
+// finish leaves the duty at 0 and sets the checks.
+//
+// finishは、デューティを0にして確認結果を設定する。
+func (s *Sweeper) finish() {
+	s.phase = sweepDone
+	s.duty = 0
+	check(s.c, s.profile, s.cfg)
+}
+
+// stepDuty returns the duty of step i out of steps.
+func stepDuty(i, steps int) uint32 {
+	return uint32(uint64(fan.MaxDuty) * uint64(i) / uint64(steps))
+}
+
+// within reports whether a and b are within the settling tolerance.
+func within(a, b uint32, cfg Config) bool {
+	diff := a - b
+	if b > a {
+		diff = b - a
+	}
+	tol := a * cfg.TolerancePercent / 100
+	if tol < cfg.TolerantRPM {
+		tol = cfg.TolerantRPM
+	}
+	return diff <= tol
+}
+
+// check sets the checks of c.
+//
+// checkは、cの確認結果を設定する。
+func check(c *fan.Characterization, profile fan.Profile, cfg Config) {
+	if c.MaxRPM < cfg.RunningRPM {
+		c.Checks |= fan.CheckNoTach
+		return
+	}
+
+	for i := 1; i < len(c.Points); i++ {
+		prev, p := c.Points[i-1].RPM, c.Points[i].RPM
+		if prev >= cfg.RunningRPM && p < prev && !within(p, prev, cfg) {
+			c.Checks |= fan.CheckNotMonotonic
+		}
+	}
+
+	if profile.MaxRPM == 0 {
+		return
+	}
+	// A wrong PPR scales every reading by configured/actual, so the
+	// maximum RPM tells the actual PPR.
+	// PPRが違うとすべての読み取りが設定値/実際の値の倍率でずれるので、最大
+	// RPMから実際のPPRがわかる。
+	ratio := float32(c.MaxRPM) / float32(profile.MaxRPM)
+	tol := float32(cfg.PPRTolerancePercent) / 100
+	switch {
+	case ratio > 1+tol:
+		c.Checks |= fan.CheckPPRTooLow
+	case ratio < 1-tol:
+		c.Checks |= fan.CheckPPRTooHigh
+	default:
+		return
+	}
+	c.SuggestedPPR = uint32(float32(c.PPR)*ratio + 0.5)
+	if c.SuggestedPPR == 0 {
+		c.SuggestedPPR = 1
+	}
+}
@@ -0,0 +1,163 @@
+package calib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/sim"
+)
+
+// Note: tinygo test ./calib
+
+// シミュレーションしたローターをスイープする
+func sweepRotor(t *testing.T, rotorPPR uint32, profile fan.Profile) *fan.Characterization {
+	t.Helper()
+	clock := sim.NewClock()
+	cfg := sim.DefaultRotorConfig()
+	cfg.PulsesPerRevolution = rotorPPR
+	rotor := sim.NewRotor(clock, cfg, 1)
+
+	f := fan.NewFanWithProfile("Sim", rotor, profile)
+	f.SetClock(clock)
+	return Sweep(f, rotor.SetDuty, clock, DefaultConfig())
+}
+
+func TestSweep(t *testing.T) {
+	testCases := []struct {
+		name         string
+		rotorPPR     uint32
+		checks       fan.Check
+		suggestedPPR uint32
+		maxRPM       uint32
+	}{
+		{name: "PPRが正しい", rotorPPR: 2, checks: fan.CheckNone, maxRPM: 3000},
+		{name: "実際のPPRが多い", rotorPPR: 4, checks: fan.CheckPPRTooLow, suggestedPPR: 4, maxRPM: 6000},
+		{name: "実際のPPRが少ない", rotorPPR: 1, checks: fan.CheckPPRTooHigh, suggestedPPR: 1, maxRPM: 1500},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := sweepRotor(t, tc.rotorPPR, fan.Profile{PulsesPerRevolution: 2, MaxRPM: 3000})
+
+			if len(c.Points) != 17 {
+				t.Fatalf("期待する点数は 17 、実際は %d で異なる", len(c.Points))
+			}
+			// シミュレーターは25%で起動し、12.5%まで回り続ける
+			if c.MinStartDuty != 10000 {
+				t.Errorf("期待する起動デューティは 10000 、実際は %d で異なる", c.MinStartDuty)
+			}
+			if c.MinSustainDuty != 5000 {
+				t.Errorf("期待する維持デューティは 5000 、実際は %d で異なる", c.MinSustainDuty)
+			}
+			if c.MaxRPM < tc.maxRPM*98/100 || c.MaxRPM > tc.maxRPM*102/100 {
+				t.Errorf("期待する最大RPMは %d 付近、実際は %d で異なる", tc.maxRPM, c.MaxRPM)
+			}
+			if c.Checks != tc.checks {
+				t.Errorf("期待する確認結果は %v 、実際は %v で異なる", tc.checks, c.Checks)
+			}
+			if c.SuggestedPPR != tc.suggestedPPR {
+				t.Errorf("期待する推定PPRは %d 、実際は %d で異なる", tc.suggestedPPR, c.SuggestedPPR)
+			}
+		})
+	}
+}
+
+// 上昇中の各点はデューティに比例したRPMになる
+func TestSweep_Points(t *testing.T) {
+	c := sweepRotor(t, 2, fan.DefaultProfile)
+	for _, p := range c.Points {
+		expected := uint32(0)
+		if p.Duty >= 10000 {
+			expected = p.Duty * 3000 / fan.MaxDuty
+		}
+		if p.RPM+30 < expected || p.RPM > expected+30 {
+			t.Errorf("デューティ %d で期待するRPMは %d 付近、実際は %d で異なる", p.Duty, expected, p.RPM)
+		}
+	}
+}
+
+// 何も数えないカウンター
+type deadCounter struct{}
+
+func (deadCounter) ReadAndReset() uint32 { return 0 }
+
+// タコ信号が無ければ起動も維持もわからない
+func TestSweep_NoTach(t *testing.T) {
+	clock := sim.NewClock()
+	f := fan.NewFan("Dead", deadCounter{})
+	f.SetClock(clock)
+	var last uint32 = 1
+	c := Sweep(f, func(duty uint32) { last = duty }, clock, DefaultConfig())
+
+	if c.Checks != fan.CheckNoTach {
+		t.Errorf("期待する確認結果は %v 、実際は %v で異なる", fan.CheckNoTach, c.Checks)
+	}
+	if c.MinStartDuty != 0 || c.MinSustainDuty != 0 || c.MaxRPM != 0 {
+		t.Errorf("期待する結果は 0/0/0 、実際は %d/%d/%d で異なる", c.MinStartDuty, c.MinSustainDuty, c.MaxRPM)
+	}
+	if last != 0 {
+		t.Errorf("スイープ後の期待するデューティは 0 、実際は %d で異なる", last)
+	}
+}
+
+// 制御ループの周期ごとに進めても、Sweepと同じ結果になり、最長時間内に終わる
+func TestSweeper(t *testing.T) {
+	clock := sim.NewClock()
+	rotor := sim.NewRotor(clock, sim.DefaultRotorConfig(), 1)
+	f := fan.NewFan("Sim", rotor)
+	f.SetClock(clock)
+	cfg := DefaultConfig()
+
+	s := NewSweeper(f, cfg, clock.Now())
+	for !s.Done() && clock.Elapsed() < cfg.MaxDuration() {
+		rotor.SetDuty(s.Duty())
+		clock.Advance(10 * time.Millisecond)
+		s.Update(clock.Now())
+	}
+	if !s.Done() {
+		t.Fatalf("%v 以内に終わるはず", cfg.MaxDuration())
+	}
+	if c := s.Result(); c.MinStartDuty != 10000 || c.MinSustainDuty != 5000 || c.Checks != fan.CheckNone {
+		t.Errorf("期待する結果は 10000/5000/none 、実際は %d/%d/%v で異なる", c.MinStartDuty, c.MinSustainDuty, c.Checks)
+	}
+	if s.Duty() != 0 || s.Driven() {
+		t.Errorf("スイープ後の期待するデューティは 0 、実際は %d で異なる", s.Duty())
+	}
+}
+
+// 最長時間は、停止の待ちと各ステップの整定の上限の合計
+func TestConfig_MaxDuration(t *testing.T) {
+	// 30s + 32ステップ × (10s + 1s)
+	if got := DefaultConfig().MaxDuration(); got != 382*time.Second {
+		t.Errorf("期待する最長時間は 6m22s 、実際は %v で異なる", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	testCases := []struct {
+		name     string
+		points   []uint32
+		expected fan.Check
+	}{
+		{name: "単調増加", points: []uint32{0, 0, 800, 1500, 3000}, expected: fan.CheckNone},
+		{name: "停止中の揺れは無視", points: []uint32{40, 0, 800, 1500, 3000}, expected: fan.CheckNone},
+		{name: "許容範囲内の減少", points: []uint32{0, 0, 800, 1500, 1480, 3000}, expected: fan.CheckNone},
+		{name: "途中で減少", points: []uint32{0, 0, 800, 1500, 1200, 3000}, expected: fan.CheckNotMonotonic},
+		{name: "回らない", points: []uint32{0, 0, 0, 0, 50}, expected: fan.CheckNoTach},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &fan.Characterization{PPR: 2}
+			for i, rpm := range tc.points {
+				c.Points = append(c.Points, fan.SweepPoint{Duty: uint32(i) * 1000, RPM: rpm})
+			}
+			c.MaxRPM = tc.points[len(tc.points)-1]
+			check(c, fan.DefaultProfile, DefaultConfig())
+			if c.Checks != tc.expected {
+				t.Errorf("期待する確認結果は %v 、実際は %v で異なる", tc.expected, c.Checks)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/protocol"
+)
+
+// errTimeout is returned when the controller does not reply in time.
+//
+// errTimeoutは、コントローラーが時間内に返答しないときに返す。
+var errTimeout = errors.New("no reply from the controller")
+
+// client sends protocol requests to the controller and waits for the
+// matching replies. Text from the controller, such as console replies and
+// telemetry, is ignored.
+//
+// clientは、コントローラーにプロトコルのリクエストを送り、対応する返答を
+// 待つ。コンソールの返答やテレメトリーなど、コントローラーからのテキスト
+// は無視する。
+type client struct {
+	conn    io.ReadWriteCloser
+	timeout time.Duration
+	id      uint8
+	replies chan protocol.Message
+	// Closed with the read error once the connection fails.
+	// 接続が失敗したら、読み込みのエラーと共に閉じる。
+	done chan struct{}
+	err  error
+}
+
+// newClient starts reading replies from conn.
+//
+// newClientは、connからの返答の読み込みを始める。
+func newClient(conn io.ReadWriteCloser, timeout time.Duration) *client {
+	c := &client{
+		conn:    conn,
+		timeout: timeout,
+		replies: make(chan protocol.Message, 8),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+func (c *client) read() {
+	d := protocol.NewDemux(nil, func(m protocol.Message) {
+		if m.Type&protocol.Reply == 0 {
+			return
+		}
+		m.Payload = append([]byte(nil), m.Payload...)
+		select {
+		case c.replies <- m:
+		default:
+			// Nobody is waiting for it.
+			// 誰も待っていない。
+		}
+	})
+	buf := make([]byte, 256)
+	for {
+		n, err := c.conn.Read(buf)
+		d.Feed(buf[:n])
+		if err != nil {
+			c.err = err
+			close(c.done)
+			return
+		}
+	}
+}
+
+// Close closes the connection.
+//
+// Closeは、接続を閉じる。
+func (c *client) Close() error {
+	return c.conn.Close()
+}
+
+// call sends a request and returns the payload of its reply. An error
+// reply is returned as a *protocol.ErrorReply.
+//
+// callは、リクエストを送り、その返答のペイロードを返す。エラーの返答は
+// *protocol.ErrorReplyとして返す。
+func (c *client) call(typ protocol.Type, payload []byte) ([]byte, error) {
+	return c.callTimeout(typ, payload, c.timeout)
+}
+
+// callTimeout is call with its own timeout, for slow requests.
+//
+// callTimeoutは、時間のかかるリクエストのための、独自のタイムアウトを持つ
+// call。
+func (c *client) callTimeout(typ protocol.Type, payload []byte, timeout time.Duration) ([]byte, error) {
+	c.id++
+	m := protocol.Message{Type: typ, ID: c.id, Payload: payload}
+	frame, err := protocol.AppendFrame(nil, m)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		select {
+		case r := <-c.replies:
+			// Skip late replies to earlier requests.
+			// 前のリクエストへの遅れた返答は飛ばす。
+			if r.ID != m.ID {
+				continue
+			}
+			if r.Type == protocol.TypeError|protocol.Reply {
+				e, err := protocol.ParseErrorReply(r.Payload)
+				if err != nil {
+					return nil, err
+				}
+				return nil, e
+			}
+			if r.Type != typ|protocol.Reply {
+				return nil, protocol.ErrBadPayload
+			}
+			return r.Payload, nil
+		case <-c.done:
+			return nil, c.err
+		case <-deadline.C:
+			return nil, errTimeout
+		}
+	}
+}
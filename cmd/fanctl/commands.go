@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/calib"
+	"github.com/kou-tkbys/tk-fancon2/console"
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/protocol"
+	"github.com/kou-tkbys/tk-fancon2/settings"
+	"github.com/kou-tkbys/tk-fancon2/telemetry"
+)
+
+// version asks for the protocol versions and the name of the fan unit.
+//
+// versionは、プロトコルのバージョンとファンユニットの名前を問い合わせる。
+func (c *cli) version() (protocol.VersionInfo, error) {
+	p, err := c.client.call(protocol.TypeVersion, nil)
+	if err != nil {
+		return protocol.VersionInfo{}, err
+	}
+	v, err := protocol.ParseVersionInfo(p)
+	if err == nil && v.Protocol != protocol.Version {
+		err = fmt.Errorf("controller speaks protocol %d, not %d", v.Protocol, protocol.Version)
+	}
+	return v, err
+}
+
+// record asks for a telemetry record with the given fields.
+//
+// recordは、指定したフィールドのテレメトリーのレコードを問い合わせる。
+func (c *cli) record(fields telemetry.Field) (telemetry.Record, error) {
+	p, err := c.client.call(protocol.TypeTelemetry, protocol.TelemetryRequest{Fields: fields}.Append(nil))
+	if err != nil {
+		return telemetry.Record{}, err
+	}
+	r, _, err := protocol.ParseTelemetry(p)
+	return r, err
+}
+
+// readConfig asks for the settings.
+//
+// readConfigは、設定を問い合わせる。
+func (c *cli) readConfig() (settings.Settings, error) {
+	var s settings.Settings
+	p, err := c.client.call(protocol.TypeReadConfig, nil)
+	if err != nil {
+		return s, err
+	}
+	return s, s.Unmarshal(p)
+}
+
+func cmdStatus(c *cli, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	v, err := c.version()
+	if err != nil {
+		return err
+	}
+	r, err := c.record(telemetry.FieldAll)
+	if err != nil {
+		return err
+	}
+	s, err := c.readConfig()
+	if err != nil {
+		return err
+	}
+
+	mode := r.Mode.String()
+	if r.Mode == control.ModeClosedLoop {
+		mode += fmt.Sprintf(", target %d rpm", s.TargetRPM)
+	}
+	w := tabwriter.NewWriter(c.stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "controller\t%s\n", v.Name)
+	fmt.Fprintf(w, "versions\tprotocol %d, settings %d\n", v.Protocol, v.Settings)
+	fmt.Fprintf(w, "uptime\t%v\n", r.Time.Truncate(time.Second))
+	fmt.Fprintf(w, "mode\t%s\n", mode)
+	fmt.Fprintf(w, "\tfront\trear\n")
+	fmt.Fprintf(w, "rpm\t%d\t%d\n", r.FrontRPM, r.RearRPM)
+	fmt.Fprintf(w, "duty\t%s\t%s\n", percent(r.FrontDuty), percent(r.RearDuty))
+	fmt.Fprintf(w, "fault\t%v\t%v\n", r.FrontFault, r.RearFault)
+	return w.Flush()
+}
+
+// percent formats a duty as a percentage of fan.MaxDuty.
+//
+// percentは、デューティをfan.MaxDutyに対する百分率で書式化する。
+func percent(duty uint32) string {
+	return fmt.Sprintf("%.1f%%", float64(duty)*100/fan.MaxDuty)
+}
+
+// poll calls sample count times, or forever if count is 0, interval
+// apart.
+//
+// pollは、sampleをinterval間隔でcount回、countが0なら際限なく呼ぶ。
+func poll(interval time.Duration, count int, sample func() error) error {
+	if interval <= 0 {
+		return errUsage
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for i := 0; count == 0 || i < count; i++ {
+		if i > 0 {
+			<-tick.C
+		}
+		if err := sample(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchHeaderEvery is the number of rows of watch between headers.
+//
+// watchHeaderEveryは、watchでヘッダーを挟む行数。
+const watchHeaderEvery = 20
+
+func cmdWatch(c *cli, args []string) error {
+	fs := c.flags("watch")
+	interval := fs.Duration("interval", time.Second, "time between rows")
+	count := fs.Int("n", 0, "number of rows; 0 runs until interrupted")
+	if err := parse(fs, args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+
+	const row = "%8s  %9s  %9s  %10s  %10s  %s\n"
+	fields := telemetry.FieldTime | telemetry.FieldFrontRPM | telemetry.FieldRearRPM |
+		telemetry.FieldFrontDuty | telemetry.FieldRearDuty | telemetry.FieldFrontFault | telemetry.FieldRearFault
+	n := 0
+	return poll(*interval, *count, func() error {
+		r, err := c.record(fields)
+		if err != nil {
+			return err
+		}
+		if n%watchHeaderEvery == 0 {
+			fmt.Fprintf(c.stdout, row, "time", "front rpm", "rear rpm", "front duty", "rear duty", "faults")
+		}
+		n++
+		_, err = fmt.Fprintf(c.stdout, row,
+			r.Time.Truncate(100*time.Millisecond), fmt.Sprint(r.FrontRPM), fmt.Sprint(r.RearRPM),
+			percent(r.FrontDuty), percent(r.RearDuty), fmt.Sprintf("%v/%v", r.FrontFault, r.RearFault))
+		return err
+	})
+}
+
+func cmdSet(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "duty":
+		if len(args) != 2 && len(args) != 3 {
+			return errUsage
+		}
+		front, err := console.ParseDuty(args[1])
+		if err != nil {
+			return err
+		}
+		rear := front
+		if len(args) == 3 {
+			if rear, err = console.ParseDuty(args[2]); err != nil {
+				return err
+			}
+		}
+		_, err = c.client.call(protocol.TypeSetDuty, protocol.Duty{Front: front, Rear: rear}.Append(nil))
+		return err
+	case "mode":
+		s := protocol.ModeSetting{Mode: control.ModeOpenLoop}
+		switch {
+		case len(args) == 2 && args[1] == "open":
+		case len(args) == 3 && args[1] == "pid":
+			rpm, err := console.ParseUint(args[2], 65535)
+			if err != nil {
+				return err
+			}
+			s = protocol.ModeSetting{Mode: control.ModeClosedLoop, TargetRPM: rpm}
+		default:
+			return errUsage
+		}
+		_, err := c.client.call(protocol.TypeSetMode, s.Append(nil))
+		return err
+	default:
+		return errUsage
+	}
+}
+
+func cmdConfig(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	fs := c.flags("config " + args[0])
+	format := fs.String("format", "", "yaml or json; load guesses from the file name")
+	switch args[0] {
+	case "dump":
+		if err := parse(fs, args[1:]); err != nil || fs.NArg() != 0 {
+			return errUsage
+		}
+		return c.configDump(*format)
+	case "load":
+		nosave := fs.Bool("nosave", false, "apply the settings without saving them")
+		if err := parse(fs, args[1:]); err != nil || fs.NArg() != 1 {
+			return errUsage
+		}
+		name := fs.Arg(0)
+		if *format == "" {
+			*format = "yaml"
+			if strings.EqualFold(filepath.Ext(name), ".json") {
+				*format = "json"
+			}
+		}
+		return c.configLoad(name, *format, !*nosave)
+	default:
+		return errUsage
+	}
+}
+
+func (c *cli) configDump(format string) error {
+	s, err := c.readConfig()
+	if err != nil {
+		return err
+	}
+	doc := newConfigDoc(s)
+	var data []byte
+	switch format {
+	case "", "yaml":
+		data, err = marshalYAML(doc)
+	case "json":
+		data, err = json.MarshalIndent(doc, "", "  ")
+		data = append(data, '\n')
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = c.stdout.Write(data)
+	return err
+}
+
+// configLoad puts the settings in file name into effect. Keys missing from
+// the file keep the controller's current values.
+//
+// configLoadは、ファイルnameの設定を反映する。ファイルに無いキーはコント
+// ローラーの現在の値のままにする。
+func (c *cli) configLoad(name, format string, save bool) error {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(c.stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	s, err := c.readConfig()
+	if err != nil {
+		return err
+	}
+	doc := newConfigDoc(s)
+	switch format {
+	case "yaml":
+		err = unmarshalYAML(data, &doc)
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&doc)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := doc.apply(&s); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	encoded, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+	req := protocol.WriteConfig{Settings: encoded}
+	if save {
+		req.Flags |= protocol.ConfigSave
+	}
+	_, err = c.client.call(protocol.TypeWriteConfig, req.Append(nil))
+	return err
+}
+
+func cmdCalibrate(c *cli, args []string) error {
+	fs := c.flags("calibrate")
+	// Both rotors at their longest sweep with the default settings, and a
+	// margin.
+	// 既定の設定で両方のローターが最も長くスイープした時間と、その余裕
+	timeout := fs.Duration("timeout", 2*calib.DefaultConfig().MaxDuration()+time.Minute, "time to wait for the sweep")
+	if err := parse(fs, args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	v, err := c.version()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.stderr, "calibrating; this takes a few minutes")
+	if _, err := c.client.callTimeout(protocol.TypeCalibrate, nil, *timeout); err != nil {
+		return err
+	}
+	s, err := c.readConfig()
+	if err != nil {
+		return err
+	}
+	if s.FrontCalibration == nil && s.RearCalibration == nil {
+		return errors.New("the controller kept no results")
+	}
+	return fan.WriteCharacterizationCSV(c.stdout,
+		[]string{v.Name + "-F", v.Name + "-R"},
+		[]*fan.Characterization{s.FrontCalibration, s.RearCalibration})
+}
+
+func cmdLog(c *cli, args []string) error {
+	fs := c.flags("log")
+	csv := fs.Bool("csv", false, "write CSV instead of JSON lines")
+	list := fs.String("fields", "all", "comma-separated telemetry fields")
+	interval := fs.Duration("interval", time.Second, "time between records")
+	count := fs.Int("n", 0, "number of records; 0 runs until interrupted")
+	if err := parse(fs, args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	fields, ok := telemetry.ParseFields(*list)
+	if !ok || fields == 0 {
+		return fmt.Errorf("unknown fields %q", *list)
+	}
+
+	cfg := telemetry.Config{Format: telemetry.FormatJSON, Fields: fields}
+	if *csv {
+		cfg.Format = telemetry.FormatCSV
+	}
+	s := telemetry.NewStream(c.stdout, cfg)
+	return poll(*interval, *count, func() error {
+		r, err := c.record(fields)
+		if err != nil {
+			return err
+		}
+		return s.Write(r)
+	})
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/curve"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/settings"
+)
+
+// configDoc is the editable part of the settings as written by
+// "config dump" and read by "config load". The calibrations are left out;
+// they come from the controller's own sweeps.
+//
+// configDocは、"config dump"が書き"config load"が読む、設定の編集できる部
+// 分。特性測定の結果は含めない。コントローラー自身のスイープで得るもの。
+type configDoc struct {
+	Curve      curveDoc   `json:"curve"`
+	Front      profileDoc `json:"front"`
+	Rear       profileDoc `json:"rear"`
+	Brightness uint8      `json:"brightness"`
+	// Mode is "open" or "closed", as control.Mode.String.
+	// Modeは、control.Mode.Stringと同じく"open"か"closed"。
+	Mode      string `json:"mode"`
+	TargetRPM uint32 `json:"target_rpm"`
+}
+
+type curveDoc struct {
+	// Shape is a name returned by curve.Shape.String.
+	// Shapeは、curve.Shape.Stringが返す名前。
+	Shape      string     `json:"shape"`
+	K          float32    `json:"k"`
+	Table      []pointDoc `json:"table"`
+	Deadzone   uint16     `json:"deadzone"`
+	Rescale    bool       `json:"rescale"`
+	Saturation uint16     `json:"saturation"`
+	OutMin     uint32     `json:"out_min"`
+	OutMax     uint32     `json:"out_max"`
+}
+
+type pointDoc struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+}
+
+type profileDoc struct {
+	PPR          uint32 `json:"ppr"`
+	MaxRPM       uint32 `json:"max_rpm"`
+	MinStartDuty uint32 `json:"min_start_duty"`
+	StallRPM     uint32 `json:"stall_rpm"`
+}
+
+// newConfigDoc returns the document of s.
+//
+// newConfigDocは、sの文書を返す。
+func newConfigDoc(s settings.Settings) configDoc {
+	c := s.PotCurve
+	d := configDoc{
+		Curve: curveDoc{
+			Shape:      c.Shape.String(),
+			K:          c.K,
+			Table:      make([]pointDoc, len(c.Table)),
+			Deadzone:   c.Deadzone,
+			Rescale:    c.Rescale,
+			Saturation: c.SaturationZone,
+			OutMin:     c.OutMin,
+			OutMax:     c.OutMax,
+		},
+		Front:      newProfileDoc(s.FrontProfile),
+		Rear:       newProfileDoc(s.RearProfile),
+		Brightness: s.Brightness,
+		Mode:       s.Mode.String(),
+		TargetRPM:  s.TargetRPM,
+	}
+	for i, p := range c.Table {
+		d.Curve.Table[i] = pointDoc{X: p.X, Y: p.Y}
+	}
+	return d
+}
+
+func newProfileDoc(p fan.Profile) profileDoc {
+	return profileDoc{PPR: p.PulsesPerRevolution, MaxRPM: p.MaxRPM, MinStartDuty: p.MinStartDuty, StallRPM: p.StallRPM}
+}
+
+// apply checks d and copies it into s, leaving the calibrations alone.
+//
+// applyは、dを検査してsに写す。特性測定の結果はそのままにする。
+func (d *configDoc) apply(s *settings.Settings) error {
+	shape, ok := curve.ParseShape(d.Curve.Shape)
+	if !ok {
+		return fmt.Errorf("unknown curve shape %q", d.Curve.Shape)
+	}
+	table := make([]curve.Point, len(d.Curve.Table))
+	for i, p := range d.Curve.Table {
+		table[i] = curve.Point{X: p.X, Y: p.Y}
+	}
+	if !sort.SliceIsSorted(table, func(i, j int) bool { return table[i].X < table[j].X }) {
+		return errors.New("curve table is not sorted by x")
+	}
+	if d.Curve.OutMin > fan.MaxDuty || d.Curve.OutMax > fan.MaxDuty {
+		return fmt.Errorf("curve output is above %d", fan.MaxDuty)
+	}
+	for _, p := range []profileDoc{d.Front, d.Rear} {
+		if p.PPR < 1 || p.PPR > 255 {
+			return fmt.Errorf("invalid ppr %d", p.PPR)
+		}
+		if p.MinStartDuty > fan.MaxDuty {
+			return fmt.Errorf("min_start_duty is above %d", fan.MaxDuty)
+		}
+	}
+	if d.Brightness > 15 {
+		return fmt.Errorf("invalid brightness %d", d.Brightness)
+	}
+	mode, ok := parseMode(d.Mode)
+	if !ok {
+		return fmt.Errorf("unknown mode %q", d.Mode)
+	}
+	if d.TargetRPM > 65535 {
+		return fmt.Errorf("invalid target_rpm %d", d.TargetRPM)
+	}
+
+	s.PotCurve = curve.Curve{
+		Shape:          shape,
+		K:              d.Curve.K,
+		Table:          table,
+		Deadzone:       d.Curve.Deadzone,
+		Rescale:        d.Curve.Rescale,
+		SaturationZone: d.Curve.Saturation,
+		OutMin:         d.Curve.OutMin,
+		OutMax:         d.Curve.OutMax,
+	}
+	s.FrontProfile = d.Front.profile()
+	s.RearProfile = d.Rear.profile()
+	s.Brightness = d.Brightness
+	s.Mode = mode
+	s.TargetRPM = d.TargetRPM
+	return nil
+}
+
+func (p profileDoc) profile() fan.Profile {
+	return fan.Profile{PulsesPerRevolution: p.PPR, MaxRPM: p.MaxRPM, MinStartDuty: p.MinStartDuty, StallRPM: p.StallRPM}
+}
+
+// parseMode returns the mode with the given name, as returned by
+// control.Mode.String.
+//
+// parseModeは、control.Mode.Stringが返す名前に対応するモードを返す。
+func parseMode(name string) (control.Mode, bool) {
+	for _, m := range []control.Mode{control.ModeOpenLoop, control.ModeClosedLoop} {
+		if m.String() == name {
+			return m, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,165 @@
+// Fanctl controls the fan controller from a Linux host over its serial
+// port, using the binary host protocol.
+//
+// Usage:
+//
+//	fanctl [-port path] [-baud rate] [-timeout d] <command> [args]
+//
+// The port defaults to $FANCTL_PORT, or /dev/ttyACM0. Run fanctl without a
+// command for the list of commands.
+//
+// fanctlは、Linuxのホストからシリアルポート越しに、バイナリのホストプロ
+// トコルでファンコントローラーを操作する。ポートのデフォルトは
+// $FANCTL_PORT、無ければ/dev/ttyACM0。コマンド無しで実行するとコマンドの
+// 一覧を表示する。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultPort is used when neither -port nor $FANCTL_PORT is given.
+//
+// defaultPortは、-portも$FANCTL_PORTも無いときに使う。
+const defaultPort = "/dev/ttyACM0"
+
+// dialFunc opens the connection to the controller.
+//
+// dialFuncは、コントローラーへの接続を開く。
+type dialFunc func(port string, baud int) (io.ReadWriteCloser, error)
+
+// cli is the environment of a command.
+//
+// cliは、コマンドの実行環境。
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	client         *client
+}
+
+// command is one subcommand of fanctl.
+//
+// commandは、fanctlのサブコマンドの1つ。
+type command struct {
+	name, args, help string
+	run              func(c *cli, args []string) error
+}
+
+var commands = []command{
+	{"status", "", "show the controller state", cmdStatus},
+	{"watch", "[-interval d] [-n count]", "show a live RPM table", cmdWatch},
+	{"set", "duty <front> [<rear>] | mode open|pid <rpm>", "set fixed duties (raw or n%) or the control mode", cmdSet},
+	{"config", "dump [-format yaml|json] | load [-format yaml|json] [-nosave] <file|->", "dump or load the settings", cmdConfig},
+	{"calibrate", "[-timeout d]", "run the characterization sweep and print it as CSV", cmdCalibrate},
+	{"log", "[-csv] [-fields list] [-interval d] [-n count]", "log telemetry records as JSON lines or CSV", cmdLog},
+}
+
+// errUsage is returned by a command given bad arguments.
+//
+// errUsageは、誤った引数を与えられたコマンドが返す。
+var errUsage = errors.New("usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, dialSerial))
+}
+
+func dialSerial(port string, baud int) (io.ReadWriteCloser, error) {
+	return openSerial(port, baud)
+}
+
+// run runs fanctl with args and returns the exit status: 0 on success, 1
+// on failure and 2 on bad usage.
+//
+// runは、argsでfanctlを実行し、終了ステータスを返す。成功なら0、失敗なら
+// 1、使い方の誤りなら2。
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, dial dialFunc) int {
+	fs := flag.NewFlagSet("fanctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	port := fs.String("port", os.Getenv("FANCTL_PORT"), "serial port of the controller (default $FANCTL_PORT or "+defaultPort+")")
+	baud := fs.Int("baud", 115200, "baud rate")
+	timeout := fs.Duration("timeout", 2*time.Second, "time to wait for each reply")
+	fs.Usage = func() { usage(stderr, fs) }
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == fs.Arg(0) {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "fanctl: unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		return 2
+	}
+	if *port == "" {
+		*port = defaultPort
+	}
+
+	conn, err := dial(*port, *baud)
+	if err != nil {
+		fmt.Fprintf(stderr, "fanctl: %v\n", err)
+		return 1
+	}
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr, client: newClient(conn, *timeout)}
+	defer c.client.Close()
+
+	switch err := cmd.run(c, fs.Args()[1:]); {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(stderr, strings.TrimSpace("usage: fanctl "+cmd.name+" "+cmd.args))
+		return 2
+	default:
+		fmt.Fprintf(stderr, "fanctl %s: %v\n", cmd.name, err)
+		return 1
+	}
+}
+
+func usage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "usage: fanctl [flags] <command> [args]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.help)
+		if cmd.args != "" {
+			fmt.Fprintf(w, "  %-10s   %s %s\n", "", cmd.name, cmd.args)
+		}
+	}
+	fmt.Fprintf(w, "\nflags:\n")
+	fs.PrintDefaults()
+}
+
+// flags returns a flag set for the arguments of a command. Parse errors
+// are reported as errUsage.
+//
+// flagsは、コマンドの引数のためのフラグの集合を返す。解析のエラーは
+// errUsageとして報告する。
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {}
+	return fs
+}
+
+// parse parses args with fs and returns errUsage on failure.
+//
+// parseは、fsでargsを解析し、失敗したらerrUsageを返す。
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
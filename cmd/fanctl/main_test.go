@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/app"
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/curve"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/ht16k33"
+	"github.com/kou-tkbys/tk-fancon2/settings"
+	"github.com/kou-tkbys/tk-fancon2/sim"
+)
+
+// Note: go test ./cmd/fanctl (host only)
+
+// 何もしないI2CバスとLED、固定のポテンショメータ
+type nopBus struct{}
+
+func (nopBus) Tx(addr uint16, w, r []byte) error { return nil }
+
+type nopLED struct{}
+
+func (nopLED) Set(on bool) {}
+
+type constPot uint16
+
+func (p constPot) Get() uint16 { return uint16(p) }
+
+// inbox is the controller's end of the host-to-device pipes. Goroutines
+// fill it, so Read never blocks, as the console requires.
+//
+// ホストから装置へのパイプのコントローラー側。ゴルーチンが中身を入れるの
+// で、コンソールが求めるとおりReadはブロックしない。
+type inbox struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *inbox) fill(r io.Reader) {
+	p := make([]byte, 256)
+	for {
+		n, err := r.Read(p)
+		b.mu.Lock()
+		b.buf.Write(p[:n])
+		b.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (b *inbox) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.buf.Len() == 0 {
+		return 0, nil
+	}
+	return b.buf.Read(p)
+}
+
+// outbox is the controller's end of the device-to-host pipe of the
+// current connection. Like a serial line, it drops what nobody reads.
+//
+// 現在の接続の、装置からホストへのパイプのコントローラー側。シリアルの回
+// 線と同じく、誰も読まないものは捨てる。
+type outbox struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (b *outbox) connect(w io.Writer) {
+	b.mu.Lock()
+	b.w = w
+	b.mu.Unlock()
+}
+
+func (b *outbox) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	w := b.w
+	b.mu.Unlock()
+	if w != nil {
+		w.Write(p)
+	}
+	return len(p), nil
+}
+
+// fakeDevice runs the whole controller on simulated fans in virtual time.
+// Each dial connects fanctl to it by a new pair of pipes.
+//
+// シミュレーションしたファンの上で、コントローラー全体を仮想時間で動か
+// す。接続するたびに、新しいパイプの組でfanctlとつなぐ。
+type fakeDevice struct {
+	in  inbox
+	out outbox
+	// Functions run by the device goroutine between steps.
+	// 装置のゴルーチンがステップの合間に実行する関数
+	calls chan func(a *app.App)
+	stop  chan struct{}
+	done  chan struct{}
+	// Where the device saves its settings.
+	// 装置が設定を保存する場所
+	store settings.Storage
+}
+
+// pipeConn is fanctl's end of the pipes.
+type pipeConn struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (c pipeConn) Close() error {
+	c.PipeWriter.Close()
+	return c.PipeReader.Close()
+}
+
+// startFakeDevice boots the controller. It stops when the test ends.
+func startFakeDevice(t *testing.T) *fakeDevice {
+	t.Helper()
+	clock := sim.NewClock()
+	pair := sim.NewPair(clock, sim.DefaultRotorConfig(), sim.DefaultRotorConfig(), 1)
+	a := app.New(app.DefaultConfig(), nopLED{}, clock)
+	err := a.Boot(func() (app.FanHardware, error) {
+		return app.FanHardware{Name: "Sim", Output: pair, Pot: constPot(0x8000), Front: pair.Front, Rear: pair.Rear}, nil
+	}, func() (ht16k33.I2CBus, error) {
+		return nopBus{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &fakeDevice{
+		calls: make(chan func(*app.App)),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		store: settings.NewLogStore(settings.NewMemFlash(4*4096, 256, 4096), 4),
+	}
+	a.LoadSettings(d.store)
+	// The telemetry text shares the line with the replies.
+	// テレメトリーのテキストが返答と同じ回線に流れる。
+	a.StartTelemetry(&d.out)
+	a.StartConsole(&d.in, &d.out)
+
+	go func() {
+		defer close(d.done)
+		for {
+			select {
+			case f := <-d.calls:
+				f(a)
+			case <-d.stop:
+				return
+			default:
+			}
+			a.Step()
+			clock.Advance(10 * time.Millisecond)
+		}
+	}()
+	t.Cleanup(func() {
+		close(d.stop)
+		<-d.done
+	})
+	return d
+}
+
+// dial connects to the device.
+func (d *fakeDevice) dial(port string, baud int) (io.ReadWriteCloser, error) {
+	hostR, devW := io.Pipe()
+	devR, hostW := io.Pipe()
+	go d.in.fill(devR)
+	d.out.connect(devW)
+	return pipeConn{hostR, hostW}, nil
+}
+
+// do runs f on the device goroutine.
+func (d *fakeDevice) do(f func(a *app.App)) {
+	done := make(chan struct{})
+	d.calls <- func(a *app.App) {
+		f(a)
+		close(done)
+	}
+	<-done
+}
+
+// fanctlを実行し、終了ステータスと出力を返す
+func runFanctl(dial dialFunc, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr, dial)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_Status(t *testing.T) {
+	dial := startFakeDevice(t).dial
+
+	code, out, errOut := runFanctl(dial, "", "status")
+	if code != 0 {
+		t.Fatalf("期待する終了ステータスは 0 、実際は %d で異なる: %s", code, errOut)
+	}
+	// 偽のデバイスが動いている間はデューティが変わり、列の幅も変わるので、
+	// 各行のフィールドを比べる
+	lines := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		lines[strings.Join(strings.Fields(line), " ")] = true
+	}
+	for _, line := range []string{
+		"controller Sim",
+		"versions protocol 1, settings 1",
+		"mode open",
+		"front rear",
+		"fault none none",
+	} {
+		if !lines[line] {
+			t.Errorf("出力に %q が無い:\n%s", line, out)
+		}
+	}
+}
+
+func TestRun_Set(t *testing.T) {
+	testCases := []struct {
+		name      string
+		args      []string
+		code      int
+		mode      control.Mode
+		target    uint32
+		front     uint32
+		rear      uint32
+		errOutput string
+	}{
+		{name: "両方のデューティ", args: []string{"set", "duty", "50%"}, front: 20000, rear: 20000},
+		{name: "別々のデューティ", args: []string{"set", "duty", "12000", "25%"}, front: 12000, rear: 10000},
+		{name: "閉ループ", args: []string{"set", "mode", "pid", "2400"}, mode: control.ModeClosedLoop, target: 2400},
+		{name: "範囲外のデューティ", args: []string{"set", "duty", "101%"}, code: 1, errOutput: "fanctl set: invalid duty: 101%\n"},
+		{name: "目標RPMが無い", args: []string{"set", "mode", "pid"}, code: 2, errOutput: "usage: fanctl set duty <front> [<rear>] | mode open|pid <rpm>\n"},
+		{name: "知らない値", args: []string{"set", "speed", "1"}, code: 2, errOutput: "usage: fanctl set duty <front> [<rear>] | mode open|pid <rpm>\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := startFakeDevice(t)
+			dial := d.dial
+			code, _, errOut := runFanctl(dial, "", tc.args...)
+			if code != tc.code || errOut != tc.errOutput {
+				t.Fatalf("期待する結果は %d %q 、実際は %d %q で異なる", tc.code, tc.errOutput, code, errOut)
+			}
+			if tc.code != 0 {
+				return
+			}
+			d.do(func(a *app.App) {
+				if mode, target := a.Mode(); mode != tc.mode || target != tc.target {
+					t.Errorf("期待するモードは %v/%d 、実際は %v/%d で異なる", tc.mode, tc.target, mode, target)
+				}
+				if tc.mode == control.ModeClosedLoop {
+					return
+				}
+				// 傾斜をつけて目標に向かうので、しばらく待つ
+				for i := 0; i < 1000; i++ {
+					a.Step()
+				}
+			})
+			d.do(func(a *app.App) {
+				if tc.mode == control.ModeClosedLoop {
+					return
+				}
+				if f, r := a.Duties(); f != tc.front || r != tc.rear {
+					t.Errorf("期待するデューティは %d/%d 、実際は %d/%d で異なる", tc.front, tc.rear, f, r)
+				}
+			})
+		})
+	}
+}
+
+func TestRun_ConfigDump(t *testing.T) {
+	dial := startFakeDevice(t).dial
+
+	code, out, errOut := runFanctl(dial, "", "config", "dump")
+	if code != 0 {
+		t.Fatalf("期待する終了ステータスは 0 、実際は %d で異なる: %s", code, errOut)
+	}
+	expected := `curve:
+  shape: square
+  k: 0
+  table: []
+  deadzone: 2000
+  rescale: false
+  saturation: 0
+  out_min: 0
+  out_max: 40000
+front:
+  ppr: 2
+  max_rpm: 0
+  min_start_duty: 0
+  stall_rpm: 0
+rear:
+  ppr: 2
+  max_rpm: 0
+  min_start_duty: 0
+  stall_rpm: 0
+brightness: 15
+mode: open
+target_rpm: 0
+`
+	if out != expected {
+		t.Errorf("期待する出力は\n%s\n実際は\n%s\nで異なる", expected, out)
+	}
+
+	code, out, _ = runFanctl(dial, "", "config", "dump", "-format", "json")
+	var doc configDoc
+	if err := json.Unmarshal([]byte(out), &doc); code != 0 || err != nil {
+		t.Fatalf("JSONとして読めない: %d %v\n%s", code, err, out)
+	}
+	if doc.Curve.OutMax != fan.MaxDuty || doc.Front.PPR != 2 {
+		t.Errorf("期待する値は 40000/2 、実際は %d/%d で異なる", doc.Curve.OutMax, doc.Front.PPR)
+	}
+}
+
+func TestRun_ConfigLoad(t *testing.T) {
+	testCases := []struct {
+		name      string
+		file      string
+		data      string
+		stdin     string
+		code      int
+		errOutput string
+		check     func(t *testing.T, a *app.App)
+	}{
+		{
+			name: "YAMLの一部",
+			file: "fan.yaml",
+			data: "# 曲線だけ変える\ncurve:\n  shape: table\n  table:\n    - {x: 0, y: 0}\n",
+			code: 1, errOutput: "fanctl config: fan.yaml: yaml: line 5: flow mappings are not supported\n",
+		},
+		{
+			name: "YAMLの表",
+			file: "fan.yaml",
+			data: "curve:\n  shape: table\n  table:\n  - x: 0\n    y: 0\n  - x: 0.5\n    y: 0.8\nrear:\n  max_rpm: 3000\nmode: closed\ntarget_rpm: 1800\n",
+			check: func(t *testing.T, a *app.App) {
+				c := a.Config.PotCurve
+				if c.Shape != curve.Table || len(c.Table) != 2 || c.Table[1] != (curve.Point{X: 0.5, Y: 0.8}) {
+					t.Errorf("期待する曲線は table [{0 0} {0.5 0.8}] 、実際は %v %v で異なる", c.Shape, c.Table)
+				}
+				if p := a.Fans.Rear.Profile(); p.MaxRPM != 3000 || p.PulsesPerRevolution != 2 {
+					t.Errorf("期待するプロファイルは 3000/2 、実際は %d/%d で異なる", p.MaxRPM, p.PulsesPerRevolution)
+				}
+				if mode, target := a.Mode(); mode != control.ModeClosedLoop || target != 1800 {
+					t.Errorf("期待するモードは closed/1800 、実際は %v/%d で異なる", mode, target)
+				}
+			},
+		},
+		{
+			name:  "標準入力",
+			file:  "-",
+			stdin: "brightness: 4\nfront:\n  stall_rpm: 300 # rpm\n",
+			check: func(t *testing.T, a *app.App) {
+				if s := a.Settings(); s.Brightness != 4 || s.FrontProfile.StallRPM != 300 {
+					t.Errorf("期待する設定は 4/300 、実際は %d/%d で異なる", s.Brightness, s.FrontProfile.StallRPM)
+				}
+			},
+		},
+		{
+			name: "JSON",
+			file: "fan.json",
+			data: `{"curve": {"shape": "cubic", "deadzone": 0}}`,
+			check: func(t *testing.T, a *app.App) {
+				if c := a.Config.PotCurve; c.Shape != curve.Cubic || c.Deadzone != 0 || c.OutMax != fan.MaxDuty {
+					t.Errorf("期待する曲線は cubic/0/40000 、実際は %v/%d/%d で異なる", c.Shape, c.Deadzone, c.OutMax)
+				}
+			},
+		},
+		{
+			name: "知らないキー",
+			file: "fan.json",
+			data: `{"colour": "red"}`,
+			code: 1, errOutput: "fanctl config: fan.json: json: unknown field \"colour\"\n",
+		},
+		{
+			name: "知らない曲線",
+			file: "fan.yml",
+			data: "curve:\n  shape: zigzag\n",
+			code: 1, errOutput: "fanctl config: fan.yml: unknown curve shape \"zigzag\"\n",
+		},
+		{
+			name: "PPRは0にできない",
+			file: "fan.yaml",
+			data: "front:\n  ppr: 0\n",
+			code: 1, errOutput: "fanctl config: fan.yaml: invalid ppr 0\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := startFakeDevice(t)
+			dial := d.dial
+			name, dir := tc.file, ""
+			if name != "-" {
+				dir = t.TempDir() + string(filepath.Separator)
+				name = dir + tc.file
+				if err := os.WriteFile(name, []byte(tc.data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			code, _, errOut := runFanctl(dial, tc.stdin, "config", "load", name)
+			errOut = strings.ReplaceAll(errOut, dir, "")
+			if code != tc.code || errOut != tc.errOutput {
+				t.Fatalf("期待する結果は %d %q 、実際は %d %q で異なる", tc.code, tc.errOutput, code, errOut)
+			}
+			if tc.check == nil {
+				return
+			}
+			d.do(func(a *app.App) {
+				tc.check(t, a)
+				// 保存されているので、既定値に戻しても読み込み直せる
+				a.ApplySettings(settings.Default())
+				if err := a.LoadSettings(d.store); err != nil {
+					t.Fatal(err)
+				}
+				tc.check(t, a)
+			})
+		})
+	}
+}
+
+func TestRun_Calibrate(t *testing.T) {
+	dial := startFakeDevice(t).dial
+
+	code, out, errOut := runFanctl(dial, "", "calibrate")
+	if code != 0 {
+		t.Fatalf("期待する終了ステータスは 0 、実際は %d で異なる: %s", code, errOut)
+	}
+	if !strings.HasPrefix(out, "rotor,duty,rpm\nSim-F,") || !strings.Contains(out, "\nSim-R,") {
+		t.Errorf("特性測定の結果になっていない:\n%s", out)
+	}
+	if !strings.Contains(out, "\nrotor,min_start_duty,min_sustain_duty,max_rpm,ppr,suggested_ppr,checks\nSim-F,") {
+		t.Errorf("要約が無い:\n%s", out)
+	}
+}
+
+func TestRun_Log(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "CSV",
+			args:     []string{"log", "--csv", "-fields", "front_fault,mode", "-interval", "1ms", "-n", "3"},
+			expected: []string{"front_fault,mode", "none,open", "none,open", "none,open", ""},
+		},
+		{
+			name:     "JSON",
+			args:     []string{"log", "-fields", "rear_fault", "-interval", "1ms", "-n", "2"},
+			expected: []string{`{"rear_fault":"none"}`, `{"rear_fault":"none"}`, ""},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dial := startFakeDevice(t).dial
+			code, out, errOut := runFanctl(dial, "", tc.args...)
+			if code != 0 {
+				t.Fatalf("期待する終了ステータスは 0 、実際は %d で異なる: %s", code, errOut)
+			}
+			if got := strings.Split(out, "\n"); strings.Join(got, "|") != strings.Join(tc.expected, "|") {
+				t.Errorf("期待する出力は %q 、実際は %q で異なる", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRun_Watch(t *testing.T) {
+	dial := startFakeDevice(t).dial
+
+	code, out, errOut := runFanctl(dial, "", "watch", "-interval", "1ms", "-n", "3")
+	if code != 0 {
+		t.Fatalf("期待する終了ステータスは 0 、実際は %d で異なる: %s", code, errOut)
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != 4 || lines[0] != "    time  front rpm   rear rpm  front duty   rear duty  faults" {
+		t.Fatalf("期待する表ではない:\n%s", out)
+	}
+	for _, line := range lines[1:] {
+		if !strings.HasSuffix(line, "  none/none") {
+			t.Errorf("期待する異常は none/none 、実際の行は %q で異なる", line)
+		}
+	}
+}
+
+// 返答しない相手
+type silentConn struct{ closed chan struct{} }
+
+func (c silentConn) Read(p []byte) (int, error) {
+	<-c.closed
+	return 0, io.EOF
+}
+func (c silentConn) Write(p []byte) (int, error) { return len(p), nil }
+func (c silentConn) Close() error                { close(c.closed); return nil }
+
+func TestRun_Errors(t *testing.T) {
+	silent := func(port string, baud int) (io.ReadWriteCloser, error) {
+		return silentConn{closed: make(chan struct{})}, nil
+	}
+	var dialed string
+	failing := func(port string, baud int) (io.ReadWriteCloser, error) {
+		dialed = fmt.Sprintf("%s@%d", port, baud)
+		return nil, errors.New("open " + port + ": no such file or directory")
+	}
+
+	testCases := []struct {
+		name      string
+		dial      dialFunc
+		args      []string
+		code      int
+		errPrefix string
+	}{
+		{name: "コマンド無し", dial: silent, args: nil, code: 2, errPrefix: "usage: fanctl [flags] <command> [args]\n"},
+		{name: "知らないコマンド", dial: silent, args: []string{"reboot"}, code: 2, errPrefix: "fanctl: unknown command \"reboot\"\n"},
+		{name: "返答が無い", dial: silent, args: []string{"-timeout", "10ms", "status"}, code: 1, errPrefix: "fanctl status: no reply from the controller\n"},
+		{name: "開けない", dial: failing, args: []string{"-port", "/dev/ttyUSB9", "-baud", "9600", "status"}, code: 1, errPrefix: "fanctl: open /dev/ttyUSB9: no such file or directory\n"},
+		{name: "余分な引数", dial: silent, args: []string{"status", "now"}, code: 2, errPrefix: "usage: fanctl status\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _, errOut := runFanctl(tc.dial, "", tc.args...)
+			if code != tc.code || !strings.HasPrefix(errOut, tc.errPrefix) {
+				t.Errorf("期待する結果は %d %q 、実際は %d %q で異なる", tc.code, tc.errPrefix, code, errOut)
+			}
+		})
+	}
+	if dialed != "/dev/ttyUSB9@9600" {
+		t.Errorf("期待する接続先は /dev/ttyUSB9@9600 、実際は %s で異なる", dialed)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// cbaud masks the baud rate bits of the termios control flags.
+//
+// cbaudは、termiosの制御フラグのボーレートのビットを取り出すマスク。
+const cbaud = 0010017
+
+var baudRates = map[int]uint32{
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+	230400: syscall.B230400,
+}
+
+// openSerial opens a serial port or pty in raw 8N1 mode at the given baud
+// rate. The USB serial port of the Pico ignores the rate.
+//
+// openSerialは、シリアルポートかptyを、指定したボーレートのraw 8N1モード
+// で開く。PicoのUSBシリアルポートはボーレートを無視する。
+func openSerial(path string, baud int) (*os.File, error) {
+	rate, ok := baudRates[baud]
+	if !ok {
+		return nil, errors.New("unsupported baud rate")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var t syscall.Termios
+	if err := ioctl(f, syscall.TCGETS, &t); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Raw mode as cfmakeraw(3): no echo, no line editing and no
+	// translation of the bytes.
+	// cfmakeraw(3)と同じrawモード：エコー、行編集、バイトの変換をしない。
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB | syscall.CSTOPB | cbaud
+	t.Cflag |= syscall.CS8 | syscall.CREAD | syscall.CLOCAL | rate
+	// Block until at least one byte has arrived.
+	// 少なくとも1バイト届くまでブロックする。
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if err := ioctl(f, syscall.TCSETS, &t); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+func ioctl(f *os.File, req uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openSerial is only implemented on Linux.
+//
+// openSerialは、Linuxでのみ実装している。
+func openSerial(path string, baud int) (*os.File, error) {
+	return nil, errors.New("serial ports are only supported on Linux")
+}
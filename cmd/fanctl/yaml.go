@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The config files use the small subset of YAML that marshalYAML writes:
+// block mappings, block sequences, flow sequences of scalars, plain and
+// quoted scalars, and comments. Both directions go through JSON, so the
+// json struct tags name the keys and encoding/json does the typing.
+//
+// 設定ファイルは、marshalYAMLが書くYAMLの小さな部分集合を使う：ブロック
+// のマッピング、ブロックのシーケンス、スカラーのフローシーケンス、プレー
+// ンと引用符付きのスカラー、コメント。どちらの向きもJSONを経由するので、
+// キーの名前はjsonの構造体タグが決め、型付けはencoding/jsonが行う。
+
+// yamlNode is a parsed document: a scalar holding its JSON text, a
+// mapping with ordered keys, or a sequence.
+//
+// yamlNodeは、解析した文書。JSONのテキストを持つスカラー、順序付きのキー
+// を持つマッピング、シーケンスのいずれか。
+type yamlNode struct {
+	kind   yamlKind
+	scalar string
+	keys   []string
+	items  []*yamlNode
+}
+
+type yamlKind uint8
+
+const (
+	yamlScalar yamlKind = iota
+	yamlMapping
+	yamlSequence
+)
+
+// marshalYAML encodes v as YAML by way of its JSON encoding.
+//
+// marshalYAMLは、JSONの符号化を経由してvをYAMLに符号化する。
+func marshalYAML(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	n, err := readJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if n.kind == yamlScalar {
+		b.WriteString(yamlScalarText(n.scalar) + "\n")
+	} else {
+		writeYAML(&b, n, 0)
+	}
+	return b.Bytes(), nil
+}
+
+// readJSON reads one JSON value from dec, keeping the order of the keys.
+//
+// readJSONは、キーの順序を保ってdecからJSONの値を1つ読む。
+func readJSON(dec *json.Decoder) (*yamlNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &yamlNode{kind: yamlMapping}
+		if t == '[' {
+			n.kind = yamlSequence
+		}
+		for dec.More() {
+			if n.kind == yamlMapping {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			item, err := readJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+		}
+		_, err := dec.Token()
+		return n, err
+	case string:
+		data, _ := json.Marshal(t)
+		return &yamlNode{scalar: string(data)}, nil
+	case json.Number:
+		return &yamlNode{scalar: t.String()}, nil
+	case bool:
+		return &yamlNode{scalar: strconv.FormatBool(t)}, nil
+	default:
+		return &yamlNode{scalar: "null"}, nil
+	}
+}
+
+// writeYAML writes the items of a mapping or sequence at indent.
+//
+// writeYAMLは、マッピングかシーケンスの要素をindentの位置に書く。
+func writeYAML(b *bytes.Buffer, n *yamlNode, indent int) {
+	pad := strings.Repeat(" ", indent)
+	for i, item := range n.items {
+		lead := pad + "-"
+		if n.kind == yamlMapping {
+			lead = pad + yamlKeyText(n.keys[i]) + ":"
+		}
+		switch {
+		case item.kind == yamlScalar:
+			b.WriteString(lead + " " + yamlScalarText(item.scalar) + "\n")
+		case len(item.items) == 0 && item.kind == yamlMapping:
+			b.WriteString(lead + " {}\n")
+		case flowSequence(item):
+			texts := make([]string, len(item.items))
+			for j, s := range item.items {
+				texts[j] = yamlScalarText(s.scalar)
+			}
+			b.WriteString(lead + " [" + strings.Join(texts, ", ") + "]\n")
+		case n.kind == yamlSequence && item.kind == yamlMapping:
+			// Start the mapping on the line of the dash.
+			// マッピングはダッシュの行から始める。
+			var inner bytes.Buffer
+			writeYAML(&inner, item, indent+2)
+			b.WriteString(lead + " " + strings.TrimLeft(inner.String(), " "))
+		default:
+			b.WriteString(lead + "\n")
+			writeYAML(b, item, indent+2)
+		}
+	}
+}
+
+// flowSequence reports whether n is a sequence of scalars, written on one
+// line.
+//
+// flowSequenceは、nが1行に書くスカラーのシーケンスかどうかを返す。
+func flowSequence(n *yamlNode) bool {
+	if n.kind != yamlSequence {
+		return false
+	}
+	for _, item := range n.items {
+		if item.kind != yamlScalar {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlScalarText returns the YAML text of a JSON scalar. Strings are only
+// quoted when they would otherwise read as something else.
+//
+// yamlScalarTextは、JSONのスカラーのYAMLのテキストを返す。文字列は、その
+// ままでは別のものとして読まれる場合だけ引用符で囲む。
+func yamlScalarText(js string) string {
+	if !strings.HasPrefix(js, `"`) {
+		return js
+	}
+	var s string
+	json.Unmarshal([]byte(js), &s)
+	if plainString(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func yamlKeyText(key string) string {
+	if plainString(key) {
+		return key
+	}
+	return strconv.Quote(key)
+}
+
+// plainString reports whether s can be written without quotes and read
+// back as the same string.
+//
+// plainStringは、sを引用符無しで書いて同じ文字列として読み戻せるかどうか
+// を返す。
+func plainString(s string) bool {
+	if s == "" || parseScalar(s) != mustJSON(s) {
+		return false
+	}
+	// Other tools still read these as booleans, as YAML 1.1 did.
+	// YAML 1.1と同じく、これらを真偽値として読むツールがまだある。
+	switch strings.ToLower(s) {
+	case "yes", "no", "on", "off":
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("_-./", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustJSON(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// unmarshalYAML decodes YAML into v by way of JSON. Unknown keys are
+// errors.
+//
+// unmarshalYAMLは、JSONを経由してYAMLをvに復号する。知らないキーはエラー
+// になる。
+func unmarshalYAML(data []byte, v any) error {
+	lines, err := yamlLines(data)
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("yaml: empty document")
+	}
+	p := yamlParser{lines: lines}
+	n, err := p.block(lines[0].indent)
+	if err != nil {
+		return err
+	}
+	if p.i < len(lines) {
+		return p.errorf("unexpected indentation")
+	}
+	var b bytes.Buffer
+	writeJSON(&b, n)
+	dec := json.NewDecoder(&b)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+type yamlLine struct {
+	num, indent int
+	text        string
+}
+
+// yamlLines splits data into lines without blank lines and comments.
+//
+// yamlLinesは、dataを空行とコメントを除いた行に分ける。
+func yamlLines(data []byte) ([]yamlLine, error) {
+	var lines []yamlLine
+	for i, text := range strings.Split(string(data), "\n") {
+		text = strings.TrimRight(stripComment(text), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	return lines, nil
+}
+
+// stripComment removes a comment that is not inside quotes.
+//
+// stripCommentは、引用符の中に無いコメントを取り除く。
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			// A quote after a backslash does not close the string.
+			// バックスラッシュの後の引用符では文字列を閉じない。
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	num := 0
+	if p.i < len(p.lines) {
+		num = p.lines[p.i].num
+	} else if len(p.lines) > 0 {
+		num = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("yaml: line %d: "+format, append([]any{num}, args...)...)
+}
+
+// block parses the mapping or sequence whose items start at indent.
+//
+// blockは、要素がindentの位置から始まるマッピングかシーケンスを解析する。
+func (p *yamlParser) block(indent int) (*yamlNode, error) {
+	if isSeqItem(p.lines[p.i].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) mapping(indent int) (*yamlNode, error) {
+	n := &yamlNode{kind: yamlMapping}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && !isSeqItem(p.lines[p.i].text) {
+		key, rest, ok := splitKey(p.lines[p.i].text)
+		if !ok {
+			return nil, p.errorf("expected key: value")
+		}
+		for _, k := range n.keys {
+			if k == key {
+				return nil, p.errorf("duplicate key %q", key)
+			}
+		}
+		p.i++
+		value, err := p.value(indent, rest, true)
+		if err != nil {
+			return nil, err
+		}
+		n.keys = append(n.keys, key)
+		n.items = append(n.items, value)
+	}
+	if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return n, nil
+}
+
+func (p *yamlParser) sequence(indent int) (*yamlNode, error) {
+	n := &yamlNode{kind: yamlSequence}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && isSeqItem(p.lines[p.i].text) {
+		line := p.lines[p.i]
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if _, _, ok := splitKey(rest); ok && !strings.ContainsAny(rest[:1], "[{'") {
+			// A mapping starting on the line of the dash: parse it as if
+			// it started on a line of its own.
+			// ダッシュの行から始まるマッピング：独立した行から始まったかのよう
+			// に解析する。
+			p.lines[p.i] = yamlLine{num: line.num, indent: line.indent + len(line.text) - len(rest), text: rest}
+			item, err := p.mapping(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+			continue
+		}
+		p.i++
+		item, err := p.value(indent, rest, false)
+		if err != nil {
+			return nil, err
+		}
+		n.items = append(n.items, item)
+	}
+	if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return n, nil
+}
+
+// value parses the value after a key or dash: rest of the line, or a
+// nested block on the following lines. A sequence under a key may start
+// at the key's own indent.
+//
+// valueは、キーかダッシュの後の値を解析する。行の残りか、続く行の入れ子の
+// ブロック。キーの下のシーケンスはキーと同じ字下げで始まっても良い。
+func (p *yamlParser) value(indent int, rest string, underKey bool) (*yamlNode, error) {
+	if rest != "" {
+		return p.inline(rest)
+	}
+	if p.i < len(p.lines) {
+		next := p.lines[p.i]
+		if next.indent > indent || (underKey && next.indent == indent && isSeqItem(next.text)) {
+			return p.block(next.indent)
+		}
+	}
+	return &yamlNode{scalar: "null"}, nil
+}
+
+// inline parses a scalar or a flow collection on one line.
+//
+// inlineは、1行のスカラーかフローのコレクションを解析する。
+func (p *yamlParser) inline(text string) (*yamlNode, error) {
+	switch {
+	case text == "{}":
+		return &yamlNode{kind: yamlMapping}, nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, p.errorf("unterminated flow sequence")
+		}
+		n := &yamlNode{kind: yamlSequence}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return n, nil
+		}
+		for _, s := range strings.Split(inner, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" || strings.ContainsAny(s, "[]{}") {
+				return nil, p.errorf("unsupported flow sequence")
+			}
+			item, err := p.scalar(s)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, item)
+		}
+		return n, nil
+	case strings.HasPrefix(text, "{"):
+		return nil, p.errorf("flow mappings are not supported")
+	default:
+		return p.scalar(text)
+	}
+}
+
+func (p *yamlParser) scalar(text string) (*yamlNode, error) {
+	if strings.HasPrefix(text, `"`) {
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, p.errorf("bad quoted string")
+		}
+		return &yamlNode{scalar: mustJSON(s)}, nil
+	}
+	if strings.HasPrefix(text, "'") {
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, p.errorf("bad quoted string")
+		}
+		return &yamlNode{scalar: mustJSON(strings.ReplaceAll(text[1:len(text)-1], "''", "'"))}, nil
+	}
+	return &yamlNode{scalar: parseScalar(text)}, nil
+}
+
+// parseScalar returns the JSON text of a plain scalar: a number, true,
+// false, null or otherwise a string.
+//
+// parseScalarは、プレーンなスカラーのJSONのテキストを返す。数、true、
+// false、null、それ以外は文字列。
+func parseScalar(s string) string {
+	switch s {
+	case "true", "false", "null":
+		return s
+	case "~":
+		return "null"
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil && json.Valid([]byte(s)) {
+		return s
+	}
+	return mustJSON(s)
+}
+
+// splitKey splits "key: value" or "key:" into the key and the rest.
+//
+// splitKeyは、"key: value"か"key:"をキーと残りに分ける。
+func splitKey(text string) (key, rest string, ok bool) {
+	if strings.HasPrefix(text, `"`) {
+		end := strings.Index(text[1:], `"`) + 1
+		if end <= 0 {
+			return "", "", false
+		}
+		k, err := strconv.Unquote(text[:end+1])
+		if err != nil || !strings.HasPrefix(text[end+1:], ":") {
+			return "", "", false
+		}
+		return k, strings.TrimSpace(text[end+2:]), true
+	}
+	if i := strings.Index(text, ": "); i > 0 {
+		return text[:i], strings.TrimSpace(text[i+2:]), true
+	}
+	if strings.HasSuffix(text, ":") && len(text) > 1 {
+		return text[:len(text)-1], "", true
+	}
+	return "", "", false
+}
+
+// writeJSON writes n as JSON.
+//
+// writeJSONは、nをJSONとして書く。
+func writeJSON(b *bytes.Buffer, n *yamlNode) {
+	switch n.kind {
+	case yamlScalar:
+		b.WriteString(n.scalar)
+	case yamlMapping:
+		b.WriteByte('{')
+		for i, item := range n.items {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(mustJSON(n.keys[i]) + ":")
+			writeJSON(b, item)
+		}
+		b.WriteByte('}')
+	case yamlSequence:
+		b.WriteByte('[')
+		for i, item := range n.items {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSON(b, item)
+		}
+		b.WriteByte(']')
+	}
+}
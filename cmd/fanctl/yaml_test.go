@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type yamlTestDoc struct {
+	Name   string            `json:"name"`
+	Size   float64           `json:"size"`
+	On     bool              `json:"on"`
+	List   []int             `json:"list"`
+	Points []map[string]int  `json:"points"`
+	Nested map[string]string `json:"nested"`
+}
+
+func TestYAML_Marshal(t *testing.T) {
+	doc := yamlTestDoc{
+		Name:   "a: b",
+		Size:   1.5,
+		On:     true,
+		List:   []int{1, 2},
+		Points: []map[string]int{{"x": 1, "y": 2}, {"x": 3}},
+		Nested: map[string]string{"k": "true", "empty": ""},
+	}
+	expected := `name: "a: b"
+size: 1.5
+"on": true
+list: [1, 2]
+points:
+  - x: 1
+    y: 2
+  - x: 3
+nested:
+  empty: ""
+  k: "true"
+`
+	data, err := marshalYAML(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Errorf("期待する出力は\n%s\n実際は\n%s\nで異なる", expected, data)
+	}
+
+	var back yamlTestDoc
+	if err := unmarshalYAML(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, doc) {
+		t.Errorf("期待する値は %+v 、実際は %+v で異なる", doc, back)
+	}
+}
+
+func TestYAML_Unmarshal(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected yamlTestDoc
+		err      string
+	}{
+		{
+			name:     "コメントと引用符",
+			data:     "--- # doc\nname: 'it''s # not a comment' # comment\nsize: -2e3\n",
+			expected: yamlTestDoc{Name: "it's # not a comment", Size: -2000},
+		},
+		{
+			name:     "キーと同じ字下げのシーケンス",
+			data:     "points:\n- x: 1\n-   y: 2\n    x: 3\nlist:\n  - 4\n  - 5\n",
+			expected: yamlTestDoc{Points: []map[string]int{{"x": 1}, {"x": 3, "y": 2}}, List: []int{4, 5}},
+		},
+		{
+			name:     "空のコレクションとnull",
+			data:     "list: []\nnested: {}\nname: ~\n",
+			expected: yamlTestDoc{List: []int{}, Nested: map[string]string{}},
+		},
+		{
+			name:     "エスケープ",
+			data:     `name: "tab\there \"#1\""`,
+			expected: yamlTestDoc{Name: "tab\there \"#1\""},
+		},
+		{name: "空", data: "# nothing\n", err: "yaml: empty document"},
+		{name: "知らないキー", data: "colour: red\n", err: `json: unknown field "colour"`},
+		{name: "型が違う", data: "on: yes\n", err: "json: cannot unmarshal string into Go struct field yamlTestDoc.on of type bool"},
+		{name: "字下げの誤り", data: "nested:\n  a: b\n    c: d\n", err: "yaml: line 3: unexpected indentation"},
+		{name: "キーの重複", data: "size: 1\nsize: 2\n", err: `yaml: line 2: duplicate key "size"`},
+		{name: "キーが無い", data: "name: a\njust text\n", err: "yaml: line 2: expected key: value"},
+		{name: "タブ", data: "nested:\n\ta: b\n", err: "yaml: line 2: tabs are not allowed for indentation"},
+		{name: "閉じないシーケンス", data: "list: [1, 2\n", err: "yaml: line 1: unterminated flow sequence"},
+		{name: "フローのマッピング", data: "nested: {a: b}\n", err: "yaml: line 1: flow mappings are not supported"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got yamlTestDoc
+			err := unmarshalYAML([]byte(tc.data), &got)
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Fatalf("期待するエラーは %q 、実際は %v で異なる", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("期待する値は %+v 、実際は %+v で異なる", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package console
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// OK writes the reply of a command that has nothing else to say.
+//
+// OKは、他に言うことの無いコマンドの返答を書く。
+func OK(w io.Writer) error {
+	_, err := io.WriteString(w, "ok\r\n")
+	return err
+}
+
+// ParseUint parses a decimal number no larger than max.
+//
+// ParseUintは、max以下の10進数を解析する。
+func ParseUint(s string, max uint32) (uint32, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || uint32(v) > max {
+		return 0, errors.New("invalid number: " + s)
+	}
+	return uint32(v), nil
+}
+
+// ParseDuty parses a duty given either as a percentage such as "30%" or
+// "12.5%", or as raw units up to fan.MaxDuty.
+//
+// ParseDutyは、"30%"や"12.5%"のような百分率か、fan.MaxDutyまでの生の単位
+// で与えられたデューティを解析する。
+func ParseDuty(s string) (uint32, error) {
+	if p, ok := strings.CutSuffix(s, "%"); ok {
+		v, err := strconv.ParseFloat(p, 32)
+		// Written so that NaN fails too.
+		// NaNも通らないように書く。
+		if err != nil || !(v >= 0 && v <= 100) {
+			return 0, errors.New("invalid duty: " + s)
+		}
+		return uint32(v*fan.MaxDuty/100 + 0.5), nil
+	}
+	v, err := ParseUint(s, fan.MaxDuty)
+	if err != nil {
+		return 0, errors.New("invalid duty: " + s)
+	}
+	return v, nil
+}
+
+// ParseOnOff parses "on" or "off".
+//
+// ParseOnOffは、"on"か"off"を解析する。
+func ParseOnOff(s string) (bool, error) {
+	switch s {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		return false, errors.New("expected on or off: " + s)
+	}
+}
@@ -0,0 +1,232 @@
+// Package console is a line-oriented command shell for the serial port.
+// It splits each line into words, dispatches the first word to a
+// registered command and writes its reply or error. Bytes come in through
+// Feed or an io.Reader and replies go to an io.Writer, so the whole shell
+// runs in host tests.
+//
+// consoleパッケージは、シリアルポート用の行指向のコマンドシェル。各行を単
+// 語に分け、最初の単語を登録されたコマンドに振り分け、その返答かエラーを
+// 書く。バイト列はFeedかio.Readerから入り、返答はio.Writerに出るので、シェ
+// ル全体をホストのテストで動かせる。
+package console
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// MaxLine is the longest line accepted; longer lines are rejected.
+//
+// MaxLineは、受け付ける最長の行。それより長い行は拒否する。
+const MaxLine = 128
+
+// ErrUsage makes the shell reply with the usage of the command instead of
+// the error text.
+//
+// ErrUsageを返すと、シェルはエラーの文言の代わりにコマンドの使い方を返答
+// する。
+var ErrUsage = errors.New("usage")
+
+// Handler runs a command. args[0] is the command name. It writes its reply
+// to w and returns nil, or returns an error that the shell reports.
+//
+// Handlerは、コマンドを実行する。args[0]はコマンド名。返答をwに書いて
+// nilを返すか、シェルが報告するエラーを返す。
+type Handler func(w io.Writer, args []string) error
+
+// Command is a registered command.
+//
+// Commandは、登録されたコマンド。
+type Command struct {
+	Name string
+	// Arguments and one-line description shown by help.
+	// helpで表示する引数と1行の説明
+	Args, Help string
+	Run        Handler
+}
+
+// Shell reads command lines and dispatches them.
+//
+// Shellは、コマンド行を読み取って振り分ける。
+type Shell struct {
+	// If Echo is set, typed characters are echoed, backspace edits the
+	// line and a prompt is shown, for a human on a terminal. Without it
+	// only replies are written, for programs.
+	// Echoが設定されていれば、入力した文字をエコーし、バックスペースで行を
+	// 編集でき、プロンプトを表示する。端末の人間向け。無ければ返答だけを書
+	// く。プログラム向け。
+	Echo   bool
+	Prompt string
+
+	w        io.Writer
+	commands []Command
+	line     []byte
+	// Set when the current line grew past MaxLine.
+	// 現在の行がMaxLineを超えたときに設定される。
+	overflow bool
+	// Set after a CR, so the LF of a CRLF does not end another line.
+	// CRの後に設定される。CRLFのLFで別の行を終わらせないため。
+	afterCR bool
+}
+
+// New creates a Shell writing to w, with echo off and the help and echo
+// commands registered.
+//
+// Newは、wに書き込むShellを作る。エコーは無効で、helpとechoのコマンドを
+// 登録しておく。
+func New(w io.Writer) *Shell {
+	s := &Shell{w: w, Prompt: "> ", line: make([]byte, 0, MaxLine)}
+	s.Register(Command{Name: "help", Args: "[command]", Help: "list commands or show one", Run: s.help})
+	s.Register(Command{Name: "echo", Args: "on|off", Help: "echo typed characters", Run: s.echo})
+	return s
+}
+
+// Register adds a command, replacing one with the same name.
+//
+// Registerは、コマンドを追加する。同じ名前のコマンドがあれば置き換える。
+func (s *Shell) Register(c Command) {
+	for i := range s.commands {
+		if s.commands[i].Name == c.Name {
+			s.commands[i] = c
+			return
+		}
+	}
+	s.commands = append(s.commands, c)
+}
+
+// Feed processes received bytes, running each complete line.
+//
+// Feedは、受信したバイト列を処理し、完成した行をそれぞれ実行する。
+func (s *Shell) Feed(p []byte) {
+	for _, c := range p {
+		afterCR := s.afterCR
+		s.afterCR = c == '\r'
+		switch {
+		case c == '\n' && afterCR:
+		case c == '\r' || c == '\n':
+			if s.Echo {
+				s.write("\r\n")
+			}
+			if s.overflow {
+				s.write("error: line too long\r\n")
+			} else {
+				s.Exec(string(s.line))
+			}
+			s.line = s.line[:0]
+			s.overflow = false
+			s.prompt()
+		case c == '\b' || c == 0x7F:
+			if len(s.line) > 0 {
+				s.line = s.line[:len(s.line)-1]
+				if s.Echo {
+					s.write("\b \b")
+				}
+			}
+		case c < ' ':
+			// Ignore other control characters.
+			// その他の制御文字は無視する。
+		default:
+			if len(s.line) == MaxLine {
+				s.overflow = true
+				continue
+			}
+			s.line = append(s.line, c)
+			if s.Echo {
+				s.w.Write([]byte{c})
+			}
+		}
+	}
+}
+
+// Serve feeds everything read from r until it returns an error, and
+// returns that error, or nil at io.EOF.
+//
+// Serveは、rがエラーを返すまで読み取ったものをすべてFeedし、そのエラーを
+// 返す。io.EOFならnilを返す。
+func (s *Shell) Serve(r io.Reader) error {
+	var buf [64]byte
+	s.prompt()
+	for {
+		n, err := r.Read(buf[:])
+		s.Feed(buf[:n])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Exec runs one command line. Empty lines do nothing.
+//
+// Execは、コマンド行を1つ実行する。空行は何もしない。
+func (s *Shell) Exec(line string) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return
+	}
+	c := s.find(args[0])
+	if c == nil {
+		s.write("error: unknown command: " + args[0] + "\r\n")
+		return
+	}
+	err := c.Run(s.w, args)
+	switch {
+	case errors.Is(err, ErrUsage):
+		s.write("usage: " + c.Name + " " + c.Args + "\r\n")
+	case err != nil:
+		s.write("error: " + err.Error() + "\r\n")
+	}
+}
+
+func (s *Shell) find(name string) *Command {
+	for i := range s.commands {
+		if s.commands[i].Name == name {
+			return &s.commands[i]
+		}
+	}
+	return nil
+}
+
+func (s *Shell) prompt() {
+	if s.Echo {
+		s.write(s.Prompt)
+	}
+}
+
+func (s *Shell) write(str string) {
+	io.WriteString(s.w, str)
+}
+
+func (s *Shell) help(w io.Writer, args []string) error {
+	if len(args) > 2 {
+		return ErrUsage
+	}
+	for _, c := range s.commands {
+		if len(args) == 2 && c.Name != args[1] {
+			continue
+		}
+		io.WriteString(w, c.Name+" "+c.Args+"\r\n    "+c.Help+"\r\n")
+		if len(args) == 2 {
+			return nil
+		}
+	}
+	if len(args) == 2 {
+		return errors.New("unknown command: " + args[1])
+	}
+	return nil
+}
+
+func (s *Shell) echo(w io.Writer, args []string) error {
+	if len(args) != 2 {
+		return ErrUsage
+	}
+	on, err := ParseOnOff(args[1])
+	if err != nil {
+		return err
+	}
+	s.Echo = on
+	return OK(w)
+}
@@ -0,0 +1,129 @@
+package console
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Note: tinygo test ./console
+
+// 引数をそのまま返すコマンドと、失敗するコマンドを登録したシェル
+func newTestShell(out *bytes.Buffer) *Shell {
+	s := New(out)
+	s.Register(Command{Name: "say", Args: "<words...>", Help: "say the words", Run: func(w io.Writer, args []string) error {
+		if len(args) < 2 {
+			return ErrUsage
+		}
+		io.WriteString(w, strings.Join(args[1:], " ")+"\r\n")
+		return nil
+	}})
+	s.Register(Command{Name: "fail", Help: "always fail", Run: func(w io.Writer, args []string) error {
+		return errors.New("it failed")
+	}})
+	return s
+}
+
+func TestShell_NoEcho(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "コマンド", input: "say hello world\n", expected: "hello world\r\n"},
+		{name: "余分な空白", input: "  say   a \t b  \r", expected: "a b\r\n"},
+		{name: "CRLFは1行", input: "say a\r\nsay b\r\n", expected: "a\r\nb\r\n"},
+		{name: "空行は無視", input: "\n\r\n\n", expected: ""},
+		{name: "行の途中では実行しない", input: "say a", expected: ""},
+		{name: "知らないコマンド", input: "jump\n", expected: "error: unknown command: jump\r\n"},
+		{name: "使い方", input: "say\n", expected: "usage: say <words...>\r\n"},
+		{name: "エラー", input: "fail\n", expected: "error: it failed\r\n"},
+		{name: "制御文字は無視", input: "sa\x01y a\n", expected: "a\r\n"},
+		{name: "バックスペース", input: "sax\by a\x7fb\n", expected: "b\r\n"},
+		{name: "長すぎる行", input: "say " + strings.Repeat("x", MaxLine) + "\nsay ok\n", expected: "error: line too long\r\nok\r\n"},
+		{name: "ヘルプ", input: "help say\n", expected: "say <words...>\r\n    say the words\r\n"},
+		{name: "知らないコマンドのヘルプ", input: "help jump\n", expected: "error: unknown command: jump\r\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			s := newTestShell(&out)
+			s.Feed([]byte(tc.input))
+			if out.String() != tc.expected {
+				t.Errorf("期待する出力は %q 、実際は %q で異なる", tc.expected, out.String())
+			}
+		})
+	}
+}
+
+// エコーありでは、入力とプロンプトも返す
+func TestShell_Echo(t *testing.T) {
+	var out bytes.Buffer
+	s := newTestShell(&out)
+	s.Feed([]byte("echo on\r"))
+	s.Feed([]byte("sax\by hi\r"))
+	s.Feed([]byte("echo off\r"))
+	s.Feed([]byte("say bye\r"))
+
+	expected := "ok\r\n> " +
+		"sax\b \by hi\r\nhi\r\n> " +
+		"echo off\r\nok\r\n" +
+		"bye\r\n"
+	if out.String() != expected {
+		t.Errorf("期待する出力は %q 、実際は %q で異なる", expected, out.String())
+	}
+}
+
+// 1バイトずつ届いても同じ
+func TestShell_Serve(t *testing.T) {
+	var out bytes.Buffer
+	s := newTestShell(&out)
+	if err := s.Serve(&oneByteReader{r: strings.NewReader("say one\nsay two\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "one\r\ntwo\r\n"; out.String() != expected {
+		t.Errorf("期待する出力は %q 、実際は %q で異なる", expected, out.String())
+	}
+}
+
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (o *oneByteReader) Read(p []byte) (int, error) {
+	return o.r.Read(p[:1])
+}
+
+func TestParseDuty(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected uint32
+		ok       bool
+	}{
+		{input: "30%", expected: 12000, ok: true},
+		{input: "12.5%", expected: 5000, ok: true},
+		{input: "100%", expected: 40000, ok: true},
+		{input: "0%", expected: 0, ok: true},
+		{input: "12000", expected: 12000, ok: true},
+		{input: "101%", ok: false},
+		{input: "-5%", ok: false},
+		{input: "40001", ok: false},
+		{input: "fast", ok: false},
+		{input: "NaN", ok: false},
+		{input: "nan%", ok: false},
+		{input: "NaN%", ok: false},
+		{input: "Inf%", ok: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := ParseDuty(tc.input)
+			if (err == nil) != tc.ok || got != tc.expected {
+				t.Errorf("期待する結果は %d (%v)、実際は %d (%v) で異なる", tc.expected, tc.ok, got, err)
+			}
+		})
+	}
+}
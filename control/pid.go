@@ -0,0 +1,154 @@
+// Package control provides closed-loop speed control for the fans.
+//
+// Outputs are in the same duty units as the PWM period (0-fan.MaxDuty).
+//
+// controlパッケージは、ファンの閉ループ速度制御を提供する。
+// 出力はPWM周期と同じデューティ単位(0-fan.MaxDuty)。
+package control
+
+import (
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// DefaultDerivativeTau is the default time constant of the derivative
+// low-pass filter.
+//
+// DefaultDerivativeTauは、微分項のローパスフィルタの時定数のデフォルト。
+const DefaultDerivativeTau = 500 * time.Millisecond
+
+// PID is a PID controller with output clamping, integrator anti-windup
+// and a filtered derivative on the measurement.
+//
+// PIDは、出力制限、積分器のアンチワインドアップ、計測値に対するフィルタ
+// 付き微分項を持つPID制御器。
+type PID struct {
+	// Gains. Ki is per second and Kd is in seconds.
+	// ゲイン。Kiは毎秒、Kdは秒の単位。
+	Kp, Ki, Kd float32
+	// Time constant of the derivative low-pass filter. 0 disables the
+	// filter.
+	// 微分項のローパスフィルタの時定数。0ならフィルタしない。
+	DerivativeTau time.Duration
+	// Output limits.
+	// 出力の上下限
+	OutMin, OutMax float32
+
+	integral     float32
+	derivative   float32
+	prevMeasured float32
+	output       float32
+	primed       bool
+}
+
+// NewPID creates a PID controller with the given gains, limited to
+// 0-fan.MaxDuty.
+//
+// NewPIDは、指定されたゲインで、出力を0-fan.MaxDutyに制限したPID制御器を
+// 作る。
+func NewPID(kp, ki, kd float32) *PID {
+	return &PID{
+		Kp:            kp,
+		Ki:            ki,
+		Kd:            kd,
+		DerivativeTau: DefaultDerivativeTau,
+		OutMin:        0,
+		OutMax:        fan.MaxDuty,
+	}
+}
+
+// Output returns the last output.
+//
+// Outputは、直近の出力を返す。
+func (p *PID) Output() float32 {
+	return p.output
+}
+
+// Reset clears the controller state.
+//
+// Resetは、制御器の状態を消す。
+func (p *PID) Reset() {
+	p.integral = 0
+	p.derivative = 0
+	p.output = 0
+	p.primed = false
+}
+
+// Update advances the controller by dt and returns the new output.
+// A non-positive dt returns the previous output unchanged.
+//
+// Updateは、制御器をdtだけ進めて新しい出力を返す。dtが0以下なら前回の出
+// 力をそのまま返す。
+func (p *PID) Update(setpoint, measured float32, dt time.Duration) float32 {
+	sec := float32(dt.Seconds())
+	if sec <= 0 {
+		return p.output
+	}
+	if !p.primed {
+		p.prevMeasured = measured
+		p.primed = true
+	}
+
+	err := setpoint - measured
+
+	// Differentiate the measurement rather than the error, so a setpoint
+	// change does not kick the output.
+	// 目標値の変更で出力が跳ねないよう、誤差ではなく計測値を微分する。
+	rawDerivative := -(measured - p.prevMeasured) / sec
+	p.prevMeasured = measured
+	tau := float32(p.DerivativeTau.Seconds())
+	p.derivative += sec / (tau + sec) * (rawDerivative - p.derivative)
+
+	integral := p.integral + p.Ki*err*sec
+	out := p.Kp*err + integral + p.Kd*p.derivative
+
+	// Anti-windup: while saturated, only accept integration that pulls
+	// the output back inside the limits.
+	// アンチワインドアップ：飽和している間は、出力を範囲内に戻す方向の積分
+	// だけを受け入れる。
+	switch {
+	case out > p.OutMax:
+		out = p.OutMax
+		if err < 0 {
+			p.integral = integral
+		}
+	case out < p.OutMin:
+		out = p.OutMin
+		if err > 0 {
+			p.integral = integral
+		}
+	default:
+		p.integral = integral
+	}
+	p.integral = clamp(p.integral, p.OutMin, p.OutMax)
+
+	p.output = out
+	return out
+}
+
+// Track aligns the controller with an output that was set elsewhere, so
+// a later switch to closed loop is bumpless. Call it on every cycle while
+// the controller is not in charge.
+//
+// Trackは、他で設定された出力に制御器を合わせて、後で閉ループに切り替え
+// たときに出力が跳ねないようにする。制御器が担当していない間、毎周期呼ぶ
+// こと。
+func (p *PID) Track(output, setpoint, measured float32) {
+	output = clamp(output, p.OutMin, p.OutMax)
+	p.integral = clamp(output-p.Kp*(setpoint-measured), p.OutMin, p.OutMax)
+	p.derivative = 0
+	p.prevMeasured = measured
+	p.primed = true
+	p.output = output
+}
+
+func clamp(v, min, max float32) float32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,140 @@
+package control
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// Note: tinygo test ./control
+
+// 1次遅れのファンモデル。定常状態のRPMはデューティに比例する。
+type fanPlant struct {
+	maxRPM float64
+	tau    float64 // 時定数(秒)
+	rpm    float64
+}
+
+func (p *fanPlant) step(duty uint32, dt time.Duration) uint32 {
+	target := p.maxRPM * float64(duty) / fan.MaxDuty
+	p.rpm += (target - p.rpm) * (1 - math.Exp(-dt.Seconds()/p.tau))
+	return uint32(p.rpm + 0.5)
+}
+
+// テスト用の標準的なゲイン
+func newTestPID() *PID {
+	return NewPID(4, 8, 0.5)
+}
+
+// 目標RPMへ収束し、出力が範囲内に収まること
+func TestPID_Converges(t *testing.T) {
+	testCases := []struct {
+		name   string
+		target float32
+	}{
+		{name: "低速", target: 600},
+		{name: "中速", target: 1500},
+		{name: "高速", target: 2700},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			plant := &fanPlant{maxRPM: 3000, tau: 1.5}
+			pid := newTestPID()
+			dt := 250 * time.Millisecond
+			measured := uint32(0)
+			for i := 0; i < 160; i++ { // 40秒
+				out := pid.Update(tc.target, float32(measured), dt)
+				if out < 0 || out > fan.MaxDuty {
+					t.Fatalf("出力 %v が範囲外", out)
+				}
+				measured = plant.step(uint32(out), dt)
+			}
+			if diff := math.Abs(float64(measured) - float64(tc.target)); diff > float64(tc.target)*0.02 {
+				t.Errorf("期待するRPMは %v 付近、実際は %d で異なる", tc.target, measured)
+			}
+		})
+	}
+}
+
+// 届かない目標で飽和した後でも、積分器が溜まりすぎず素早く戻ること
+func TestPID_AntiWindup(t *testing.T) {
+	plant := &fanPlant{maxRPM: 3000, tau: 1.5}
+	pid := newTestPID()
+	dt := 250 * time.Millisecond
+	measured := uint32(0)
+
+	for i := 0; i < 240; i++ { // 60秒間、届かない目標
+		out := pid.Update(5000, float32(measured), dt)
+		measured = plant.step(uint32(out), dt)
+	}
+	if pid.Output() != fan.MaxDuty {
+		t.Fatalf("飽和中の期待する出力は %v 、実際は %v で異なる", fan.MaxDuty, pid.Output())
+	}
+
+	// 目標を下げたら10秒以内に戻る
+	for i := 0; i < 40; i++ {
+		out := pid.Update(1500, float32(measured), dt)
+		measured = plant.step(uint32(out), dt)
+	}
+	if diff := math.Abs(float64(measured) - 1500); diff > 30 {
+		t.Errorf("期待するRPMは 1500 付近、実際は %d で異なる", measured)
+	}
+}
+
+// 出力が設定した上下限に収まること
+func TestPID_OutputClamp(t *testing.T) {
+	pid := NewPID(100, 0, 0)
+	pid.OutMin = 8000
+	pid.OutMax = 30000
+
+	if out := pid.Update(3000, 0, time.Second); out != 30000 {
+		t.Errorf("期待する出力は 30000 、実際は %v で異なる", out)
+	}
+	if out := pid.Update(0, 3000, time.Second); out != 8000 {
+		t.Errorf("期待する出力は 8000 、実際は %v で異なる", out)
+	}
+}
+
+// 微分項はローパスフィルタを通るので、計測値の段差で出力が跳ねすぎない
+func TestPID_DerivativeFilter(t *testing.T) {
+	filtered := NewPID(0, 0, 1)
+	unfiltered := NewPID(0, 0, 1)
+	unfiltered.DerivativeTau = 0
+	filtered.OutMin, unfiltered.OutMin = -1e6, -1e6
+	dt := 100 * time.Millisecond
+
+	filtered.Update(0, 1000, dt)
+	unfiltered.Update(0, 1000, dt)
+	f := filtered.Update(0, 900, dt)
+	u := unfiltered.Update(0, 900, dt)
+
+	// 100 RPM / 0.1 s = 1000 RPM/s
+	if u != 1000 {
+		t.Errorf("フィルタ無しの期待する出力は 1000 、実際は %v で異なる", u)
+	}
+	// alpha = 0.1 / (0.5 + 0.1)
+	if math.Abs(float64(f)-1000.0/6) > 0.01 {
+		t.Errorf("フィルタ有りの期待する出力は %v 、実際は %v で異なる", 1000.0/6, f)
+	}
+}
+
+// 目標値の変更では微分項が跳ねない
+func TestPID_NoDerivativeKick(t *testing.T) {
+	pid := NewPID(0, 0, 10)
+	pid.Update(1000, 1000, time.Second)
+	if out := pid.Update(3000, 1000, time.Second); out != 0 {
+		t.Errorf("期待する出力は 0 、実際は %v で異なる", out)
+	}
+}
+
+// dtが0以下なら前回の出力を返す
+func TestPID_ZeroDt(t *testing.T) {
+	pid := NewPID(1, 0, 0)
+	first := pid.Update(2000, 1000, time.Second)
+	if out := pid.Update(3000, 0, 0); out != first {
+		t.Errorf("期待する出力は %v 、実際は %v で異なる", first, out)
+	}
+}
@@ -0,0 +1,147 @@
+package control
+
+import (
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// RampConfig holds the slew rates of a Ramp, in duty units per second.
+// A zero rate means unlimited.
+//
+// RampConfigは、Rampの変化率(デューティ単位/秒)を持つ。0は無制限を表す。
+type RampConfig struct {
+	// Largest rise and fall of the duty per second.
+	// 1秒あたりのデューティの上昇と下降の上限
+	Up, Down uint32
+	// Rise rate used during a soft start, and how long it lasts.
+	// ソフトスタート中に使う上昇率と、その継続時間
+	SoftStartRate uint32
+	SoftStartTime time.Duration
+}
+
+// DefaultRampConfig returns rates that take 2s from off to full speed, or
+// 5s during a soft start.
+//
+// DefaultRampConfigは、停止から全速まで2秒、ソフトスタート中は5秒かける変
+// 化率を返す。
+func DefaultRampConfig() RampConfig {
+	return RampConfig{
+		Up:            fan.MaxDuty / 2,
+		Down:          fan.MaxDuty,
+		SoftStartRate: fan.MaxDuty / 5,
+		SoftStartTime: 5 * time.Second,
+	}
+}
+
+// Ramp limits how fast the duty may change between a control source and
+// the PWM output, to avoid current spikes on the supply.
+//
+// Rampは、電源の電流スパイクを避けるため、制御元とPWM出力の間でデューティ
+// が変化する速さを制限する。
+type Ramp struct {
+	Config RampConfig
+
+	output float32
+	// Time left in the current soft start.
+	// 現在のソフトスタートの残り時間
+	softLeft time.Duration
+}
+
+// NewRamp creates a Ramp starting from 0.
+//
+// NewRampは、0から始まるRampを作る。
+func NewRamp(cfg RampConfig) *Ramp {
+	return &Ramp{Config: cfg}
+}
+
+// Output returns the last output.
+//
+// Outputは、直近の出力を返す。
+func (r *Ramp) Output() uint32 {
+	return uint32(r.output + 0.5)
+}
+
+// Reset jumps the output to value without ramping.
+//
+// Resetは、ランプを使わずに出力をvalueにする。
+func (r *Ramp) Reset(value uint32) {
+	r.output = float32(value)
+}
+
+// StartSoft restarts the output from 0 with a soft start: for
+// SoftStartTime it rises no faster than SoftStartRate. Use it at power-up.
+//
+// StartSoftは、出力を0からソフトスタートでやり直す。SoftStartTimeの間、
+// 出力はSoftStartRateより速く上がらない。起動時に使う。
+func (r *Ramp) StartSoft() {
+	r.StartSoftFrom(0)
+}
+
+// StartSoftFrom is StartSoft from value instead of 0. Use it after a fault
+// clears, with the duty the fan runs at, so the fan ramps down from there
+// instead of stopping.
+//
+// StartSoftFromは、0の代わりにvalueから始めるStartSoft。異常が解除された
+// 後に、ファンが回っているデューティを渡して使う。これでファンは止まらず
+// にそこから下がっていく。
+func (r *Ramp) StartSoftFrom(value uint32) {
+	r.output = float32(value)
+	r.softLeft = r.Config.SoftStartTime
+}
+
+// SoftStarting reports whether a soft start is in progress.
+//
+// SoftStartingは、ソフトスタート中かどうかを返す。
+func (r *Ramp) SoftStarting() bool {
+	return r.softLeft > 0
+}
+
+// RiseRate returns the largest rise of the output per second right now,
+// which is the slower one during a soft start. 0 means unlimited.
+//
+// RiseRateは、今の1秒あたりの出力の上昇の上限を返す。ソフトスタート中は
+// 遅い方になる。0は無制限を表す。
+func (r *Ramp) RiseRate() uint32 {
+	up := r.Config.Up
+	if r.softLeft > 0 && (up == 0 || (r.Config.SoftStartRate != 0 && r.Config.SoftStartRate < up)) {
+		up = r.Config.SoftStartRate
+	}
+	return up
+}
+
+// Update moves the output towards target by at most the allowed change
+// over dt and returns it.
+//
+// Updateは、dtの間に許される変化量までで出力をtargetに近づけ、それを返す。
+func (r *Ramp) Update(target uint32, dt time.Duration) uint32 {
+	if dt < 0 {
+		dt = 0
+	}
+	up := r.RiseRate()
+	if r.softLeft > 0 {
+		r.softLeft -= dt
+	}
+
+	t := float32(target)
+	sec := float32(dt.Seconds())
+	switch {
+	case t > r.output:
+		r.output = step(r.output, t, up, sec)
+	case t < r.output:
+		r.output = -step(-r.output, -t, r.Config.Down, sec)
+	}
+	return r.Output()
+}
+
+// step moves from towards a larger to by at most rate*sec. A zero rate
+// jumps straight to to.
+func step(from, to float32, rate uint32, sec float32) float32 {
+	if rate == 0 {
+		return to
+	}
+	if next := from + float32(rate)*sec; next < to {
+		return next
+	}
+	return to
+}
@@ -0,0 +1,135 @@
+package control
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// 50msごとに更新したときの出力の推移
+func rampOutputs(r *Ramp, target uint32, ticks int) []uint32 {
+	out := make([]uint32, ticks)
+	for i := range out {
+		out[i] = r.Update(target, 50*time.Millisecond)
+	}
+	return out
+}
+
+func TestRamp_SlewRates(t *testing.T) {
+	testCases := []struct {
+		name     string
+		start    uint32
+		target   uint32
+		expected []uint32
+	}{
+		{
+			name:     "上昇：毎秒20000",
+			start:    0,
+			target:   fan.MaxDuty,
+			expected: []uint32{1000, 2000, 3000, 4000},
+		},
+		{
+			name:     "下降：毎秒40000",
+			start:    fan.MaxDuty,
+			target:   0,
+			expected: []uint32{38000, 36000, 34000, 32000},
+		},
+		{
+			name:     "目標を超えない",
+			start:    9500,
+			target:   10500,
+			expected: []uint32{10500, 10500, 10500},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRamp(DefaultRampConfig())
+			r.Reset(tc.start)
+			got := rampOutputs(r, tc.target, len(tc.expected))
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Fatalf("期待する推移は %v 、実際は %v で異なる", tc.expected, got)
+				}
+			}
+		})
+	}
+}
+
+// 0から全速まで、設定どおりの時間がかかる
+func TestRamp_TimeToFull(t *testing.T) {
+	r := NewRamp(DefaultRampConfig())
+	ticks := 0
+	for r.Update(fan.MaxDuty, 50*time.Millisecond) < fan.MaxDuty {
+		ticks++
+	}
+	if elapsed := time.Duration(ticks+1) * 50 * time.Millisecond; elapsed != 2*time.Second {
+		t.Errorf("期待する所要時間は 2s 、実際は %v で異なる", elapsed)
+	}
+}
+
+// ソフトスタート中は上昇が遅く、終わったら通常の上昇率に戻る
+func TestRamp_SoftStart(t *testing.T) {
+	r := NewRamp(DefaultRampConfig())
+	r.StartSoft()
+	if !r.SoftStarting() {
+		t.Fatal("ソフトスタート中のはず")
+	}
+
+	// 毎秒8000
+	got := rampOutputs(r, fan.MaxDuty, 2)
+	if got[0] != 400 || got[1] != 800 {
+		t.Errorf("期待する推移は [400 800] 、実際は %v で異なる", got)
+	}
+
+	// 5秒経てば終わる
+	rampOutputs(r, fan.MaxDuty, 98)
+	if r.SoftStarting() {
+		t.Error("ソフトスタートは終わっているはず")
+	}
+	r.Reset(0)
+	if got := r.Update(fan.MaxDuty, 50*time.Millisecond); got != 1000 {
+		t.Errorf("通常の期待する出力は 1000 、実際は %d で異なる", got)
+	}
+}
+
+// ソフトスタートは0からやり直す
+func TestRamp_SoftStartRestartsFromZero(t *testing.T) {
+	r := NewRamp(DefaultRampConfig())
+	r.Reset(fan.MaxDuty)
+	r.StartSoft()
+	if got := r.Update(fan.MaxDuty, 50*time.Millisecond); got != 400 {
+		t.Errorf("期待する出力は 400 、実際は %d で異なる", got)
+	}
+}
+
+// 異常の解除後は、今のデューティからソフトスタートする
+func TestRamp_StartSoftFrom(t *testing.T) {
+	r := NewRamp(DefaultRampConfig())
+	r.StartSoftFrom(fan.MaxDuty)
+	if !r.SoftStarting() {
+		t.Fatal("ソフトスタート中のはず")
+	}
+	// 下降は通常どおり毎秒40000
+	if got := r.Update(10000, 50*time.Millisecond); got != 38000 {
+		t.Errorf("期待する出力は 38000 、実際は %d で異なる", got)
+	}
+	// 上昇はソフトスタートの毎秒8000
+	r.Reset(10000)
+	if got := r.Update(fan.MaxDuty, 50*time.Millisecond); got != 10400 {
+		t.Errorf("期待する出力は 10400 、実際は %d で異なる", got)
+	}
+}
+
+// 0は無制限
+func TestRamp_Unlimited(t *testing.T) {
+	r := NewRamp(RampConfig{})
+	if got := r.Update(fan.MaxDuty, 50*time.Millisecond); got != fan.MaxDuty {
+		t.Errorf("期待する出力は %d 、実際は %d で異なる", fan.MaxDuty, got)
+	}
+	r.StartSoft()
+	if got := r.Update(fan.MaxDuty, 50*time.Millisecond); got != fan.MaxDuty {
+		t.Errorf("ソフトスタート中の期待する出力は %d 、実際は %d で異なる", fan.MaxDuty, got)
+	}
+}
@@ -0,0 +1,139 @@
+package control
+
+import (
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+const (
+	// DefaultRatio is the default rear/front RPM ratio.
+	// DefaultRatioは、後ろ/前のRPM比のデフォルト。
+	DefaultRatio = 0.85
+
+	// MinRatio and MaxRatio bound the ratio accepted by SetRatio.
+	// MinRatioとMaxRatioは、SetRatioが受け付ける比の範囲。
+	MinRatio = 0.25
+	MaxRatio = 2.0
+)
+
+// RatioController holds the rear rotor of a contra-rotating pair at a
+// fixed RPM ratio to the front rotor by trimming the rear duty.
+//
+// RatioControllerは、後ろ側のデューティを補正して、二重反転ファンの後ろ側
+// ローターを前側ローターに対して一定のRPM比に保つ。
+type RatioController struct {
+	// Gains applied to the RPM error. Ki is per second.
+	// RPM誤差に掛けるゲイン。Kiは毎秒。
+	Kp, Ki float32
+	// Largest trim, in duty units, added to or taken from the front duty.
+	// 前側のデューティに足し引きする補正量の上限(デューティ単位)
+	MaxTrim uint32
+
+	ratio    float32
+	trim     float32
+	fallback bool
+	output   uint32
+}
+
+// NewRatioController creates a RatioController holding DefaultRatio.
+//
+// NewRatioControllerは、DefaultRatioを保つRatioControllerを作る。
+func NewRatioController() *RatioController {
+	return &RatioController{
+		Ki:      2,
+		MaxTrim: fan.MaxDuty / 4,
+		ratio:   DefaultRatio,
+	}
+}
+
+// Ratio returns the target rear/front RPM ratio.
+//
+// Ratioは、目標の後ろ/前RPM比を返す。
+func (r *RatioController) Ratio() float32 {
+	return r.ratio
+}
+
+// SetRatio sets the target rear/front RPM ratio, clamped to
+// MinRatio-MaxRatio.
+//
+// SetRatioは、目標の後ろ/前RPM比を設定する。MinRatio-MaxRatioに収める。
+func (r *RatioController) SetRatio(ratio float32) {
+	r.ratio = clamp(ratio, MinRatio, MaxRatio)
+}
+
+// Trim returns the current trim of the rear duty.
+//
+// Trimは、後ろ側のデューティの現在の補正量を返す。
+func (r *RatioController) Trim() float32 {
+	return r.trim
+}
+
+// Fallback reports whether the last update fell back to driving the rear
+// rotor with the front duty because a tach had failed.
+//
+// Fallbackは、タコ信号の故障のため、直近の更新で後ろ側ローターを前側のデ
+// ューティで駆動するようにフォールバックしたかどうかを返す。
+func (r *RatioController) Fallback() bool {
+	return r.fallback
+}
+
+// Reset drops the accumulated trim.
+//
+// Resetは、積算した補正量を捨てる。
+func (r *RatioController) Reset() {
+	r.trim = 0
+}
+
+// Update advances the controller by dt and returns the rear duty.
+// frontDuty is the duty of the front rotor, frontRPM and rearRPM the
+// measured speeds and frontFault and rearFault the rotor faults, e.g.
+// from DualFan.Faults. If either tach has failed, the trim is dropped and
+// the rear rotor simply follows frontDuty.
+//
+// Updateは、制御器をdtだけ進めて後ろ側のデューティを返す。
+// frontDutyは前側ローターのデューティ、frontRPMとrearRPMは計測した速度、
+// frontFaultとrearFaultはローターの異常(例えばDualFan.Faultsの値)。どち
+// らかのタコ信号が故障していれば、補正量を捨てて後ろ側ローターは単に
+// frontDutyに従う。
+func (r *RatioController) Update(frontDuty, frontRPM, rearRPM uint32, frontFault, rearFault fan.Fault, dt time.Duration) uint32 {
+	const tachFailed = fan.FaultTachMissing | fan.FaultStalled
+	r.fallback = frontFault&tachFailed != 0 || rearFault&tachFailed != 0
+	if r.fallback || frontDuty == 0 {
+		r.trim = 0
+		r.output = frontDuty
+		return r.output
+	}
+
+	err := r.ratio*float32(frontRPM) - float32(rearRPM)
+	maxTrim := float32(r.MaxTrim)
+
+	// Hold the trim while the front rotor has not spun up, as the ratio
+	// is meaningless then.
+	// 前側ローターが回り出すまでは比に意味が無いので、補正量を保持する。
+	trim := r.trim
+	if frontRPM > 0 && dt > 0 {
+		trim = clamp(trim+r.Ki*err*float32(dt.Seconds()), -maxTrim, maxTrim)
+	}
+	out := float32(frontDuty) + clamp(trim+r.Kp*err, -maxTrim, maxTrim)
+
+	// Anti-windup: do not keep integrating into a saturated output.
+	// アンチワインドアップ：飽和した出力に向かって積分し続けない。
+	switch {
+	case out > fan.MaxDuty:
+		out = fan.MaxDuty
+		if trim < r.trim {
+			r.trim = trim
+		}
+	case out < 0:
+		out = 0
+		if trim > r.trim {
+			r.trim = trim
+		}
+	default:
+		r.trim = trim
+	}
+
+	r.output = uint32(out + 0.5)
+	return r.output
+}
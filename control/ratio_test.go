@@ -0,0 +1,139 @@
+package control
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// 後ろ側が前側より非力なペアでも、目標の比に収束すること
+func TestRatioController_Converges(t *testing.T) {
+	testCases := []struct {
+		name      string
+		ratio     float32
+		frontDuty uint32
+		rearMax   float64
+	}{
+		{name: "0.85・後ろが同じ性能", ratio: 0.85, frontDuty: 30000, rearMax: 3000},
+		{name: "0.85・後ろが非力", ratio: 0.85, frontDuty: 20000, rearMax: 2200},
+		{name: "1.1・後ろを速く", ratio: 1.1, frontDuty: 20000, rearMax: 3000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			front := &fanPlant{maxRPM: 3000, tau: 1.5}
+			rear := &fanPlant{maxRPM: tc.rearMax, tau: 1.5}
+			r := NewRatioController()
+			r.SetRatio(tc.ratio)
+			dt := 250 * time.Millisecond
+
+			var frontRPM, rearRPM uint32
+			for i := 0; i < 240; i++ { // 60秒
+				rearDuty := r.Update(tc.frontDuty, frontRPM, rearRPM, fan.FaultNone, fan.FaultNone, dt)
+				frontRPM = front.step(tc.frontDuty, dt)
+				rearRPM = rear.step(rearDuty, dt)
+			}
+
+			got := float32(rearRPM) / float32(frontRPM)
+			if got < tc.ratio-0.01 || got > tc.ratio+0.01 {
+				t.Errorf("期待する比は %v 、実際は %v (%d/%d) で異なる", tc.ratio, got, rearRPM, frontRPM)
+			}
+			if r.Fallback() {
+				t.Error("フォールバックしていないはず")
+			}
+		})
+	}
+}
+
+// 補正量がMaxTrimで制限されること
+func TestRatioController_TrimLimit(t *testing.T) {
+	r := NewRatioController()
+	r.MaxTrim = 4000
+	dt := 250 * time.Millisecond
+
+	// 後ろ側が全く追いつかない
+	var rearDuty uint32
+	for i := 0; i < 100; i++ {
+		rearDuty = r.Update(20000, 2000, 0, fan.FaultNone, fan.FaultNone, dt)
+	}
+	if rearDuty != 24000 {
+		t.Errorf("期待する後ろ側のデューティは 24000 、実際は %d で異なる", rearDuty)
+	}
+	if r.Trim() != 4000 {
+		t.Errorf("期待する補正量は 4000 、実際は %v で異なる", r.Trim())
+	}
+}
+
+// 出力がMaxDutyで飽和しても、補正量が溜まり続けないこと
+func TestRatioController_Saturation(t *testing.T) {
+	r := NewRatioController()
+	dt := 250 * time.Millisecond
+
+	var rearDuty uint32
+	for i := 0; i < 100; i++ {
+		rearDuty = r.Update(fan.MaxDuty-1000, 3000, 0, fan.FaultNone, fan.FaultNone, dt)
+	}
+	if rearDuty != fan.MaxDuty {
+		t.Errorf("期待する後ろ側のデューティは %d 、実際は %d で異なる", fan.MaxDuty, rearDuty)
+	}
+	if r.Trim() > 2000 {
+		t.Errorf("補正量 %v が溜まりすぎている", r.Trim())
+	}
+}
+
+// タコ信号が故障したら前側のデューティにフォールバックすること
+func TestRatioController_Fallback(t *testing.T) {
+	testCases := []struct {
+		name       string
+		frontFault fan.Fault
+		rearFault  fan.Fault
+		fallback   bool
+	}{
+		{name: "正常", frontFault: fan.FaultNone, rearFault: fan.FaultNone, fallback: false},
+		{name: "前側のタコ信号なし", frontFault: fan.FaultTachMissing, rearFault: fan.FaultNone, fallback: true},
+		{name: "後ろ側が停止", frontFault: fan.FaultNone, rearFault: fan.FaultStalled, fallback: true},
+		{name: "速度超過はフォールバックしない", frontFault: fan.FaultOverspeed, rearFault: fan.FaultNone, fallback: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := NewRatioController()
+			dt := 250 * time.Millisecond
+			for i := 0; i < 10; i++ {
+				r.Update(20000, 2000, 1000, fan.FaultNone, fan.FaultNone, dt)
+			}
+
+			rearDuty := r.Update(20000, 2000, 1000, tc.frontFault, tc.rearFault, dt)
+			if r.Fallback() != tc.fallback {
+				t.Errorf("期待するフォールバックは %v 、実際は %v で異なる", tc.fallback, r.Fallback())
+			}
+			if tc.fallback && (rearDuty != 20000 || r.Trim() != 0) {
+				t.Errorf("期待するのは 20000/0 、実際は %d/%v で異なる", rearDuty, r.Trim())
+			}
+		})
+	}
+}
+
+// 前側が止まっている間は後ろ側も止める
+func TestRatioController_FrontOff(t *testing.T) {
+	r := NewRatioController()
+	if rearDuty := r.Update(0, 0, 500, fan.FaultNone, fan.FaultNone, time.Second); rearDuty != 0 {
+		t.Errorf("期待する後ろ側のデューティは 0 、実際は %d で異なる", rearDuty)
+	}
+}
+
+func TestRatioController_SetRatio(t *testing.T) {
+	r := NewRatioController()
+	if r.Ratio() != DefaultRatio {
+		t.Errorf("期待する初期比は %v 、実際は %v で異なる", DefaultRatio, r.Ratio())
+	}
+	r.SetRatio(5)
+	if r.Ratio() != MaxRatio {
+		t.Errorf("期待する比は %v 、実際は %v で異なる", MaxRatio, r.Ratio())
+	}
+	r.SetRatio(0)
+	if r.Ratio() != MinRatio {
+		t.Errorf("期待する比は %v 、実際は %v で異なる", MinRatio, r.Ratio())
+	}
+}
@@ -0,0 +1,110 @@
+package control
+
+import "time"
+
+// Mode selects who drives the duty output.
+//
+// Modeは、デューティ出力を誰が決めるかを選ぶ。
+type Mode uint8
+
+const (
+	// ModeOpenLoop passes the requested duty through unchanged.
+	// ModeOpenLoopは、要求されたデューティをそのまま通す。
+	ModeOpenLoop Mode = iota
+	// ModeClosedLoop drives the duty from a PID controller to hold a
+	// target RPM.
+	// ModeClosedLoopは、目標RPMを保つようPID制御器でデューティを決める。
+	ModeClosedLoop
+)
+
+// String returns the name of the mode.
+func (m Mode) String() string {
+	switch m {
+	case ModeOpenLoop:
+		return "open"
+	case ModeClosedLoop:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// SpeedController switches between open-loop duty and closed-loop RPM
+// control without a bump in the output.
+//
+// SpeedControllerは、出力を跳ねさせずに、開ループのデューティと閉ループの
+// RPM制御を切り替える。
+type SpeedController struct {
+	PID    *PID
+	mode   Mode
+	target uint32
+	output uint32
+	// The last feedback seen by Update.
+	// Updateが最後に受け取ったフィードバック
+	measured uint32
+}
+
+// NewSpeedController creates a SpeedController in open-loop mode.
+//
+// NewSpeedControllerは、開ループモードのSpeedControllerを作る。
+func NewSpeedController(pid *PID) *SpeedController {
+	return &SpeedController{PID: pid}
+}
+
+// Mode returns the current mode.
+//
+// Modeは、現在のモードを返す。
+func (c *SpeedController) Mode() Mode {
+	return c.mode
+}
+
+// Target returns the target RPM used in closed-loop mode.
+//
+// Targetは、閉ループモードで使う目標RPMを返す。
+func (c *SpeedController) Target() uint32 {
+	return c.target
+}
+
+// Output returns the last duty output.
+//
+// Outputは、直近のデューティ出力を返す。
+func (c *SpeedController) Output() uint32 {
+	return c.output
+}
+
+// SetOpenLoop switches to open-loop mode.
+//
+// SetOpenLoopは、開ループモードに切り替える。
+func (c *SpeedController) SetOpenLoop() {
+	c.mode = ModeOpenLoop
+}
+
+// SetClosedLoop switches to closed-loop mode holding targetRPM. The PID
+// continues from the current output, so neither the switch nor a new
+// target makes the output jump.
+//
+// SetClosedLoopは、targetRPMを保つ閉ループモードに切り替える。PIDは現在の
+// 出力から続けるので、切り替えても目標を変えても出力は跳ねない。
+func (c *SpeedController) SetClosedLoop(targetRPM uint32) {
+	c.mode = ModeClosedLoop
+	c.target = targetRPM
+	c.PID.Track(float32(c.output), float32(c.target), float32(c.measured))
+}
+
+// Update advances the controller by dt and returns the duty to output.
+// openLoopDuty is used in open-loop mode; measuredRPM is the feedback,
+// e.g. the front rotor from DualFan.CalculateRPMs.
+//
+// Updateは、制御器をdtだけ進めて出力するデューティを返す。openLoopDutyは
+// 開ループモードで使い、measuredRPMはフィードバック(例えば
+// DualFan.CalculateRPMsの前側ローター)。
+func (c *SpeedController) Update(openLoopDuty, measuredRPM uint32, dt time.Duration) uint32 {
+	c.measured = measuredRPM
+	if c.mode == ModeOpenLoop {
+		c.PID.Track(float32(openLoopDuty), float32(c.target), float32(measuredRPM))
+		c.output = uint32(c.PID.Output() + 0.5)
+		return c.output
+	}
+	c.output = uint32(c.PID.Update(float32(c.target), float32(measuredRPM), dt) + 0.5)
+	return c.output
+}
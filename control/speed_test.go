@@ -0,0 +1,74 @@
+package control
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// 開ループから閉ループへの切り替えで出力が跳ねないこと
+func TestSpeedController_BumplessTransfer(t *testing.T) {
+	plant := &fanPlant{maxRPM: 3000, tau: 1.5}
+	c := NewSpeedController(newTestPID())
+	dt := 250 * time.Millisecond
+	measured := uint32(0)
+
+	// 開ループで20000のまま定常状態まで回す
+	for i := 0; i < 80; i++ {
+		out := c.Update(20000, measured, dt)
+		measured = plant.step(out, dt)
+	}
+	if c.Output() != 20000 {
+		t.Fatalf("開ループの期待する出力は 20000 、実際は %d で異なる", c.Output())
+	}
+
+	// 目標を今の回転数から離れた値にして閉ループへ
+	c.SetClosedLoop(2000)
+	out := c.Update(20000, measured, dt)
+	// 1周期分の積分だけ動く。積分器がゼロから始まると大きく落ちる。
+	if out < 20000 || out > 21500 {
+		t.Errorf("切り替え直後の期待する出力は 20000 付近、実際は %d で異なる", out)
+	}
+
+	for i := 0; i < 160; i++ {
+		measured = plant.step(out, dt)
+		out = c.Update(20000, measured, dt)
+	}
+	if measured < 1960 || measured > 2040 {
+		t.Errorf("期待するRPMは 2000 付近、実際は %d で異なる", measured)
+	}
+
+	// 閉ループから開ループへ戻すと要求デューティがそのまま出る
+	c.SetOpenLoop()
+	if out := c.Update(12000, measured, dt); out != 12000 {
+		t.Errorf("開ループの期待する出力は 12000 、実際は %d で異なる", out)
+	}
+}
+
+func TestSpeedController_Mode(t *testing.T) {
+	c := NewSpeedController(newTestPID())
+	if c.Mode() != ModeOpenLoop {
+		t.Errorf("期待する初期モードは %v 、実際は %v で異なる", ModeOpenLoop, c.Mode())
+	}
+	c.SetClosedLoop(2400)
+	if c.Mode() != ModeClosedLoop || c.Target() != 2400 {
+		t.Errorf("期待するのは %v/2400 、実際は %v/%d で異なる", ModeClosedLoop, c.Mode(), c.Target())
+	}
+}
+
+// ExampleSpeedController shows how to hold a target RPM.
+//
+// ExampleSpeedControllerは、目標RPMを保つ方法を示す。
+func ExampleSpeedController() {
+	plant := &fanPlant{maxRPM: 3000, tau: 1.5}
+	c := NewSpeedController(NewPID(4, 8, 0.5))
+	c.SetClosedLoop(1800)
+
+	measured := uint32(0)
+	for i := 0; i < 160; i++ {
+		duty := c.Update(0, measured, 250*time.Millisecond)
+		measured = plant.step(duty, 250*time.Millisecond)
+	}
+	fmt.Println("Holding", c.Target(), "RPM:", measured > 1780 && measured < 1820)
+	// Output: Holding 1800 RPM: true
+}
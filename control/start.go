@@ -0,0 +1,217 @@
+package control
+
+import (
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// StartConfig describes how a fan is spun up from rest. Most fans will not
+// start below about 20-30% duty but keep running well below that once
+// spinning.
+//
+// StartConfigは、停止したファンの回し始め方を表す。多くのファンは20-30%
+// 程度未満のデューティでは回り始めないが、一度回ればそれよりずっと低くても
+// 回り続ける。
+type StartConfig struct {
+	// Duty of the kick applied when leaving zero, and its shortest
+	// length.
+	// 0から動き出すときに加えるキックのデューティと、その最短の長さ
+	KickDuty uint32
+	KickTime time.Duration
+	// The kick lasts until a tach reading taken during it is at least
+	// ConfirmRPM, or gives up after StartTimeout and leaves the stall
+	// detection to the fault detector. Such a reading can take up to two
+	// RPM intervals, so StartTimeout should be longer.
+	// キックは、その間に取ったタコ信号の値がConfirmRPM以上になるまで続く。
+	// StartTimeoutを過ぎたら諦め、停止の検出は異常検出器に任せる。そのよう
+	// な値を得るにはRPMの計測間隔の2倍までかかるので、StartTimeoutはそれよ
+	// り長くすること。
+	ConfirmRPM   uint32
+	StartTimeout time.Duration
+	// Lowest duty the fan keeps running at. Requests below OffBelow turn
+	// the fan off; requests between OffBelow and MinRunDuty are raised to
+	// MinRunDuty.
+	// ファンが回り続けられる最低のデューティ。OffBelow未満の要求はファン
+	// を止め、OffBelowからMinRunDutyの間の要求はMinRunDutyに引き上げる。
+	MinRunDuty uint32
+	OffBelow   uint32
+}
+
+// DefaultStartConfig returns a full-duty kick of at least 300ms, a 10%
+// minimum running duty, and off below 5%.
+//
+// DefaultStartConfigは、最短300msの全デューティのキック、最低運転デュー
+// ティ10%、5%未満で停止する設定を返す。
+func DefaultStartConfig() StartConfig {
+	return StartConfig{
+		KickDuty:     fan.MaxDuty,
+		KickTime:     300 * time.Millisecond,
+		ConfirmRPM:   300,
+		StartTimeout: 3 * time.Second,
+		MinRunDuty:   fan.MaxDuty / 10,
+		OffBelow:     fan.MaxDuty / 20,
+	}
+}
+
+// StartState is the spin-up state of a Starter.
+//
+// StartStateは、Starterの起動状態。
+type StartState uint8
+
+const (
+	// StartOff means the output is off.
+	// StartOffは、出力が停止している状態。
+	StartOff StartState = iota
+	// StartKicking means the kick duty is applied.
+	// StartKickingは、キックのデューティを加えている状態。
+	StartKicking
+	// StartRunning means the requested duty is passed through.
+	// StartRunningは、要求されたデューティを通している状態。
+	StartRunning
+)
+
+// String returns the name of the state.
+func (s StartState) String() string {
+	switch s {
+	case StartOff:
+		return "off"
+	case StartKicking:
+		return "kicking"
+	case StartRunning:
+		return "running"
+	default:
+		return "unknown"
+	}
+}
+
+// Starter sits just before a fan's duty output. It kicks the fan when it
+// leaves zero, keeps the duty at or above the minimum running duty, and
+// confirms the start through the tach.
+//
+// Starterは、ファンのデューティ出力の直前に置く。0から動き出すときにファ
+// ンをキックし、デューティを最低運転デューティ以上に保ち、タコ信号で起動
+// を確認する。
+type Starter struct {
+	Config StartConfig
+
+	state StartState
+	// Time spent in the current kick.
+	// 現在のキックの経過時間
+	kicked time.Duration
+	// Tach readings seen since the kick began, and whether a reading
+	// taken during the kick reached ConfirmRPM.
+	// キックを始めてから見たタコ信号の値の数と、キックの間に取った値が
+	// ConfirmRPMに達したかどうか
+	readings int
+	spinning bool
+	// Whether the tach confirmed the last start.
+	// 直前の起動をタコ信号で確認できたかどうか
+	confirmed bool
+	// The rise rate of the kick set by SetSoftStart, and the one taken
+	// when the current kick began; 0 means unlimited.
+	// SetSoftStartで設定したキックの上昇率と、現在のキックを始めたときに
+	// 取ったもの。0は無制限を表す。
+	softRate, kickRate uint32
+}
+
+// NewStarter creates a Starter with the fan off.
+//
+// NewStarterは、ファンが停止した状態のStarterを作る。
+func NewStarter(cfg StartConfig) *Starter {
+	return &Starter{Config: cfg}
+}
+
+// State returns the current spin-up state.
+//
+// Stateは、現在の起動状態を返す。
+func (s *Starter) State() StartState {
+	return s.state
+}
+
+// Confirmed reports whether the tach confirmed the last start. It is
+// false while kicking and after a start that timed out.
+//
+// Confirmedは、直前の起動をタコ信号で確認できたかどうかを返す。キック中と、
+// 起動がタイムアウトした後はfalse。
+func (s *Starter) Confirmed() bool {
+	return s.confirmed
+}
+
+// SetSoftStart sets the rise rate of the kicks that begin from now on, in
+// duty units per second, while a soft start runs; 0 ends it. Such a kick
+// starts at the requested duty and rises no faster than rate, as the ramp
+// does, so a soft start is not undone by a jump to KickDuty.
+//
+// SetSoftStartは、ソフトスタート中に、これから始めるキックの上昇率(デュー
+// ティ単位/秒)を設定する。0で終わる。そのキックは要求されたデューティから
+// 始まり、ランプと同じくrateより速く上がらないので、KickDutyへの跳ね上が
+// りでソフトスタートが台無しになることはない。
+func (s *Starter) SetSoftStart(rate uint32) {
+	s.softRate = rate
+}
+
+// Observe passes a new tach reading of the fan. Call it after each RPM
+// measurement. The first reading after a kick began was partly measured
+// before it, so only later ones can confirm the start.
+//
+// Observeは、ファンの新しいタコ信号の値を渡す。RPMを計測するたびに呼ぶこ
+// と。キックを始めて最初の値は一部がキックの前に計測されたものなので、起
+// 動を確認できるのはそれ以降の値だけ。
+func (s *Starter) Observe(rpm uint32) {
+	if s.state != StartKicking {
+		return
+	}
+	s.readings++
+	if s.readings > 1 && rpm >= s.Config.ConfirmRPM {
+		s.spinning = true
+	}
+}
+
+// Update returns the duty to write for the requested duty, given the time
+// since the last call.
+//
+// Updateは、前回の呼び出しからの時間をもとに、要求されたデューティに対し
+// て書き込むデューティを返す。
+func (s *Starter) Update(request uint32, dt time.Duration) uint32 {
+	if request == 0 || request < s.Config.OffBelow {
+		s.state = StartOff
+		s.confirmed = false
+		return 0
+	}
+	if request < s.Config.MinRunDuty {
+		request = s.Config.MinRunDuty
+	}
+
+	switch s.state {
+	case StartOff:
+		if s.Config.KickTime <= 0 {
+			s.state = StartRunning
+			s.confirmed = true
+			return request
+		}
+		s.state = StartKicking
+		s.kicked = 0
+		s.readings = 0
+		s.spinning = false
+		s.confirmed = false
+		s.kickRate = s.softRate
+	case StartKicking:
+		s.kicked += dt
+		if s.kicked >= s.Config.KickTime && s.spinning {
+			s.state = StartRunning
+			s.confirmed = true
+		} else if s.kicked >= s.Config.StartTimeout {
+			s.state = StartRunning
+		}
+	}
+
+	if s.state == StartKicking && s.Config.KickDuty > request {
+		if s.kickRate == 0 {
+			return s.Config.KickDuty
+		}
+		rise := uint64(s.kickRate) * uint64(s.kicked) / uint64(time.Second)
+		return uint32(min(uint64(request)+rise, uint64(s.Config.KickDuty)))
+	}
+	return request
+}
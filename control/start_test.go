@@ -0,0 +1,164 @@
+package control
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+func TestStarter_MinRunDuty(t *testing.T) {
+	testCases := []struct {
+		name     string
+		request  uint32
+		expected uint32
+	}{
+		{name: "0は停止", request: 0, expected: 0},
+		{name: "5%未満は停止", request: 1999, expected: 0},
+		{name: "5%から10%は最低運転デューティ", request: 2000, expected: 4000},
+		{name: "10%以上はそのまま", request: 12000, expected: 12000},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewStarter(DefaultStartConfig())
+			// キックが終わるまで回しておく
+			s.Update(fan.MaxDuty, 50*time.Millisecond)
+			s.Observe(1000)
+			s.Observe(1000)
+			for i := 0; i < 10; i++ {
+				s.Update(fan.MaxDuty, 50*time.Millisecond)
+			}
+			if got := s.Update(tc.request, 50*time.Millisecond); got != tc.expected {
+				t.Errorf("期待するデューティは %d 、実際は %d で異なる", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestStarter_Kick(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 計測値を渡す直前の更新の番号と、その計測値
+		readings  map[int]uint32
+		expected  []uint32
+		state     StartState
+		confirmed bool
+	}{
+		{
+			name:      "すぐ回れば最短時間でキックを終える",
+			readings:  map[int]uint32{0: 0, 1: 900},
+			expected:  []uint32{40000, 40000, 40000, 40000, 40000, 40000, 8000},
+			state:     StartRunning,
+			confirmed: true,
+		},
+		{
+			name:      "回るまでキックを続ける",
+			readings:  map[int]uint32{0: 0, 4: 0, 8: 400},
+			expected:  []uint32{40000, 40000, 40000, 40000, 40000, 40000, 40000, 40000, 40000, 8000},
+			state:     StartRunning,
+			confirmed: true,
+		},
+		{
+			// キックを始めて最初の計測値は、キックの前に回っていた分を含む
+			name:      "キックの前からの計測値では確認しない",
+			readings:  map[int]uint32{0: 3000},
+			expected:  []uint32{40000, 40000, 40000, 40000, 40000, 40000, 40000, 40000, 40000, 40000},
+			state:     StartKicking,
+			confirmed: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewStarter(DefaultStartConfig())
+			for i, expected := range tc.expected {
+				if got := s.Update(8000, 50*time.Millisecond); got != expected {
+					t.Fatalf("%d回目の期待するデューティは %d 、実際は %d で異なる", i, expected, got)
+				}
+				if rpm, ok := tc.readings[i]; ok {
+					s.Observe(rpm)
+				}
+			}
+			if s.State() != tc.state {
+				t.Errorf("期待する状態は %v 、実際は %v で異なる", tc.state, s.State())
+			}
+			if s.Confirmed() != tc.confirmed {
+				t.Errorf("期待する確認結果は %v 、実際は %v で異なる", tc.confirmed, s.Confirmed())
+			}
+		})
+	}
+}
+
+// 回らないままタイムアウトしたら、要求されたデューティに戻して確認できなかったことを示す
+func TestStarter_Timeout(t *testing.T) {
+	s := NewStarter(DefaultStartConfig())
+	var got uint32
+	for i := 0; i < 61; i++ {
+		got = s.Update(8000, 50*time.Millisecond)
+		s.Observe(0)
+	}
+	if got != 8000 || s.State() != StartRunning {
+		t.Errorf("期待するデューティは 8000 (running)、実際は %d (%v) で異なる", got, s.State())
+	}
+	if s.Confirmed() {
+		t.Error("起動は確認できていないはず")
+	}
+
+	// 一度止めれば、またキックする
+	s.Update(0, 50*time.Millisecond)
+	if got := s.Update(8000, 50*time.Millisecond); got != fan.MaxDuty {
+		t.Errorf("再起動時の期待するデューティは %d 、実際は %d で異なる", fan.MaxDuty, got)
+	}
+}
+
+// 要求がキックより大きければ要求を優先する
+func TestStarter_RequestAboveKick(t *testing.T) {
+	cfg := DefaultStartConfig()
+	cfg.KickDuty = fan.MaxDuty / 2
+	s := NewStarter(cfg)
+	if got := s.Update(30000, 50*time.Millisecond); got != 30000 {
+		t.Errorf("期待するデューティは 30000 、実際は %d で異なる", got)
+	}
+	if s.State() != StartKicking {
+		t.Errorf("期待する状態は %v 、実際は %v で異なる", StartKicking, s.State())
+	}
+}
+
+// KickTimeが0ならキックしない
+func TestStarter_NoKick(t *testing.T) {
+	s := NewStarter(StartConfig{})
+	if got := s.Update(100, 50*time.Millisecond); got != 100 {
+		t.Errorf("期待するデューティは 100 、実際は %d で異なる", got)
+	}
+}
+
+// ソフトスタート中のキックは要求からゆっくり上がり、起動の確認はいつもどおり行う
+func TestStarter_SoftStart(t *testing.T) {
+	s := NewStarter(DefaultStartConfig())
+	// 毎秒8000
+	s.SetSoftStart(fan.MaxDuty / 5)
+	got := []uint32{s.Update(6000, 50*time.Millisecond), s.Update(6000, 50*time.Millisecond), s.Update(6000, 50*time.Millisecond)}
+	if fmt.Sprint(got) != "[6000 6400 6800]" {
+		t.Errorf("ソフトスタート中の期待する推移は [6000 6400 6800] 、実際は %v で異なる", got)
+	}
+	if s.State() != StartKicking {
+		t.Errorf("期待する状態は %v 、実際は %v で異なる", StartKicking, s.State())
+	}
+	s.Observe(0)
+	s.Observe(600)
+	for i := 0; i < 4; i++ {
+		s.Update(6000, 50*time.Millisecond)
+	}
+	if s.State() != StartRunning || !s.Confirmed() {
+		t.Errorf("期待する状態は %v (確認済み)、実際は %v (%v) で異なる", StartRunning, s.State(), s.Confirmed())
+	}
+
+	// ソフトスタートが終われば、停止からの起動はまたキックする
+	s.SetSoftStart(0)
+	s.Update(0, 50*time.Millisecond)
+	if got := s.Update(6000, 50*time.Millisecond); got != fan.MaxDuty {
+		t.Errorf("期待するデューティは %d 、実際は %d で異なる", fan.MaxDuty, got)
+	}
+}
@@ -0,0 +1,214 @@
+// Package curve maps a potentiometer reading to a duty through a
+// configurable response curve, so the knob feel can be tuned per
+// installation.
+//
+// curveパッケージは、設定できる応答曲線を通してポテンショメータの値をデュー
+// ティに変換する。これで設置場所ごとにつまみの感触を調整できる。
+package curve
+
+import (
+	"math"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// MaxInput is the full-scale input value (16-bit ADC).
+//
+// MaxInputは、フルスケールの入力値(16ビットADC)。
+const MaxInput = 0xFFFF
+
+// Shape is the shape of a response curve.
+//
+// Shapeは、応答曲線の形。
+type Shape uint8
+
+const (
+	// Linear: y = x
+	Linear Shape = iota
+	// Square: y = x^2, finer control at low speed.
+	// Square: y = x^2。低速域を細かく調整できる。
+	Square
+	// Cubic: y = x^3, even finer control at low speed.
+	// Cubic: y = x^3。低速域をさらに細かく調整できる。
+	Cubic
+	// Exponential: y = (e^(kx) - 1) / (e^k - 1)
+	Exponential
+	// Logarithmic: y = ln(1 + kx) / ln(1 + k), coarser at low speed.
+	// Logarithmic: y = ln(1 + kx) / ln(1 + k)。低速域が粗くなる。
+	Logarithmic
+	// Table: piecewise-linear through Curve.Table.
+	// Table: Curve.Tableを通る折れ線。
+	Table
+)
+
+// String returns the name of the shape.
+func (s Shape) String() string {
+	switch s {
+	case Linear:
+		return "linear"
+	case Square:
+		return "square"
+	case Cubic:
+		return "cubic"
+	case Exponential:
+		return "exp"
+	case Logarithmic:
+		return "log"
+	case Table:
+		return "table"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseShape returns the shape with the given name, as returned by
+// Shape.String.
+//
+// ParseShapeは、Shape.Stringが返す名前に対応する形を返す。
+func ParseShape(name string) (Shape, bool) {
+	for s := Linear; s <= Table; s++ {
+		if s.String() == name {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// Point is a point of a lookup table. X and Y are fractions of full
+// scale (0-1).
+//
+// Pointは、ルックアップテーブルの1点。XとYはフルスケールに対する割合(0-1)。
+type Point struct {
+	X, Y float32
+}
+
+// DefaultK is the default steepness of the exponential and logarithmic
+// shapes.
+//
+// DefaultKは、指数と対数の形の急峻さのデフォルト。
+const DefaultK = 3
+
+// Curve maps an input (0-MaxInput) to a duty (0-fan.MaxDuty).
+//
+// Curveは、入力(0-MaxInput)をデューティ(0-fan.MaxDuty)に変換する。
+type Curve struct {
+	Shape Shape
+	// Steepness of Exponential and Logarithmic. 0 means DefaultK.
+	// ExponentialとLogarithmicの急峻さ。0ならDefaultK。
+	K float32
+	// Points of Table, sorted by X.
+	// Tableの点(X順)
+	Table []Point
+	// Inputs below Deadzone map to 0 (off).
+	// Deadzone未満の入力は0(停止)になる。
+	Deadzone uint16
+	// Rescale stretches the range between the deadzone and the saturation
+	// zone so the curve starts from zero at the deadzone. Otherwise the
+	// deadzone only cuts off the curve.
+	// Rescaleは、デッドゾーンと飽和ゾーンの間の範囲を引き伸ばし、曲線がデッ
+	// ドゾーンでゼロから始まるようにする。falseならデッドゾーンは曲線を切り
+	// 捨てるだけ。
+	Rescale bool
+	// Inputs within SaturationZone of full scale map to OutMax.
+	// フルスケールからSaturationZone以内の入力はOutMaxになる。
+	SaturationZone uint16
+	// Output range outside the deadzone. OutMax 0 means fan.MaxDuty.
+	// デッドゾーンの外での出力範囲。OutMaxが0ならfan.MaxDuty。
+	OutMin, OutMax uint32
+}
+
+// Default returns the curve of the original firmware: a square curve cut
+// off by a ~3% deadzone.
+//
+// Defaultは、元のファームウェアの曲線を返す。約3%のデッドゾーンで切り捨て
+// た2乗カーブ。
+func Default() Curve {
+	return Curve{
+		Shape:    Square,
+		Deadzone: 2000, // ~3% of 65535
+		OutMax:   fan.MaxDuty,
+	}
+}
+
+// Map converts an input to a duty.
+//
+// Mapは、入力をデューティに変換する。
+func (c *Curve) Map(in uint16) uint32 {
+	if in < c.Deadzone {
+		return 0
+	}
+	outMin, outMax := c.OutMin, c.OutMax
+	if outMax == 0 || outMax > fan.MaxDuty {
+		outMax = fan.MaxDuty
+	}
+	if outMin > outMax {
+		outMin = outMax
+	}
+
+	top := uint32(MaxInput) - uint32(c.SaturationZone)
+	if uint32(in) >= top || top <= uint32(c.Deadzone) {
+		return outMax
+	}
+	x := float64(in) / float64(top)
+	if c.Rescale {
+		x = float64(uint32(in)-uint32(c.Deadzone)) / float64(top-uint32(c.Deadzone))
+	}
+
+	y := c.shape(x)
+	if y < 0 {
+		y = 0
+	}
+	if y > 1 {
+		y = 1
+	}
+	// Truncate like the integer math of the original firmware.
+	// 元のファームウェアの整数演算と同じく切り捨てる。
+	return outMin + uint32(y*float64(outMax-outMin))
+}
+
+// shape applies the curve shape to x (0-1).
+//
+// shapeは、x(0-1)に曲線の形を適用する。
+func (c *Curve) shape(x float64) float64 {
+	k := float64(c.K)
+	if k == 0 {
+		k = DefaultK
+	}
+	switch c.Shape {
+	case Square:
+		return x * x
+	case Cubic:
+		return x * x * x
+	case Exponential:
+		return math.Expm1(k*x) / math.Expm1(k)
+	case Logarithmic:
+		return math.Log1p(k*x) / math.Log1p(k)
+	case Table:
+		return float64(interpolate(c.Table, float32(x)))
+	default:
+		return x
+	}
+}
+
+// interpolate returns the piecewise-linear value of table at x. An empty
+// table is linear.
+//
+// interpolateは、xにおけるtableの折れ線の値を返す。空のテーブルは直線。
+func interpolate(table []Point, x float32) float32 {
+	if len(table) == 0 {
+		return x
+	}
+	if x <= table[0].X {
+		return table[0].Y
+	}
+	for i := 1; i < len(table); i++ {
+		a, b := table[i-1], table[i]
+		if x <= b.X {
+			if b.X == a.X {
+				return b.Y
+			}
+			return a.Y + (b.Y-a.Y)*(x-a.X)/(b.X-a.X)
+		}
+	}
+	return table[len(table)-1].Y
+}
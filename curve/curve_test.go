@@ -0,0 +1,198 @@
+package curve
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// Note: tinygo test ./curve
+
+func TestCurve_Shapes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		shape    Shape
+		in       uint16
+		expected uint32
+	}{
+		{name: "linear 0", shape: Linear, in: 0, expected: 0},
+		{name: "linear 半分", shape: Linear, in: 32768, expected: 20000},
+		{name: "linear 最大", shape: Linear, in: MaxInput, expected: fan.MaxDuty},
+		{name: "square 半分", shape: Square, in: 32768, expected: 10000},
+		{name: "square 最大", shape: Square, in: MaxInput, expected: fan.MaxDuty},
+		{name: "cubic 半分", shape: Cubic, in: 32768, expected: 5000},
+		{name: "exp 半分", shape: Exponential, in: 32768, expected: 7297},
+		{name: "exp 最大", shape: Exponential, in: MaxInput, expected: fan.MaxDuty},
+		{name: "log 半分", shape: Logarithmic, in: 32768, expected: 26438},
+		{name: "log 最大", shape: Logarithmic, in: MaxInput, expected: fan.MaxDuty},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := Curve{Shape: tc.shape}
+			if got := c.Map(tc.in); got != tc.expected {
+				t.Errorf("期待するデューティは %d 、実際は %d で異なる", tc.expected, got)
+			}
+		})
+	}
+}
+
+// どの形も単調増加で、0からOutMaxまでを通る
+func TestCurve_Monotonic(t *testing.T) {
+	for s := Linear; s <= Table; s++ {
+		t.Run(s.String(), func(t *testing.T) {
+			c := Curve{Shape: s, Table: []Point{{0, 0}, {0.5, 0.2}, {1, 1}}}
+			prev := c.Map(0)
+			if prev != 0 {
+				t.Errorf("入力0で期待するデューティは 0 、実際は %d で異なる", prev)
+			}
+			for in := 256; in <= MaxInput; in += 256 {
+				got := c.Map(uint16(in))
+				if got < prev {
+					t.Fatalf("入力 %d でデューティが %d から %d に下がった", in, prev, got)
+				}
+				prev = got
+			}
+			if got := c.Map(MaxInput); got != fan.MaxDuty {
+				t.Errorf("最大入力で期待するデューティは %d 、実際は %d で異なる", fan.MaxDuty, got)
+			}
+		})
+	}
+}
+
+func TestCurve_Zones(t *testing.T) {
+	c := Curve{
+		Shape:          Linear,
+		Deadzone:       5535,
+		Rescale:        true,
+		SaturationZone: 10000,
+	}
+	testCases := []struct {
+		name     string
+		in       uint16
+		expected uint32
+	}{
+		{name: "デッドゾーン内", in: 5534, expected: 0},
+		{name: "デッドゾーンの端", in: 5535, expected: 0},
+		{name: "中間", in: 30535, expected: 20000},
+		{name: "飽和ゾーンの端", in: 55535, expected: fan.MaxDuty},
+		{name: "飽和ゾーン内", in: 60000, expected: fan.MaxDuty},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := c.Map(tc.in); got != tc.expected {
+				t.Errorf("期待するデューティは %d 、実際は %d で異なる", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCurve_OutputClamp(t *testing.T) {
+	c := Curve{
+		Shape:    Linear,
+		Deadzone: 1000,
+		Rescale:  true,
+		OutMin:   8000,
+		OutMax:   32000,
+	}
+	testCases := []struct {
+		name     string
+		in       uint16
+		expected uint32
+	}{
+		{name: "デッドゾーン内は停止", in: 999, expected: 0},
+		{name: "デッドゾーンを出たら最小値", in: 1000, expected: 8000},
+		{name: "最大入力で最大値", in: MaxInput, expected: 32000},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := c.Map(tc.in); got != tc.expected {
+				t.Errorf("期待するデューティは %d 、実際は %d で異なる", tc.expected, got)
+			}
+		})
+	}
+
+	// MaxDutyを超えるOutMaxは制限する
+	c.OutMax = 50000
+	if got := c.Map(MaxInput); got != fan.MaxDuty {
+		t.Errorf("期待するデューティは %d 、実際は %d で異なる", fan.MaxDuty, got)
+	}
+}
+
+func TestCurve_Table(t *testing.T) {
+	c := Curve{
+		Shape: Table,
+		Table: []Point{
+			{X: 0, Y: 0.2},
+			{X: 0.5, Y: 0.4},
+			{X: 0.75, Y: 0.4},
+			{X: 1, Y: 1},
+		},
+	}
+	testCases := []struct {
+		in       uint16
+		expected uint32
+	}{
+		{in: 0, expected: 8000},
+		{in: 16384, expected: 12000},
+		{in: 32768, expected: 16000},
+		{in: 40000, expected: 16000},
+		{in: 57344, expected: 28000},
+		{in: MaxInput, expected: fan.MaxDuty},
+	}
+	for _, tc := range testCases {
+		if got := c.Map(tc.in); got < tc.expected-2 || got > tc.expected+2 {
+			t.Errorf("入力 %d で期待するデューティは %d 、実際は %d で異なる", tc.in, tc.expected, got)
+		}
+	}
+}
+
+// Rescaleしないと、デッドゾーンは曲線を切り捨てるだけ
+func TestCurve_Cutoff(t *testing.T) {
+	c := Curve{Shape: Linear, Deadzone: 5535}
+	if got := c.Map(5534); got != 0 {
+		t.Errorf("デッドゾーン内で期待するデューティは 0 、実際は %d で異なる", got)
+	}
+	if got := c.Map(32768); got != 20000 {
+		t.Errorf("期待するデューティは 20000 、実際は %d で異なる", got)
+	}
+}
+
+// Defaultは元のファームウェアの計算と全入力で一致する
+func TestDefault(t *testing.T) {
+	c := Default()
+	for in := 0; in <= MaxInput; in++ {
+		expected := uint32(uint64(in) * uint64(in) * fan.MaxDuty / (MaxInput * MaxInput))
+		if in < 2000 {
+			expected = 0
+		}
+		if got := c.Map(uint16(in)); got != expected {
+			t.Fatalf("入力 %d で期待するデューティは %d 、実際は %d で異なる", in, expected, got)
+		}
+	}
+}
+
+func TestParseShape(t *testing.T) {
+	for s := Linear; s <= Table; s++ {
+		if got, ok := ParseShape(s.String()); !ok || got != s {
+			t.Errorf("%q で期待する形は %v 、実際は %v (ok=%v) で異なる", s.String(), s, got, ok)
+		}
+	}
+	if _, ok := ParseShape("zigzag"); ok {
+		t.Error("知らない名前は失敗するはず")
+	}
+}
+
+// ExampleCurve_Map shows how to tune the knob feel.
+//
+// ExampleCurve_Mapは、つまみの感触を調整する方法を示す。
+func ExampleCurve_Map() {
+	knob := Default()
+	knob.Shape = Cubic
+	knob.Rescale = true // Start the curve from zero at the deadzone.
+	knob.OutMin = 8000  // Never run below 20% once out of the deadzone.
+
+	fmt.Println(knob.Map(1000), knob.Map(2000), knob.Map(33768), knob.Map(0xFFFF))
+	// Output: 0 8000 12000 40000
+}
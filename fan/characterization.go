@@ -0,0 +1,178 @@
+package fan
+
+import (
+	"io"
+	"strconv"
+)
+
+// SweepPoint is one step of a characterization sweep: the steady RPM
+// measured at a duty.
+//
+// SweepPointは、特性測定のスイープの1ステップ。あるデューティで計測した定
+// 常RPM。
+type SweepPoint struct {
+	Duty uint32
+	RPM  uint32
+}
+
+// Check is a set of problems found by a characterization sweep.
+//
+// Checkは、特性測定のスイープで見つかった問題の集合。
+type Check uint8
+
+const (
+	// CheckNoTach means no RPM was measured even at full duty.
+	// CheckNoTachは、全デューティでもRPMが計測できなかったことを表す。
+	CheckNoTach Check = 1 << iota
+	// CheckNotMonotonic means the RPM dropped while the duty rose.
+	// CheckNotMonotonicは、デューティを上げたのにRPMが下がったことを表す。
+	CheckNotMonotonic
+	// CheckPPRTooLow means the measured maximum RPM is well above
+	// Profile.MaxRPM, so the fan gives more pulses per revolution than
+	// configured.
+	// CheckPPRTooLowは、計測した最大RPMがProfile.MaxRPMを大きく上回ること
+	// を表す。ファンは設定より多くのパルスを1回転で出している。
+	CheckPPRTooLow
+	// CheckPPRTooHigh means the measured maximum RPM is well below
+	// Profile.MaxRPM, so the fan gives fewer pulses per revolution than
+	// configured.
+	// CheckPPRTooHighは、計測した最大RPMがProfile.MaxRPMを大きく下回ること
+	// を表す。ファンは設定より少ないパルスを1回転で出している。
+	CheckPPRTooHigh
+
+	// CheckNone is the empty set.
+	// CheckNoneは空集合。
+	CheckNone Check = 0
+
+	numChecks = 4
+)
+
+// Has reports whether all checks in x are set in c.
+//
+// Hasは、xの問題がすべてcに含まれるかどうかを返す。
+func (c Check) Has(x Check) bool {
+	return c&x == x && x != 0
+}
+
+// String returns the names of the set checks joined with "|".
+func (c Check) String() string {
+	if c == CheckNone {
+		return "none"
+	}
+	names := [numChecks]string{"no-tach", "not-monotonic", "ppr-too-low", "ppr-too-high"}
+	s := ""
+	for i := 0; i < numChecks; i++ {
+		if c&(1<<i) != 0 {
+			if s != "" {
+				s += "|"
+			}
+			s += names[i]
+		}
+	}
+	return s
+}
+
+// Characterization is the result of a characterization sweep of one
+// rotor.
+//
+// Characterizationは、1つのローターの特性測定の結果。
+type Characterization struct {
+	// Steady RPMs measured while stepping the duty up from rest.
+	// 停止状態からデューティを上げながら計測した定常RPM
+	Points []SweepPoint
+	// Lowest duty that starts the rotor from rest, and lowest duty that
+	// keeps it running once spinning. Zero if it never started.
+	// 停止状態からローターが回り始める最低のデューティと、一度回ったローター
+	// が回り続ける最低のデューティ。一度も回らなければ0。
+	MinStartDuty   uint32
+	MinSustainDuty uint32
+	// RPM measured at full duty.
+	// 全デューティで計測したRPM
+	MaxRPM uint32
+	// Pulses per revolution used for the sweep, and the value the
+	// measurements suggest when a PPR check failed.
+	// スイープに使った1回転あたりのパルス数と、PPRの確認に失敗したときに
+	// 計測結果から推定される値
+	PPR          uint32
+	SuggestedPPR uint32
+	Checks       Check
+}
+
+// Characterization returns the result of the last characterization sweep,
+// or nil if there was none.
+//
+// Characterizationは、直近の特性測定の結果を返す。無ければnil。
+func (f *Fan) Characterization() *Characterization {
+	return f.characterization
+}
+
+// SetCharacterization stores the result of a characterization sweep.
+//
+// SetCharacterizationは、特性測定の結果を保存する。
+func (f *Fan) SetCharacterization(c *Characterization) {
+	f.characterization = c
+}
+
+// Characterizations returns the characterizations of both fan components.
+//
+// Characterizationsは、両方のファン部品の特性測定の結果を返す。
+func (df *DualFan) Characterizations() (*Characterization, *Characterization) {
+	return df.Front.Characterization(), df.Rear.Characterization()
+}
+
+// WriteCharacterizationCSV writes the characterizations of both fan
+// components as CSV: the duty→RPM table of each rotor, a blank line, then
+// one summary row per rotor. Rotors without one are skipped.
+//
+// WriteCharacterizationCSVは、両方のファン部品の特性測定の結果をCSVで書
+// き出す。各ローターのデューティ→RPM表、空行、ローターごとの要約行の順。
+// 結果の無いローターは飛ばす。
+func (df *DualFan) WriteCharacterizationCSV(w io.Writer) error {
+	return WriteCharacterizationCSV(w,
+		[]string{df.Front.Name, df.Rear.Name},
+		[]*Characterization{df.Front.characterization, df.Rear.characterization})
+}
+
+// WriteCharacterizationCSV writes characterizations as
+// DualFan.WriteCharacterizationCSV does, labelling cs[i] with names[i].
+// Nil characterizations are skipped.
+//
+// WriteCharacterizationCSVは、DualFan.WriteCharacterizationCSVと同じ形式
+// で特性測定の結果を書き出す。cs[i]にはnames[i]の名前を付ける。nilの結果は
+// 飛ばす。
+func WriteCharacterizationCSV(w io.Writer, names []string, cs []*Characterization) error {
+	var buf []byte
+
+	buf = append(buf, "rotor,duty,rpm\n"...)
+	for i, c := range cs {
+		if c == nil {
+			continue
+		}
+		for _, p := range c.Points {
+			buf = append(buf, names[i]...)
+			buf = append(buf, ',')
+			buf = strconv.AppendUint(buf, uint64(p.Duty), 10)
+			buf = append(buf, ',')
+			buf = strconv.AppendUint(buf, uint64(p.RPM), 10)
+			buf = append(buf, '\n')
+		}
+	}
+
+	buf = append(buf, "\nrotor,min_start_duty,min_sustain_duty,max_rpm,ppr,suggested_ppr,checks\n"...)
+	for i, c := range cs {
+		if c == nil {
+			continue
+		}
+		buf = append(buf, names[i]...)
+		for _, v := range [...]uint32{c.MinStartDuty, c.MinSustainDuty, c.MaxRPM, c.PPR, c.SuggestedPPR} {
+			buf = append(buf, ',')
+			buf = strconv.AppendUint(buf, uint64(v), 10)
+		}
+		buf = append(buf, ',')
+		buf = append(buf, c.Checks.String()...)
+		buf = append(buf, '\n')
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
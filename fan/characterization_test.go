@@ -0,0 +1,59 @@
+package fan
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheck_String(t *testing.T) {
+	testCases := []struct {
+		name     string
+		check    Check
+		expected string
+	}{
+		{name: "問題なし", check: CheckNone, expected: "none"},
+		{name: "1つ", check: CheckNoTach, expected: "no-tach"},
+		{name: "複数", check: CheckNotMonotonic | CheckPPRTooHigh, expected: "not-monotonic|ppr-too-high"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.check.String(); got != tc.expected {
+				t.Errorf("期待する文字列は %q 、実際は %q で異なる", tc.expected, got)
+			}
+		})
+	}
+}
+
+func ExampleDualFan_WriteCharacterizationCSV() {
+	dualFan := NewDualFan("Typhoon", &dualMockPulseCounter{}, &dualMockPulseCounter{})
+	dualFan.Front.SetCharacterization(&Characterization{
+		Points:         []SweepPoint{{Duty: 0, RPM: 0}, {Duty: 20000, RPM: 1500}, {Duty: MaxDuty, RPM: 3000}},
+		MinStartDuty:   20000,
+		MinSustainDuty: 20000,
+		MaxRPM:         3000,
+		PPR:            2,
+	})
+	dualFan.Rear.SetCharacterization(&Characterization{
+		Points:       []SweepPoint{{Duty: 0, RPM: 0}, {Duty: 20000, RPM: 3000}, {Duty: MaxDuty, RPM: 6000}},
+		MinStartDuty: 20000,
+		MaxRPM:       6000,
+		PPR:          2,
+		SuggestedPPR: 4,
+		Checks:       CheckPPRTooLow,
+	})
+
+	dualFan.WriteCharacterizationCSV(os.Stdout)
+	// Output:
+	// rotor,duty,rpm
+	// Typhoon-F,0,0
+	// Typhoon-F,20000,1500
+	// Typhoon-F,40000,3000
+	// Typhoon-R,0,0
+	// Typhoon-R,20000,3000
+	// Typhoon-R,40000,6000
+	//
+	// rotor,min_start_duty,min_sustain_duty,max_rpm,ppr,suggested_ppr,checks
+	// Typhoon-F,20000,20000,3000,2,0,none
+	// Typhoon-R,20000,0,6000,2,4,ppr-too-low
+}
@@ -1,5 +1,7 @@
 package fan
 
+import "time"
+
 // DualFan represents a dual contra-rotating fan unit.
 //
 // DualFanは、二重反転ファンユニット
@@ -13,20 +15,39 @@ type DualFan struct {
 	Rear *Fan
 }
 
-// NewDualFan creates a new DualFan instance.
+// NewDualFan creates a new DualFan instance with DefaultProfile for both
+// rotors.
 //
-// NewDualFanは、新しいDualFanインスタンスを作る
+// NewDualFanは、両方のローターにDefaultProfileを使って新しいDualFanイン
+// スタンスを作る
 func NewDualFan(name string, counterFront, counterRear PulseCounter) *DualFan {
+	return NewDualFanWithProfiles(name, counterFront, counterRear, DefaultProfile, DefaultProfile)
+}
+
+// NewDualFanWithProfiles creates a new DualFan instance with a separate
+// profile for each rotor, for units whose rotors report differently.
+//
+// NewDualFanWithProfilesは、ローターごとに別のプロファイルを使って新しい
+// DualFanインスタンスを作る。ローターごとに報告の仕方が違うユニット向け。
+func NewDualFanWithProfiles(name string, counterFront, counterRear PulseCounter, front, rear Profile) *DualFan {
 	// It internally holds two Fan instances.
 	// 内部的に2つのFanインスタンスを保持
 	df := &DualFan{
 		Name:  name,
-		Front: NewFan(name+"-F", counterFront),
-		Rear:  NewFan(name+"-R", counterRear),
+		Front: NewFanWithProfile(name+"-F", counterFront, front),
+		Rear:  NewFanWithProfile(name+"-R", counterRear, rear),
 	}
 	return df
 }
 
+// SetClock replaces the clock of both fan components.
+//
+// SetClockは、両方のファン部品のクロックを差し替える。
+func (df *DualFan) SetClock(clock Clock) {
+	df.Front.SetClock(clock)
+	df.Rear.SetClock(clock)
+}
+
 // CalculateRPMs calculates the RPM for both fan components at once and returns the results.
 //
 // CalculateRPMsは、両方のファン部品のRPMを一度に計算して結果を返す
@@ -35,3 +56,63 @@ func (df *DualFan) CalculateRPMs() (uint32, uint32) {
 	rearRpm := df.Rear.CalculateRPM()
 	return frontRpm, rearRpm
 }
+
+// CalculateRPMsOver is like CalculateRPMs but uses the given measurement
+// window for both fan components.
+//
+// CalculateRPMsOverは、CalculateRPMsと同様だが、両方のファン部品に指定さ
+// れた計測時間を使う。
+func (df *DualFan) CalculateRPMsOver(window time.Duration) (uint32, uint32) {
+	frontRpm := df.Front.CalculateRPMOver(window)
+	rearRpm := df.Rear.CalculateRPMOver(window)
+	return frontRpm, rearRpm
+}
+
+// SetFilters sets the filter of each fan component. Each fan needs its
+// own filter instance.
+//
+// SetFiltersは、それぞれのファン部品のフィルタを設定する。フィルタのイン
+// スタンスはファンごとに別にすること。
+func (df *DualFan) SetFilters(front, rear Filter) {
+	df.Front.SetFilter(front)
+	df.Rear.SetFilter(rear)
+}
+
+// FilteredRPMs returns the last filtered RPM of both fan components.
+//
+// FilteredRPMsは、両方のファン部品のフィルタ後の直近のRPMを返す。
+func (df *DualFan) FilteredRPMs() (uint32, uint32) {
+	return df.Front.FilteredRPM(), df.Rear.FilteredRPM()
+}
+
+// CheckFaults evaluates both fan components against their commanded
+// duties and returns the raised faults of each.
+//
+// CheckFaultsは、両方のファン部品をそれぞれの指令デューティと比べて評価
+// し、それぞれの立っている異常を返す。
+func (df *DualFan) CheckFaults(frontDuty, rearDuty uint32) (Fault, Fault) {
+	return df.Front.CheckFaults(frontDuty), df.Rear.CheckFaults(rearDuty)
+}
+
+// Faults returns the currently raised faults of both fan components.
+//
+// Faultsは、両方のファン部品の現在立っている異常を返す。
+func (df *DualFan) Faults() (Fault, Fault) {
+	return df.Front.Faults(), df.Rear.Faults()
+}
+
+// HasFault reports whether either fan component has a raised fault.
+//
+// HasFaultは、どちらかのファン部品に異常が立っているかどうかを返す。
+func (df *DualFan) HasFault() bool {
+	front, rear := df.Faults()
+	return front != FaultNone || rear != FaultNone
+}
+
+// ClearFaults drops all raised faults of both fan components.
+//
+// ClearFaultsは、両方のファン部品の立っているすべての異常を下ろす。
+func (df *DualFan) ClearFaults() {
+	df.Front.ClearFaults()
+	df.Rear.ClearFaults()
+}
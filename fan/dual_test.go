@@ -3,6 +3,7 @@ package fan
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 // パルスカウンターモック
@@ -37,6 +38,39 @@ func TestDualFan_CalculateRPMs(t *testing.T) {
 	}
 }
 
+func TestDualFan_CalculateRPMsOver(t *testing.T) {
+	mockCounterF := &dualMockPulseCounter{mockCount: 60} // 500msで3600 RPM
+	mockCounterR := &dualMockPulseCounter{mockCount: 31} // 500msで1860 RPM
+
+	dualFan := NewDualFan("Test DualFan", mockCounterF, mockCounterR)
+
+	frontRpm, rearRpm := dualFan.CalculateRPMsOver(500 * time.Millisecond)
+
+	if frontRpm != 3600 {
+		t.Errorf("Frontの期待RPMは %d 、実際は %d で異なる", 3600, frontRpm)
+	}
+	if rearRpm != 1860 {
+		t.Errorf("Rearの期待RPMは %d 、実際は %d で異なる", 1860, rearRpm)
+	}
+}
+
+func TestNewDualFanWithProfiles(t *testing.T) {
+	mockCounterF := &dualMockPulseCounter{mockCount: 120} // 2PPRで3600 RPM
+	mockCounterR := &dualMockPulseCounter{mockCount: 120} // 4PPRで1800 RPM
+
+	dualFan := NewDualFanWithProfiles("Test DualFan", mockCounterF, mockCounterR,
+		Profile{PulsesPerRevolution: 2}, Profile{PulsesPerRevolution: 4})
+
+	frontRpm, rearRpm := dualFan.CalculateRPMs()
+
+	if frontRpm != 3600 {
+		t.Errorf("Frontの期待RPMは %d 、実際は %d で異なる", 3600, frontRpm)
+	}
+	if rearRpm != 1800 {
+		t.Errorf("Rearの期待RPMは %d 、実際は %d で異なる", 1800, rearRpm)
+	}
+}
+
 // ExampleDualFan_CalculateRPMs shows how to use the DualFan type.
 //
 // ExampleDualFan_CalculateRPMsは、DualFan型の使い方を示す。
@@ -0,0 +1,222 @@
+package fan
+
+import "time"
+
+// Fault is a set of fault conditions detected on a rotor.
+//
+// Faultは、ローターで検出された異常状態の集合。
+type Fault uint8
+
+const (
+	// FaultStalled means the rotor stopped although it is driven.
+	// FaultStalledは、駆動しているのにローターが止まっていることを表す。
+	FaultStalled Fault = 1 << iota
+	// FaultTachMissing means no tach pulse has ever been seen although the
+	// rotor is driven, which points at a missing tach wire.
+	// FaultTachMissingは、駆動しているのにタコパルスが一度も来ていないこと
+	// を表す。タコ信号線の断線が疑われる。
+	FaultTachMissing
+	// FaultUnderspeed means the rotor runs well below the speed expected
+	// for the commanded duty.
+	// FaultUnderspeedは、指令デューティから期待される速度を大きく下回って
+	// いることを表す。
+	FaultUnderspeed
+	// FaultOverspeed means the rotor runs above its rated maximum.
+	// FaultOverspeedは、定格最大回転数を超えていることを表す。
+	FaultOverspeed
+
+	// FaultNone is the empty set.
+	// FaultNoneは空集合。
+	FaultNone Fault = 0
+
+	numFaults = 4
+)
+
+// Has reports whether all faults in x are set in f.
+//
+// Hasは、xの異常がすべてfに含まれるかどうかを返す。
+func (f Fault) Has(x Fault) bool {
+	return f&x == x && x != 0
+}
+
+// String returns the names of the set faults joined with "|".
+func (f Fault) String() string {
+	if f == FaultNone {
+		return "none"
+	}
+	names := [numFaults]string{"stalled", "tach-missing", "underspeed", "overspeed"}
+	s := ""
+	for i := 0; i < numFaults; i++ {
+		if f&(1<<i) != 0 {
+			if s != "" {
+				s += "|"
+			}
+			s += names[i]
+		}
+	}
+	return s
+}
+
+// FaultConfig holds the thresholds and timing of a FaultDetector.
+//
+// FaultConfigは、FaultDetectorのしきい値とタイミングを持つ。
+type FaultConfig struct {
+	// A condition must hold this long before its fault is raised.
+	// 異常状態がこの時間続いたら異常を立てる。
+	RaiseAfter time.Duration
+	// A condition must be gone this long before its fault is cleared.
+	// 異常状態がこの時間無くなったら異常を解除する。
+	ClearAfter time.Duration
+	// Underspeed if the RPM is below this percentage of the RPM expected
+	// for the commanded duty. Needs Profile.MaxRPM.
+	// 指令デューティから期待されるRPMに対して、この割合(%)を下回ったら速度
+	// 不足。Profile.MaxRPMが必要。
+	UnderspeedPercent uint32
+	// Overspeed if the RPM exceeds Profile.MaxRPM by this percentage.
+	// Profile.MaxRPMをこの割合(%)超えたら速度超過。
+	OverspeedPercent uint32
+	// Stalled and TachMissing are only checked at this duty and above,
+	// and at Profile.MinStartDuty if higher. Below it, a fan may just hum
+	// without turning, which is no fault.
+	// StalledとTachMissingは、このデューティ以上(Profile.MinStartDutyの方
+	// が高ければそれ以上)でのみ判定する。これ未満ではファンが唸るだけで回
+	// らないこともあり、異常ではない。
+	MinRunDuty uint32
+	// If true, raised faults stay until Clear is called.
+	// trueなら、立った異常はClearを呼ぶまで残る。
+	Latch bool
+}
+
+// DefaultFaultConfig is the configuration used by new fans.
+//
+// DefaultFaultConfigは、新しいファンが使う設定。
+var DefaultFaultConfig = FaultConfig{
+	RaiseAfter:        3 * time.Second,
+	ClearAfter:        2 * time.Second,
+	UnderspeedPercent: 50,
+	OverspeedPercent:  15,
+	MinRunDuty:        MaxDuty / 10,
+}
+
+// FaultDetector compares the commanded duty with the measured RPM and
+// raises debounced faults for one rotor.
+//
+// FaultDetectorは、指令デューティと計測したRPMを比べて、1つのローターの
+// 異常をデバウンスして立てる。
+type FaultDetector struct {
+	Config  FaultConfig
+	profile Profile
+
+	active Fault
+	// Whether the tach has ever reported a pulse.
+	// タコ信号が一度でもパルスを報告したかどうか
+	tachSeen bool
+	// When each condition started or stopped holding; zero if not
+	// pending.
+	// 各状態が始まった時刻と終わった時刻。保留中でなければゼロ値。
+	conditionSince [numFaults]time.Time
+	clearSince     [numFaults]time.Time
+}
+
+// NewFaultDetector creates a FaultDetector for the given profile with
+// DefaultFaultConfig.
+//
+// NewFaultDetectorは、DefaultFaultConfigで指定されたプロファイル用の
+// FaultDetectorを作る。
+func NewFaultDetector(profile Profile) *FaultDetector {
+	return &FaultDetector{
+		Config:  DefaultFaultConfig,
+		profile: profile.normalized(),
+	}
+}
+
+// Faults returns the currently raised faults.
+//
+// Faultsは、現在立っている異常を返す。
+func (d *FaultDetector) Faults() Fault {
+	return d.active
+}
+
+// Clear drops all raised faults, restarts the debounce timers and forgets
+// any tach pulse seen, so a tach wire lost meanwhile is reported as such.
+//
+// Clearは、立っているすべての異常を下ろし、デバウンスタイマーをやり直し、
+// 見たタコパルスを忘れる。これでその間に外れたタコ信号線もそのとおり報告
+// される。
+func (d *FaultDetector) Clear() {
+	d.active = FaultNone
+	d.tachSeen = false
+	d.conditionSince = [numFaults]time.Time{}
+	d.clearSince = [numFaults]time.Time{}
+}
+
+// Update evaluates the rotor at now with the commanded duty (0-MaxDuty)
+// and the measured RPM, and returns the raised faults.
+//
+// Updateは、指令デューティ(0-MaxDuty)と計測したRPMでnow時点のローターを
+// 評価し、立っている異常を返す。
+func (d *FaultDetector) Update(now time.Time, duty, rpm uint32) Fault {
+	if rpm > 0 {
+		d.tachSeen = true
+	}
+	conditions := d.conditions(duty, rpm)
+
+	for i := 0; i < numFaults; i++ {
+		bit := Fault(1 << i)
+		if conditions&bit != 0 {
+			d.clearSince[i] = time.Time{}
+			if d.conditionSince[i].IsZero() {
+				d.conditionSince[i] = now
+			}
+			if now.Sub(d.conditionSince[i]) >= d.Config.RaiseAfter {
+				d.active |= bit
+			}
+			continue
+		}
+
+		d.conditionSince[i] = time.Time{}
+		if d.active&bit == 0 || d.Config.Latch {
+			continue
+		}
+		if d.clearSince[i].IsZero() {
+			d.clearSince[i] = now
+		}
+		if now.Sub(d.clearSince[i]) >= d.Config.ClearAfter {
+			d.active &^= bit
+			d.clearSince[i] = time.Time{}
+		}
+	}
+	return d.active
+}
+
+// conditions returns the fault conditions that hold right now, before
+// debouncing.
+//
+// conditionsは、デバウンス前の、今成り立っている異常状態を返す。
+func (d *FaultDetector) conditions(duty, rpm uint32) Fault {
+	var c Fault
+	p := d.profile
+	driven := duty > 0 && duty >= p.MinStartDuty && duty >= d.Config.MinRunDuty
+
+	if p.MaxRPM > 0 && uint64(rpm)*100 > uint64(p.MaxRPM)*uint64(100+d.Config.OverspeedPercent) {
+		c |= FaultOverspeed
+	}
+	if !driven {
+		return c
+	}
+
+	switch {
+	case rpm <= p.StallRPM && !d.tachSeen:
+		c |= FaultTachMissing
+	case rpm <= p.StallRPM:
+		c |= FaultStalled
+	case p.MaxRPM > 0:
+		// Assume the RPM is roughly proportional to the duty.
+		// RPMはおおよそデューティに比例すると仮定する。
+		expected := uint64(p.MaxRPM) * uint64(duty) / MaxDuty
+		if uint64(rpm)*100 < expected*uint64(d.Config.UnderspeedPercent) {
+			c |= FaultUnderspeed
+		}
+	}
+	return c
+}
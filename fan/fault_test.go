@@ -0,0 +1,227 @@
+package fan
+
+import (
+	"testing"
+	"time"
+)
+
+// 検出器に与える1ステップ分の入力と、その後に期待する異常
+type faultStep struct {
+	advance  time.Duration
+	duty     uint32
+	rpm      uint32
+	expected Fault
+}
+
+func runFaultSteps(t *testing.T, d *FaultDetector, steps []faultStep) {
+	t.Helper()
+	clock := newFakeClock()
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		if got := d.Update(clock.Now(), step.duty, step.rpm); got != step.expected {
+			t.Errorf("%d番目の期待する異常は %v 、実際は %v で異なる", i, step.expected, got)
+		}
+	}
+}
+
+func TestFaultDetector(t *testing.T) {
+	profile := Profile{PulsesPerRevolution: 2, MaxRPM: 3000, StallRPM: 100}
+
+	testCases := []struct {
+		name  string
+		latch bool
+		steps []faultStep
+	}{
+		{
+			name: "正常回転では異常なし",
+			steps: []faultStep{
+				{0, MaxDuty, 2900, FaultNone},
+				{5 * time.Second, MaxDuty / 2, 1500, FaultNone},
+			},
+		},
+		{
+			name: "タコ信号が一度も来ない",
+			steps: []faultStep{
+				{0, MaxDuty, 0, FaultNone},
+				{2 * time.Second, MaxDuty, 0, FaultNone},
+				{time.Second, MaxDuty, 0, FaultTachMissing},
+			},
+		},
+		{
+			name: "回っていたのに止まった",
+			steps: []faultStep{
+				{0, MaxDuty, 2900, FaultNone},
+				{time.Second, MaxDuty, 0, FaultNone},
+				{3 * time.Second, MaxDuty, 0, FaultStalled},
+				// 回復して解除時間が経てば下りる
+				{time.Second, MaxDuty, 2900, FaultStalled},
+				{2 * time.Second, MaxDuty, 2900, FaultNone},
+			},
+		},
+		{
+			name: "一瞬の停止はデバウンスで無視",
+			steps: []faultStep{
+				{0, MaxDuty, 2900, FaultNone},
+				{time.Second, MaxDuty, 0, FaultNone},
+				{time.Second, MaxDuty, 2900, FaultNone},
+				{2 * time.Second, MaxDuty, 0, FaultNone},
+			},
+		},
+		{
+			name: "デューティ0なら停止は異常ではない",
+			steps: []faultStep{
+				{0, MaxDuty, 2900, FaultNone},
+				{time.Second, 0, 0, FaultNone},
+				{10 * time.Second, 0, 0, FaultNone},
+			},
+		},
+		{
+			name: "速度不足",
+			steps: []faultStep{
+				{0, MaxDuty, 1400, FaultNone},
+				{3 * time.Second, MaxDuty, 1400, FaultUnderspeed},
+			},
+		},
+		{
+			name: "速度超過はデューティ0でも検出",
+			steps: []faultStep{
+				{0, 0, 3500, FaultNone},
+				{3 * time.Second, 0, 3500, FaultOverspeed},
+			},
+		},
+		{
+			name:  "ラッチは回復しても残る",
+			latch: true,
+			steps: []faultStep{
+				{0, MaxDuty, 2900, FaultNone},
+				{time.Second, MaxDuty, 0, FaultNone},
+				{3 * time.Second, MaxDuty, 0, FaultStalled},
+				{10 * time.Second, MaxDuty, 2900, FaultStalled},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := NewFaultDetector(profile)
+			d.Config.Latch = tc.latch
+			runFaultSteps(t, d, tc.steps)
+		})
+	}
+}
+
+// MaxRPMが不明なら速度不足・速度超過は判定しない
+func TestFaultDetector_UnknownMaxRPM(t *testing.T) {
+	d := NewFaultDetector(DefaultProfile)
+	runFaultSteps(t, d, []faultStep{
+		{0, MaxDuty, 10, FaultNone},
+		{5 * time.Second, MaxDuty, 100000, FaultNone},
+	})
+}
+
+// MinStartDuty未満の指令では停止を異常としない
+func TestFaultDetector_BelowMinStartDuty(t *testing.T) {
+	d := NewFaultDetector(Profile{MinStartDuty: 8000})
+	runFaultSteps(t, d, []faultStep{
+		{0, 4000, 0, FaultNone},
+		{5 * time.Second, 4000, 0, FaultNone},
+		{0, 8000, 0, FaultNone},
+		{3 * time.Second, 8000, 0, FaultTachMissing},
+	})
+}
+
+// MinRunDuty未満の指令では、唸るだけで回らなくても異常としない
+func TestFaultDetector_BelowMinRunDuty(t *testing.T) {
+	d := NewFaultDetector(DefaultProfile)
+	runFaultSteps(t, d, []faultStep{
+		{0, MaxDuty, 1500, FaultNone},
+		{time.Second, MaxDuty/10 - 1, 0, FaultNone},
+		{5 * time.Second, MaxDuty/10 - 1, 0, FaultNone},
+		{0, MaxDuty / 10, 0, FaultNone},
+		{3 * time.Second, MaxDuty / 10, 0, FaultStalled},
+	})
+}
+
+// Clearの後は、タコパルスを見たことも忘れる
+func TestFaultDetector_ClearForgetsTach(t *testing.T) {
+	d := NewFaultDetector(DefaultProfile)
+	runFaultSteps(t, d, []faultStep{
+		{0, MaxDuty, 1500, FaultNone},
+		{time.Second, MaxDuty, 0, FaultNone},
+		{3 * time.Second, MaxDuty, 0, FaultStalled},
+	})
+	d.Clear()
+	runFaultSteps(t, d, []faultStep{
+		{0, MaxDuty, 0, FaultNone},
+		{3 * time.Second, MaxDuty, 0, FaultTachMissing},
+	})
+}
+
+func TestFaultDetector_Clear(t *testing.T) {
+	d := NewFaultDetector(DefaultProfile)
+	d.Config.Latch = true
+	clock := newFakeClock()
+
+	d.Update(clock.Now(), MaxDuty, 0)
+	clock.Advance(3 * time.Second)
+	if got := d.Update(clock.Now(), MaxDuty, 0); got != FaultTachMissing {
+		t.Fatalf("期待する異常は %v 、実際は %v で異なる", FaultTachMissing, got)
+	}
+
+	d.Clear()
+	if got := d.Faults(); got != FaultNone {
+		t.Errorf("Clear後の期待する異常は %v 、実際は %v で異なる", FaultNone, got)
+	}
+	// タイマーもやり直しなので、すぐには立たない
+	clock.Advance(time.Second)
+	if got := d.Update(clock.Now(), MaxDuty, 0); got != FaultNone {
+		t.Errorf("Clear直後の期待する異常は %v 、実際は %v で異なる", FaultNone, got)
+	}
+}
+
+func TestFault_String(t *testing.T) {
+	testCases := []struct {
+		fault    Fault
+		expected string
+	}{
+		{FaultNone, "none"},
+		{FaultStalled, "stalled"},
+		{FaultTachMissing | FaultOverspeed, "tach-missing|overspeed"},
+	}
+	for _, tc := range testCases {
+		if got := tc.fault.String(); got != tc.expected {
+			t.Errorf("期待する文字列は %q 、実際は %q で異なる", tc.expected, got)
+		}
+	}
+	if !(FaultStalled | FaultUnderspeed).Has(FaultStalled) || FaultStalled.Has(FaultNone) {
+		t.Error("Hasの結果が正しくない")
+	}
+}
+
+// DualFanから両方のローターの異常が取れること
+func TestDualFan_CheckFaults(t *testing.T) {
+	clock := newFakeClock()
+	counterF := &dualMockPulseCounter{mockCount: 100}
+	counterR := &dualMockPulseCounter{mockCount: 0}
+	dualFan := NewDualFan("Test DualFan", counterF, counterR)
+	dualFan.SetClock(clock)
+
+	for i := 0; i < 4; i++ {
+		clock.Advance(time.Second)
+		dualFan.CalculateRPMs()
+		dualFan.CheckFaults(MaxDuty, MaxDuty)
+	}
+
+	front, rear := dualFan.Faults()
+	if front != FaultNone || rear != FaultTachMissing {
+		t.Errorf("期待する異常は %v/%v 、実際は %v/%v で異なる", FaultNone, FaultTachMissing, front, rear)
+	}
+	if !dualFan.HasFault() {
+		t.Error("HasFaultはtrueのはず")
+	}
+
+	dualFan.ClearFaults()
+	if dualFan.HasFault() {
+		t.Error("ClearFaults後のHasFaultはfalseのはず")
+	}
+}
@@ -0,0 +1,173 @@
+package fan
+
+// Filter smooths a stream of RPM readings.
+//
+// Filterは、RPMの読み取り値の流れを平滑化する。
+type Filter interface {
+	// Update adds a new raw reading and returns the filtered value.
+	//
+	// Updateは、新しい生の読み取り値を追加し、フィルタ後の値を返す。
+	Update(rpm uint32) uint32
+	// Reset discards the filter history.
+	//
+	// Resetは、フィルタの履歴を捨てる。
+	Reset()
+}
+
+// MovingAverage is a Filter that returns the mean of the last N readings.
+//
+// MovingAverageは、直近N個の読み取り値の平均を返すFilter。
+type MovingAverage struct {
+	samples []uint32
+	next    int
+	filled  int
+	sum     uint64
+}
+
+// NewMovingAverage creates a MovingAverage over n readings. n below 1 is
+// treated as 1.
+//
+// NewMovingAverageは、n個の読み取り値のMovingAverageを作る。1未満のnは1
+// として扱う。
+func NewMovingAverage(n int) *MovingAverage {
+	if n < 1 {
+		n = 1
+	}
+	return &MovingAverage{samples: make([]uint32, n)}
+}
+
+// Update adds a reading and returns the rounded mean.
+//
+// Updateは、読み取り値を追加し、丸めた平均を返す。
+func (m *MovingAverage) Update(rpm uint32) uint32 {
+	if m.filled == len(m.samples) {
+		m.sum -= uint64(m.samples[m.next])
+	} else {
+		m.filled++
+	}
+	m.samples[m.next] = rpm
+	m.sum += uint64(rpm)
+	m.next = (m.next + 1) % len(m.samples)
+	return uint32((m.sum + uint64(m.filled)/2) / uint64(m.filled))
+}
+
+// Reset discards the filter history.
+//
+// Resetは、フィルタの履歴を捨てる。
+func (m *MovingAverage) Reset() {
+	m.next = 0
+	m.filled = 0
+	m.sum = 0
+}
+
+// EMA is an exponential moving average Filter.
+//
+// EMAは、指数移動平均のFilter。
+type EMA struct {
+	alpha  float32
+	value  float32
+	primed bool
+}
+
+// NewEMA creates an EMA with the given smoothing factor. alpha is clamped
+// to (0, 1]; smaller values smooth more.
+//
+// NewEMAは、指定された平滑化係数でEMAを作る。alphaは(0, 1]に収める。小さ
+// いほど強く平滑化する。
+func NewEMA(alpha float32) *EMA {
+	if alpha <= 0 {
+		alpha = 0.01
+	}
+	if alpha > 1 {
+		alpha = 1
+	}
+	return &EMA{alpha: alpha}
+}
+
+// Update adds a reading and returns the rounded average. The first
+// reading is returned as is.
+//
+// Updateは、読み取り値を追加し、丸めた平均を返す。最初の読み取り値はその
+// まま返す。
+func (e *EMA) Update(rpm uint32) uint32 {
+	if !e.primed {
+		e.value = float32(rpm)
+		e.primed = true
+	} else {
+		e.value += e.alpha * (float32(rpm) - e.value)
+	}
+	return uint32(e.value + 0.5)
+}
+
+// Reset discards the filter history.
+//
+// Resetは、フィルタの履歴を捨てる。
+func (e *EMA) Reset() {
+	e.primed = false
+}
+
+// Median is a Filter that returns the median of the last N readings. It
+// rejects single-sample spikes.
+//
+// Medianは、直近N個の読み取り値の中央値を返すFilter。1サンプルだけのスパ
+// イクを取り除く。
+type Median struct {
+	samples []uint32
+	sorted  []uint32
+	next    int
+	filled  int
+}
+
+// NewMedian creates a Median over n readings. An even n is rounded up to
+// the next odd number so there is always a middle value.
+//
+// NewMedianは、n個の読み取り値のMedianを作る。常に真ん中の値があるよう、
+// 偶数のnは次の奇数に切り上げる。
+func NewMedian(n int) *Median {
+	if n < 1 {
+		n = 1
+	}
+	if n%2 == 0 {
+		n++
+	}
+	return &Median{
+		samples: make([]uint32, n),
+		sorted:  make([]uint32, n),
+	}
+}
+
+// Update adds a reading and returns the median of the readings so far.
+//
+// Updateは、読み取り値を追加し、これまでの読み取り値の中央値を返す。
+func (m *Median) Update(rpm uint32) uint32 {
+	m.samples[m.next] = rpm
+	m.next = (m.next + 1) % len(m.samples)
+	if m.filled < len(m.samples) {
+		m.filled++
+	}
+
+	// Insertion sort is fine for the handful of samples we keep.
+	// 保持するサンプルは数個なので挿入ソートで十分。
+	sorted := m.sorted[:m.filled]
+	copy(sorted, m.samples[:m.filled])
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j-1] > sorted[j]; j-- {
+			sorted[j-1], sorted[j] = sorted[j], sorted[j-1]
+		}
+	}
+	if len(sorted)%2 == 1 {
+		return sorted[len(sorted)/2]
+	}
+	// Not filled yet and even: average the two middle values.
+	// まだ埋まっておらず偶数個なら、真ん中の2つを平均する。
+	mid := len(sorted) / 2
+	return uint32((uint64(sorted[mid-1]) + uint64(sorted[mid]) + 1) / 2)
+}
+
+// Reset discards the filter history.
+//
+// Resetは、フィルタの履歴を捨てる。
+func (m *Median) Reset() {
+	m.next = 0
+	m.filled = 0
+}
@@ -0,0 +1,187 @@
+package fan
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMovingAverage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		n        int
+		inputs   []uint32
+		expected []uint32
+	}{
+		{
+			name:     "3サンプル平均",
+			n:        3,
+			inputs:   []uint32{3000, 3060, 2940, 3600, 3000},
+			expected: []uint32{3000, 3030, 3000, 3200, 3180},
+		},
+		{
+			name:     "1サンプルはそのまま",
+			n:        1,
+			inputs:   []uint32{100, 200, 300},
+			expected: []uint32{100, 200, 300},
+		},
+		{
+			name:     "0は1として扱う",
+			n:        0,
+			inputs:   []uint32{100, 200},
+			expected: []uint32{100, 200},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewMovingAverage(tc.n)
+			for i, in := range tc.inputs {
+				if got := f.Update(in); got != tc.expected[i] {
+					t.Errorf("%d番目の期待値は %d 、実際は %d で異なる", i, tc.expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestEMA(t *testing.T) {
+	testCases := []struct {
+		name     string
+		alpha    float32
+		inputs   []uint32
+		expected []uint32
+	}{
+		{
+			name:     "alpha 0.5",
+			alpha:    0.5,
+			inputs:   []uint32{1000, 2000, 2000, 0},
+			expected: []uint32{1000, 1500, 1750, 875},
+		},
+		{
+			name:     "alpha 1はそのまま",
+			alpha:    1,
+			inputs:   []uint32{1000, 2000, 0},
+			expected: []uint32{1000, 2000, 0},
+		},
+		{
+			name:     "1より大きいalphaは1に収める",
+			alpha:    2,
+			inputs:   []uint32{1000, 2000},
+			expected: []uint32{1000, 2000},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewEMA(tc.alpha)
+			for i, in := range tc.inputs {
+				if got := f.Update(in); got != tc.expected[i] {
+					t.Errorf("%d番目の期待値は %d 、実際は %d で異なる", i, tc.expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestMedian(t *testing.T) {
+	testCases := []struct {
+		name     string
+		n        int
+		inputs   []uint32
+		expected []uint32
+	}{
+		{
+			name:     "スパイクを除去",
+			n:        3,
+			inputs:   []uint32{3000, 9000, 3060, 3000, 0, 3000},
+			expected: []uint32{3000, 6000, 3060, 3060, 3000, 3000},
+		},
+		{
+			name:     "偶数は奇数に切り上げ",
+			n:        4,
+			inputs:   []uint32{10, 20, 30, 40, 1000},
+			expected: []uint32{10, 15, 20, 25, 30},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := NewMedian(tc.n)
+			for i, in := range tc.inputs {
+				if got := f.Update(in); got != tc.expected[i] {
+					t.Errorf("%d番目の期待値は %d 、実際は %d で異なる", i, tc.expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+// Resetで履歴が捨てられること
+func TestFilter_Reset(t *testing.T) {
+	filters := map[string]Filter{
+		"MovingAverage": NewMovingAverage(4),
+		"EMA":           NewEMA(0.25),
+		"Median":        NewMedian(3),
+	}
+	for name, f := range filters {
+		t.Run(name, func(t *testing.T) {
+			f.Update(5000)
+			f.Update(5000)
+			f.Reset()
+			if got := f.Update(1200); got != 1200 {
+				t.Errorf("Reset後の期待値は 1200 、実際は %d で異なる", got)
+			}
+		})
+	}
+}
+
+// 生の値とフィルタ後の値が並んで取れること
+func TestFan_FilteredRPM(t *testing.T) {
+	mockCounter := &singleMockPulseCounter{}
+	testFan := NewFan("Test Fan", mockCounter)
+
+	// フィルタ無しなら同じ値
+	mockCounter.mockCount = 100
+	testFan.CalculateRPM()
+	if testFan.RPM() != 3000 || testFan.FilteredRPM() != 3000 {
+		t.Fatalf("期待する値は 3000/3000 、実際は %d/%d で異なる", testFan.RPM(), testFan.FilteredRPM())
+	}
+
+	testFan.SetFilter(NewMedian(3))
+	for _, count := range []uint32{100, 300, 100} {
+		mockCounter.mockCount = count
+		testFan.CalculateRPMOver(time.Second)
+	}
+	if raw, filtered := testFan.RPM(), testFan.FilteredRPM(); raw != 3000 || filtered != 3000 {
+		t.Errorf("期待する値は 3000/3000 、実際は %d/%d で異なる", raw, filtered)
+	}
+
+	mockCounter.mockCount = 300
+	raw := testFan.CalculateRPMOver(time.Second)
+	if raw != 9000 || testFan.FilteredRPM() != 9000 {
+		t.Errorf("期待する値は 9000/9000 、実際は %d/%d で異なる", raw, testFan.FilteredRPM())
+	}
+}
+
+// ExampleDualFan_FilteredRPMs shows how to show smoothed RPMs while
+// keeping the raw values.
+//
+// ExampleDualFan_FilteredRPMsは、生の値を残したまま平滑化したRPMを表示す
+// る方法を示す。
+func ExampleDualFan_FilteredRPMs() {
+	counterF := &dualMockPulseCounter{}
+	counterR := &dualMockPulseCounter{}
+	dualFan := NewDualFan("Typhoon", counterF, counterR)
+	dualFan.SetFilters(NewMovingAverage(2), NewMovingAverage(2))
+
+	for _, count := range []uint32{120, 124} {
+		counterF.mockCount = count
+		counterR.mockCount = count / 2
+		dualFan.CalculateRPMsOver(time.Second)
+	}
+
+	front, rear := dualFan.FilteredRPMs()
+	fmt.Printf("Raw: %d/%d, Filtered: %d/%d\n", dualFan.Front.RPM(), dualFan.Rear.RPM(), front, rear)
+	// Output: Raw: 3720/1860, Filtered: 3660/1830
+}
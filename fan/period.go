@@ -0,0 +1,245 @@
+package fan
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// EdgeBufferSize is the number of edge timestamps kept by EdgeBuffer.
+	// It must be a power of two so the ring index survives wrap-around.
+	//
+	// EdgeBufferSizeは、EdgeBufferが保持するエッジ時刻の数。インデックスが
+	// 一周しても崩れないよう、2のべき乗でなければならない。
+	EdgeBufferSize = 16
+
+	// DefaultPeriodSamples is the number of pulse periods averaged in
+	// period mode.
+	//
+	// DefaultPeriodSamplesは、周期モードで平均するパルス周期の数。
+	DefaultPeriodSamples = 4
+)
+
+// EdgeCounter is a PulseCounter that also records the time of each edge,
+// so the RPM can be calculated from the pulse period.
+//
+// EdgeCounterは、各エッジの時刻も記録するPulseCounter。これでパルス周期
+// からRPMを計算できる。
+type EdgeCounter interface {
+	PulseCounter
+	// ReadEdges copies the most recent edge timestamps, in microseconds
+	// and oldest first, into dst and returns how many were copied. It
+	// does not reset anything.
+	//
+	// ReadEdgesは、直近のエッジ時刻(マイクロ秒、古い順)をdstにコピーし、
+	// コピーした数を返す。何もリセットしない。
+	ReadEdges(dst []uint32) int
+}
+
+// EdgeBuffer is a ring buffer of edge timestamps that implements
+// EdgeCounter. Record may be called from an interrupt; all other methods
+// must be called from a single reader.
+//
+// EdgeBufferは、EdgeCounterを実装するエッジ時刻のリングバッファ。Record
+// は割り込みから呼んでも良い。それ以外のメソッドは1つの読み手から呼ぶこと。
+type EdgeBuffer struct {
+	edges [EdgeBufferSize]uint32
+	// Total number of edges recorded. Only the writer stores it.
+	// 記録したエッジの総数。書き込むのは書き手だけ。
+	head atomic.Uint32
+	// head at the last ReadAndReset.
+	// 前回ReadAndResetしたときのhead
+	read uint32
+	// Set once the reader has seen a full buffer, so a wrapped head is
+	// not mistaken for a nearly empty one.
+	// 読み手がバッファが埋まったのを一度見たら設定する。一周したheadを空に
+	// 近いバッファと取り違えないため。
+	full bool
+}
+
+// Record stores the timestamp, in microseconds, of a new edge.
+//
+// Recordは、新しいエッジの時刻(マイクロ秒)を記録する。
+func (b *EdgeBuffer) Record(us uint32) {
+	h := b.head.Load()
+	b.edges[h%EdgeBufferSize] = us
+	b.head.Store(h + 1)
+}
+
+// ReadAndReset returns the number of edges recorded since the previous
+// call.
+//
+// ReadAndResetは、前回の呼び出しから記録されたエッジの数を返す。
+func (b *EdgeBuffer) ReadAndReset() uint32 {
+	h := b.head.Load()
+	n := h - b.read
+	b.read = h
+	return n
+}
+
+// ReadEdges copies the most recent edge timestamps, oldest first, into
+// dst and returns how many were copied.
+//
+// ReadEdgesは、直近のエッジ時刻を古い順にdstへコピーし、コピーした数を返
+// す。
+func (b *EdgeBuffer) ReadEdges(dst []uint32) int {
+	h := b.head.Load()
+	n := uint32(len(dst))
+	if n > EdgeBufferSize {
+		n = EdgeBufferSize
+	}
+	if h >= EdgeBufferSize {
+		b.full = true
+	}
+	if !b.full && n > h {
+		n = h
+	}
+	for i := uint32(0); i < n; i++ {
+		dst[i] = b.edges[(h-n+i)%EdgeBufferSize]
+	}
+	return int(n)
+}
+
+// MeasureMode is the method used to turn tach pulses into RPM.
+//
+// MeasureModeは、タコパルスをRPMに変換する方法。
+type MeasureMode uint8
+
+const (
+	// ModeCount counts pulses over the measurement window.
+	// ModeCountは、計測時間内のパルスを数える。
+	ModeCount MeasureMode = iota
+	// ModePeriod averages the time between pulses.
+	// ModePeriodは、パルス間の時間を平均する。
+	ModePeriod
+)
+
+// String returns the name of the mode.
+func (m MeasureMode) String() string {
+	switch m {
+	case ModeCount:
+		return "count"
+	case ModePeriod:
+		return "period"
+	default:
+		return "unknown"
+	}
+}
+
+// PeriodEstimator switches between count mode and period mode depending
+// on speed. Period mode is used at low speed, where counting pulses over
+// a short window has poor resolution.
+//
+// PeriodEstimatorは、速度に応じてカウントモードと周期モードを切り替える。
+// 短い計測時間でパルスを数えると分解能が低くなる低速域では、周期モードを
+// 使う。
+type PeriodEstimator struct {
+	// Switch to period mode below this RPM.
+	// この回転数を下回ったら周期モードに切り替える。
+	PeriodBelowRPM uint32
+	// Switch back to count mode above this RPM. Keep it higher than
+	// PeriodBelowRPM so the mode does not flap.
+	// この回転数を上回ったらカウントモードに戻す。モードがばたつかないよう
+	// PeriodBelowRPMより高くしておく。
+	CountAboveRPM uint32
+	// Number of pulse periods averaged in period mode.
+	// 周期モードで平均するパルス周期の数。
+	Samples int
+	// Report 0 RPM when no edge has been seen for this long.
+	// この時間エッジが無ければ0 RPMとする。
+	StopTimeout time.Duration
+
+	mode MeasureMode
+	// Number of edges counted since the fan was last seen stopped.
+	// Edges from before the stop must not be mixed into the period.
+	// 最後に停止を検出してから数えたエッジの数。停止前のエッジを周期に混ぜ
+	// てはならない。
+	fresh uint32
+}
+
+// NewPeriodEstimator creates a PeriodEstimator with default thresholds.
+//
+// NewPeriodEstimatorは、デフォルトのしきい値でPeriodEstimatorを作る。
+func NewPeriodEstimator() *PeriodEstimator {
+	return &PeriodEstimator{
+		PeriodBelowRPM: 1000,
+		CountAboveRPM:  1200,
+		Samples:        DefaultPeriodSamples,
+		StopTimeout:    2 * time.Second,
+	}
+}
+
+// Mode returns the mode used by the last estimate.
+//
+// Modeは、直近の推定で使ったモードを返す。
+func (e *PeriodEstimator) Mode() MeasureMode {
+	return e.mode
+}
+
+// Estimate returns the RPM in units of 1/1000 RPM.
+// countMilliRPM is the result of count mode for count pulses, edges are
+// the most recent edge timestamps in microseconds (oldest first) and
+// sinceLastEdge is the time since an edge was last counted.
+//
+// Estimateは、1/1000 RPM単位でRPMを返す。
+// countMilliRPMはcount個のパルスに対するカウントモードの結果、edgesは直
+// 近のエッジ時刻(マイクロ秒、古い順)、sinceLastEdgeは最後にエッジを数え
+// てからの時間。
+func (e *PeriodEstimator) Estimate(countMilliRPM uint64, count uint32, edges []uint32, ppr uint32, sinceLastEdge time.Duration) uint64 {
+	if sinceLastEdge > e.StopTimeout {
+		e.mode = ModePeriod
+		e.fresh = 0
+		return 0
+	}
+
+	e.fresh += count
+	if e.fresh > EdgeBufferSize {
+		e.fresh = EdgeBufferSize
+	}
+	if len(edges) > int(e.fresh) {
+		edges = edges[len(edges)-int(e.fresh):]
+	}
+
+	result := countMilliRPM
+	if e.mode == ModePeriod {
+		if periodMilliRPM, ok := e.fromPeriod(edges, ppr); ok {
+			result = periodMilliRPM
+		}
+	}
+
+	rpm := result / 1000
+	switch {
+	case e.mode == ModeCount && rpm < uint64(e.PeriodBelowRPM):
+		e.mode = ModePeriod
+	case e.mode == ModePeriod && rpm > uint64(e.CountAboveRPM):
+		e.mode = ModeCount
+	}
+	return result
+}
+
+// fromPeriod calculates the RPM from the average of the most recent pulse
+// periods. It reports false if there are not enough edges.
+//
+// fromPeriodは、直近のパルス周期の平均からRPMを計算する。エッジが足りな
+// ければfalseを返す。
+func (e *PeriodEstimator) fromPeriod(edges []uint32, ppr uint32) (uint64, bool) {
+	samples := e.Samples
+	if samples < 1 {
+		samples = 1
+	}
+	if len(edges) > samples+1 {
+		edges = edges[len(edges)-samples-1:]
+	}
+	if len(edges) < 2 {
+		return 0, false
+	}
+	// uint32の引き算なので、タイマーが一周しても差は正しい。
+	span := uint64(edges[len(edges)-1] - edges[0])
+	if span == 0 {
+		return 0, false
+	}
+	periods := uint64(len(edges) - 1)
+	// milliRPM = periods / ppr * (1 minute / span) * 1000
+	den := uint64(ppr) * span
+	return (periods*uint64(time.Minute/time.Microsecond)*1000 + den/2) / den, true
+}
@@ -0,0 +1,293 @@
+package fan
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// 合成したタイムスタンプ列をEdgeBufferに流し込むテスト用ヘルパー
+type edgeStream struct {
+	buf      *EdgeBuffer
+	clock    *fakeClock
+	nowUS    uint64 // 仮想時刻(マイクロ秒)
+	nextUS   uint64 // 次のエッジの時刻
+	periodUS uint64 // パルス周期。0なら停止
+	offsetUS uint32 // タイマー値のオフセット(一周のテスト用)
+}
+
+func newEdgeStream(clock *fakeClock) *edgeStream {
+	return &edgeStream{buf: &EdgeBuffer{}, clock: clock}
+}
+
+// setRPM changes the pulse period for the given RPM and PPR.
+func (s *edgeStream) setRPM(rpm, ppr uint64) {
+	if rpm == 0 {
+		s.periodUS = 0
+		return
+	}
+	s.periodUS = 60_000_000 / (rpm * ppr)
+	if s.nextUS <= s.nowUS {
+		s.nextUS = s.nowUS + s.periodUS
+	}
+}
+
+// advance moves virtual time forward, recording every edge on the way.
+func (s *edgeStream) advance(d time.Duration) {
+	end := s.nowUS + uint64(d/time.Microsecond)
+	for s.periodUS != 0 && s.nextUS <= end {
+		s.buf.Record(uint32(s.nextUS) + s.offsetUS)
+		s.nextUS += s.periodUS
+	}
+	if s.periodUS == 0 {
+		s.nextUS = end
+	}
+	s.nowUS = end
+	s.clock.Advance(d)
+}
+
+func TestEdgeBuffer_ReadEdges(t *testing.T) {
+	b := &EdgeBuffer{}
+	for i := uint32(1); i <= 20; i++ {
+		b.Record(i * 100)
+	}
+
+	if n := b.ReadAndReset(); n != 20 {
+		t.Errorf("期待するパルス数は 20 、実際は %d で異なる", n)
+	}
+	if n := b.ReadAndReset(); n != 0 {
+		t.Errorf("リセット後の期待するパルス数は 0 、実際は %d で異なる", n)
+	}
+
+	var dst [5]uint32
+	n := b.ReadEdges(dst[:])
+	expected := [5]uint32{1600, 1700, 1800, 1900, 2000}
+	if n != 5 || dst != expected {
+		t.Errorf("期待するエッジは %v 、実際は %v (%d個) で異なる", expected, dst, n)
+	}
+
+	// バッファより大きいdstでもEdgeBufferSize個まで
+	var big [EdgeBufferSize + 4]uint32
+	if n := b.ReadEdges(big[:]); n != EdgeBufferSize || big[0] != 500 {
+		t.Errorf("期待するのは %d 個で先頭 500 、実際は %d 個で先頭 %d", EdgeBufferSize, n, big[0])
+	}
+}
+
+func TestEdgeBuffer_ReadEdges_Partial(t *testing.T) {
+	b := &EdgeBuffer{}
+	b.Record(10)
+	b.Record(20)
+
+	var dst [4]uint32
+	if n := b.ReadEdges(dst[:]); n != 2 || dst[0] != 10 || dst[1] != 20 {
+		t.Errorf("期待するエッジは [10 20] 、実際は %v (%d個) で異なる", dst[:n], n)
+	}
+}
+
+// headが一周してもインデックスとカウントが崩れないこと
+func TestEdgeBuffer_HeadWrap(t *testing.T) {
+	b := &EdgeBuffer{}
+	b.head.Store(math.MaxUint32 - 2)
+	b.read = math.MaxUint32 - 2
+	var dst [5]uint32
+	b.ReadEdges(dst[:]) // 一周する前に読み手がバッファを一度見ている
+
+	for i := uint32(1); i <= 5; i++ {
+		b.Record(i)
+	}
+
+	if n := b.ReadAndReset(); n != 5 {
+		t.Errorf("期待するパルス数は 5 、実際は %d で異なる", n)
+	}
+	b.ReadEdges(dst[:])
+	if dst != [5]uint32{1, 2, 3, 4, 5} {
+		t.Errorf("期待するエッジは [1 2 3 4 5] 、実際は %v で異なる", dst)
+	}
+}
+
+func TestPeriodEstimator_FromPeriod(t *testing.T) {
+	testCases := []struct {
+		name     string
+		edges    []uint32
+		ppr      uint32
+		expected uint64 // milliRPM
+	}{
+		{
+			name:     "60 RPM 2PPR：500ms周期",
+			edges:    []uint32{0, 500_000, 1_000_000},
+			ppr:      2,
+			expected: 60_000,
+		},
+		{
+			name:     "45 RPM 2PPR：666.666ms周期",
+			edges:    []uint32{0, 666_667, 1_333_333, 2_000_000},
+			ppr:      2,
+			expected: 45_000,
+		},
+		{
+			name:     "サンプル数より多いエッジは新しい方だけ使う",
+			edges:    []uint32{0, 100_000, 600_000, 1_100_000, 1_600_000, 2_100_000},
+			ppr:      2,
+			expected: 60_000,
+		},
+		{
+			name:     "タイマーの一周をまたぐ",
+			edges:    []uint32{math.MaxUint32 - 250_000, 249_999},
+			ppr:      1,
+			expected: 120_000,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := NewPeriodEstimator()
+			got, ok := e.fromPeriod(tc.edges, tc.ppr)
+			if !ok || got != tc.expected {
+				t.Errorf("期待するmilliRPMは %d 、実際は %d (ok=%v) で異なる", tc.expected, got, ok)
+			}
+		})
+	}
+
+	e := NewPeriodEstimator()
+	if _, ok := e.fromPeriod([]uint32{100}, 2); ok {
+		t.Error("エッジが1つでは周期を計算できないはず")
+	}
+}
+
+// 低速では周期モードに切り替わり、カウントモードの60RPM刻みより正確になる
+func TestFan_PeriodMode_LowSpeed(t *testing.T) {
+	clock := newFakeClock()
+	stream := newEdgeStream(clock)
+	testFan := NewFan("Test Fan", stream.buf)
+	testFan.SetClock(clock)
+
+	stream.setRPM(45, 2)
+	testFan.CalculateRPM()
+	for i := 0; i < 6; i++ {
+		stream.advance(time.Second)
+		testFan.CalculateRPM()
+	}
+
+	if mode := testFan.MeasureMode(); mode != ModePeriod {
+		t.Errorf("期待するモードは %v 、実際は %v で異なる", ModePeriod, mode)
+	}
+	if rpm := testFan.RPM(); rpm != 45 {
+		t.Errorf("期待するRPMは %d 、実際は %d で異なる", 45, rpm)
+	}
+}
+
+// 高速ではカウントモードのまま
+func TestFan_PeriodMode_HighSpeed(t *testing.T) {
+	clock := newFakeClock()
+	stream := newEdgeStream(clock)
+	testFan := NewFan("Test Fan", stream.buf)
+	testFan.SetClock(clock)
+
+	stream.setRPM(3000, 2)
+	testFan.CalculateRPM()
+	for i := 0; i < 3; i++ {
+		stream.advance(time.Second)
+		testFan.CalculateRPM()
+	}
+
+	if mode := testFan.MeasureMode(); mode != ModeCount {
+		t.Errorf("期待するモードは %v 、実際は %v で異なる", ModeCount, mode)
+	}
+	if rpm := testFan.RPM(); rpm != 3000 {
+		t.Errorf("期待するRPMは %d 、実際は %d で異なる", 3000, rpm)
+	}
+}
+
+// 減速すると周期モードへ、再加速するとカウントモードへ戻る
+func TestFan_PeriodMode_Switching(t *testing.T) {
+	clock := newFakeClock()
+	stream := newEdgeStream(clock)
+	testFan := NewFan("Test Fan", stream.buf)
+	testFan.SetClock(clock)
+
+	steps := []struct {
+		rpm          uint64
+		expectedMode MeasureMode
+	}{
+		{rpm: 2400, expectedMode: ModeCount},
+		{rpm: 300, expectedMode: ModePeriod},
+		{rpm: 1100, expectedMode: ModePeriod}, // ヒステリシス内なので周期モードのまま
+		{rpm: 2400, expectedMode: ModeCount},
+	}
+
+	testFan.CalculateRPM()
+	for _, step := range steps {
+		stream.setRPM(step.rpm, 2)
+		for i := 0; i < 4; i++ {
+			stream.advance(500 * time.Millisecond)
+			testFan.CalculateRPMOver(500 * time.Millisecond)
+		}
+		if mode := testFan.MeasureMode(); mode != step.expectedMode {
+			t.Errorf("%d RPMで期待するモードは %v 、実際は %v で異なる", step.rpm, step.expectedMode, mode)
+		}
+		if rpm := testFan.RPM(); rpm != uint32(step.rpm) {
+			t.Errorf("期待するRPMは %d 、実際は %d で異なる", step.rpm, rpm)
+		}
+	}
+}
+
+// エッジが途絶えたらStopTimeout後に0 RPM、再始動時は停止前のエッジを使わない
+func TestFan_PeriodMode_StopAndRestart(t *testing.T) {
+	clock := newFakeClock()
+	stream := newEdgeStream(clock)
+	testFan := NewFan("Test Fan", stream.buf)
+	testFan.SetClock(clock)
+
+	stream.setRPM(120, 2)
+	testFan.CalculateRPM()
+	for i := 0; i < 4; i++ {
+		stream.advance(time.Second)
+		testFan.CalculateRPM()
+	}
+	if rpm := testFan.RPM(); rpm != 120 {
+		t.Fatalf("期待するRPMは %d 、実際は %d で異なる", 120, rpm)
+	}
+
+	// 停止
+	stream.setRPM(0, 2)
+	for i := 0; i < 4; i++ {
+		stream.advance(time.Second)
+		testFan.CalculateRPM()
+	}
+	if rpm := testFan.RPM(); rpm != 0 {
+		t.Errorf("停止後の期待するRPMは 0 、実際は %d で異なる", rpm)
+	}
+
+	// 再始動：最初の1パルスだけでは周期が分からず、停止前のエッジとも混ぜない
+	stream.setRPM(60, 2)
+	stream.advance(600 * time.Millisecond)
+	testFan.CalculateRPMOver(600 * time.Millisecond)
+	if rpm := testFan.RPM(); rpm != 50 { // カウントモードの値 (1 / 2) * 100
+		t.Errorf("再始動直後の期待するRPMは %d 、実際は %d で異なる", 50, rpm)
+	}
+	stream.advance(time.Second)
+	testFan.CalculateRPM()
+	if rpm := testFan.RPM(); rpm != 60 {
+		t.Errorf("再始動後の期待するRPMは %d 、実際は %d で異なる", 60, rpm)
+	}
+}
+
+// タイマー値が一周しても周期モードの結果は変わらない
+func TestFan_PeriodMode_TimerWrap(t *testing.T) {
+	clock := newFakeClock()
+	stream := newEdgeStream(clock)
+	stream.offsetUS = math.MaxUint32 - 1_500_000
+	testFan := NewFanWithProfile("Test Fan", stream.buf, Profile{PulsesPerRevolution: 3})
+	testFan.SetClock(clock)
+
+	stream.setRPM(200, 3)
+	testFan.CalculateRPM()
+	for i := 0; i < 5; i++ {
+		stream.advance(time.Second)
+		testFan.CalculateRPM()
+	}
+
+	if rpm := testFan.RPM(); rpm != 200 {
+		t.Errorf("期待するRPMは %d 、実際は %d で異なる", 200, rpm)
+	}
+}
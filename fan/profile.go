@@ -0,0 +1,50 @@
+package fan
+
+// MaxDuty is the full-scale duty value, in the same units as the PWM
+// period (40000ns for 25kHz).
+//
+// MaxDutyは、フルスケールのデューティ値。PWM周期と同じ単位(25kHzで
+// 40000ns)。
+const MaxDuty = 40000
+
+// Profile describes the electrical and mechanical characteristics of a
+// fan model.
+//
+// Profileは、ファンの機種ごとの電気的・機械的な特性を表す。
+type Profile struct {
+	// Number of tach pulses per revolution. Most PC fans give 2.
+	// 1回転あたりのタコパルス数。ほとんどのPCファンは2。
+	PulsesPerRevolution uint32
+	// Rated maximum RPM. 0 means unknown.
+	// 定格最大回転数。0は不明を表す。
+	MaxRPM uint32
+	// Minimum duty (0-MaxDuty) needed to start the fan from rest.
+	// 0 means unknown.
+	// 停止状態から回り始めるのに必要な最小デューティ(0-MaxDuty)。0は不明
+	// を表す。
+	MinStartDuty uint32
+	// RPM at or below which the fan is considered stalled.
+	// この回転数以下でファンが停止しているとみなす。
+	StallRPM uint32
+}
+
+// DefaultProfile is the profile used by NewFan and NewDualFan: a fan
+// that gives 2 pulses per revolution.
+//
+// DefaultProfileは、NewFanとNewDualFanが使うプロファイル。1回転あたり2パ
+// ルスを出すファン。
+var DefaultProfile = Profile{
+	PulsesPerRevolution: 2,
+}
+
+// normalized returns p with zero pulses per revolution replaced by the
+// default, so it can always be used as a divisor.
+//
+// normalizedは、1回転あたりのパルス数が0ならデフォルトに置き換えたpを返
+// す。これで常に割る数として使える。
+func (p Profile) normalized() Profile {
+	if p.PulsesPerRevolution == 0 {
+		p.PulsesPerRevolution = DefaultProfile.PulsesPerRevolution
+	}
+	return p
+}
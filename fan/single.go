@@ -1,5 +1,14 @@
 package fan
 
+import "time"
+
+// DefaultWindow is the measurement window assumed for the very first
+// CalculateRPM call, when there is no previous reading to measure from.
+//
+// DefaultWindowは、前回の読み取りが無い最初のCalculateRPM呼び出しで仮定
+// する計測時間。
+const DefaultWindow = 1 * time.Second
+
 // PulseCounter is an interface that provides pulse counting
 // functionality.
 //
@@ -13,33 +22,255 @@ type PulseCounter interface {
 	ReadAndReset() uint32
 }
 
+// Clock is an interface that provides the current time. It allows the
+// measurement window to be controlled in tests.
+//
+// Clockは、現在時刻を提供するインターフェース。テストで計測時間を制御で
+// きるようにする。
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts an ordinary function to the Clock interface.
+//
+// ClockFuncは、普通の関数をClockインターフェースに適合させる。
+type ClockFunc func() time.Time
+
+// Now calls f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is the Clock backed by time.Now.
+//
+// SystemClockは、time.Nowを使うClock。
+var SystemClock Clock = ClockFunc(time.Now)
+
 // Fan represents a single fan unit.
 type Fan struct {
 	Name    string
 	counter PulseCounter
-	rpm     uint32
+	profile Profile
+	clock   Clock
+	// Set when the counter also records edge times.
+	// カウンタがエッジ時刻も記録する場合に設定される。
+	edges     EdgeCounter
+	estimator *PeriodEstimator
+	edgeBuf   [EdgeBufferSize]uint32
+	// Time an edge was last counted.
+	// 最後にエッジを数えた時刻
+	lastEdge time.Time
+	// Time of the previous reading. Zero until the first reading.
+	// 前回読み取った時刻。最初の読み取りまではゼロ値。
+	lastRead time.Time
+	rpm      uint32
+	detector *FaultDetector
+	// Optional smoothing stage and its last output.
+	// 任意の平滑化段とその直近の出力
+	filter      Filter
+	filteredRPM uint32
+	// The last RPM in units of 1/1000 RPM, before rounding.
+	// 丸める前の直近のRPM(1/1000 RPM単位)
+	milliRPM uint64
+	// Result of the last characterization sweep, if any.
+	// 直近の特性測定の結果。無ければnil。
+	characterization *Characterization
 }
 
-// NewFan creates a new Fan instance. The name can be any string.
+// NewFan creates a new Fan instance with DefaultProfile. The name can be
+// any string.
 //
-// NewFanは、新しいFanインスタンスを作る。名前は好きな文字列で良い。
+// NewFanは、DefaultProfileで新しいFanインスタンスを作る。名前は好きな文
+// 字列で良い。
 func NewFan(name string, counter PulseCounter) *Fan {
-	return &Fan{
+	return NewFanWithProfile(name, counter, DefaultProfile)
+}
+
+// NewFanWithProfile creates a new Fan instance for the given fan profile.
+// A zero PulsesPerRevolution falls back to DefaultProfile's value.
+// If the counter is an EdgeCounter, the fan switches to period mode at low
+// speed.
+//
+// NewFanWithProfileは、指定されたプロファイルで新しいFanインスタンスを作
+// る。PulsesPerRevolutionが0ならDefaultProfileの値を使う。
+// カウンタがEdgeCounterなら、低速域では周期モードに切り替える。
+func NewFanWithProfile(name string, counter PulseCounter, profile Profile) *Fan {
+	f := &Fan{
 		Name:    name,
 		counter: counter,
+		profile: profile.normalized(),
+		clock:   SystemClock,
+	}
+	f.detector = NewFaultDetector(f.profile)
+	if edges, ok := counter.(EdgeCounter); ok {
+		f.edges = edges
+		f.estimator = NewPeriodEstimator()
 	}
+	return f
+}
+
+// Profile returns the fan profile.
+//
+// Profileは、ファンのプロファイルを返す。
+func (f *Fan) Profile() Profile {
+	return f.profile
+}
+
+// SetProfile replaces the fan profile. It takes effect from the next
+// reading.
+//
+// SetProfileは、ファンのプロファイルを差し替える。次の読み取りから有効に
+// なる。
+func (f *Fan) SetProfile(profile Profile) {
+	f.profile = profile.normalized()
+	f.detector.profile = f.profile
+}
+
+// FaultDetector returns the fault detector of the fan. Its Config may be
+// adjusted.
+//
+// FaultDetectorは、ファンの異常検出器を返す。Configは調整しても良い。
+func (f *Fan) FaultDetector() *FaultDetector {
+	return f.detector
+}
+
+// CheckFaults evaluates the last reading against the commanded duty
+// (0-MaxDuty) and returns the raised faults. Call it after each reading.
+//
+// CheckFaultsは、直近の読み取り値を指令デューティ(0-MaxDuty)と比べて評価
+// し、立っている異常を返す。読み取りのたびに呼ぶこと。
+func (f *Fan) CheckFaults(duty uint32) Fault {
+	return f.detector.Update(f.clock.Now(), duty, f.rpm)
+}
+
+// Faults returns the currently raised faults.
+//
+// Faultsは、現在立っている異常を返す。
+func (f *Fan) Faults() Fault {
+	return f.detector.Faults()
+}
+
+// ClearFaults drops all raised faults.
+//
+// ClearFaultsは、立っているすべての異常を下ろす。
+func (f *Fan) ClearFaults() {
+	f.detector.Clear()
+}
+
+// SetClock replaces the clock used to measure the time between readings.
+//
+// SetClockは、読み取り間隔の計測に使うクロックを差し替える。
+func (f *Fan) SetClock(clock Clock) {
+	f.clock = clock
 }
 
 // CalculateRPM retrieves the value from the internal counter, calculates
-// the RPM, and returns it.
+// the RPM over the time elapsed since the previous call, and returns it
+// rounded to the nearest RPM. The first call assumes DefaultWindow.
 //
-// CalculateRPMは、内部カウンタの値を取得し、RPMを計算して返却する。
+// CalculateRPMは、内部カウンタの値を取得し、前回の呼び出しからの経過時間
+// をもとにRPMを計算して、最も近い整数に丸めて返却する。最初の呼び出しで
+// はDefaultWindowを仮定する。
 func (f *Fan) CalculateRPM() uint32 {
-	// Retrieve the value from the internal counter, calculate, and
-	// return.
-	//
-	// 内部カウンタの値を取得し、計算したうえで返却する。
-	count := f.counter.ReadAndReset()
-	f.rpm = (count / 2) * 60
+	now := f.clock.Now()
+	window := DefaultWindow
+	if !f.lastRead.IsZero() {
+		window = now.Sub(f.lastRead)
+		if window <= 0 {
+			// No time has passed, so leave the pulses for the next call.
+			// 時間が経っていないので、パルスは次回に残しておく。
+			return f.rpm
+		}
+	}
+	f.lastRead = now
+	return f.calculate(f.counter.ReadAndReset(), window)
+}
+
+// CalculateRPMOver is like CalculateRPM but uses the given measurement
+// window instead of measuring it with the clock.
+//
+// CalculateRPMOverは、CalculateRPMと同様だが、クロックで計測する代わりに
+// 指定された計測時間を使う。
+func (f *Fan) CalculateRPMOver(window time.Duration) uint32 {
+	if window <= 0 {
+		return f.rpm
+	}
+	f.lastRead = f.clock.Now()
+	return f.calculate(f.counter.ReadAndReset(), window)
+}
+
+// Estimator returns the period estimator, or nil if the counter does not
+// record edge times. Its thresholds may be adjusted.
+//
+// Estimatorは、周期推定器を返す。カウンタがエッジ時刻を記録しない場合は
+// nil。しきい値は調整しても良い。
+func (f *Fan) Estimator() *PeriodEstimator {
+	return f.estimator
+}
+
+// MeasureMode returns the mode used by the last reading.
+//
+// MeasureModeは、直近の読み取りで使ったモードを返す。
+func (f *Fan) MeasureMode() MeasureMode {
+	if f.estimator == nil {
+		return ModeCount
+	}
+	return f.estimator.Mode()
+}
+
+// SetFilter sets the filter applied to each new reading. nil disables
+// filtering, so FilteredRPM equals RPM.
+//
+// SetFilterは、新しい読み取り値ごとに適用するフィルタを設定する。nilなら
+// フィルタを使わず、FilteredRPMはRPMと等しくなる。
+func (f *Fan) SetFilter(filter Filter) {
+	f.filter = filter
+	f.filteredRPM = f.rpm
+}
+
+// FilteredRPM returns the last RPM after the filter stage.
+//
+// FilteredRPMは、フィルタを通した後の直近のRPMを返す。
+func (f *Fan) FilteredRPM() uint32 {
+	return f.filteredRPM
+}
+
+// RPM returns the last calculated raw RPM without touching the counter.
+//
+// RPMは、カウンタに触れずに直近に計算した生のRPMを返す。
+func (f *Fan) RPM() uint32 {
+	return f.rpm
+}
+
+// FractionalRPM returns the last calculated RPM before rounding.
+//
+// FractionalRPMは、丸める前の直近に計算したRPMを返す。
+func (f *Fan) FractionalRPM() float32 {
+	return float32(f.milliRPM) / 1000
+}
+
+// calculate converts a pulse count taken over window into RPM and stores
+// the result.
+//
+// calculateは、window の間に数えたパルス数をRPMに変換して結果を保持する。
+func (f *Fan) calculate(count uint32, window time.Duration) uint32 {
+	// milliRPM = count / ppr * (1 minute / window) * 1000
+	// uint64でも桁あふれしないよう、分母は最後に割る。
+	den := uint64(f.profile.PulsesPerRevolution) * uint64(window)
+	f.milliRPM = (uint64(count)*uint64(time.Minute)*1000 + den/2) / den
+
+	if f.edges != nil {
+		if count > 0 || f.lastEdge.IsZero() {
+			f.lastEdge = f.lastRead
+		}
+		n := f.edges.ReadEdges(f.edgeBuf[:])
+		f.milliRPM = f.estimator.Estimate(f.milliRPM, count, f.edgeBuf[:n], f.profile.PulsesPerRevolution, f.lastRead.Sub(f.lastEdge))
+	}
+	f.rpm = uint32((f.milliRPM + 500) / 1000)
+
+	f.filteredRPM = f.rpm
+	if f.filter != nil {
+		f.filteredRPM = f.filter.Update(f.rpm)
+	}
 	return f.rpm
 }
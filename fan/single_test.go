@@ -3,6 +3,7 @@ package fan
 import (
 	"fmt"
 	"testing"
+	"time"
 )
 
 // Note: tinygo test ./fan
@@ -17,6 +18,23 @@ func (m *singleMockPulseCounter) ReadAndReset() uint32 {
 	return m.mockCount
 }
 
+// テスト用の進められるクロック
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
 // CalculateRPM test
 func TestFan_CalculateRPM(t *testing.T) {
 	testCases := []struct {
@@ -42,7 +60,12 @@ func TestFan_CalculateRPM(t *testing.T) {
 		{
 			name:        "奇数パルス：1秒121パルス",
 			pulseCount:  121,
-			expectedRPM: 3600, // (121 / 2) * 60 = 60 * 60
+			expectedRPM: 3630, // (121 / 2) * 60 = 60.5 * 60
+		},
+		{
+			name:        "1パルス：1秒1パルス",
+			pulseCount:  1,
+			expectedRPM: 30, // (1 / 2) * 60
 		},
 	}
 
@@ -63,6 +86,151 @@ func TestFan_CalculateRPM(t *testing.T) {
 	}
 }
 
+// CalculateRPM test with measured windows
+func TestFan_CalculateRPM_MeasuredWindow(t *testing.T) {
+	testCases := []struct {
+		name        string
+		pulseCount  uint32        // 2回目の呼び出しでmockに仕込むパルス値
+		elapsed     time.Duration // 1回目と2回目の間の経過時間
+		expectedRPM uint32
+	}{
+		{
+			name:        "500ms間隔：60パルス",
+			pulseCount:  60,
+			elapsed:     500 * time.Millisecond,
+			expectedRPM: 3600, // (60 / 2) * 120
+		},
+		{
+			name:        "遅れたtick：1.2秒で144パルス",
+			pulseCount:  144,
+			elapsed:     1200 * time.Millisecond,
+			expectedRPM: 3600, // (144 / 2) / 1.2 * 60
+		},
+		{
+			name:        "丸め：250ms間隔で3パルス",
+			pulseCount:  3,
+			elapsed:     250 * time.Millisecond,
+			expectedRPM: 360, // (3 / 2) * 240
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := newFakeClock()
+			mockCounter := &singleMockPulseCounter{}
+			testFan := NewFan("Test Fan", mockCounter)
+			testFan.SetClock(clock)
+
+			// 1回目はDefaultWindowを仮定する
+			testFan.CalculateRPM()
+
+			clock.Advance(tc.elapsed)
+			mockCounter.mockCount = tc.pulseCount
+			rpm := testFan.CalculateRPM()
+
+			if rpm != tc.expectedRPM {
+				t.Errorf("期待するRPMは %d 、実際は %d で異なる", tc.expectedRPM, rpm)
+			}
+		})
+	}
+}
+
+// 時間が進んでいなければパルスを読まずに前回値を返す
+func TestFan_CalculateRPM_NoElapsedTime(t *testing.T) {
+	clock := newFakeClock()
+	mockCounter := &singleMockPulseCounter{mockCount: 120}
+	testFan := NewFan("Test Fan", mockCounter)
+	testFan.SetClock(clock)
+
+	first := testFan.CalculateRPM()
+	mockCounter.mockCount = 0
+	second := testFan.CalculateRPM()
+
+	if first != 3600 || second != first {
+		t.Errorf("期待するRPMは 3600, 3600 、実際は %d, %d で異なる", first, second)
+	}
+}
+
+// CalculateRPM test with various pulses per revolution
+func TestFan_CalculateRPM_Profile(t *testing.T) {
+	testCases := []struct {
+		name        string
+		ppr         uint32
+		pulseCount  uint32
+		expectedRPM uint32
+	}{
+		{name: "1パルス/回転", ppr: 1, pulseCount: 60, expectedRPM: 3600},
+		{name: "2パルス/回転", ppr: 2, pulseCount: 60, expectedRPM: 1800},
+		{name: "3パルス/回転", ppr: 3, pulseCount: 60, expectedRPM: 1200},
+		{name: "4パルス/回転", ppr: 4, pulseCount: 60, expectedRPM: 900},
+		{name: "3パルス/回転の端数", ppr: 3, pulseCount: 100, expectedRPM: 2000},
+		{name: "0はデフォルトの2パルス/回転", ppr: 0, pulseCount: 60, expectedRPM: 1800},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCounter := &singleMockPulseCounter{mockCount: tc.pulseCount}
+			testFan := NewFanWithProfile("Test Fan", mockCounter, Profile{PulsesPerRevolution: tc.ppr})
+
+			rpm := testFan.CalculateRPM()
+
+			if rpm != tc.expectedRPM {
+				t.Errorf("期待するRPMは %d 、実際は %d で異なる", tc.expectedRPM, rpm)
+			}
+		})
+	}
+}
+
+// SetProfile test
+func TestFan_SetProfile(t *testing.T) {
+	mockCounter := &singleMockPulseCounter{mockCount: 120}
+	testFan := NewFan("Test Fan", mockCounter)
+
+	if ppr := testFan.Profile().PulsesPerRevolution; ppr != 2 {
+		t.Fatalf("期待するデフォルトPPRは 2 、実際は %d で異なる", ppr)
+	}
+
+	testFan.SetProfile(Profile{PulsesPerRevolution: 4, MaxRPM: 3000})
+	rpm := testFan.CalculateRPMOver(time.Second)
+	if rpm != 1800 {
+		t.Errorf("期待するRPMは %d 、実際は %d で異なる", 1800, rpm)
+	}
+	if max := testFan.Profile().MaxRPM; max != 3000 {
+		t.Errorf("期待するMaxRPMは %d 、実際は %d で異なる", 3000, max)
+	}
+}
+
+// CalculateRPMOver test
+func TestFan_CalculateRPMOver(t *testing.T) {
+	mockCounter := &singleMockPulseCounter{mockCount: 25}
+	testFan := NewFan("Test Fan", mockCounter)
+
+	rpm := testFan.CalculateRPMOver(250 * time.Millisecond)
+	if rpm != 3000 { // (25 / 2) * 240
+		t.Errorf("期待するRPMは %d 、実際は %d で異なる", 3000, rpm)
+	}
+
+	mockCounter.mockCount = 7
+	rpm = testFan.CalculateRPMOver(2 * time.Second)
+	if rpm != 105 { // (7 / 2) * 30
+		t.Errorf("期待するRPMは %d 、実際は %d で異なる", 105, rpm)
+	}
+	if frac := testFan.FractionalRPM(); frac != 105 {
+		t.Errorf("期待する小数RPMは %v 、実際は %v で異なる", 105.0, frac)
+	}
+
+	mockCounter.mockCount = 1
+	testFan.CalculateRPMOver(3 * time.Second) // (1 / 2) * 20 = 10
+	mockCounter.mockCount = 1
+	rpm = testFan.CalculateRPMOver(7 * time.Second) // (1 / 2) * 60 / 7 = 4.2857...
+	if rpm != 4 {
+		t.Errorf("期待するRPMは %d 、実際は %d で異なる", 4, rpm)
+	}
+	if frac := testFan.FractionalRPM(); frac < 4.285 || frac > 4.287 {
+		t.Errorf("期待する小数RPMは約 %v 、実際は %v で異なる", 4.286, frac)
+	}
+}
+
 // ExampleFan_CalculateRPM shows how to use the Fan type to calculate RPM.
 //
 // ExampleFan_CalculateRPMは、Fan型を使ってRPMを計算する方法を示す。
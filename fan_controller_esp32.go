@@ -4,26 +4,25 @@ package main
 
 import (
 	"machine"
-	"sync/atomic"
 	"time"
 
+	"github.com/kou-tkbys/tk-fancon2/app"
 	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/ht16k33"
+	"github.com/kou-tkbys/tk-fancon2/settings"
 )
 
 // esp32TachoCounter is an ESP32-specific implementation for counting pulses.
+// It records the time of each edge into a ring buffer.
 //
 // esp32TachoCounterは、ESP32専用のパルスカウント実装じゃ。
+// 各エッジの時刻をリングバッファに記録するぞ。
 type esp32TachoCounter struct {
-	pulseCount atomic.Uint32
-}
-
-// ReadAndReset reads the current pulse count and resets it to zero atomically.
-func (p *esp32TachoCounter) ReadAndReset() uint32 {
-	return p.pulseCount.Swap(0)
+	fan.EdgeBuffer
 }
 
 // newESP32TachoCounter creates a new pulse counter for a given pin.
-func newESP32TachoCounter(pin machine.Pin) fan.PulseCounter {
+func newESP32TachoCounter(pin machine.Pin) fan.EdgeCounter {
 	p := &esp32TachoCounter{}
 	pin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
 
@@ -34,7 +33,7 @@ func newESP32TachoCounter(pin machine.Pin) fan.PulseCounter {
 		for {
 			currentState := pin.Get()
 			if lastState && !currentState { // Falling edge (High -> Low)
-				p.pulseCount.Add(1)
+				p.Record(uint32(time.Now().UnixMicro()))
 			}
 			lastState = currentState
 			// Check every 100 microseconds (10kHz sampling is enough for fans)
@@ -45,53 +44,70 @@ func newESP32TachoCounter(pin machine.Pin) fan.PulseCounter {
 	return p
 }
 
-// ESPFanController manages the dual contra-rotating fan on ESP32.
+// fullScalePot stands in for the potentiometer, which is not wired on
+// ESP32 yet. It always reads full scale, i.e. full speed.
+type fullScalePot struct{}
+
+// Get returns the full-scale reading.
+func (fullScalePot) Get() uint16 {
+	return 0xFFFF
+}
+
+// ESPFanController drives the dual contra-rotating fan on ESP32. It
+// implements app.DutyOutput.
 //
-// ESPFanControllerは、ESP32上で二重反転ファンを管理するのじゃ。
+// ESPFanControllerは、ESP32上で二重反転ファンを駆動するのじゃ。
+// app.DutyOutputを実装するぞ。
 type ESPFanController struct {
-	Fans *fan.DualFan
 	pinF machine.Pin
 	pinR machine.Pin
 }
 
-// NewFanController creates and configures a new fan controller for ESP32.
+// NewFanHardware creates and configures the fan hardware for ESP32.
 //
-// NewFanControllerは、ESP32用のファンコントローラーを作成して設定するぞ。
-func NewFanController() (*ESPFanController, error) {
+// NewFanHardwareは、ESP32用のファンのハードウェアを作成して設定するぞ。
+func NewFanHardware() (app.FanHardware, error) {
 	pinF := machine.GPIO18
 	pinR := machine.GPIO19
 	pinF.Configure(machine.PinConfig{Mode: machine.PinOutput})
 	pinR.Configure(machine.PinConfig{Mode: machine.PinOutput})
 
 	// Set up counters (Using GPIO16 and GPIO17 for tacho)
-	counterF := newESP32TachoCounter(machine.GPIO16)
-	counterR := newESP32TachoCounter(machine.GPIO17)
-
-	fans := fan.NewDualFan("Typhoon-ESP", counterF, counterR)
-
-	return &ESPFanController{
-		Fans: fans,
-		pinF: pinF,
-		pinR: pinR,
+	return app.FanHardware{
+		Name:   "Typhoon-ESP",
+		Output: &ESPFanController{pinF: pinF, pinR: pinR},
+		Pot:    fullScalePot{},
+		Front:  newESP32TachoCounter(machine.GPIO16),
+		Rear:   newESP32TachoCounter(machine.GPIO17),
 	}, nil
 }
 
-// UpdatePWM reads the value from the potentiometer and updates the PWM duty cycle.
-func (fc *ESPFanController) UpdatePWM() {
-	fc.pinF.High()
-	fc.pinR.High()
-}
-
-// GetRPMs returns the calculated RPM values for both fans.
-func (fc *ESPFanController) GetRPMs() (uint32, uint32) {
-	return fc.Fans.CalculateRPMs()
+// SetDuty drives the front and rear fan pins. TinyGo has no PWM on ESP32
+// yet, so any non-zero duty drives the pin high (full speed) and zero
+// drives it low.
+//
+// SetDutyは、前側と後ろ側のファンのピンを駆動するぞ。TinyGoのESP32には
+// まだPWMが無いので、0以外のデューティならHigh(全速)、0ならLowにするのじゃ。
+func (fc *ESPFanController) SetDuty(front, rear uint32) {
+	fc.pinF.Set(front > 0)
+	fc.pinR.Set(rear > 0)
 }
 
-// SetupI2C configures the I2C bus for ESP32.
-func SetupI2C() *machine.I2C {
-	machine.I2C0.Configure(machine.I2CConfig{
+// SetupI2C configures the I2C bus for ESP32. The bus can clear itself
+// through its pins.
+func SetupI2C() (ht16k33.I2CBus, error) {
+	bus, err := newI2CBus(machine.I2C0, machine.I2CConfig{
 		SDA: machine.GPIO21,
 		SCL: machine.GPIO22,
 	})
-	return machine.I2C0
+	return bus, err
+}
+
+// NewSettingsStorage returns a settings log in RAM. TinyGo has no flash
+// access on the ESP32 yet, so settings are lost at power off.
+//
+// NewSettingsStorageは、RAM上の設定のログを返す。TinyGoのESP32ではまだフ
+// ラッシュにアクセスできないので、設定は電源を切ると消えるのじゃ。
+func NewSettingsStorage() settings.Storage {
+	return settings.NewLogStore(settings.NewMemFlash(2*4096, 4, 4096), 2)
 }
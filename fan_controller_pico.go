@@ -4,28 +4,23 @@ package main
 
 import (
 	"machine"
-	"sync/atomic"
+	"time"
 
+	"github.com/kou-tkbys/tk-fancon2/app"
 	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/ht16k33"
+	"github.com/kou-tkbys/tk-fancon2/settings"
 )
 
 // picoTachoCounter is a Pico-specific implementation for counting pulses.
-// It uses atomic operations to safely increment the count from an
-// interrupt.
+// It records the time of each edge from an interrupt into a ring buffer,
+// so the fan can switch to period mode at low speed.
 //
 // picoTachoCounterは、Pico専用のパルスカウント実装。
-// 割り込みから安全にカウントを増やすために、アトミック操作を使う。
+// 割り込みから各エッジの時刻をリングバッファに記録する。これで低速域では
+// ファン側が周期モードに切り替えられる。
 type picoTachoCounter struct {
-	pulseCount atomic.Uint32
-}
-
-// ReadAndReset reads the current pulse count and resets it to zero
-// atomically.
-//
-// ReadAndResetは、現在のパルス数を読み取って、アトミックにゼロにリセット
-// する。
-func (p *picoTachoCounter) ReadAndReset() uint32 {
-	return p.pulseCount.Swap(0)
+	fan.EdgeBuffer
 }
 
 // newPicoTachoCounter creates a new pulse counter for a given pin.
@@ -35,31 +30,34 @@ func (p *picoTachoCounter) ReadAndReset() uint32 {
 // newPicoTachoCounterは、指定されたピンのための新しいパルスカウンターを作
 // る。ピンをプルアップ付きの入力として設定し、立ち下がりエッジの割り込み
 // を設定する。
-func newPicoTachoCounter(pin machine.Pin) fan.PulseCounter {
+func newPicoTachoCounter(pin machine.Pin) fan.EdgeCounter {
 	p := &picoTachoCounter{}
 	pin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
 	_ = pin.SetInterrupt(machine.PinFalling, func(m machine.Pin) {
-		p.pulseCount.Add(1)
+		p.Record(uint32(time.Now().UnixMicro()))
 	})
 	return p
 }
 
-// PicoFanController manages the dual contra-rotating fan.
+// PicoFanController drives the PWM outputs of the dual contra-rotating
+// fan. It implements app.DutyOutput.
 //
-// PicoFanControllerは、二重反転ファンを管理する。
+// PicoFanControllerは、二重反転ファンのPWM出力を駆動する。
+// app.DutyOutputを実装する。
 type PicoFanController struct {
-	Fans *fan.DualFan
-	adc  machine.ADC
+	// PWM channels of the front and rear fans.
+	// 前側と後ろ側のファンのPWMチャンネル
+	chF, chR uint8
 }
 
-// NewFanController creates and configures a new fan controller.
+// NewFanHardware creates and configures the fan hardware.
 // It sets up the ADC for the potentiometer, configures PWM for a 25kHz
 // frequency, and initializes the pulse counters for both fans.
 //
-// NewFanControllerは、新しいファンコントローラーを作成して設定する。
+// NewFanHardwareは、ファンのハードウェアを作成して設定する。
 // ポテンショメータ用のADCを設定し、25kHzの周波数でPWMを設定し、両方のファ
 // ンのパルスカウンターを初期化する。
-func NewFanController() (*PicoFanController, error) {
+func NewFanHardware() (app.FanHardware, error) {
 	// Initialize the ADC peripheral. This is required on RP2040 to enable the ADC block.
 	// RP2040では、ADCを使う前に必ずこれを呼んで、ADCモジュールの電源を入れる必要があるのじゃ！
 	machine.InitADC()
@@ -73,80 +71,81 @@ func NewFanController() (*PicoFanController, error) {
 	// For 25kHz
 	err := pwm.Configure(machine.PWMConfig{Period: 40000})
 	if err != nil {
-		return nil, err
+		return app.FanHardware{}, err
 	}
 
 	// Configure the pins for PWM output.
 	// これを忘れておった！GPIO2とGPIO3をPWMモードに切り替える必要があるのじゃ。
 	// これを呼ばないと、ピンから信号が出ず、ファンは信号断と判断してフル回転してしまうぞ。
-	_, err = pwm.Channel(machine.GPIO2) // PWM1 Channel A
+	chF, err := pwm.Channel(machine.GPIO2) // PWM1 Channel A
 	if err != nil {
-		return nil, err
+		return app.FanHardware{}, err
 	}
-	_, err = pwm.Channel(machine.GPIO3) // PWM1 Channel B
+	chR, err := pwm.Channel(machine.GPIO3) // PWM1 Channel B
 	if err != nil {
-		return nil, err
+		return app.FanHardware{}, err
 	}
 
 	// Set up counters by passing Pico's pin information.
 	// picoのピン情報を渡しつつカウンタを設定
-	counterF := newPicoTachoCounter(machine.GPIO4)
-	counterR := newPicoTachoCounter(machine.GPIO5)
-
-	fans := fan.NewDualFan("Typhoon", counterF, counterR)
-
-	return &PicoFanController{
-		Fans: fans,
-		adc:  adc,
+	return app.FanHardware{
+		Name:   "Typhoon",
+		Output: &PicoFanController{chF: chF, chR: chR},
+		Pot:    adc,
+		Front:  newPicoTachoCounter(machine.GPIO4),
+		Rear:   newPicoTachoCounter(machine.GPIO5),
 	}, nil
 }
 
-// UpdatePWM reads the value from the potentiometer and updates the PWM
-// duty cycle.
+// SetDuty writes the front and rear duties (0-fan.MaxDuty) to their PWM
+// channels. Values above fan.MaxDuty are clamped.
 //
-// UpdatePWMは、ポテンショメータから値を読み取り、PWMのデューティサイクル
-// を更新する。
-func (fc *PicoFanController) UpdatePWM() {
+// SetDutyは、前側と後ろ側のデューティ(0-fan.MaxDuty)をそれぞれのPWMチャン
+// ネルに書き込む。fan.MaxDutyを超える値は制限する。
+func (fc *PicoFanController) SetDuty(front, rear uint32) {
 	// Since PWM is only handled within this method, a local variable is
 	// sufficient.
 	//
 	// PWMはこのメソッド内でしか扱わないので、ローカル変数で十分。
 	pwm := machine.PWM1
 
-	potValue := fc.adc.Get()
-
-	// Software deadzone: if value is low enough, treat as zero.
-	// ソフトウェアデッドゾーン：値が十分に低ければ、ゼロとして扱うのじゃ。
-	if potValue < 2000 { // ~3% of 65535
-		potValue = 0
+	if front > fan.MaxDuty {
+		front = fan.MaxDuty
+	}
+	if rear > fan.MaxDuty {
+		rear = fan.MaxDuty
 	}
 
-	// Scaling: ADC (0-65535) -> PWM Period (0-40000)
-	// Use a squared curve for finer control at low speeds.
-	// リニアだと急激すぎるから、2乗カーブを使って低速域をマイルドにするのじゃ！
-	// Formula: (potValue^2 * 40000) / 65535^2
-	// uint64を使わないと計算途中で桁あふれするから注意じゃよ。
-	duty := uint32((uint64(potValue) * uint64(potValue) * 40000) / (65535 * 65535))
-	println("Duty:", duty)
-
-	pwm.Set(0, duty)
-	pwm.Set(1, duty)
-}
-
-// GetRPMs returns the calculated RPM values for both fans.
-//
-// GetRPMsは、計算された両方のファンのRPM値を返す。
-func (fc *PicoFanController) GetRPMs() (uint32, uint32) {
-	return fc.Fans.CalculateRPMs()
+	pwm.Set(fc.chF, front)
+	pwm.Set(fc.chR, rear)
 }
 
-// SetupI2C configures the I2C bus for Pico.
+// SetupI2C configures the I2C bus for Pico. The bus can clear itself
+// through its pins.
 //
-// SetupI2Cは、Pico用のI2Cバスを設定する。
-func SetupI2C() *machine.I2C {
-	machine.I2C0.Configure(machine.I2CConfig{
+// SetupI2Cは、Pico用のI2Cバスを設定する。バスは自分のピンでバスクリアで
+// きる。
+func SetupI2C() (ht16k33.I2CBus, error) {
+	bus, err := newI2CBus(machine.I2C0, machine.I2CConfig{
 		SDA: machine.GPIO0, // GP0 (I2C0 SDA)
 		SCL: machine.GPIO1, // GP1 (I2C0 SCL)
 	})
-	return machine.I2C0
+	return bus, err
+}
+
+// settingsSectors is the number of 4KB flash sectors the settings log
+// rotates through.
+//
+// settingsSectorsは、設定のログが順に使う4KBのフラッシュセクターの数。
+const settingsSectors = 4
+
+// NewSettingsStorage returns the settings log on the flash area after the
+// program image. Rotating through several sectors spreads the erases, as
+// each sector only survives about 100k of them.
+//
+// NewSettingsStorageは、プログラムの後ろのフラッシュ領域に置いた設定のロ
+// グを返す。各セクターは10万回程度しか消去に耐えないので、複数のセクター
+// を順に使って消去を分散する。
+func NewSettingsStorage() settings.Storage {
+	return settings.NewLogStore(machine.Flash, settingsSectors)
 }
@@ -42,7 +42,7 @@ package ht16k33
 const (
 	// Commands for HT16K33
 	ht16k33TurnOnOscillator = 0x21
-	ht16k33TurnOnDisplay    = 0x81
+	ht16k33DisplaySetup     = 0x80 // | blink<<1 | on
 	ht16k33SetBrightness    = 0xE0
 
 	// MaxDigitsPerDisplay is the number of 7-segment digits per display unit.
@@ -84,29 +84,78 @@ type Device struct {
 	// Display RAM buffer for the HT16K33 (16x8 bits).
 	// HT16K33の表示用RAMバッファ(16x8ビット)
 	buffer [16]byte
+	// Glyphs defined with DefineGlyph, and the segments drawn for
+	// characters without a glyph.
+	// DefineGlyphで定義したグリフと、グリフの無い文字に描くセグメント
+	custom    [maxCustomGlyphs]customGlyph
+	numCustom uint8
+	fallback  byte
+	// Display setup and brightness, kept so that each command can be sent
+	// again without changing the others.
+	// 表示設定と明るさ。他を変えずに各コマンドを送り直せるように保持する。
+	on         bool
+	blink      BlinkRate
+	brightness uint8
 }
 
+// BlinkRate is the rate at which the HT16K33 blinks the whole display by
+// itself.
+//
+// BlinkRateは、HT16K33が自分でディスプレイ全体を点滅させる速さ。
+type BlinkRate uint8
+
+const (
+	BlinkOff    BlinkRate = iota
+	Blink2Hz              // 0.5 s period / 周期0.5秒
+	Blink1Hz              // 1 s period / 周期1秒
+	BlinkHalfHz           // 2 s period / 周期2秒
+)
+
 // New creates a new Device instance.
 //
 // Newは、新しいDeviceインスタンスを作る
 func New(bus I2CBus, address uint8) Device {
 	return Device{
-		bus:     bus,
-		Address: address,
+		bus:        bus,
+		Address:    address,
+		fallback:   Fallback,
+		on:         true,
+		brightness: 15,
 	}
 }
 
 // Configure initializes the HT16K33 device.
-// It turns on the oscillator and the display, and sets the brightness to
-// maximum.
+// It turns on the oscillator, then sends the display setup and the
+// brightness: display on, no blink and maximum brightness for a new
+// Device, or the settings made since, so that Configure can also restore
+// a chip that lost power. It stops at the first command that fails and
+// returns an *Error.
 //
 // Configureは、HT16K33デバイスを初期化する
-// オシレーターとディスプレイをオンにし、明るさを最大に設定する。
-func (d *Device) Configure() {
-	d.bus.Tx(uint16(d.Address), []byte{ht16k33TurnOnOscillator}, nil)
-	d.bus.Tx(uint16(d.Address), []byte{ht16k33TurnOnDisplay}, nil)
-	// Set to maximum brightness for now
-	d.SetBrightness(15)
+// オシレーターをオンにし、表示設定と明るさを送る。新しいDeviceなら表示オ
+// ン、点滅なし、明るさ最大。その後に設定していればその値を送るので、電源
+// が切れたチップを元に戻すのにも使える。最初に失敗したコマンドで止まり、
+// *Errorを返す。
+func (d *Device) Configure() error {
+	if err := d.tx("oscillator on", []byte{ht16k33TurnOnOscillator}, nil); err != nil {
+		return err
+	}
+	if err := d.sendDisplaySetup(); err != nil {
+		return err
+	}
+	return d.SetBrightness(d.brightness)
+}
+
+// Ping checks that a device ACKs at d.Address, by pointing at the start
+// of the display RAM and reading one byte back. Nothing on the display
+// changes. It returns an *Error when the device does not answer.
+//
+// Pingは、表示RAMの先頭を指して1バイト読み返すことで、d.Addressでデバイス
+// がACKを返すか確かめる。表示は何も変わらない。デバイスが応答しなければ
+// *Errorを返す。
+func (d *Device) Ping() error {
+	var r [1]byte
+	return d.tx("ping", []byte{0x00}, r[:])
 }
 
 // ClearAll clears the entire display buffer, turning off all segments on
@@ -140,27 +189,36 @@ func (d *Device) SetDigit(display int, position int, num byte, dot bool) {
 	} else {
 		pattern = font[blankPatternIndex]
 	}
+	if dot {
+		pattern |= SegDP
+	}
+	d.SetSegments(display, position, pattern)
+}
+
+// SetSegments lights the given segments (SegA | ... | SegDP) of a single
+// digit and turns the others off.
+//
+// SetSegmentsは、1桁の指定したセグメント(SegA | ... | SegDP)を点け、それ
+// 以外を消す。
+//
+// display: 0 for the first display (A), 1 for the second (B).
+// position: 0-7, the digit position.
+func (d *Device) SetSegments(display int, position int, segments byte) {
+	if display < 0 || display >= NumDisplays || position < 0 || position >= MaxDigitsPerDisplay {
+		return
+	}
 
 	rowOffset := display * MaxDigitsPerDisplay // 0 for display A, 8 for display B
 	mask := ^byte(1 << position)               // Mask to clear the bit for the current position
 
-	// Clear the bits for this digit position first
-	for i := 0; i < MaxDigitsPerDisplay; i++ { // 7 segments + 1 dot
-		d.buffer[rowOffset+i] &= mask
-	}
-
-	// Set the new segment bits (a-g -> ROW0-6 for display 0, ROW8-14 for display 1)
-	for seg := 0; seg < 7; seg++ {
-		if (pattern>>seg)&1 == 1 {
+	// Clear the bits for this digit position first, then set the new
+	// ones (a-g, dp -> ROW0-7 for display 0, ROW8-15 for display 1)
+	for seg := 0; seg < 8; seg++ { // 7 segments + 1 dot
+		d.buffer[rowOffset+seg] &= mask
+		if (segments>>seg)&1 == 1 {
 			d.buffer[rowOffset+seg] |= (1 << position)
 		}
 	}
-
-	// Set the new dot bit (dp -> ROW7 for display 0, ROW15 for display 1)
-	if dot {
-		dotRow := rowOffset + 7
-		d.buffer[dotRow] |= (1 << position)
-	}
 }
 
 // ClearDisplay clears one of the two 8-digit displays.
@@ -182,7 +240,17 @@ func (d *Device) ClearDisplay(display int) {
 // WriteStringは、2つのディスプレイのいずれかに文字列を表示する。
 //
 // display: 0 for the first display (A), 1 for the second (B).
-// s: The string to display. Handles numbers and dots (e.g., "123", "45.6", "78.").
+// s: The string to display (e.g., "123", "45.6", "Err", "oFF", "21.5°C").
+// Each character takes one digit, drawn with its glyph (see Glyph and
+// DefineGlyph) or the fallback (see SetFallback). A dot lights the point
+// of the digit before it, or takes a blank digit of its own when that
+// digit has its point lit already. Characters past the eighth digit are
+// dropped.
+//
+// 各文字は1桁を使い、そのグリフ(GlyphとDefineGlyphを参照)か、代替
+// (SetFallbackを参照)で描く。ドットは前の桁の小数点を点ける。前の桁の小
+// 数点が既に点いていれば、自分で空白の桁を1つ使う。8桁目より後ろの文字は
+// 捨てる。
 func (d *Device) WriteString(display int, s string) {
 	if display < 0 || display >= NumDisplays {
 		return
@@ -190,40 +258,110 @@ func (d *Device) WriteString(display int, s string) {
 
 	d.ClearDisplay(display)
 
+	rowOffset := display * MaxDigitsPerDisplay
 	digitPos := 0
-	runes := []rune(s) // runeのスライスに変換して、マルチバイト文字にも対応する
-	for i := 0; i < len(runes) && digitPos < MaxDigitsPerDisplay; i++ {
-		char := runes[i]
-		if char >= '0' && char <= '9' {
-			num := byte(char - '0')
-			dot := false
-			// Look ahead for a dot
-			if i+1 < len(runes) && runes[i+1] == '.' {
-				dot = true
-				i++ // ドットを処理したので、次の文字はスキップ
-			}
-
-			d.SetDigit(display, digitPos, num, dot)
-			digitPos++
+	// Whether the point of the previous digit is lit
+	// 前の桁の小数点が点いているかどうか
+	dotted := false
+	for _, char := range s { // rangeでrune単位に読むので、マルチバイト文字にも対応する
+		if char == '.' && digitPos > 0 && !dotted {
+			d.buffer[rowOffset+7] |= 1 << (digitPos - 1)
+			dotted = true
+			continue
+		}
+		if digitPos == MaxDigitsPerDisplay {
+			break
 		}
-		// 数字でもドットでもない文字は、ここでは単純に無視
+		pattern := SegDP
+		if char != '.' {
+			pattern = d.glyph(char)
+		}
+		d.SetSegments(display, digitPos, pattern)
+		dotted = pattern&SegDP != 0
+		digitPos++
 	}
 }
 
-// Display transfers the buffer's content to the LED driver.
+// Display transfers the buffer's content to the LED driver. The buffer
+// is kept when the transfer fails, so the next call sends it again.
 //
-// Displayは、バッファの内容をLEDドライバに転送する。
-func (d *Device) Display() {
+// Displayは、バッファの内容をLEDドライバに転送する。転送に失敗してもバッ
+// ファはそのままなので、次の呼び出しで送り直す。
+func (d *Device) Display() error {
 	data := append([]byte{0x00}, d.buffer[:]...)
-	d.bus.Tx(uint16(d.Address), data, nil)
+	return d.tx("display RAM", data, nil)
 }
 
-// SetBrightness sets the display brightness (0-15).
+// SetBrightness sets the display brightness (0-15). The brightness is kept
+// even if sending it fails, so the next Configure sends it.
 //
-// SetBrightnessは、ディスプレイの明るさを設定する(0-15)。
-func (d *Device) SetBrightness(brightness uint8) {
+// SetBrightnessは、ディスプレイの明るさを設定する(0-15)。送信に失敗しても
+// 明るさは保持するので、次のConfigureで送られる。
+func (d *Device) SetBrightness(brightness uint8) error {
 	if brightness > 15 {
 		brightness = 15
 	}
-	d.bus.Tx(uint16(d.Address), []byte{ht16k33SetBrightness | brightness}, nil)
+	d.brightness = brightness
+	return d.tx("brightness", []byte{ht16k33SetBrightness | brightness}, nil)
+}
+
+// Brightness returns the brightness last set (0-15).
+//
+// Brightnessは、最後に設定した明るさを返す(0-15)。
+func (d *Device) Brightness() uint8 {
+	return d.brightness
+}
+
+// SetBlink makes the HT16K33 blink the whole display at rate, with no
+// further work from the CPU. BlinkOff stops it. The display RAM and the
+// on/off state are kept. Like the brightness, the rate is kept even if
+// sending it fails.
+//
+// SetBlinkは、HT16K33にディスプレイ全体をrateで点滅させる。CPUはそれ以上
+// 何もしなくてよい。BlinkOffで止まる。表示RAMとオン/オフの状態は保たれる。
+// 明るさと同じく、送信に失敗しても速さは保持する。
+func (d *Device) SetBlink(rate BlinkRate) error {
+	if rate > BlinkHalfHz {
+		rate = BlinkOff
+	}
+	d.blink = rate
+	return d.sendDisplaySetup()
+}
+
+// Blink returns the blink rate last set.
+//
+// Blinkは、最後に設定した点滅の速さを返す。
+func (d *Device) Blink() BlinkRate {
+	return d.blink
+}
+
+// SetDisplayOn turns both displays on or off. The display RAM, the blink
+// rate and the brightness are kept, so turning the display on again shows
+// the same as before.
+//
+// SetDisplayOnは、両方のディスプレイをオンまたはオフにする。表示RAM、点滅
+// の速さ、明るさは保たれるので、再びオンにすれば前と同じ表示になる。
+func (d *Device) SetDisplayOn(on bool) error {
+	d.on = on
+	return d.sendDisplaySetup()
+}
+
+// DisplayOn reports whether the displays are on.
+//
+// DisplayOnは、ディスプレイがオンかどうかを返す。
+func (d *Device) DisplayOn() bool {
+	return d.on
+}
+
+// sendDisplaySetup sends the display setup command for the current on/off
+// state and blink rate.
+//
+// sendDisplaySetupは、現在のオン/オフの状態と点滅の速さで表示設定コマンド
+// を送る。
+func (d *Device) sendDisplaySetup() error {
+	cmd := byte(ht16k33DisplaySetup) | byte(d.blink)<<1
+	if d.on {
+		cmd |= 1
+	}
+	return d.tx("display setup", []byte{cmd}, nil)
 }
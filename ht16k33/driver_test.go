@@ -4,6 +4,7 @@ package ht16k33
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"testing"
 )
@@ -12,16 +13,47 @@ import (
 type mockI2C struct {
 	addr uint16
 	data []byte
+	// Every write so far, oldest first
+	writes [][]byte
+	// If set, fail decides whether a transaction fails; failed writes are
+	// not recorded.
+	fail func(w []byte) error
 }
 
 // Tx fakes the I2C transaction, recording the data that was supposed to be sent.
 func (m *mockI2C) Tx(addr uint16, w, r []byte) error {
+	if m.fail != nil {
+		if err := m.fail(w); err != nil {
+			return err
+		}
+	}
 	m.addr = addr
 	m.data = make([]byte, len(w))
 	copy(m.data, w)
+	m.writes = append(m.writes, m.data)
 	return nil
 }
 
+// errNack stands in for the error of an I2C transaction that no device
+// acknowledged.
+var errNack = errors.New("i2c: nack")
+
+// failOn returns a fail function for mockI2C that fails every write
+// starting with cmd.
+func failOn(cmd byte) func(w []byte) error {
+	return func(w []byte) error {
+		if w[0] == cmd {
+			return errNack
+		}
+		return nil
+	}
+}
+
+// failAlways is a fail function for mockI2C with nothing on the bus.
+func failAlways(w []byte) error {
+	return errNack
+}
+
 // TestSetDigit verifies that setting a single digit correctly modifies the buffer.
 func TestSetDigit(t *testing.T) {
 	testCases := []struct {
@@ -151,6 +183,246 @@ func TestClearDisplay(t *testing.T) {
 	}
 }
 
+// TestDisplaySetup verifies that Configure, SetBrightness, SetBlink and
+// SetDisplayOn send their commands without undoing each other's settings.
+func TestDisplaySetup(t *testing.T) {
+	testCases := []struct {
+		name     string
+		setup    func(d *Device)
+		expected []byte
+	}{
+		{name: "Configure", setup: func(d *Device) { d.Configure() }, expected: []byte{0x21, 0x81, 0xEF}},
+		{name: "Blink 2 Hz", setup: func(d *Device) { d.SetBlink(Blink2Hz) }, expected: []byte{0x83}},
+		{name: "Blink 1 Hz", setup: func(d *Device) { d.SetBlink(Blink1Hz) }, expected: []byte{0x85}},
+		{name: "Blink 0.5 Hz", setup: func(d *Device) { d.SetBlink(BlinkHalfHz) }, expected: []byte{0x87}},
+		{name: "Unknown rate stops blinking", setup: func(d *Device) { d.SetBlink(Blink1Hz); d.SetBlink(4) }, expected: []byte{0x85, 0x81}},
+		{name: "Off keeps the blink", setup: func(d *Device) { d.SetBlink(Blink1Hz); d.SetDisplayOn(false); d.SetDisplayOn(true) }, expected: []byte{0x85, 0x84, 0x85}},
+		{name: "Brightness keeps the blink", setup: func(d *Device) { d.SetBlink(Blink2Hz); d.SetBrightness(3) }, expected: []byte{0x83, 0xE3}},
+		{name: "Configure restores the settings", setup: func(d *Device) {
+			d.SetBlink(BlinkHalfHz)
+			d.SetDisplayOn(false)
+			d.SetBrightness(20)
+			d.Configure()
+		}, expected: []byte{0x87, 0x86, 0xEF, 0x21, 0x86, 0xEF}},
+		{name: "Dim configure", setup: func(d *Device) { d.SetBrightness(0); d.Configure() }, expected: []byte{0xE0, 0x21, 0x81, 0xE0}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockBus := &mockI2C{}
+			device := New(mockBus, 0x70)
+			tc.setup(&device)
+
+			var got []byte
+			for _, w := range mockBus.writes {
+				if len(w) != 1 {
+					t.Fatalf("FAIL: Expected single-byte commands, got %x", w)
+				}
+				got = append(got, w[0])
+			}
+			if !bytes.Equal(got, tc.expected) {
+				t.Errorf("FAIL: Commands are wrong!\nExpected: %x\nGot:      %x", tc.expected, got)
+			}
+			if mockBus.addr != 0x70 {
+				t.Errorf("FAIL: Sent to address %#x", mockBus.addr)
+			}
+		})
+	}
+}
+
+// TestBusErrors verifies that every method that talks to the device
+// returns the bus error wrapped with the address and the failed command.
+func TestBusErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fail     func(w []byte) error
+		call     func(d *Device) error
+		op       string
+		command  byte
+		message  string
+		expected []byte // Commands sent before the failure
+	}{
+		{
+			name:     "Configure, no device",
+			fail:     failAlways,
+			call:     (*Device).Configure,
+			op:       "oscillator on",
+			command:  0x21,
+			message:  "ht16k33 at 0x70: oscillator on (0x21): i2c: nack",
+			expected: nil,
+		},
+		{
+			name:     "Configure stops at the display setup",
+			fail:     failOn(0x81),
+			call:     (*Device).Configure,
+			op:       "display setup",
+			command:  0x81,
+			message:  "ht16k33 at 0x70: display setup (0x81): i2c: nack",
+			expected: []byte{0x21},
+		},
+		{
+			name:     "Configure, brightness",
+			fail:     failOn(0xEF),
+			call:     (*Device).Configure,
+			op:       "brightness",
+			command:  0xEF,
+			message:  "ht16k33 at 0x70: brightness (0xEF): i2c: nack",
+			expected: []byte{0x21, 0x81},
+		},
+		{
+			name:    "Display",
+			fail:    failAlways,
+			call:    (*Device).Display,
+			op:      "display RAM",
+			command: 0x00,
+			message: "ht16k33 at 0x70: display RAM (0x00): i2c: nack",
+		},
+		{
+			name:    "SetBrightness",
+			fail:    failAlways,
+			call:    func(d *Device) error { return d.SetBrightness(4) },
+			op:      "brightness",
+			command: 0xE4,
+			message: "ht16k33 at 0x70: brightness (0xE4): i2c: nack",
+		},
+		{
+			name:    "SetBlink",
+			fail:    failAlways,
+			call:    func(d *Device) error { return d.SetBlink(Blink1Hz) },
+			op:      "display setup",
+			command: 0x85,
+			message: "ht16k33 at 0x70: display setup (0x85): i2c: nack",
+		},
+		{
+			name:    "SetDisplayOn",
+			fail:    failAlways,
+			call:    func(d *Device) error { return d.SetDisplayOn(false) },
+			op:      "display setup",
+			command: 0x80,
+			message: "ht16k33 at 0x70: display setup (0x80): i2c: nack",
+		},
+		{
+			name:    "Ping",
+			fail:    failAlways,
+			call:    (*Device).Ping,
+			op:      "ping",
+			command: 0x00,
+			message: "ht16k33 at 0x70: ping (0x00): i2c: nack",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockBus := &mockI2C{fail: tc.fail}
+			device := New(mockBus, 0x70)
+
+			err := tc.call(&device)
+			if !errors.Is(err, errNack) {
+				t.Fatalf("FAIL: Expected the bus error, got %v", err)
+			}
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("FAIL: Expected an *Error, got %T", err)
+			}
+			if e.Address != 0x70 || e.Op != tc.op || e.Command != tc.command {
+				t.Errorf("FAIL: Error is wrong!\nExpected: 0x70 %q %#x\nGot:      %#x %q %#x", tc.op, tc.command, e.Address, e.Op, e.Command)
+			}
+			if err.Error() != tc.message {
+				t.Errorf("FAIL: Message is wrong!\nExpected: %s\nGot:      %s", tc.message, err)
+			}
+
+			var sent []byte
+			for _, w := range mockBus.writes {
+				sent = append(sent, w[0])
+			}
+			if !bytes.Equal(sent, tc.expected) {
+				t.Errorf("FAIL: Commands before the failure are wrong!\nExpected: %x\nGot:      %x", tc.expected, sent)
+			}
+		})
+	}
+}
+
+// TestBusErrors_KeepState verifies that a failed command keeps its setting
+// and the buffer, so that they are sent again once the bus recovers.
+func TestBusErrors_KeepState(t *testing.T) {
+	mockBus := &mockI2C{fail: failAlways}
+	device := New(mockBus, 0x70)
+	device.WriteString(0, "1")
+	if device.SetBlink(Blink2Hz) == nil || device.SetBrightness(3) == nil || device.Display() == nil {
+		t.Fatal("FAIL: Expected errors with nothing on the bus")
+	}
+
+	mockBus.fail = nil
+	if err := device.Configure(); err != nil {
+		t.Fatalf("FAIL: Configure: %v", err)
+	}
+	if err := device.Display(); err != nil {
+		t.Fatalf("FAIL: Display: %v", err)
+	}
+	expected := [][]byte{{0x21}, {0x83}, {0xE3}, append([]byte{0x00}, device.buffer[:]...)}
+	if len(mockBus.writes) != len(expected) {
+		t.Fatalf("FAIL: Writes are wrong!\nExpected: %x\nGot:      %x", expected, mockBus.writes)
+	}
+	for i := range expected {
+		if !bytes.Equal(mockBus.writes[i], expected[i]) {
+			t.Errorf("FAIL: Writes are wrong!\nExpected: %x\nGot:      %x", expected, mockBus.writes)
+		}
+	}
+	if device.buffer[1] != 1 || device.buffer[2] != 1 {
+		t.Errorf("FAIL: Buffer was lost: %08b", device.buffer)
+	}
+}
+
+// TestPing verifies that Ping reads from the device without writing to
+// the display RAM.
+func TestPing(t *testing.T) {
+	mockBus := &mockI2C{}
+	device := New(mockBus, 0x70)
+	if err := device.Ping(); err != nil {
+		t.Fatalf("FAIL: Ping: %v", err)
+	}
+	if mockBus.addr != 0x70 || !bytes.Equal(mockBus.data, []byte{0x00}) {
+		t.Errorf("FAIL: Ping sent %x to %#x", mockBus.data, mockBus.addr)
+	}
+}
+
+// TestDisplaySetup_State verifies the getters of the tracked state.
+func TestDisplaySetup_State(t *testing.T) {
+	device := New(&mockI2C{}, 0x70)
+	if !device.DisplayOn() || device.Blink() != BlinkOff || device.Brightness() != 15 {
+		t.Errorf("FAIL: New device is on=%v blink=%d brightness=%d", device.DisplayOn(), device.Blink(), device.Brightness())
+	}
+	device.SetDisplayOn(false)
+	device.SetBlink(Blink1Hz)
+	device.SetBrightness(7)
+	if device.DisplayOn() || device.Blink() != Blink1Hz || device.Brightness() != 7 {
+		t.Errorf("FAIL: Device is on=%v blink=%d brightness=%d", device.DisplayOn(), device.Blink(), device.Brightness())
+	}
+}
+
+// ExampleDevice_SetBlink shows how to flash a fault alert without toggling
+// the display from software.
+//
+// ExampleDevice_SetBlinkは、ソフトウェアで表示を切り替えずに異常を点滅で
+// 知らせる方法を示す。
+func ExampleDevice_SetBlink() {
+	display := New(&mockI2C{}, 0x70)
+	display.Configure()
+
+	// The chip blinks by itself until told otherwise.
+	// チップは、止めるまで自分で点滅し続ける。
+	display.WriteString(0, "FAn Err")
+	display.Display()
+	display.SetBlink(Blink2Hz)
+
+	// Once the fault clears, stop blinking.
+	// 異常が解除されたら点滅を止める。
+	display.SetBlink(BlinkOff)
+
+	fmt.Println("Blinked 'FAn Err' on display 0.")
+	// Output: Blinked 'FAn Err' on display 0.
+}
+
 // ExampleDevice_WriteString shows how to use the Device to write strings
 // to both displays.
 //
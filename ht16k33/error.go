@@ -0,0 +1,54 @@
+package ht16k33
+
+// Error is returned by the methods that talk to the HT16K33 when the I2C
+// bus reports a failure, such as a missing ACK from a loose cable. It
+// records the device address and the command that failed; errors.Is and
+// errors.As see the bus error through Unwrap.
+//
+// Errorは、I2Cバスが失敗を報告したとき(ケーブルが緩んでACKが返らないなど)
+// に、HT16K33とやり取りするメソッドが返す。デバイスのアドレスと失敗したコ
+// マンドを記録する。errors.Isとerrors.AsはUnwrapを通してバスのエラーを見る。
+type Error struct {
+	Address uint8
+	// The name of the command, such as "brightness", and its first byte
+	// as sent.
+	// "brightness"などのコマンド名と、送った最初のバイト
+	Op      string
+	Command byte
+	Err     error
+}
+
+// Error formats the failure as, for example,
+// "ht16k33 at 0x70: brightness (0xEF): <bus error>".
+//
+// Errorは、例えば"ht16k33 at 0x70: brightness (0xEF): <バスのエラー>"の
+// ように失敗を書き表す。
+func (e *Error) Error() string {
+	return "ht16k33 at " + hexByte(e.Address) + ": " + e.Op + " (" + hexByte(e.Command) + "): " + e.Err.Error()
+}
+
+// hexByte formats b as 0x and two hex digits.
+//
+// hexByteは、bを0xと2桁の16進数で書き表す。
+func hexByte(b byte) string {
+	return string([]byte{'0', 'x', hexDigits[b>>4], hexDigits[b&0xF]})
+}
+
+// Unwrap returns the bus error.
+//
+// Unwrapは、バスのエラーを返す。
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// tx sends w to the device, then reads into r, and wraps any bus error
+// with the address and op.
+//
+// txは、デバイスにwを送ってからrに読み込み、バスのエラーをアドレスとopで
+// 包む。
+func (d *Device) tx(op string, w, r []byte) error {
+	if err := d.bus.Tx(uint16(d.Address), w, r); err != nil {
+		return &Error{Address: d.Address, Op: op, Command: w[0], Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package ht16k33
+
+// Segment bits of a glyph, as wired to ROW0-7 (ROW8-15) of each digit:
+//
+//	 aaa
+//	f   b
+//	 ggg
+//	e   c
+//	 ddd  dp
+//
+// 各桁のROW0-7(ROW8-15)に接続したグリフのセグメントのビット。
+const (
+	SegA byte = 1 << iota
+	SegB
+	SegC
+	SegD
+	SegE
+	SegF
+	SegG
+	SegDP
+)
+
+// Fallback is drawn for characters without a glyph: the three horizontal
+// bars, so an unexpected character shows up instead of vanishing. Change
+// it per device with SetFallback.
+//
+// Fallbackは、グリフの無い文字の代わりに表示する3本の横棒。予期しない文字
+// が消えずに目に見えるようにする。デバイスごとにSetFallbackで変えられる。
+const Fallback = SegA | SegG | SegD
+
+// hasGlyph marks the entries of glyphs that can be drawn. The built-in
+// glyphs never light the dot, so its bit is free for this.
+//
+// hasGlyphは、glyphsのうち描ける項目の印。組み込みのグリフはドットを点け
+// ないので、そのビットをこれに使う。
+const hasGlyph = SegDP
+
+// glyphs are the built-in glyphs of ASCII characters. Letters with only one
+// drawable form, such as b, E and r, use it for both cases, so "Err", "HI"
+// and "oFF" read as written; c, h, i, n, o and u have a form of each case.
+// K, M, V, W, X and Z cannot be told apart from other characters and have
+// no glyph.
+//
+// glyphsは、ASCII文字の組み込みのグリフ。b、E、rのように描ける形が1つしか
+// ない文字は大文字と小文字の両方にそれを使うので、"Err"、"HI"、"oFF"は書
+// いたとおりに読める。c、h、i、n、o、uは大文字と小文字それぞれの形を持つ。
+// K、M、V、W、X、Zは他の文字と見分けられないのでグリフが無い。
+var glyphs = [128]byte{
+	' ':  hasGlyph,
+	'-':  hasGlyph | SegG,
+	'_':  hasGlyph | SegD,
+	'=':  hasGlyph | SegG | SegD,
+	'\'': hasGlyph | SegF,
+	'"':  hasGlyph | SegF | SegB,
+	'[':  hasGlyph | SegA | SegD | SegE | SegF,
+	']':  hasGlyph | SegA | SegB | SegC | SegD,
+	'(':  hasGlyph | SegA | SegD | SegE | SegF,
+	')':  hasGlyph | SegA | SegB | SegC | SegD,
+	'?':  hasGlyph | SegA | SegB | SegE | SegG,
+
+	'A': hasGlyph | SegA | SegB | SegC | SegE | SegF | SegG,
+	'a': hasGlyph | SegA | SegB | SegC | SegE | SegF | SegG,
+	'B': hasGlyph | SegC | SegD | SegE | SegF | SegG,
+	'b': hasGlyph | SegC | SegD | SegE | SegF | SegG,
+	'C': hasGlyph | SegA | SegD | SegE | SegF,
+	'c': hasGlyph | SegD | SegE | SegG,
+	'D': hasGlyph | SegB | SegC | SegD | SegE | SegG,
+	'd': hasGlyph | SegB | SegC | SegD | SegE | SegG,
+	'E': hasGlyph | SegA | SegD | SegE | SegF | SegG,
+	'e': hasGlyph | SegA | SegD | SegE | SegF | SegG,
+	'F': hasGlyph | SegA | SegE | SegF | SegG,
+	'f': hasGlyph | SegA | SegE | SegF | SegG,
+	'G': hasGlyph | SegA | SegC | SegD | SegE | SegF,
+	'g': hasGlyph | SegA | SegC | SegD | SegE | SegF,
+	'H': hasGlyph | SegB | SegC | SegE | SegF | SegG,
+	'h': hasGlyph | SegC | SegE | SegF | SegG,
+	'I': hasGlyph | SegE | SegF,
+	'i': hasGlyph | SegE,
+	'J': hasGlyph | SegB | SegC | SegD | SegE,
+	'j': hasGlyph | SegB | SegC | SegD | SegE,
+	'L': hasGlyph | SegD | SegE | SegF,
+	'l': hasGlyph | SegD | SegE | SegF,
+	'N': hasGlyph | SegA | SegB | SegC | SegE | SegF,
+	'n': hasGlyph | SegC | SegE | SegG,
+	'O': hasGlyph | SegA | SegB | SegC | SegD | SegE | SegF,
+	'o': hasGlyph | SegC | SegD | SegE | SegG,
+	'P': hasGlyph | SegA | SegB | SegE | SegF | SegG,
+	'p': hasGlyph | SegA | SegB | SegE | SegF | SegG,
+	'Q': hasGlyph | SegA | SegB | SegC | SegF | SegG,
+	'q': hasGlyph | SegA | SegB | SegC | SegF | SegG,
+	'R': hasGlyph | SegE | SegG,
+	'r': hasGlyph | SegE | SegG,
+	'S': hasGlyph | SegA | SegC | SegD | SegF | SegG,
+	's': hasGlyph | SegA | SegC | SegD | SegF | SegG,
+	'T': hasGlyph | SegD | SegE | SegF | SegG,
+	't': hasGlyph | SegD | SegE | SegF | SegG,
+	'U': hasGlyph | SegB | SegC | SegD | SegE | SegF,
+	'u': hasGlyph | SegC | SegD | SegE,
+	'Y': hasGlyph | SegB | SegC | SegD | SegF | SegG,
+	'y': hasGlyph | SegB | SegC | SegD | SegF | SegG,
+}
+
+// degree is the degree sign, the one glyph outside ASCII.
+//
+// degreeは度の記号。ASCII以外で唯一のグリフ。
+const (
+	degree      = '°'
+	degreeGlyph = SegA | SegB | SegF | SegG
+)
+
+// maxCustomGlyphs is the number of glyphs DefineGlyph can hold.
+//
+// maxCustomGlyphsは、DefineGlyphが保持できるグリフの数。
+const maxCustomGlyphs = 8
+
+// customGlyph is a glyph defined with DefineGlyph.
+//
+// customGlyphは、DefineGlyphで定義したグリフ。
+type customGlyph struct {
+	r        rune
+	segments byte
+}
+
+// Glyph returns the built-in segments of r and whether r has a glyph.
+//
+// Glyphは、rの組み込みのセグメントと、rにグリフがあるかどうかを返す。
+func Glyph(r rune) (byte, bool) {
+	switch {
+	case r >= '0' && r <= '9':
+		return font[r-'0'], true
+	case r == degree:
+		return degreeGlyph, true
+	case r >= 0 && r < rune(len(glyphs)) && glyphs[r]&hasGlyph != 0:
+		return glyphs[r] &^ hasGlyph, true
+	default:
+		return 0, false
+	}
+}
+
+// DefineGlyph makes WriteString draw r with the given segments (SegA |
+// ... | SegDP), overriding any built-in glyph. It returns false when the
+// device already holds the maximum of 8 custom glyphs. The dot ('.') cannot
+// be redefined.
+//
+// DefineGlyphは、WriteStringがrを指定したセグメント(SegA | ... | SegDP)
+// で描くようにする。組み込みのグリフより優先する。デバイスが既に上限の8個
+// のカスタムグリフを持っていればfalseを返す。ドット('.')は定義し直せない。
+func (d *Device) DefineGlyph(r rune, segments byte) bool {
+	if r == '.' {
+		return false
+	}
+	for i := range d.custom[:d.numCustom] {
+		if d.custom[i].r == r {
+			d.custom[i].segments = segments
+			return true
+		}
+	}
+	if d.numCustom == maxCustomGlyphs {
+		return false
+	}
+	d.custom[d.numCustom] = customGlyph{r: r, segments: segments}
+	d.numCustom++
+	return true
+}
+
+// SetFallback sets the segments drawn for characters without a glyph. The
+// default is Fallback; 0 leaves them blank.
+//
+// SetFallbackは、グリフの無い文字に描くセグメントを設定する。デフォルトは
+// Fallback。0なら空白にする。
+func (d *Device) SetFallback(segments byte) {
+	d.fallback = segments
+}
+
+// glyph returns the segments WriteString draws for r.
+//
+// glyphは、WriteStringがrに描くセグメントを返す。
+func (d *Device) glyph(r rune) byte {
+	for _, c := range d.custom[:d.numCustom] {
+		if c.r == r {
+			return c.segments
+		}
+	}
+	if segments, ok := Glyph(r); ok {
+		return segments
+	}
+	return d.fallback
+}
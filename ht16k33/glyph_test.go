@@ -0,0 +1,188 @@
+package ht16k33
+
+import (
+	"fmt"
+	"testing"
+)
+
+// segmentsAt reads the segments of one digit back from the buffer.
+func segmentsAt(d *Device, display, position int) byte {
+	var segments byte
+	for seg := 0; seg < 8; seg++ {
+		if d.buffer[display*MaxDigitsPerDisplay+seg]&(1<<position) != 0 {
+			segments |= 1 << seg
+		}
+	}
+	return segments
+}
+
+// TestWriteString_Glyphs draws every character with a glyph on its own and
+// checks the segments in the buffer (dp-g-f-e-d-c-b-a).
+func TestWriteString_Glyphs(t *testing.T) {
+	testCases := []struct {
+		char     rune
+		expected byte
+	}{
+		{'0', 0b00111111}, {'1', 0b00000110}, {'2', 0b01011011}, {'3', 0b01001111}, {'4', 0b01100110},
+		{'5', 0b01101101}, {'6', 0b01111101}, {'7', 0b00000111}, {'8', 0b01111111}, {'9', 0b01101111},
+
+		{'A', 0b01110111}, {'a', 0b01110111}, {'B', 0b01111100}, {'b', 0b01111100},
+		{'C', 0b00111001}, {'c', 0b01011000}, {'D', 0b01011110}, {'d', 0b01011110},
+		{'E', 0b01111001}, {'e', 0b01111001}, {'F', 0b01110001}, {'f', 0b01110001},
+		{'G', 0b00111101}, {'g', 0b00111101}, {'H', 0b01110110}, {'h', 0b01110100},
+		{'I', 0b00110000}, {'i', 0b00010000}, {'J', 0b00011110}, {'j', 0b00011110},
+		{'L', 0b00111000}, {'l', 0b00111000}, {'N', 0b00110111}, {'n', 0b01010100},
+		{'O', 0b00111111}, {'o', 0b01011100}, {'P', 0b01110011}, {'p', 0b01110011},
+		{'Q', 0b01100111}, {'q', 0b01100111}, {'R', 0b01010000}, {'r', 0b01010000},
+		{'S', 0b01101101}, {'s', 0b01101101}, {'T', 0b01111000}, {'t', 0b01111000},
+		{'U', 0b00111110}, {'u', 0b00011100}, {'Y', 0b01101110}, {'y', 0b01101110},
+
+		{' ', 0b00000000}, {'-', 0b01000000}, {'_', 0b00001000}, {'=', 0b01001000},
+		{'\'', 0b00100000}, {'"', 0b00100010}, {'[', 0b00111001}, {']', 0b00001111},
+		{'(', 0b00111001}, {')', 0b00001111}, {'?', 0b01010011}, {'°', 0b01100011},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%q", tc.char), func(t *testing.T) {
+			device := New(&mockI2C{}, 0x70)
+			device.WriteString(1, string(tc.char))
+
+			if got := segmentsAt(&device, 1, 0); got != tc.expected {
+				t.Errorf("FAIL: Segments of %q are wrong!\nExpected: %08b\nGot:      %08b", tc.char, tc.expected, got)
+			}
+			if got, ok := Glyph(tc.char); !ok || got != tc.expected {
+				t.Errorf("FAIL: Glyph(%q) = %08b, %v; expected %08b, true", tc.char, got, ok, tc.expected)
+			}
+		})
+	}
+
+	// Every other printable ASCII character has no glyph.
+	drawn := map[rune]bool{}
+	for _, tc := range testCases {
+		drawn[tc.char] = true
+	}
+	for c := rune(' '); c <= '~'; c++ {
+		if _, ok := Glyph(c); ok != drawn[c] {
+			t.Errorf("FAIL: Glyph(%q) reports %v, but the table above says %v", c, ok, drawn[c])
+		}
+	}
+}
+
+// TestWriteString_Text verifies whole strings, including dots, the
+// fallback and strings longer than the display.
+func TestWriteString_Text(t *testing.T) {
+	const (
+		dash = 0b01000000
+		e    = 0b01111001
+		r    = 0b01010000
+		dp   = 0b10000000
+	)
+	testCases := []struct {
+		name     string
+		s        string
+		expected [MaxDigitsPerDisplay]byte
+	}{
+		{name: "Word", s: "Err", expected: [8]byte{e, r, r}},
+		{name: "Dot after a letter", s: "E.r", expected: [8]byte{e | dp, r}},
+		{name: "Leading dot takes a digit", s: ".5", expected: [8]byte{dp, 0b01101101}},
+		{name: "Second dot takes a digit", s: "1..", expected: [8]byte{0b00000110 | dp, dp}},
+		{name: "Fallback", s: "-K-", expected: [8]byte{dash, Fallback, dash}},
+		{name: "Fallback outside ASCII", s: "r→", expected: [8]byte{r, Fallback}},
+		{name: "Temperature", s: "21.5°C", expected: [8]byte{0b01011011, 0b00000110 | dp, 0b01101101, 0b01100011, 0b00111001}},
+		{name: "Dot after the last digit", s: "--------.", expected: [8]byte{dash, dash, dash, dash, dash, dash, dash, dash | dp}},
+		{name: "Too long", s: "rrrrrrrr-", expected: [8]byte{r, r, r, r, r, r, r, r}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			device := New(&mockI2C{}, 0x70)
+			device.WriteString(0, "88888888")
+			device.WriteString(0, tc.s)
+
+			var got [MaxDigitsPerDisplay]byte
+			for pos := range got {
+				got[pos] = segmentsAt(&device, 0, pos)
+			}
+			if got != tc.expected {
+				t.Errorf("FAIL: Digits of %q are wrong!\nExpected: %08b\nGot:      %08b", tc.s, tc.expected, got)
+			}
+		})
+	}
+}
+
+// TestDefineGlyph verifies custom glyphs and the fallback setting.
+func TestDefineGlyph(t *testing.T) {
+	device := New(&mockI2C{}, 0x70)
+
+	device.SetFallback(0)
+	device.WriteString(0, "K")
+	if got := segmentsAt(&device, 0, 0); got != 0 {
+		t.Errorf("FAIL: A blank fallback drew %08b", got)
+	}
+
+	// Override a built-in glyph and add a new one; the last definition wins.
+	if !device.DefineGlyph('7', SegA|SegB|SegC|SegF) || !device.DefineGlyph('K', SegG) || !device.DefineGlyph('K', SegE|SegF|SegG|SegDP) {
+		t.Fatal("FAIL: DefineGlyph refused a glyph")
+	}
+	device.WriteString(0, "7K.")
+	if got := segmentsAt(&device, 0, 0); got != 0b00100111 {
+		t.Errorf("FAIL: Custom '7' is wrong!\nExpected: %08b\nGot:      %08b", 0b00100111, got)
+	}
+	// The custom 'K' lights its own dot, so the '.' takes a digit.
+	if got := segmentsAt(&device, 0, 1); got != 0b11110000 {
+		t.Errorf("FAIL: Custom 'K' is wrong!\nExpected: %08b\nGot:      %08b", 0b11110000, got)
+	}
+	if got := segmentsAt(&device, 0, 2); got != SegDP {
+		t.Errorf("FAIL: The dot after 'K' is wrong!\nExpected: %08b\nGot:      %08b", SegDP, got)
+	}
+	if segments, _ := Glyph('7'); segments != 0b00000111 {
+		t.Errorf("FAIL: DefineGlyph changed the built-in glyph to %08b", segments)
+	}
+
+	if device.DefineGlyph('.', SegG) {
+		t.Error("FAIL: The dot must not be redefinable")
+	}
+	for _, c := range "MVWXZ%" {
+		if !device.DefineGlyph(c, SegG) {
+			t.Fatalf("FAIL: DefineGlyph refused %q", c)
+		}
+	}
+	if device.DefineGlyph('&', SegG) {
+		t.Errorf("FAIL: DefineGlyph took more than %d glyphs", maxCustomGlyphs)
+	}
+	if !device.DefineGlyph('M', SegA) {
+		t.Error("FAIL: Redefining a glyph must work at the limit")
+	}
+}
+
+// TestWriteString_NoAllocs verifies that writing a string does not
+// allocate, since it runs on every display update.
+func TestWriteString_NoAllocs(t *testing.T) {
+	device := New(&mockI2C{}, 0x70)
+	device.DefineGlyph('K', SegG)
+	allocs := testing.AllocsPerRun(100, func() {
+		device.WriteString(0, "21.5°C K")
+	})
+	if allocs != 0 {
+		t.Errorf("FAIL: WriteString allocated %v times", allocs)
+	}
+}
+
+// ExampleDevice_DefineGlyph shows how to draw a character that has no
+// built-in glyph.
+//
+// ExampleDevice_DefineGlyphは、組み込みのグリフが無い文字を描く方法を示す。
+func ExampleDevice_DefineGlyph() {
+	display := New(&mockI2C{}, 0x70)
+
+	// 'Z' reads as '2', so it has no built-in glyph. Where the context
+	// makes it clear, draw it like one anyway.
+	// 'Z'は'2'に読めるので組み込みのグリフが無い。文脈で分かる場面なら、そ
+	// れでも同じ形で描く。
+	display.DefineGlyph('Z', SegA|SegB|SegG|SegE|SegD)
+	display.WriteString(0, "ZonE 1")
+	display.Display()
+
+	fmt.Println("Wrote 'ZonE 1' to display 0.")
+	// Output: Wrote 'ZonE 1' to display 0.
+}
@@ -0,0 +1,172 @@
+package ht16k33
+
+// Align places a number within a display.
+//
+// Alignは、ディスプレイの中での数値の位置を決める。
+type Align uint8
+
+const (
+	// AlignRight keeps the last digit in place as the value changes.
+	// AlignRightは、値が変わっても最後の桁の位置を保つ。
+	AlignRight Align = iota
+	AlignLeft
+	// AlignCenter leaves one blank digit more on the right when the
+	// blanks do not split evenly.
+	// AlignCenterは、空白が均等に分けられないときは右に1桁多く残す。
+	AlignCenter
+)
+
+// Overflow selects what a number too wide for the display shows.
+//
+// Overflowは、ディスプレイに収まらない数値に表示するものを選ぶ。
+type Overflow uint8
+
+const (
+	// OverflowDashes fills the display with "--------".
+	// OverflowDashesは、ディスプレイを"--------"で埋める。
+	OverflowDashes Overflow = iota
+	// OverflowSaturate shows the largest number of the same sign that
+	// fits, such as 99999999, -9999999 or 99999.999.
+	// OverflowSaturateは、収まる範囲で最大の同じ符号の数値を表示する。
+	// 99999999、-9999999、99999.999など。
+	OverflowSaturate
+)
+
+// NumberFormat lays out the numbers of WriteInt, WriteFixed and WriteHex.
+// The zero value right-aligns the number without padding and shows dashes
+// on overflow.
+//
+// NumberFormatは、WriteInt、WriteFixed、WriteHexの数値の配置を決める。ゼ
+// ロ値は数値を右揃えにし、詰め物はせず、あふれたらダッシュを表示する。
+type NumberFormat struct {
+	Align Align
+	// Minimum number of digits, sign included. Shorter numbers are padded
+	// with blanks before the sign, or with zeros after it if ZeroPad is
+	// set. Values above MaxDigitsPerDisplay act as MaxDigitsPerDisplay.
+	// 符号を含めた最小の桁数。短い数値は符号の前を空白で、ZeroPadなら符号
+	// の後ろをゼロで埋める。MaxDigitsPerDisplayを超える値は
+	// MaxDigitsPerDisplayとして扱う。
+	Width   int
+	ZeroPad bool
+	// What to show when the number needs more than MaxDigitsPerDisplay
+	// digits.
+	// 数値がMaxDigitsPerDisplayより多くの桁を必要とするときに表示するもの
+	Overflow Overflow
+}
+
+// hexDigits are the characters of the hexadecimal digits, drawn with
+// their glyphs: 0-9, A, b, C, d, E, F.
+//
+// hexDigitsは16進数の各桁の文字。そのグリフで描く：0-9、A、b、C、d、E、F。
+const hexDigits = "0123456789ABCDEF"
+
+// WriteInt displays v in decimal on one of the two displays.
+//
+// WriteIntは、2つのディスプレイのいずれかにvを10進数で表示する。
+func (d *Device) WriteInt(display int, v int, f NumberFormat) {
+	d.WriteFixed(display, v, 0, f)
+}
+
+// WriteFixed displays v / 10^decimals in decimal on one of the two
+// displays, so WriteFixed(0, -1234, 2, f) shows "-12.34". The point takes
+// no digit of its own, and at least one digit comes before it ("0.05").
+//
+// WriteFixedは、2つのディスプレイのいずれかにv / 10^decimalsを10進数で表
+// 示する。WriteFixed(0, -1234, 2, f)なら"-12.34"になる。小数点は自分の桁
+// を使わず、その前には少なくとも1桁置く("0.05")。
+func (d *Device) WriteFixed(display int, v int, decimals int, f NumberFormat) {
+	neg := v < 0
+	mag := uint64(v)
+	if neg {
+		mag = -mag
+	}
+	d.writeNumber(display, neg, mag, 10, max(decimals, 0), f)
+}
+
+// WriteHex displays v in hexadecimal on one of the two displays. A uint32
+// always fits in 8 digits, so f.Overflow does not apply.
+//
+// WriteHexは、2つのディスプレイのいずれかにvを16進数で表示する。uint32は
+// 常に8桁に収まるので、f.Overflowは関係しない。
+func (d *Device) WriteHex(display int, v uint32, f NumberFormat) {
+	d.writeNumber(display, false, uint64(v), 16, 0, f)
+}
+
+// writeNumber lays out a number into the digits of display without
+// allocating. The number is built right to left in field, then placed.
+//
+// writeNumberは、割り当てをせずに数値をディスプレイの桁に配置する。数値
+// はfieldに右から左へ組み立ててから置く。
+func (d *Device) writeNumber(display int, neg bool, mag, base uint64, decimals int, f NumberFormat) {
+	if display < 0 || display >= NumDisplays {
+		return
+	}
+	sign := 0
+	if neg {
+		sign = 1
+	}
+	width := min(f.Width, MaxDigitsPerDisplay)
+
+	// Count the digits, then the zeros that pad them to the width.
+	// 桁数を数え、次に幅まで埋めるゼロを数える。
+	digits := 1
+	for p := base; p <= mag && digits <= MaxDigitsPerDisplay; p *= base {
+		digits++
+	}
+	digits = max(digits, decimals+1)
+	if f.ZeroPad {
+		digits = max(digits, width-sign)
+	}
+
+	if sign+digits > MaxDigitsPerDisplay {
+		capacity := MaxDigitsPerDisplay - sign
+		if f.Overflow != OverflowSaturate || capacity < decimals+1 {
+			for pos := 0; pos < MaxDigitsPerDisplay; pos++ {
+				d.SetSegments(display, pos, d.glyph('-'))
+			}
+			return
+		}
+		// All nines in every digit.
+		// すべての桁を9にする。
+		digits = capacity
+		mag = 1
+		for i := 0; i < digits; i++ {
+			mag *= base
+		}
+		mag--
+	}
+
+	var field [MaxDigitsPerDisplay]byte
+	n := 0
+	for i := 0; i < digits; i++ {
+		segments := d.glyph(rune(hexDigits[mag%base]))
+		if decimals > 0 && i == decimals {
+			segments |= SegDP
+		}
+		field[len(field)-1-n] = segments
+		n++
+		mag /= base
+	}
+	if neg {
+		field[len(field)-1-n] = d.glyph('-')
+		n++
+	}
+	// Blank padding; the field is already blank.
+	// 空白で埋める。fieldは既に空白。
+	n = max(n, width)
+
+	start := 0
+	switch f.Align {
+	case AlignRight:
+		start = MaxDigitsPerDisplay - n
+	case AlignCenter:
+		start = (MaxDigitsPerDisplay - n) / 2
+	}
+	for pos := 0; pos < MaxDigitsPerDisplay; pos++ {
+		var segments byte
+		if i := pos - start + len(field) - n; pos >= start && pos < start+n {
+			segments = field[i]
+		}
+		d.SetSegments(display, pos, segments)
+	}
+}
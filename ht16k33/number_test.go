@@ -0,0 +1,161 @@
+package ht16k33
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// checkDigits compares display 0 of device with text drawn by WriteString.
+func checkDigits(t *testing.T, device *Device, text string) {
+	t.Helper()
+	expected := New(&mockI2C{}, 0x70)
+	expected.WriteString(0, text)
+	if !bytes.Equal(device.buffer[:MaxDigitsPerDisplay], expected.buffer[:MaxDigitsPerDisplay]) {
+		t.Errorf("FAIL: Digits are wrong!\nExpected: %q %08b\nGot:      %08b", text, expected.buffer[:MaxDigitsPerDisplay], device.buffer[:MaxDigitsPerDisplay])
+	}
+}
+
+// TestWriteInt verifies alignment, padding, signs and overflow of decimal
+// integers.
+func TestWriteInt(t *testing.T) {
+	testCases := []struct {
+		name     string
+		v        int
+		f        NumberFormat
+		expected string
+	}{
+		{name: "Right aligned by default", v: 1800, expected: "    1800"},
+		{name: "Zero", v: 0, expected: "       0"},
+		{name: "Left", v: 1800, f: NumberFormat{Align: AlignLeft}, expected: "1800    "},
+		{name: "Centre", v: 180, f: NumberFormat{Align: AlignCenter}, expected: "  180   "},
+		{name: "Centre, even", v: 1800, f: NumberFormat{Align: AlignCenter}, expected: "  1800  "},
+		{name: "Negative", v: -42, expected: "     -42"},
+		{name: "Zero padded", v: 42, f: NumberFormat{Width: 8, ZeroPad: true}, expected: "00000042"},
+		{name: "Zero padded negative", v: -42, f: NumberFormat{Width: 5, ZeroPad: true}, expected: "   -0042"},
+		{name: "Blank padded width, left", v: -42, f: NumberFormat{Width: 5, Align: AlignLeft}, expected: "  -42   "},
+		{name: "Width above the display", v: 7, f: NumberFormat{Width: 20, ZeroPad: true, Align: AlignLeft}, expected: "00000007"},
+		{name: "Widest positive", v: 99999999, expected: "99999999"},
+		{name: "Widest negative", v: -9999999, expected: "-9999999"},
+		{name: "Overflow", v: 100000000, expected: "--------"},
+		{name: "Negative overflow", v: -10000000, expected: "--------"},
+		{name: "Saturate", v: 123456789, f: NumberFormat{Overflow: OverflowSaturate}, expected: "99999999"},
+		{name: "Saturate negative", v: math.MinInt32, f: NumberFormat{Overflow: OverflowSaturate}, expected: "-9999999"},
+		{name: "Zero padding capped at the display", v: -1, f: NumberFormat{Width: 9, ZeroPad: true}, expected: "-0000001"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			device := New(&mockI2C{}, 0x70)
+			device.WriteString(0, "88888888")
+			device.WriteInt(0, tc.v, tc.f)
+			checkDigits(t, &device, tc.expected)
+		})
+	}
+}
+
+// TestWriteFixed verifies the decimal point of fixed-point values.
+func TestWriteFixed(t *testing.T) {
+	testCases := []struct {
+		name     string
+		v        int
+		decimals int
+		f        NumberFormat
+		expected string
+	}{
+		{name: "Two decimals", v: -1234, decimals: 2, expected: "   -12.34"},
+		{name: "Leading zero", v: 5, decimals: 2, expected: "     0.05"},
+		{name: "Negative leading zero", v: -5, decimals: 3, expected: "   -0.005"},
+		{name: "No decimals", v: 5, decimals: 0, expected: "       5"},
+		{name: "Negative decimals act as none", v: 5, decimals: -1, expected: "       5"},
+		{name: "Zero padded", v: 215, decimals: 1, f: NumberFormat{Width: 4, ZeroPad: true}, expected: "    021.5"},
+		{name: "Left", v: 215, decimals: 1, f: NumberFormat{Align: AlignLeft}, expected: "21.5     "},
+		{name: "All decimals", v: 1, decimals: 7, expected: "0.0000001"},
+		{name: "Overflow", v: 123456789, decimals: 3, expected: "--------"},
+		{name: "Saturate", v: 123456789, decimals: 3, f: NumberFormat{Overflow: OverflowSaturate}, expected: "99999.999"},
+		{name: "Saturate negative", v: -123456789, decimals: 3, f: NumberFormat{Overflow: OverflowSaturate}, expected: "-9999.999"},
+		{name: "Too many decimals to saturate", v: -1, decimals: 7, f: NumberFormat{Overflow: OverflowSaturate}, expected: "--------"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			device := New(&mockI2C{}, 0x70)
+			device.WriteFixed(0, tc.v, tc.decimals, tc.f)
+			checkDigits(t, &device, tc.expected)
+		})
+	}
+}
+
+// TestWriteHex verifies hexadecimal values.
+func TestWriteHex(t *testing.T) {
+	testCases := []struct {
+		name     string
+		v        uint32
+		f        NumberFormat
+		expected string
+	}{
+		{name: "Letters", v: 0xABCDEF, expected: "  AbCdEF"},
+		{name: "Largest", v: math.MaxUint32, expected: "FFFFFFFF"},
+		{name: "Zero padded", v: 0x2A, f: NumberFormat{Width: 4, ZeroPad: true, Align: AlignLeft}, expected: "002A    "},
+		{name: "Centre", v: 0x70, f: NumberFormat{Align: AlignCenter}, expected: "   70   "},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			device := New(&mockI2C{}, 0x70)
+			device.WriteHex(0, tc.v, tc.f)
+			checkDigits(t, &device, tc.expected)
+		})
+	}
+}
+
+// TestWriteNumber_OtherDisplay verifies that a number only changes its own
+// display.
+func TestWriteNumber_OtherDisplay(t *testing.T) {
+	device := New(&mockI2C{}, 0x70)
+	device.WriteString(0, "88888888")
+	device.WriteInt(1, 1800, NumberFormat{})
+	device.WriteInt(2, 1800, NumberFormat{})
+
+	checkDigits(t, &device, "88888888")
+	expected := New(&mockI2C{}, 0x70)
+	expected.WriteString(1, "    1800")
+	if !bytes.Equal(device.buffer[MaxDigitsPerDisplay:], expected.buffer[MaxDigitsPerDisplay:]) {
+		t.Errorf("FAIL: Display 1 is wrong!\nExpected: %08b\nGot:      %08b", expected.buffer[MaxDigitsPerDisplay:], device.buffer[MaxDigitsPerDisplay:])
+	}
+}
+
+// TestWriteNumber_NoAllocs verifies that numbers are written without
+// allocating, since they are written on every RPM tick.
+func TestWriteNumber_NoAllocs(t *testing.T) {
+	device := New(&mockI2C{}, 0x70)
+	allocs := testing.AllocsPerRun(100, func() {
+		device.WriteInt(0, -1800, NumberFormat{Width: 6, ZeroPad: true})
+		device.WriteFixed(1, 215, 1, NumberFormat{Align: AlignCenter})
+		device.WriteHex(1, 0xBEEF, NumberFormat{Overflow: OverflowSaturate})
+	})
+	if allocs != 0 {
+		t.Errorf("FAIL: Writing numbers allocated %v times", allocs)
+	}
+}
+
+// ExampleDevice_WriteInt shows right-aligned RPMs that keep their last
+// digit in place.
+//
+// ExampleDevice_WriteIntは、最後の桁の位置を保つ右揃えのRPMを示す。
+func ExampleDevice_WriteInt() {
+	display := New(&mockI2C{}, 0x70)
+
+	// "     900", then "    1800": the ones digit stays in place.
+	// "     900"、次に"    1800"：1の位は同じ位置のまま。
+	display.WriteInt(0, 900, NumberFormat{})
+	display.WriteInt(0, 1800, NumberFormat{})
+	// "    21.5": a temperature in tenths of a degree.
+	// "    21.5"：0.1度単位の温度。
+	display.WriteFixed(1, 215, 1, NumberFormat{})
+	display.Display()
+
+	fmt.Println("Wrote the RPM and the temperature.")
+	// Output: Wrote the RPM and the temperature.
+}
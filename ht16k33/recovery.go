@@ -0,0 +1,265 @@
+package ht16k33
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrOffline is returned by RecoveringBus while the device counts as
+// offline, until the next attempt to reach it is due.
+//
+// ErrOfflineは、デバイスがオフライン扱いの間、次に接続を試みる時刻まで
+// RecoveringBusが返す。
+var ErrOffline = errors.New("ht16k33: device offline")
+
+// Clock provides the current time and a way to wait. app.Clock satisfies
+// it.
+//
+// Clockは、現在時刻と待つ手段を提供する。app.Clockはこれを満たす。
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// RecoveryConfig sets how RecoveringBus retries and backs off.
+//
+// RecoveryConfigは、RecoveringBusの再試行と待ち方を設定する。
+type RecoveryConfig struct {
+	// Attempts after the first failure of a transaction, and the wait
+	// before the first of them, doubled for each further one.
+	// トランザクションが最初に失敗した後の試行回数と、その1回目の前の待ち
+	// 時間。以降は1回ごとに倍にする。
+	Retries int
+	Backoff time.Duration
+	// Once a transaction fails all its attempts, the device counts as
+	// offline and transactions fail at once with ErrOffline for Holdoff.
+	// Then one is tried; each failure doubles the holdoff, up to
+	// MaxHoldoff.
+	// トランザクションがすべての試行に失敗したら、デバイスはオフライン扱い
+	// になり、Holdoffの間トランザクションはすぐにErrOfflineで失敗する。そ
+	// の後1回だけ試し、失敗するたびに待ちを倍にする。上限はMaxHoldoff。
+	Holdoff    time.Duration
+	MaxHoldoff time.Duration
+}
+
+// DefaultRecoveryConfig returns retries that cost the control loop at most
+// 1.5ms per failed transaction, and an offline device tried again within
+// 5s of coming back.
+//
+// DefaultRecoveryConfigは、失敗したトランザクション1回あたり制御ループの時
+// 間を最大1.5msしか使わない再試行と、オフラインのデバイスが戻ってから5秒以
+// 内に再び試す設定を返す。
+func DefaultRecoveryConfig() RecoveryConfig {
+	return RecoveryConfig{
+		Retries:    2,
+		Backoff:    500 * time.Microsecond,
+		Holdoff:    100 * time.Millisecond,
+		MaxHoldoff: 5 * time.Second,
+	}
+}
+
+// BusStats counts what RecoveringBus has seen, for diagnostics.
+//
+// BusStatsは、診断用にRecoveringBusが見たことを数える。
+type BusStats struct {
+	// Errors counts every failed attempt on the underlying bus, Retries
+	// the attempts repeated, and Failures the transactions that failed
+	// all their attempts.
+	// Errorsは下のバスで失敗したすべての試行、Retriesは繰り返した試行、
+	// Failuresはすべての試行に失敗したトランザクションを数える。
+	Errors   uint32
+	Retries  uint32
+	Failures uint32
+	// Skipped counts the transactions refused with ErrOffline.
+	// SkippedはErrOfflineで断ったトランザクションを数える。
+	Skipped uint32
+	// BusClears counts the bus-clear sequences run, and Recoveries the
+	// times the device came back after being offline.
+	// BusClearsは実行したバスクリアの手順、Recoveriesはオフラインから
+	// デバイスが戻った回数を数える。
+	BusClears  uint32
+	Recoveries uint32
+}
+
+// RecoveringBus wraps the I2CBus of a Device so that a display that NAKs
+// or a hung bus neither stalls the caller nor stays dark. It retries
+// failed transactions with backoff, and after the retries run out it runs
+// the bus-clear hook and holds off for a growing time. Once the device
+// answers again, it runs the reconfigure hook, usually Device.Configure,
+// so a chip that lost power comes back with its settings.
+//
+// RecoveringBusは、DeviceのI2CBusを包み、NAKを返すディスプレイや止まった
+// バスが呼び出し側を止めたり、表示が消えたままになったりしないようにする。
+// 失敗したトランザクションを待ちを挟んで再試行し、再試行が尽きたらバスク
+// リアのフックを実行して、伸びていく時間だけ待つ。デバイスが再び応答した
+// ら再設定のフック(普通はDevice.Configure)を実行するので、電源が落ちたチッ
+// プも設定ごと戻る。
+type RecoveringBus struct {
+	bus   I2CBus
+	clock Clock
+	cfg   RecoveryConfig
+	// Optional hooks; see SetBusClear and SetReconfigure.
+	// 任意のフック。SetBusClearとSetReconfigureを参照。
+	clear, reconfigure func() error
+	// Whether the device is offline, the current holdoff and when the
+	// next attempt is due.
+	// デバイスがオフラインかどうか、現在の待ち時間、次に試す時刻
+	offline bool
+	holdoff time.Duration
+	retryAt time.Time
+	// Set while reconfigure runs, which sends through this bus too.
+	// reconfigureの実行中に設定する。reconfigureもこのバスで送るため。
+	reconfiguring  bool
+	reconfigureErr error
+	stats          BusStats
+}
+
+// NewRecoveringBus wraps bus, using clock to wait and to time the
+// holdoff.
+//
+// NewRecoveringBusは、busを包む。待つのと待ち時間を計るのにclockを使う。
+func NewRecoveringBus(bus I2CBus, clock Clock, cfg RecoveryConfig) *RecoveringBus {
+	return &RecoveringBus{bus: bus, clock: clock, cfg: cfg}
+}
+
+// SetBusClear sets the hook that frees a bus a device holds stuck, such
+// as SDA held low after a brown-out, usually by toggling SCL as a GPIO
+// and re-configuring the I2C peripheral. It runs whenever a transaction
+// fails all its attempts.
+//
+// SetBusClearは、デバイスが止めたバス(ブラウンアウト後にSDAがLowのままな
+// ど)を解放するフックを設定する。普通はSCLをGPIOとして切り替え、I2Cペリ
+// フェラルを設定し直す。トランザクションがすべての試行に失敗するたびに実
+// 行する。
+func (b *RecoveringBus) SetBusClear(clear func() error) {
+	b.clear = clear
+}
+
+// SetReconfigure sets the hook run when the device answers again after
+// being offline, usually Device.Configure.
+//
+// SetReconfigureは、オフラインだったデバイスが再び応答したときに実行する
+// フックを設定する。普通はDevice.Configure。
+func (b *RecoveringBus) SetReconfigure(reconfigure func() error) {
+	b.reconfigure = reconfigure
+}
+
+// Online reports whether the device answered the last transaction tried
+// and, if it had been offline, the reconfigure hook succeeded.
+//
+// Onlineは、最後に試したトランザクションにデバイスが応答し、オフラインだっ
+// た場合は再設定のフックが成功したかどうかを返す。
+func (b *RecoveringBus) Online() bool {
+	return !b.offline
+}
+
+// ReconfigureErr returns the error of the last run of the reconfigure
+// hook, or nil if it succeeded or has not run.
+//
+// ReconfigureErrは、再設定のフックを最後に実行したときのエラーを返す。成
+// 功したか、まだ実行していなければnilを返す。
+func (b *RecoveringBus) ReconfigureErr() error {
+	return b.reconfigureErr
+}
+
+// Stats returns the counts so far.
+//
+// Statsは、これまでの回数を返す。
+func (b *RecoveringBus) Stats() BusStats {
+	return b.stats
+}
+
+// Tx sends w and reads into r through the underlying bus, as described on
+// RecoveringBus. It returns ErrOffline without touching the bus while the
+// device is held off, and otherwise the last error of the bus.
+//
+// Txは、RecoveringBusの説明のとおり、下のバスを通してwを送りrに読み込む。
+// デバイスを待たせている間はバスに触れずにErrOfflineを返し、それ以外では
+// バスの最後のエラーを返す。
+func (b *RecoveringBus) Tx(addr uint16, w, r []byte) error {
+	retries := b.cfg.Retries
+	// While reconfiguring, the device is still offline but has just
+	// answered, so the hook's transactions go through as usual.
+	// 再設定の間、デバイスはまだオフラインだが応答したばかりなので、フッ
+	// クのトランザクションは普段どおり通す。
+	if b.offline && !b.reconfiguring {
+		if b.clock.Now().Before(b.retryAt) {
+			b.stats.Skipped++
+			return ErrOffline
+		}
+		// One attempt is enough to tell whether it is back.
+		// 戻ったかどうかは1回試せば分かる。
+		retries = 0
+	}
+
+	backoff := b.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		err := b.bus.Tx(addr, w, r)
+		if err == nil {
+			break
+		}
+		b.stats.Errors++
+		if attempt >= retries {
+			b.fail()
+			return err
+		}
+		b.stats.Retries++
+		b.clock.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if b.offline && !b.reconfiguring {
+		b.reconnect()
+	}
+	return nil
+}
+
+// reconnect runs the reconfigure hook once an offline device answers, and
+// only then counts the device as back. If the hook fails, the device
+// stays offline and its holdoff keeps doubling, so a device that flaps
+// while being configured is not tried every Holdoff.
+//
+// reconnectは、オフラインのデバイスが応答したら再設定のフックを実行し、そ
+// の後で初めてデバイスが戻ったとみなす。フックが失敗したら、デバイスはオ
+// フラインのままで待ちも倍になり続けるので、設定中に落ちたり戻ったりする
+// デバイスをHoldoffごとに試すことはない。
+func (b *RecoveringBus) reconnect() {
+	if b.reconfigure != nil {
+		failures := b.stats.Failures
+		b.reconfiguring = true
+		b.reconfigureErr = b.reconfigure()
+		b.reconfiguring = false
+		if b.reconfigureErr != nil {
+			// A bus failure in the hook has already held the device
+			// off; any other error has not.
+			// フック内のバスの失敗なら既に待たせている。それ以外のエラー
+			// ではまだ。
+			if b.stats.Failures == failures {
+				b.fail()
+			}
+			return
+		}
+	}
+	b.offline = false
+	b.stats.Recoveries++
+}
+
+// fail takes the device offline after a transaction failed all its
+// attempts, clears the bus and schedules the next attempt.
+//
+// failは、トランザクションがすべての試行に失敗した後、デバイスをオフライ
+// ンにしてバスをクリアし、次に試す時刻を決める。
+func (b *RecoveringBus) fail() {
+	b.stats.Failures++
+	if b.offline {
+		b.holdoff = min(2*b.holdoff, b.cfg.MaxHoldoff)
+	} else {
+		b.offline = true
+		b.holdoff = b.cfg.Holdoff
+	}
+	if b.clear != nil {
+		b.stats.BusClears++
+		b.clear()
+	}
+	b.retryAt = b.clock.Now().Add(b.holdoff)
+}
@@ -0,0 +1,297 @@
+package ht16k33
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// scriptedBus is a mock I2CBus that fails transactions as scripted: the
+// nth transaction returns script[n], and every one after the script
+// succeeds.
+type scriptedBus struct {
+	script []error
+	calls  int
+	// The first byte of every transaction that succeeded, oldest first
+	sent []byte
+}
+
+func (s *scriptedBus) Tx(addr uint16, w, r []byte) error {
+	s.calls++
+	if s.calls <= len(s.script) && s.script[s.calls-1] != nil {
+		return s.script[s.calls-1]
+	}
+	s.sent = append(s.sent, w[0])
+	return nil
+}
+
+// fakeClock is a Clock that only moves when told to, or when slept on.
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+}
+
+// nacks returns n failures for a scriptedBus.
+func nacks(n int) []error {
+	script := make([]error, n)
+	for i := range script {
+		script[i] = errNack
+	}
+	return script
+}
+
+// TestRecoveringBus_Retries verifies the retries within one transaction
+// and their backoff.
+func TestRecoveringBus_Retries(t *testing.T) {
+	testCases := []struct {
+		name     string
+		script   []error
+		err      error
+		slept    []time.Duration
+		expected BusStats
+	}{
+		{
+			name:     "No errors",
+			expected: BusStats{},
+		},
+		{
+			name:     "One NAK",
+			script:   nacks(1),
+			slept:    []time.Duration{500 * time.Microsecond},
+			expected: BusStats{Errors: 1, Retries: 1},
+		},
+		{
+			name:     "Last retry succeeds",
+			script:   nacks(2),
+			slept:    []time.Duration{500 * time.Microsecond, time.Millisecond},
+			expected: BusStats{Errors: 2, Retries: 2},
+		},
+		{
+			name:     "Retries run out",
+			script:   nacks(3),
+			err:      errNack,
+			slept:    []time.Duration{500 * time.Microsecond, time.Millisecond},
+			expected: BusStats{Errors: 3, Retries: 2, Failures: 1, BusClears: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockBus := &scriptedBus{script: tc.script}
+			clock := &fakeClock{}
+			clears := 0
+			bus := NewRecoveringBus(mockBus, clock, DefaultRecoveryConfig())
+			bus.SetBusClear(func() error { clears++; return nil })
+
+			err := bus.Tx(0x70, []byte{0x21}, nil)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("FAIL: Expected error %v, got %v", tc.err, err)
+			}
+			if fmt.Sprint(clock.slept) != fmt.Sprint(tc.slept) {
+				t.Errorf("FAIL: Backoff is wrong!\nExpected: %v\nGot:      %v", tc.slept, clock.slept)
+			}
+			if got := bus.Stats(); got != tc.expected {
+				t.Errorf("FAIL: Stats are wrong!\nExpected: %+v\nGot:      %+v", tc.expected, got)
+			}
+			if bus.Online() != (tc.err == nil) || clears != int(tc.expected.BusClears) {
+				t.Errorf("FAIL: Online is %v after %d bus clears", bus.Online(), clears)
+			}
+		})
+	}
+}
+
+// TestRecoveringBus_Holdoff verifies that an offline device is left alone
+// for a doubling holdoff, and tried once when it is due.
+func TestRecoveringBus_Holdoff(t *testing.T) {
+	mockBus := &scriptedBus{script: nacks(3 + 5)}
+	clock := &fakeClock{}
+	cfg := DefaultRecoveryConfig()
+	cfg.MaxHoldoff = 500 * time.Millisecond
+	bus := NewRecoveringBus(mockBus, clock, cfg)
+
+	if err := bus.Tx(0x70, []byte{0x00}, nil); !errors.Is(err, errNack) {
+		t.Fatalf("FAIL: Expected the bus error, got %v", err)
+	}
+	calls := mockBus.calls
+	clock.slept = nil
+
+	// The holdoffs after each failed single attempt double, capped at
+	// 500ms; the last attempt succeeds.
+	holdoffs := []time.Duration{100, 200, 400, 500, 500, 500}
+	for i, holdoff := range holdoffs {
+		clock.now = clock.now.Add(holdoff*time.Millisecond - time.Millisecond)
+		if err := bus.Tx(0x70, []byte{0x00}, nil); !errors.Is(err, ErrOffline) {
+			t.Fatalf("FAIL: Step %d: Expected ErrOffline before the holdoff, got %v", i, err)
+		}
+		if mockBus.calls != calls {
+			t.Fatalf("FAIL: Step %d: The bus was used while offline", i)
+		}
+
+		clock.now = clock.now.Add(time.Millisecond)
+		err := bus.Tx(0x70, []byte{0x00}, nil)
+		if mockBus.calls != calls+1 {
+			t.Fatalf("FAIL: Step %d: Expected one attempt, got %d", i, mockBus.calls-calls)
+		}
+		calls++
+		if last := i == len(holdoffs)-1; last && err != nil || !last && !errors.Is(err, errNack) {
+			t.Fatalf("FAIL: Step %d: Unexpected error %v", i, err)
+		}
+	}
+	if len(clock.slept) != 0 {
+		t.Errorf("FAIL: Offline attempts must not retry, but slept %v", clock.slept)
+	}
+	if !bus.Online() {
+		t.Error("FAIL: The device should be back")
+	}
+	expected := BusStats{Errors: 8, Retries: 2, Failures: 6, Skipped: 6, Recoveries: 1}
+	if got := bus.Stats(); got != expected {
+		t.Errorf("FAIL: Stats are wrong!\nExpected: %+v\nGot:      %+v", expected, got)
+	}
+}
+
+// TestRecoveringBus_Reconfigure verifies that a Device on a RecoveringBus
+// is configured again, with its settings, once it comes back.
+func TestRecoveringBus_Reconfigure(t *testing.T) {
+	mockBus := &scriptedBus{}
+	clock := &fakeClock{}
+	bus := NewRecoveringBus(mockBus, clock, DefaultRecoveryConfig())
+	device := New(bus, 0x70)
+	bus.SetReconfigure(device.Configure)
+	if err := device.Configure(); err != nil {
+		t.Fatalf("FAIL: Configure: %v", err)
+	}
+
+	// A brown-out: the chip drops off the bus and loses its settings.
+	mockBus.script = append(make([]error, mockBus.calls), nacks(3)...)
+	if err := device.SetBlink(Blink1Hz); !errors.Is(err, errNack) {
+		t.Fatalf("FAIL: Expected the bus error, got %v", err)
+	}
+	var e *Error
+	if err := device.Display(); !errors.As(err, &e) || !errors.Is(err, ErrOffline) || e.Op != "display RAM" {
+		t.Fatalf("FAIL: Expected ErrOffline wrapped by the device, got %v", err)
+	}
+
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	mockBus.sent = nil
+	if err := device.Display(); err != nil {
+		t.Fatalf("FAIL: Display after the holdoff: %v", err)
+	}
+	expected := []byte{0x00, 0x21, 0x85, 0xEF}
+	if !bytes.Equal(mockBus.sent, expected) {
+		t.Errorf("FAIL: Commands after recovery are wrong!\nExpected: %x\nGot:      %x", expected, mockBus.sent)
+	}
+	if got := bus.Stats().Recoveries; got != 1 {
+		t.Errorf("FAIL: Expected 1 recovery, got %d", got)
+	}
+}
+
+// TestRecoveringBus_ReconfigureFails verifies that a device that drops off
+// again while being configured goes back offline.
+func TestRecoveringBus_ReconfigureFails(t *testing.T) {
+	// Fails all attempts, then succeeds once, then fails all attempts of
+	// the reconfiguration.
+	script := append(append(nacks(3), nil), nacks(3)...)
+	mockBus := &scriptedBus{script: script}
+	clock := &fakeClock{}
+	bus := NewRecoveringBus(mockBus, clock, DefaultRecoveryConfig())
+	device := New(bus, 0x70)
+	var reconfigureErr error
+	bus.SetReconfigure(func() error {
+		reconfigureErr = device.Configure()
+		return reconfigureErr
+	})
+
+	device.Display()
+	clock.now = clock.now.Add(100 * time.Millisecond)
+	if err := device.Display(); err != nil {
+		t.Fatalf("FAIL: Expected the display write to succeed, got %v", err)
+	}
+	if !errors.Is(reconfigureErr, errNack) || bus.Online() {
+		t.Errorf("FAIL: Expected the device offline after a failed Configure, got %v", reconfigureErr)
+	}
+	if !errors.Is(bus.ReconfigureErr(), errNack) {
+		t.Errorf("FAIL: Expected the Configure error to be kept, got %v", bus.ReconfigureErr())
+	}
+	if got := bus.Stats().Recoveries; got != 0 {
+		t.Errorf("FAIL: A failed Configure must not count as a recovery, got %d", got)
+	}
+
+	// The holdoff doubled instead of starting over.
+	clock.now = clock.now.Add(200*time.Millisecond - time.Millisecond)
+	if err := device.Display(); !errors.Is(err, ErrOffline) {
+		t.Errorf("FAIL: Expected ErrOffline, got %v", err)
+	}
+	clock.now = clock.now.Add(time.Millisecond)
+	if err := device.Display(); err != nil {
+		t.Fatalf("FAIL: Expected the display write to succeed, got %v", err)
+	}
+	if reconfigureErr != nil || bus.ReconfigureErr() != nil || !bus.Online() {
+		t.Errorf("FAIL: Expected the device back after Configure succeeded, got %v", reconfigureErr)
+	}
+	if got := bus.Stats().Recoveries; got != 1 {
+		t.Errorf("FAIL: Expected 1 recovery, got %d", got)
+	}
+}
+
+// TestRecoveringBus_Flapping verifies that a device that answers each
+// probe but fails every reconfiguration is held off for a doubling time.
+func TestRecoveringBus_Flapping(t *testing.T) {
+	mockBus := &scriptedBus{script: nacks(3)}
+	clock := &fakeClock{}
+	bus := NewRecoveringBus(mockBus, clock, DefaultRecoveryConfig())
+	errLost := errors.New("settings lost")
+	bus.SetReconfigure(func() error { return errLost })
+
+	bus.Tx(0x70, []byte{0x00}, nil)
+	for i, holdoff := range []time.Duration{100, 200, 400, 800, 1600} {
+		clock.now = clock.now.Add(holdoff*time.Millisecond - time.Millisecond)
+		if err := bus.Tx(0x70, []byte{0x00}, nil); !errors.Is(err, ErrOffline) {
+			t.Fatalf("FAIL: Step %d: Expected ErrOffline before the holdoff, got %v", i, err)
+		}
+		clock.now = clock.now.Add(time.Millisecond)
+		if err := bus.Tx(0x70, []byte{0x00}, nil); err != nil {
+			t.Fatalf("FAIL: Step %d: Expected the probe to succeed, got %v", i, err)
+		}
+		if bus.Online() || bus.ReconfigureErr() != errLost {
+			t.Fatalf("FAIL: Step %d: Expected the device offline with %v, got %v", i, errLost, bus.ReconfigureErr())
+		}
+	}
+	if got := bus.Stats().Recoveries; got != 0 {
+		t.Errorf("FAIL: Expected no recoveries, got %d", got)
+	}
+}
+
+// ExampleRecoveringBus shows how to keep a display going through loose
+// cables and brown-outs.
+//
+// ExampleRecoveringBusは、ケーブルの緩みやブラウンアウトがあっても表示を続
+// ける方法を示す。
+func ExampleRecoveringBus() {
+	// In a real application, this would be machine.I2C0 and a clock
+	// backed by the time package.
+	// 実際のアプリケーションでは、machine.I2C0と、timeパッケージを使うクロッ
+	// クになる。
+	bus := NewRecoveringBus(&mockI2C{}, &fakeClock{}, DefaultRecoveryConfig())
+	display := New(bus, 0x70)
+	bus.SetReconfigure(display.Configure)
+	display.Configure()
+
+	display.WriteInt(0, 1800, NumberFormat{})
+	if err := display.Display(); err != nil {
+		// The next call tries again; nothing else to do.
+		// 次の呼び出しで再び試すので、他にすることは無い。
+		fmt.Println(err)
+	}
+
+	fmt.Println("Online:", bus.Online())
+	// Output: Online: true
+}
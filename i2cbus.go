@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"machine"
+	"time"
+)
+
+// errBusStuck is returned by ClearBus when SDA stays low after the clock
+// pulses.
+//
+// errBusStuckは、クロックのパルスを送ってもSDAがLowのままのときにClearBus
+// が返す。
+var errBusStuck = errors.New("i2c: SDA stuck low")
+
+// i2cBus is the I2C bus of the display. It remembers its configuration so
+// that it can take the pins over for a bus clear and hand them back.
+//
+// i2cBusは、ディスプレイのI2Cバス。バスクリアのためにピンを借りて返せるよ
+// う、設定を覚えておく。
+type i2cBus struct {
+	*machine.I2C
+	config machine.I2CConfig
+}
+
+// newI2CBus configures i2c and returns it as the display bus. It returns
+// the bus along with any error from Configure, since a bus clear
+// configures the peripheral again later.
+//
+// newI2CBusは、i2cを設定し、ディスプレイのバスとして返す。バスクリアで後
+// からペリフェラルを設定し直すので、Configureのエラーがあってもバスと一緒
+// に返す。
+func newI2CBus(i2c *machine.I2C, config machine.I2CConfig) (*i2cBus, error) {
+	err := i2c.Configure(config)
+	return &i2cBus{I2C: i2c, config: config}, err
+}
+
+// ClearBus frees a device holding SDA low, usually after a brown-out cut
+// it off in the middle of a byte. It clocks SCL up to nine times, until
+// the device lets go of SDA, then sends a STOP and configures the I2C
+// peripheral again. It satisfies app.BusClearer.
+//
+// ClearBusは、SDAをLowにしたままのデバイスを解放する。普通はブラウンアウ
+// トでバイトの途中で切れた後に起こる。デバイスがSDAを放すまでSCLを最大9回
+// 送り、STOPを送ってからI2Cペリフェラルを設定し直す。app.BusClearerを満た
+// す。
+func (b *i2cBus) ClearBus() error {
+	const halfClock = 5 * time.Microsecond // 100kHz
+	sda, scl := b.config.SDA, b.config.SCL
+
+	sda.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	scl.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	scl.High()
+	for i := 0; i < 9 && !sda.Get(); i++ {
+		scl.Low()
+		time.Sleep(halfClock)
+		scl.High()
+		time.Sleep(halfClock)
+	}
+	released := sda.Get()
+
+	// STOP: SDA rises while SCL is high.
+	// STOP：SCLがHighの間にSDAを上げる。
+	sda.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	scl.Low()
+	sda.Low()
+	time.Sleep(halfClock)
+	scl.High()
+	time.Sleep(halfClock)
+	sda.High()
+	time.Sleep(halfClock)
+
+	if err := b.I2C.Configure(b.config); err != nil {
+		return err
+	}
+	if !released {
+		return errBusStuck
+	}
+	return nil
+}
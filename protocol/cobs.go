@@ -0,0 +1,78 @@
+package protocol
+
+// cobsEncoder writes Consistent Overhead Byte Stuffing: the data is split
+// at each zero into blocks of at most 254 bytes, each led by a code byte
+// one more than its length, so the output never holds a zero.
+//
+// cobsEncoderは、COBS(Consistent Overhead Byte Stuffing)を書く。データを
+// 0ごとに最大254バイトのブロックに分け、それぞれの先頭にその長さに1を足し
+// たコードバイトを置く。これで出力には0が現れない。
+type cobsEncoder struct {
+	b []byte
+	// Index of the code byte of the current block.
+	// 現在のブロックのコードバイトの位置
+	code int
+}
+
+func newCOBSEncoder(b []byte) cobsEncoder {
+	return cobsEncoder{b: append(b, 0), code: len(b)}
+}
+
+func (e *cobsEncoder) write(p []byte) {
+	for _, c := range p {
+		if c == 0 {
+			e.next()
+			continue
+		}
+		e.b = append(e.b, c)
+		if len(e.b)-e.code == 0xFF {
+			e.next()
+		}
+	}
+}
+
+// next ends the current block and starts another.
+//
+// nextは、現在のブロックを終えて次のブロックを始める。
+func (e *cobsEncoder) next() {
+	e.b[e.code] = byte(len(e.b) - e.code)
+	e.code = len(e.b)
+	e.b = append(e.b, 0)
+}
+
+// finish ends the last block and returns the encoded bytes.
+//
+// finishは、最後のブロックを終えて符号化したバイト列を返す。
+func (e *cobsEncoder) finish() []byte {
+	e.b[e.code] = byte(len(e.b) - e.code)
+	return e.b
+}
+
+// cobsDecode decodes b in place and returns the decoded bytes.
+//
+// cobsDecodeは、bをその場で復号し、復号したバイト列を返す。
+func cobsDecode(b []byte) ([]byte, error) {
+	n := 0
+	for i := 0; i < len(b); {
+		code := int(b[i])
+		end := i + code
+		if code == 0 || end > len(b) {
+			return nil, ErrBadFrame
+		}
+		for i++; i < end; i++ {
+			if b[i] == 0 {
+				return nil, ErrBadFrame
+			}
+			b[n] = b[i]
+			n++
+		}
+		// A block shorter than 254 bytes stood for a zero, unless it is
+		// the last one.
+		// 254バイト未満のブロックは、最後のものでなければ0を表していた。
+		if code != 0xFF && i < len(b) {
+			b[n] = 0
+			n++
+		}
+	}
+	return b[:n], nil
+}
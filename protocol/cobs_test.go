@@ -0,0 +1,48 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+// COBSの論文やWikipediaの例
+func TestCOBS(t *testing.T) {
+	seq := func(from, to int) []byte {
+		b := make([]byte, 0, to-from+1)
+		for i := from; i <= to; i++ {
+			b = append(b, byte(i))
+		}
+		return b
+	}
+	testCases := []struct {
+		name    string
+		data    []byte
+		encoded []byte
+	}{
+		{name: "0が1つ", data: []byte{0}, encoded: []byte{1, 1}},
+		{name: "0が2つ", data: []byte{0, 0}, encoded: []byte{1, 1, 1}},
+		{name: "0の間", data: []byte{0, 0x11, 0}, encoded: []byte{1, 2, 0x11, 1}},
+		{name: "途中に0", data: []byte{0x11, 0x22, 0, 0x33}, encoded: []byte{3, 0x11, 0x22, 2, 0x33}},
+		{name: "0無し", data: []byte{0x11, 0x22, 0x33, 0x44}, encoded: []byte{5, 0x11, 0x22, 0x33, 0x44}},
+		{name: "254バイト", data: seq(1, 254), encoded: append(append([]byte{0xFF}, seq(1, 254)...), 1)},
+		{name: "255バイト", data: seq(1, 255), encoded: append(append([]byte{0xFF}, seq(1, 254)...), 2, 0xFF)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newCOBSEncoder(nil)
+			e.write(tc.data)
+			encoded := e.finish()
+			if !bytes.Equal(encoded, tc.encoded) {
+				t.Errorf("期待する符号は %x 、実際は %x で異なる", tc.encoded, encoded)
+			}
+			decoded, err := cobsDecode(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, tc.data) {
+				t.Errorf("期待する復号結果は %x 、実際は %x で異なる", tc.data, decoded)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package protocol
+
+// Demux splits a byte stream into text and frames. Outside a frame bytes
+// are text; a 0x00 starts a frame and the next 0x00 ends it, so frames
+// can be mixed with the lines of a text console. After a frame that does
+// not decode, the bytes up to the next 0x00 are taken as another frame
+// rather than text.
+//
+// A stray 0x00, such as from a UART break or line noise, must not swallow
+// the console. The second byte of a frame is its type, which is never
+// printable ASCII, CR or LF, so a "frame" of at least two such bytes that
+// reaches a CR or LF is a line of text: it goes to Text and the Demux
+// leaves the frame.
+//
+// Demuxは、バイトストリームをテキストとフレームに振り分ける。フレームの外
+// のバイトはテキストで、0x00がフレームを始め、次の0x00がそれを終える。こ
+// れでフレームをテキストのコンソールの行と混ぜられる。復号できないフレー
+// ムの後は、次の0x00までのバイトをテキストではなく別のフレームとみなす。
+//
+// UARTのブレークや回線のノイズなどによる迷い込んだ0x00で、コンソールが飲
+// み込まれてはならない。フレームの2バイト目は種類で、印字可能なASCII、
+// CR、LFには決してならない。そのため、そうしたバイトが2つ以上並んでCRか
+// LFに至った「フレーム」はテキストの行であり、Textに渡してフレームを抜け
+// る。
+type Demux struct {
+	// Text receives the runs of text between frames.
+	// Textは、フレームの間のテキストの並びを受け取る。
+	Text func(p []byte)
+	// Message receives each frame that decodes. The payload is only valid
+	// during the call.
+	// Messageは、復号できた各フレームを受け取る。ペイロードは呼び出しの間
+	// だけ有効。
+	Message func(m Message)
+
+	buf     []byte
+	inFrame bool
+	// Set when the current frame grew past MaxFrame.
+	// 現在のフレームがMaxFrameを超えたときに設定される。
+	overflow bool
+	dropped  uint32
+}
+
+// NewDemux creates a Demux passing text and messages to the given
+// functions.
+//
+// NewDemuxは、テキストとメッセージを指定した関数に渡すDemuxを作る。
+func NewDemux(text func(p []byte), message func(m Message)) *Demux {
+	return &Demux{Text: text, Message: message, buf: make([]byte, 0, MaxFrame)}
+}
+
+// Dropped returns the number of frames dropped because they did not
+// decode or were too long.
+//
+// Droppedは、復号できなかったり長すぎたりして捨てたフレームの数を返す。
+func (d *Demux) Dropped() uint32 {
+	return d.dropped
+}
+
+// Feed processes received bytes.
+//
+// Feedは、受信したバイト列を処理する。
+func (d *Demux) Feed(p []byte) {
+	text := 0
+	for i, c := range p {
+		if !d.inFrame {
+			if c == 0 {
+				d.text(p[text:i])
+				d.inFrame = true
+				d.buf = d.buf[:0]
+				d.overflow = false
+			}
+			continue
+		}
+		if c != 0 {
+			if (c == '\r' || c == '\n') && !d.overflow && isText(d.buf) {
+				d.inFrame = false
+				d.text(d.buf)
+				text = i
+				continue
+			}
+			if len(d.buf) == cap(d.buf) {
+				d.overflow = true
+				continue
+			}
+			d.buf = append(d.buf, c)
+			continue
+		}
+		// Repeated zeros, such as the leading delimiter after the end of
+		// the last frame, are not empty frames.
+		// 前のフレームの終わりに続く先頭の区切りのような連続した0は、空の
+		// フレームではない。
+		if len(d.buf) == 0 && !d.overflow {
+			continue
+		}
+		// A frame that does not decode was most likely cut short, and
+		// this zero leads the next one.
+		// 復号できないフレームはおそらく途中で切れたもので、この0は次のフ
+		// レームの先頭。
+		if d.frame() {
+			d.inFrame = false
+			text = i + 1
+		}
+		d.buf = d.buf[:0]
+		d.overflow = false
+	}
+	if !d.inFrame {
+		d.text(p[text:])
+	}
+}
+
+// isText reports whether b, buffered as a frame, is a line of text: at
+// least a code byte and a type, all printable ASCII, CR or LF.
+//
+// isTextは、フレームとしてバッファしたbがテキストの行かどうかを返す。少な
+// くともコードのバイトと種類があり、すべて印字可能なASCII、CR、LFであるこ
+// と。
+func isText(b []byte) bool {
+	if len(b) < 2 {
+		return false
+	}
+	for _, c := range b {
+		if (c < ' ' || c > '~') && c != '\r' && c != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Demux) text(p []byte) {
+	if len(p) > 0 && d.Text != nil {
+		d.Text(p)
+	}
+}
+
+// frame passes on the frame in buf and reports whether it decoded.
+//
+// frameは、bufのフレームを渡し、復号できたかどうかを返す。
+func (d *Demux) frame() bool {
+	if d.overflow {
+		d.dropped++
+		return false
+	}
+	m, err := DecodeFrame(d.buf)
+	if err != nil {
+		d.dropped++
+		return false
+	}
+	if d.Message != nil {
+		d.Message(m)
+	}
+	return true
+}
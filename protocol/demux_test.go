@@ -0,0 +1,106 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 受け取ったテキストとメッセージを記録するDemux
+type demuxLog struct {
+	text     bytes.Buffer
+	messages []Message
+}
+
+func newLoggedDemux() (*Demux, *demuxLog) {
+	l := &demuxLog{}
+	d := NewDemux(func(p []byte) { l.text.Write(p) }, func(m Message) {
+		m.Payload = append([]byte(nil), m.Payload...)
+		l.messages = append(l.messages, m)
+	})
+	return d, l
+}
+
+func frameOf(m Message) []byte {
+	b, _ := AppendFrame(nil, m)
+	return b
+}
+
+func TestDemux(t *testing.T) {
+	version := frameOf(Message{Type: TypeVersion, ID: 1})
+	faults := frameOf(Message{Type: TypeFaults, ID: 2})
+	broken := append([]byte(nil), faults...)
+	broken[3] ^= 0x10
+
+	testCases := []struct {
+		name     string
+		input    []byte
+		text     string
+		ids      []uint8
+		dropped  uint32
+		byteWise bool
+	}{
+		{name: "テキストだけ", input: []byte("get rpm\r\n"), text: "get rpm\r\n"},
+		{name: "フレームだけ", input: version, ids: []uint8{1}},
+		{name: "連続したフレーム", input: append(append([]byte(nil), version...), faults...), ids: []uint8{1, 2}},
+		{
+			name:  "テキストの間のフレーム",
+			input: append(append([]byte("get "), version...), "rpm\n"...),
+			text:  "get rpm\n", ids: []uint8{1},
+		},
+		{name: "1バイトずつ", input: append(append([]byte("a"), faults...), 'b'), text: "ab", ids: []uint8{2}, byteWise: true},
+		{name: "壊れたフレームは捨てる", input: append(append([]byte(nil), broken...), version...), ids: []uint8{1}, dropped: 1},
+		{name: "迷い込んだ0の後のテキスト", input: []byte("\x00get rpm\r\n"), text: "get rpm\r\n"},
+		{name: "迷い込んだ0の後のテキストを1バイトずつ", input: []byte("a\x00get rpm\r\nfault\n"), text: "aget rpm\r\nfault\n", byteWise: true},
+		{name: "迷い込んだ0の後の改行だけの行", input: []byte("\x00\r\nget rpm\r\n"), text: "\r\nget rpm\r\n"},
+		{name: "迷い込んだ0の後のフレーム", input: append([]byte("\x00get"), version...), ids: []uint8{1}, dropped: 1},
+		{name: "改行を含むフレーム", input: frameOf(Message{Type: TypeSetDuty, ID: '\n', Payload: []byte("a\r\n")}), ids: []uint8{'\n'}},
+		{name: "長すぎるフレームは捨てる", input: append(append([]byte{0}, bytes.Repeat([]byte{1}, MaxFrame)...), version...), ids: []uint8{1}, dropped: 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, l := newLoggedDemux()
+			if tc.byteWise {
+				for i := range tc.input {
+					d.Feed(tc.input[i : i+1])
+				}
+			} else {
+				d.Feed(tc.input)
+			}
+			if l.text.String() != tc.text {
+				t.Errorf("期待するテキストは %q 、実際は %q で異なる", tc.text, l.text.String())
+			}
+			if len(l.messages) != len(tc.ids) {
+				t.Fatalf("期待するメッセージの数は %d 、実際は %d で異なる", len(tc.ids), len(l.messages))
+			}
+			for i, m := range l.messages {
+				if m.ID != tc.ids[i] {
+					t.Errorf("期待するIDは %d 、実際は %d で異なる", tc.ids[i], m.ID)
+				}
+			}
+			if d.Dropped() != tc.dropped {
+				t.Errorf("期待する捨てたフレームの数は %d 、実際は %d で異なる", tc.dropped, d.Dropped())
+			}
+		})
+	}
+}
+
+// FuzzDemux checks that Demux never panics, and that after arbitrary
+// bytes and a 0x00, which always leaves the buffer empty, the next frame
+// gets through.
+func FuzzDemux(f *testing.F) {
+	f.Add([]byte("help\n"))
+	f.Add(frameOf(Message{Type: TypeFaults, ID: 9}))
+	f.Add([]byte{0, 0xFF, 0xFF})
+
+	last := frameOf(Message{Type: TypeVersion, ID: 42})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d, l := newLoggedDemux()
+		d.Feed(data)
+		d.Feed([]byte{0})
+		d.Feed(last)
+		if n := len(l.messages); n == 0 || l.messages[n-1].ID != 42 {
+			t.Errorf("最後のフレームが届いていない: %v", l.messages)
+		}
+	})
+}
@@ -0,0 +1,292 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"strconv"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/telemetry"
+)
+
+// VersionInfo is the reply to TypeVersion:
+//
+//	protocol(1) settings(1) name...
+//
+// VersionInfoは、TypeVersionへの返答。
+type VersionInfo struct {
+	// Version of this protocol and of the settings schema.
+	// このプロトコルと設定のスキーマのバージョン
+	Protocol, Settings uint8
+	// Name of the fan unit.
+	// ファンユニットの名前
+	Name string
+}
+
+// Append appends the payload of v to b.
+//
+// Appendは、vのペイロードをbに追加する。
+func (v VersionInfo) Append(b []byte) []byte {
+	return append(append(b, v.Protocol, v.Settings), v.Name...)
+}
+
+// ParseVersionInfo decodes the payload of a TypeVersion reply.
+//
+// ParseVersionInfoは、TypeVersionの返答のペイロードを復号する。
+func ParseVersionInfo(p []byte) (VersionInfo, error) {
+	if len(p) < 2 {
+		return VersionInfo{}, ErrBadPayload
+	}
+	return VersionInfo{Protocol: p[0], Settings: p[1], Name: string(p[2:])}, nil
+}
+
+// TelemetryRequest is the request of TypeTelemetry:
+//
+//	fields(2)
+//
+// TelemetryRequestは、TypeTelemetryのリクエスト。
+type TelemetryRequest struct {
+	Fields telemetry.Field
+}
+
+// Append appends the payload of r to b.
+//
+// Appendは、rのペイロードをbに追加する。
+func (r TelemetryRequest) Append(b []byte) []byte {
+	return binary.LittleEndian.AppendUint16(b, uint16(r.Fields))
+}
+
+// ParseTelemetryRequest decodes the payload of a TypeTelemetry request.
+//
+// ParseTelemetryRequestは、TypeTelemetryのリクエストのペイロードを復号す
+// る。
+func ParseTelemetryRequest(p []byte) (TelemetryRequest, error) {
+	if len(p) != 2 {
+		return TelemetryRequest{}, ErrBadPayload
+	}
+	f := telemetry.Field(binary.LittleEndian.Uint16(p))
+	if f&^telemetry.FieldAll != 0 {
+		return TelemetryRequest{}, ErrBadPayload
+	}
+	return TelemetryRequest{Fields: f}, nil
+}
+
+// ParseTelemetry decodes the payload of a TypeTelemetry reply and returns
+// the record and its fields.
+//
+// ParseTelemetryは、TypeTelemetryの返答のペイロードを復号し、レコードと
+// そのフィールドを返す。
+func ParseTelemetry(p []byte) (telemetry.Record, telemetry.Field, error) {
+	r, fields, err := telemetry.DecodeValues(p)
+	if err != nil {
+		return r, 0, ErrBadPayload
+	}
+	return r, fields, nil
+}
+
+// Duty is the request of TypeSetDuty, in duty units (0-fan.MaxDuty):
+//
+//	front(2) rear(2)
+//
+// Dutyは、TypeSetDutyのリクエスト。デューティ単位(0-fan.MaxDuty)。
+type Duty struct {
+	Front, Rear uint32
+}
+
+// Append appends the payload of d to b. Duties above fan.MaxDuty are
+// clamped.
+//
+// Appendは、dのペイロードをbに追加する。fan.MaxDutyを超えるデューティは
+// 制限する。
+func (d Duty) Append(b []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, uint16(min(d.Front, fan.MaxDuty)))
+	return binary.LittleEndian.AppendUint16(b, uint16(min(d.Rear, fan.MaxDuty)))
+}
+
+// ParseDuty decodes the payload of a TypeSetDuty request.
+//
+// ParseDutyは、TypeSetDutyのリクエストのペイロードを復号する。
+func ParseDuty(p []byte) (Duty, error) {
+	if len(p) != 4 {
+		return Duty{}, ErrBadPayload
+	}
+	d := Duty{
+		Front: uint32(binary.LittleEndian.Uint16(p)),
+		Rear:  uint32(binary.LittleEndian.Uint16(p[2:])),
+	}
+	if d.Front > fan.MaxDuty || d.Rear > fan.MaxDuty {
+		return Duty{}, ErrBadPayload
+	}
+	return d, nil
+}
+
+// ModeSetting is the request of TypeSetMode:
+//
+//	mode(1) target_rpm(2)
+//
+// ModeSettingは、TypeSetModeのリクエスト。
+type ModeSetting struct {
+	Mode control.Mode
+	// Target RPM of closed-loop mode.
+	// 閉ループモードの目標RPM
+	TargetRPM uint32
+}
+
+// Append appends the payload of s to b. Targets above 65535 RPM are
+// clamped.
+//
+// Appendは、sのペイロードをbに追加する。65535 RPMを超える目標は制限する。
+func (s ModeSetting) Append(b []byte) []byte {
+	return binary.LittleEndian.AppendUint16(append(b, byte(s.Mode)), uint16(min(s.TargetRPM, 0xFFFF)))
+}
+
+// ParseModeSetting decodes the payload of a TypeSetMode request.
+//
+// ParseModeSettingは、TypeSetModeのリクエストのペイロードを復号する。
+func ParseModeSetting(p []byte) (ModeSetting, error) {
+	if len(p) != 3 {
+		return ModeSetting{}, ErrBadPayload
+	}
+	mode := control.Mode(p[0])
+	if mode != control.ModeOpenLoop && mode != control.ModeClosedLoop {
+		return ModeSetting{}, ErrBadPayload
+	}
+	return ModeSetting{Mode: mode, TargetRPM: uint32(binary.LittleEndian.Uint16(p[1:]))}, nil
+}
+
+// ConfigFlags modify TypeWriteConfig.
+//
+// ConfigFlagsは、TypeWriteConfigの動作を変える。
+type ConfigFlags uint8
+
+// ConfigSave also saves the settings to the controller's storage.
+//
+// ConfigSaveは、設定をコントローラーの保存先にも保存する。
+const ConfigSave ConfigFlags = 1 << 0
+
+// WriteConfig is the request of TypeWriteConfig:
+//
+//	flags(1) settings...
+//
+// WriteConfigは、TypeWriteConfigのリクエスト。
+type WriteConfig struct {
+	Flags ConfigFlags
+	// Settings as encoded by settings.Settings.Marshal.
+	// settings.Settings.Marshalで符号化した設定
+	Settings []byte
+}
+
+// Append appends the payload of c to b.
+//
+// Appendは、cのペイロードをbに追加する。
+func (c WriteConfig) Append(b []byte) []byte {
+	return append(append(b, byte(c.Flags)), c.Settings...)
+}
+
+// ParseWriteConfig decodes the payload of a TypeWriteConfig request. The
+// settings share p's memory.
+//
+// ParseWriteConfigは、TypeWriteConfigのリクエストのペイロードを復号する。
+// 設定はpのメモリを共有する。
+func ParseWriteConfig(p []byte) (WriteConfig, error) {
+	if len(p) < 1 {
+		return WriteConfig{}, ErrBadPayload
+	}
+	return WriteConfig{Flags: ConfigFlags(p[0]), Settings: p[1:]}, nil
+}
+
+// Faults is the reply to TypeFaults:
+//
+//	front(1) rear(1)
+//
+// Faultsは、TypeFaultsへの返答。
+type Faults struct {
+	Front, Rear fan.Fault
+}
+
+// Append appends the payload of f to b.
+//
+// Appendは、fのペイロードをbに追加する。
+func (f Faults) Append(b []byte) []byte {
+	return append(b, byte(f.Front), byte(f.Rear))
+}
+
+// ParseFaults decodes the payload of a TypeFaults reply.
+//
+// ParseFaultsは、TypeFaultsの返答のペイロードを復号する。
+func ParseFaults(p []byte) (Faults, error) {
+	if len(p) != 2 {
+		return Faults{}, ErrBadPayload
+	}
+	return Faults{Front: fan.Fault(p[0]), Rear: fan.Fault(p[1])}, nil
+}
+
+// ErrorCode tells why a request failed.
+//
+// ErrorCodeは、リクエストが失敗した理由を表す。
+type ErrorCode uint8
+
+const (
+	// ErrCodeUnknownType: the type is not a known request.
+	// ErrCodeUnknownType: 種類が既知のリクエストではない。
+	ErrCodeUnknownType ErrorCode = 1 + iota
+	// ErrCodeBadPayload: the payload does not fit the type.
+	// ErrCodeBadPayload: ペイロードが種類に合わない。
+	ErrCodeBadPayload
+	// ErrCodeFailed: the request was understood but failed.
+	// ErrCodeFailed: リクエストは理解したが失敗した。
+	ErrCodeFailed
+)
+
+// String returns the name of the code.
+func (c ErrorCode) String() string {
+	switch c {
+	case ErrCodeUnknownType:
+		return "unknown type"
+	case ErrCodeBadPayload:
+		return "bad payload"
+	case ErrCodeFailed:
+		return "failed"
+	default:
+		return "code " + strconv.Itoa(int(c))
+	}
+}
+
+// ErrorReply is the payload of TypeError:
+//
+//	code(1) message...
+//
+// It is also the error returned for such a reply.
+//
+// ErrorReplyは、TypeErrorのペイロード。そのような返答に対して返すエラー
+// でもある。
+type ErrorReply struct {
+	Code    ErrorCode
+	Message string
+}
+
+// Error returns the code and message.
+func (e *ErrorReply) Error() string {
+	s := "protocol: " + e.Code.String()
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// Append appends the payload of e to b.
+//
+// Appendは、eのペイロードをbに追加する。
+func (e *ErrorReply) Append(b []byte) []byte {
+	return append(append(b, byte(e.Code)), e.Message...)
+}
+
+// ParseErrorReply decodes the payload of a TypeError reply.
+//
+// ParseErrorReplyは、TypeErrorの返答のペイロードを復号する。
+func ParseErrorReply(p []byte) (*ErrorReply, error) {
+	if len(p) < 1 {
+		return nil, ErrBadPayload
+	}
+	return &ErrorReply{Code: ErrorCode(p[0]), Message: string(p[1:])}, nil
+}
@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/telemetry"
+)
+
+func TestPayload_RoundTrip(t *testing.T) {
+	v, err := ParseVersionInfo(VersionInfo{Protocol: Version, Settings: 1, Name: "Typhoon"}.Append(nil))
+	if err != nil || v != (VersionInfo{Protocol: Version, Settings: 1, Name: "Typhoon"}) {
+		t.Errorf("バージョン: %+v, %v", v, err)
+	}
+
+	req, err := ParseTelemetryRequest(TelemetryRequest{Fields: telemetry.FieldFrontRPM | telemetry.FieldMode}.Append(nil))
+	if err != nil || req.Fields != telemetry.FieldFrontRPM|telemetry.FieldMode {
+		t.Errorf("テレメトリーのリクエスト: %+v, %v", req, err)
+	}
+
+	record := telemetry.Record{Time: 1500 * time.Millisecond, FrontRPM: 2400, Mode: control.ModeClosedLoop}
+	fields := telemetry.FieldTime | telemetry.FieldFrontRPM | telemetry.FieldMode
+	r, f, err := ParseTelemetry(telemetry.AppendValues(nil, record, fields))
+	if err != nil || r != record || f != fields {
+		t.Errorf("テレメトリー: %+v, %v, %v", r, f, err)
+	}
+
+	d, err := ParseDuty(Duty{Front: fan.MaxDuty, Rear: 1234}.Append(nil))
+	if err != nil || d != (Duty{Front: fan.MaxDuty, Rear: 1234}) {
+		t.Errorf("デューティ: %+v, %v", d, err)
+	}
+
+	m, err := ParseModeSetting(ModeSetting{Mode: control.ModeClosedLoop, TargetRPM: 2400}.Append(nil))
+	if err != nil || m != (ModeSetting{Mode: control.ModeClosedLoop, TargetRPM: 2400}) {
+		t.Errorf("モード: %+v, %v", m, err)
+	}
+
+	c, err := ParseWriteConfig(WriteConfig{Flags: ConfigSave, Settings: []byte{1, 2, 3}}.Append(nil))
+	if err != nil || c.Flags != ConfigSave || string(c.Settings) != "\x01\x02\x03" {
+		t.Errorf("設定: %+v, %v", c, err)
+	}
+
+	fl, err := ParseFaults(Faults{Front: fan.FaultNone, Rear: fan.FaultStalled}.Append(nil))
+	if err != nil || fl != (Faults{Front: fan.FaultNone, Rear: fan.FaultStalled}) {
+		t.Errorf("異常: %+v, %v", fl, err)
+	}
+
+	e, err := ParseErrorReply((&ErrorReply{Code: ErrCodeFailed, Message: "no storage"}).Append(nil))
+	if err != nil || *e != (ErrorReply{Code: ErrCodeFailed, Message: "no storage"}) {
+		t.Errorf("エラー: %+v, %v", e, err)
+	}
+	if e.Error() != "protocol: failed: no storage" {
+		t.Errorf("期待するエラーの文言は %q 、実際は %q で異なる", "protocol: failed: no storage", e.Error())
+	}
+}
+
+func TestPayload_Bad(t *testing.T) {
+	testCases := []struct {
+		name  string
+		parse func() error
+	}{
+		{name: "バージョンが短い", parse: func() error { _, err := ParseVersionInfo([]byte{1}); return err }},
+		{name: "知らないフィールド", parse: func() error { _, err := ParseTelemetryRequest([]byte{0, 0x80}); return err }},
+		{name: "値が足りない", parse: func() error { _, _, err := ParseTelemetry([]byte{0x02, 0, 0x60}); return err }},
+		{name: "デューティが大きすぎる", parse: func() error { _, err := ParseDuty([]byte{0x41, 0x9C, 0, 0}); return err }},
+		{name: "デューティが短い", parse: func() error { _, err := ParseDuty([]byte{0, 0, 0}); return err }},
+		{name: "知らないモード", parse: func() error { _, err := ParseModeSetting([]byte{2, 0, 0}); return err }},
+		{name: "設定のフラグが無い", parse: func() error { _, err := ParseWriteConfig(nil); return err }},
+		{name: "異常が長い", parse: func() error { _, err := ParseFaults([]byte{0, 0, 0}); return err }},
+		{name: "エラーのコードが無い", parse: func() error { _, err := ParseErrorReply(nil); return err }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.parse(); !errors.Is(err, ErrBadPayload) {
+				t.Errorf("期待するエラーは %v 、実際は %v で異なる", ErrBadPayload, err)
+			}
+		})
+	}
+}
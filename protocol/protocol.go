@@ -0,0 +1,222 @@
+// Package protocol is the binary host protocol of the fan controller,
+// shared by the firmware and host tools. Each message carries a type, a
+// request ID echoed by the reply, a payload and a CRC-16, and travels
+// COBS-encoded between 0x00 delimiters, so it can share the serial port
+// with the text console.
+//
+// protocolパッケージは、ファンコントローラーのバイナリのホストプロトコル
+// で、ファームウェアとホストのツールが共用する。各メッセージは種類、返答
+// がそのまま返すリクエストID、ペイロード、CRC-16を持ち、COBSで符号化して
+// 0x00の区切りの間に入れて送る。これでテキストのコンソールとシリアルポー
+// トを共有できる。
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/kou-tkbys/tk-fancon2/telemetry"
+)
+
+// Version is the protocol version reported by TypeVersion.
+//
+// Versionは、TypeVersionで報告するプロトコルのバージョン。
+const Version = 1
+
+// MaxPayload is the largest payload of a message.
+//
+// MaxPayloadは、メッセージのペイロードの最大長。
+const MaxPayload = 1024
+
+// MaxFrame is the largest encoded frame, delimiters included.
+//
+// MaxFrameは、区切りを含めた符号化後のフレームの最大長。
+const MaxFrame = 2 + headerSize + MaxPayload + crcSize + (headerSize+MaxPayload+crcSize)/254 + 1
+
+const (
+	headerSize = 2
+	crcSize    = 2
+)
+
+var (
+	// ErrBadFrame means the bytes are not a valid frame.
+	// ErrBadFrameは、バイト列が正しいフレームではないことを表す。
+	ErrBadFrame = errors.New("protocol: bad frame")
+	// ErrBadCRC means the frame failed its CRC.
+	// ErrBadCRCは、フレームがCRCの検査に通らないことを表す。
+	ErrBadCRC = errors.New("protocol: bad crc")
+	// ErrTooLarge means the payload is longer than MaxPayload.
+	// ErrTooLargeは、ペイロードがMaxPayloadより長いことを表す。
+	ErrTooLarge = errors.New("protocol: payload too large")
+	// ErrBadPayload means the payload does not fit the message type.
+	// ErrBadPayloadは、ペイロードがメッセージの種類に合わないことを表す。
+	ErrBadPayload = errors.New("protocol: bad payload")
+)
+
+// Type is the type of a message. A reply has the type of its request, or
+// TypeError if it failed, with Reply set. No type may be printable ASCII,
+// CR or LF, which is how Demux tells a frame from a line of text.
+//
+// Typeは、メッセージの種類。返答はリクエストの種類(失敗したならTypeError)
+// にReplyを立てたもの。どの種類も印字可能なASCII、CR、LFであってはならな
+// い。Demuxはこれでフレームとテキストの行を見分ける。
+type Type uint8
+
+const (
+	// TypeVersion asks for the versions. Reply: VersionInfo.
+	// TypeVersionは、バージョンを問い合わせる。返答：VersionInfo。
+	TypeVersion Type = 0x01
+	// TypeTelemetry asks for a telemetry record. Request: the fields (2
+	// bytes). Reply: the values as written by telemetry.AppendValues.
+	// TypeTelemetryは、テレメトリーのレコードを問い合わせる。リクエスト：
+	// フィールド(2バイト)。返答：telemetry.AppendValuesが書く形式の値。
+	TypeTelemetry Type = 0x02
+	// TypeSetDuty drives the fans at fixed duties. Request: Duty.
+	// TypeSetDutyは、固定のデューティでファンを駆動する。リクエスト：Duty。
+	TypeSetDuty Type = 0x03
+	// TypeSetMode switches the control mode. Request: ModeSetting.
+	// TypeSetModeは、制御モードを切り替える。リクエスト：ModeSetting。
+	TypeSetMode Type = 0x04
+	// TypeReadConfig asks for the settings. Reply: the settings as
+	// encoded by settings.Settings.Marshal.
+	// TypeReadConfigは、設定を問い合わせる。返答：
+	// settings.Settings.Marshalで符号化した設定。
+	TypeReadConfig Type = 0x05
+	// TypeWriteConfig puts settings into effect. Request: ConfigFlags
+	// (1 byte), then the settings as encoded by settings.Settings.Marshal.
+	// TypeWriteConfigは、設定を反映する。リクエスト：ConfigFlags(1バイト)
+	// の後に、settings.Settings.Marshalで符号化した設定。
+	TypeWriteConfig Type = 0x06
+	// TypeFaults asks for the fan faults. Reply: Faults.
+	// TypeFaultsは、ファンの異常を問い合わせる。返答：Faults。
+	TypeFaults Type = 0x07
+	// TypeClearFaults drops all raised faults.
+	// TypeClearFaultsは、立っているすべての異常を下ろす。
+	TypeClearFaults Type = 0x08
+	// TypeCalibrate runs the characterization sweep of both rotors and
+	// replies once it is done, which takes minutes, or with an error if a
+	// fan fault stops it. The results are then in the settings.
+	// TypeCalibrateは、両方のローターの特性測定のスイープを実行し、終わっ
+	// たら返答する。数分かかる。ファンの異常で止まればエラーを返す。結果
+	// はその後、設定に入っている。
+	TypeCalibrate Type = 0x09
+
+	// TypeError is the reply to a request that failed. Payload:
+	// ErrorReply.
+	// TypeErrorは、失敗したリクエストへの返答。ペイロード：ErrorReply。
+	TypeError Type = 0x7F
+
+	// Reply is set in the type of a reply.
+	// Replyは、返答の種類に立てる。
+	Reply Type = 0x80
+)
+
+// String returns the name of the type.
+func (t Type) String() string {
+	name := "unknown"
+	switch t &^ Reply {
+	case TypeVersion:
+		name = "version"
+	case TypeTelemetry:
+		name = "telemetry"
+	case TypeSetDuty:
+		name = "set-duty"
+	case TypeSetMode:
+		name = "set-mode"
+	case TypeReadConfig:
+		name = "read-config"
+	case TypeWriteConfig:
+		name = "write-config"
+	case TypeFaults:
+		name = "faults"
+	case TypeClearFaults:
+		name = "clear-faults"
+	case TypeCalibrate:
+		name = "calibrate"
+	case TypeError:
+		name = "error"
+	}
+	if t&Reply != 0 {
+		name += "-reply"
+	}
+	return name
+}
+
+// Message is one request or reply.
+//
+// Messageは、1つのリクエストか返答。
+type Message struct {
+	Type Type
+	// Chosen by the requester and echoed by the reply, to match them up.
+	// リクエスト側が選び、返答がそのまま返す。両者を対応付けるため。
+	ID      uint8
+	Payload []byte
+}
+
+// ReplyTo returns the reply to m with the given payload.
+//
+// ReplyToは、mへの指定したペイロードの返答を返す。
+func ReplyTo(m Message, payload []byte) Message {
+	return Message{Type: m.Type | Reply, ID: m.ID, Payload: payload}
+}
+
+// ErrorTo returns the TypeError reply to m, with the payload of e
+// appended to buf.
+//
+// ErrorToは、mへのTypeErrorの返答を返す。ペイロードはeをbufに追加したも
+// の。
+func ErrorTo(m Message, e *ErrorReply, buf []byte) Message {
+	return Message{Type: TypeError | Reply, ID: m.ID, Payload: e.Append(buf)}
+}
+
+// AppendFrame appends m to b as a frame:
+//
+//	0x00 COBS(type id payload... CRC-16(2)) 0x00
+//
+// The CRC-16/CCITT covers type to the end of the payload and is
+// little-endian. The leading 0x00 ends any text or partial frame before
+// it.
+//
+// AppendFrameは、mをフレームとしてbに追加する。CRC-16/CCITTはtypeから
+// ペイロードの最後までにかかり、リトルエンディアン。先頭の0x00は、その前
+// のテキストや途中までのフレームを終わらせる。
+func AppendFrame(b []byte, m Message) ([]byte, error) {
+	if len(m.Payload) > MaxPayload {
+		return b, ErrTooLarge
+	}
+	head := [headerSize]byte{byte(m.Type), m.ID}
+	crc := telemetry.UpdateCRC16(telemetry.CRC16(head[:]), m.Payload)
+	var tail [crcSize]byte
+	binary.LittleEndian.PutUint16(tail[:], crc)
+
+	b = append(b, 0)
+	e := newCOBSEncoder(b)
+	e.write(head[:])
+	e.write(m.Payload)
+	e.write(tail[:])
+	b = e.finish()
+	return append(b, 0), nil
+}
+
+// DecodeFrame decodes one frame without its 0x00 delimiters. It decodes
+// in place, so the payload of the message shares frame's memory.
+//
+// DecodeFrameは、0x00の区切りを除いたフレームを1つ復号する。その場で復
+// 号するので、メッセージのペイロードはframeのメモリを共有する。
+func DecodeFrame(frame []byte) (Message, error) {
+	b, err := cobsDecode(frame)
+	if err != nil {
+		return Message{}, err
+	}
+	if len(b) < headerSize+crcSize {
+		return Message{}, ErrBadFrame
+	}
+	body := b[:len(b)-crcSize]
+	if binary.LittleEndian.Uint16(b[len(body):]) != telemetry.CRC16(body) {
+		return Message{}, ErrBadCRC
+	}
+	if len(body)-headerSize > MaxPayload {
+		return Message{}, ErrTooLarge
+	}
+	return Message{Type: Type(body[0]), ID: body[1], Payload: body[headerSize:]}, nil
+}
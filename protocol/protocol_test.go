@@ -0,0 +1,141 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Note: tinygo test ./protocol
+
+func TestFrame_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name string
+		msg  Message
+	}{
+		{name: "ペイロード無し", msg: Message{Type: TypeVersion, ID: 1}},
+		{name: "0を含む", msg: Message{Type: TypeSetDuty, ID: 0, Payload: []byte{0, 0, 0x40, 0x9C}}},
+		{name: "返答", msg: Message{Type: TypeFaults | Reply, ID: 255, Payload: []byte{1, 0}}},
+		{name: "254バイトの並び", msg: Message{Type: TypeWriteConfig, ID: 7, Payload: bytes.Repeat([]byte{0xAA}, 252)}},
+		{name: "最大長", msg: Message{Type: TypeReadConfig | Reply, ID: 9, Payload: bytes.Repeat([]byte{1, 0, 2}, MaxPayload/3)}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			frame, err := AppendFrame(nil, tc.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(frame) > MaxFrame {
+				t.Errorf("フレームの長さ %d は MaxFrame %d を超えている", len(frame), MaxFrame)
+			}
+			if frame[0] != 0 || frame[len(frame)-1] != 0 || bytes.IndexByte(frame[1:len(frame)-1], 0) >= 0 {
+				t.Fatalf("0は両端の区切りだけのはず: %x", frame)
+			}
+			got, err := DecodeFrame(frame[1 : len(frame)-1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != tc.msg.Type || got.ID != tc.msg.ID || !bytes.Equal(got.Payload, tc.msg.Payload) {
+				t.Errorf("期待するメッセージは %v 、実際は %v で異なる", tc.msg, got)
+			}
+		})
+	}
+}
+
+func TestAppendFrame_TooLarge(t *testing.T) {
+	_, err := AppendFrame(nil, Message{Type: TypeWriteConfig, Payload: make([]byte, MaxPayload+1)})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("期待するエラーは %v 、実際は %v で異なる", ErrTooLarge, err)
+	}
+}
+
+func TestDecodeFrame_Errors(t *testing.T) {
+	frame, _ := AppendFrame(nil, Message{Type: TypeSetMode, ID: 3, Payload: []byte{1, 0x60, 0x09}})
+	body := frame[1 : len(frame)-1]
+	flipped := append([]byte(nil), body...)
+	flipped[4] ^= 0x01
+
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{name: "空", data: nil, expected: ErrBadFrame},
+		{name: "短すぎる", data: []byte{0x04, 1, 2, 3}, expected: ErrBadFrame},
+		{name: "コードがはみ出す", data: body[:len(body)-1], expected: ErrBadFrame},
+		{name: "途中に0", data: []byte{0x03, 1, 0, 0x01}, expected: ErrBadFrame},
+		{name: "ビット化け", data: flipped, expected: ErrBadCRC},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := append([]byte(nil), tc.data...)
+			if _, err := DecodeFrame(data); !errors.Is(err, tc.expected) {
+				t.Errorf("期待するエラーは %v 、実際は %v で異なる", tc.expected, err)
+			}
+		})
+	}
+}
+
+// FuzzDecodeFrame checks that DecodeFrame never panics on arbitrary
+// bytes, and that anything it accepts encodes back to the same message.
+func FuzzDecodeFrame(f *testing.F) {
+	for _, m := range []Message{
+		{Type: TypeVersion, ID: 1},
+		{Type: TypeSetDuty, ID: 2, Payload: Duty{Front: 12000, Rear: 0}.Append(nil)},
+		{Type: TypeError | Reply, ID: 3, Payload: []byte{byte(ErrCodeFailed), 'n', 'o'}},
+	} {
+		frame, _ := AppendFrame(nil, m)
+		f.Add(frame[1 : len(frame)-1])
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0xFF})
+	f.Add([]byte{0x01, 0x01, 0x01})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := DecodeFrame(append([]byte(nil), data...))
+		if err != nil {
+			return
+		}
+		frame, err := AppendFrame(nil, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := DecodeFrame(frame[1 : len(frame)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.Type != m.Type || again.ID != m.ID || !bytes.Equal(again.Payload, m.Payload) {
+			t.Errorf("期待するメッセージは %v 、実際は %v で異なる", m, again)
+		}
+	})
+}
+
+func TestType_String(t *testing.T) {
+	testCases := []struct {
+		typ      Type
+		expected string
+	}{
+		{typ: TypeSetDuty, expected: "set-duty"},
+		{typ: TypeTelemetry | Reply, expected: "telemetry-reply"},
+		{typ: TypeError | Reply, expected: "error-reply"},
+		{typ: 0x42, expected: "unknown"},
+	}
+
+	for _, tc := range testCases {
+		if got := tc.typ.String(); got != tc.expected {
+			t.Errorf("期待する名前は %s 、実際は %s で異なる", tc.expected, got)
+		}
+	}
+}
+
+// ExampleAppendFrame shows the bytes of a request on the wire.
+//
+// ExampleAppendFrameは、通信路上のリクエストのバイト列を示す。
+func ExampleAppendFrame() {
+	frame, _ := AppendFrame(nil, Message{Type: TypeSetDuty, ID: 1, Payload: Duty{Front: 20000, Rear: 20000}.Append(nil)})
+	fmt.Printf("% x\n", frame)
+	// Output: 00 09 03 01 20 4e 20 4e af f4 00
+}
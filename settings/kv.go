@@ -0,0 +1,133 @@
+package settings
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// encoder appends key/value pairs. The first error sticks.
+//
+// encoderは、キーと値の組を追加していく。最初のエラーが残る。
+type encoder struct {
+	buf []byte
+	err error
+}
+
+func (e *encoder) put(key string, value []byte) {
+	if len(key) > 0xFF || len(value) > 0xFF {
+		e.err = ErrTooLarge
+		return
+	}
+	e.buf = append(e.buf, byte(len(key)))
+	e.buf = append(e.buf, key...)
+	e.buf = append(e.buf, byte(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *encoder) u32(key string, v uint32) {
+	e.put(key, binary.LittleEndian.AppendUint32(nil, v))
+}
+
+func (e *encoder) f32(key string, v float32) {
+	e.u32(key, math.Float32bits(v))
+}
+
+// profile stores the four fields of p.
+func (e *encoder) profile(key string, p fan.Profile) {
+	v := make([]byte, 0, 16)
+	for _, x := range [...]uint32{p.PulsesPerRevolution, p.MaxRPM, p.MinStartDuty, p.StallRPM} {
+		v = binary.LittleEndian.AppendUint32(v, x)
+	}
+	e.put(key, v)
+}
+
+// calibration stores the summary of c followed by its points.
+func (e *encoder) calibration(key string, c *fan.Characterization) {
+	if c == nil {
+		return
+	}
+	v := make([]byte, 0, calSummarySize+len(c.Points)*calPointSize)
+	for _, x := range [...]uint32{c.MinStartDuty, c.MinSustainDuty, c.MaxRPM, c.PPR, c.SuggestedPPR} {
+		v = binary.LittleEndian.AppendUint32(v, x)
+	}
+	v = append(v, byte(c.Checks))
+	for _, p := range c.Points {
+		v = binary.LittleEndian.AppendUint32(v, p.Duty)
+		v = binary.LittleEndian.AppendUint32(v, p.RPM)
+	}
+	e.put(key, v)
+}
+
+const (
+	// Five uint32 values and the checks.
+	// uint32の値5つと確認結果
+	calSummarySize = 21
+	// Duty and RPM.
+	// デューティとRPM
+	calPointSize = 8
+)
+
+// decode splits the key/value pairs of data into a map.
+//
+// decodeは、dataのキーと値の組をmapに分ける。
+func decode(data []byte) (map[string][]byte, error) {
+	kv := make(map[string][]byte)
+	for len(data) > 0 {
+		n := int(data[0])
+		if len(data) < 2+n {
+			return nil, ErrCorrupt
+		}
+		key := string(data[1 : 1+n])
+		data = data[1+n:]
+		m := int(data[0])
+		if len(data) < 1+m {
+			return nil, ErrCorrupt
+		}
+		kv[key] = data[1 : 1+m]
+		data = data[1+m:]
+	}
+	return kv, nil
+}
+
+func getU32(kv map[string][]byte, key string) (uint32, bool) {
+	v, ok := kv[key]
+	if !ok || len(v) != 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(v), true
+}
+
+func getProfile(kv map[string][]byte, key string, p *fan.Profile) {
+	v, ok := kv[key]
+	if !ok || len(v) != 16 {
+		return
+	}
+	p.PulsesPerRevolution = binary.LittleEndian.Uint32(v[0:])
+	p.MaxRPM = binary.LittleEndian.Uint32(v[4:])
+	p.MinStartDuty = binary.LittleEndian.Uint32(v[8:])
+	p.StallRPM = binary.LittleEndian.Uint32(v[12:])
+}
+
+func getCalibration(kv map[string][]byte, key string, c **fan.Characterization) {
+	v, ok := kv[key]
+	if !ok || len(v) < calSummarySize || (len(v)-calSummarySize)%calPointSize != 0 {
+		return
+	}
+	r := &fan.Characterization{
+		MinStartDuty:   binary.LittleEndian.Uint32(v[0:]),
+		MinSustainDuty: binary.LittleEndian.Uint32(v[4:]),
+		MaxRPM:         binary.LittleEndian.Uint32(v[8:]),
+		PPR:            binary.LittleEndian.Uint32(v[12:]),
+		SuggestedPPR:   binary.LittleEndian.Uint32(v[16:]),
+		Checks:         fan.Check(v[20]),
+	}
+	points := v[calSummarySize:]
+	r.Points = make([]fan.SweepPoint, len(points)/calPointSize)
+	for i := range r.Points {
+		r.Points[i].Duty = binary.LittleEndian.Uint32(points[i*calPointSize:])
+		r.Points[i].RPM = binary.LittleEndian.Uint32(points[i*calPointSize+4:])
+	}
+	*c = r
+}
@@ -0,0 +1,286 @@
+package settings
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// BlockDevice is a NOR flash region. Erased bytes read as 0xFF, writes can
+// only clear bits, and erases work on whole blocks. It matches TinyGo's
+// machine.BlockDevice, so machine.Flash can be used directly.
+//
+// BlockDeviceは、NORフラッシュの領域。消去されたバイトは0xFFと読め、書き
+// 込みはビットを落とすことしかできず、消去はブロック単位で行う。TinyGoの
+// machine.BlockDeviceと同じなので、machine.Flashをそのまま使える。
+type BlockDevice interface {
+	ReadAt(p []byte, off int64) (n int, err error)
+	WriteAt(p []byte, off int64) (n int, err error)
+	Size() int64
+	WriteBlockSize() int64
+	EraseBlockSize() int64
+	// EraseBlocks erases length blocks starting at block start.
+	// EraseBlocksは、startブロックからlength個のブロックを消去する。
+	EraseBlocks(start, length int64) error
+}
+
+var (
+	// ErrTooLarge is returned when a record does not fit in one sector.
+	// ErrTooLargeは、レコードが1セクターに収まらないときに返す。
+	ErrTooLarge = errors.New("settings: record too large")
+	// ErrNoSpace is returned when the device has fewer than two sectors.
+	// ErrNoSpaceは、デバイスのセクターが2つ未満のときに返す。
+	ErrNoSpace = errors.New("settings: not enough flash")
+	// ErrVerify is returned when a record reads back differently from
+	// what was written.
+	// ErrVerifyは、書き込んだレコードを読み戻した内容が異なるときに返す。
+	ErrVerify = errors.New("settings: verify failed")
+)
+
+const (
+	recordMagic = 0x5453 // "TS"
+	// magic(2) + length(2) + sequence(4) + CRC-32(4)
+	headerSize = 12
+)
+
+// LogStore is a wear-levelled, log-structured Storage on a BlockDevice.
+// Each Save appends a new record after the previous one, and only when a
+// sector is full is the next one erased, so the erases rotate through all
+// sectors. A record torn by a power loss fails its CRC and is skipped, so
+// Load returns the last complete record.
+//
+// LogStoreは、BlockDevice上の、ウェアレベリングを行うログ構造のStorage。
+// Saveのたびに前のレコードの後ろへ新しいレコードを追記し、セクターが一杯
+// になったときだけ次のセクターを消去する。これで消去はすべてのセクターを
+// 順に回る。電源断で途切れたレコードはCRCで弾かれて飛ばされるので、Load
+// は最後に完全に書けたレコードを返す。
+type LogStore struct {
+	dev BlockDevice
+	// Offset and number of the sectors used.
+	// 使うセクターの先頭オフセットと数
+	base    int64
+	sectors int64
+	// Sector and write block sizes of the device.
+	// デバイスのセクターと書き込みブロックの大きさ
+	sectorSize, writeSize int64
+
+	mounted bool
+	// Sequence number of the latest record.
+	// 最新のレコードの通し番号
+	seq uint32
+	// Offset of the latest record, or -1 if there is none.
+	// 最新のレコードのオフセット。無ければ-1。
+	latest int64
+	// Sector being appended to, or -1 before the first record, and the
+	// offset of the next record in it.
+	// 追記中のセクター(最初のレコードの前は-1)と、その中の次のレコードの
+	// オフセット
+	sector int64
+	next   int64
+}
+
+// NewLogStore creates a LogStore on the first sectors erase blocks of dev.
+// At least two sectors are used, so the latest record always survives
+// the erase of the next sector; on a smaller device Load and Save return
+// ErrNoSpace.
+//
+// NewLogStoreは、devの先頭sectors個の消去ブロックにLogStoreを作る。最低
+// でも2セクター使う。これで次のセクターを消去しても、最新のレコードは必
+// ず残る。それより小さいデバイスでは、LoadとSaveはErrNoSpaceを返す。
+func NewLogStore(dev BlockDevice, sectors int) *LogStore {
+	if sectors < 2 {
+		sectors = 2
+	}
+	s := &LogStore{
+		dev:        dev,
+		sectors:    int64(sectors),
+		sectorSize: dev.EraseBlockSize(),
+		writeSize:  dev.WriteBlockSize(),
+	}
+	if s.writeSize < 1 {
+		s.writeSize = 1
+	}
+	if max := dev.Size() / s.sectorSize; s.sectors > max {
+		s.sectors = max
+	}
+	if s.sectors < 2 {
+		s.sectors = 0
+	}
+	return s
+}
+
+// Load returns the payload of the latest complete record.
+//
+// Loadは、最新の完全なレコードの内容を返す。
+func (s *LogStore) Load() ([]byte, error) {
+	if err := s.mount(); err != nil {
+		return nil, err
+	}
+	if s.latest < 0 {
+		return nil, ErrNotFound
+	}
+	data, ok, err := s.readRecord(s.latest)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
+
+// Save appends data as a new record, erasing the next sector first when
+// the current one is full.
+//
+// Saveは、dataを新しいレコードとして追記する。現在のセクターが一杯なら、
+// 先に次のセクターを消去する。
+func (s *LogStore) Save(data []byte) error {
+	size := s.recordSize(len(data))
+	if len(data) > 0xFFFF || size > s.sectorSize {
+		return ErrTooLarge
+	}
+	if err := s.mount(); err != nil {
+		return err
+	}
+
+	if s.sector < 0 || s.next+size > s.sectorSize {
+		sector := (s.sector + 1) % s.sectors
+		if err := s.dev.EraseBlocks(s.base/s.sectorSize+sector, 1); err != nil {
+			return err
+		}
+		s.sector, s.next = sector, 0
+	}
+
+	off := s.base + s.sector*s.sectorSize + s.next
+	rec := s.encodeRecord(s.seq+1, data, size)
+	// Whatever happens now, this part of the sector is used.
+	// この後何が起きても、セクターのこの部分は使用済みになる。
+	s.next += size
+	if _, err := s.dev.WriteAt(rec, off); err != nil {
+		return err
+	}
+	if got, ok, err := s.readRecord(off); err != nil {
+		return err
+	} else if !ok || string(got) != string(data) {
+		return ErrVerify
+	}
+	s.seq++
+	s.latest = off
+	return nil
+}
+
+// recordSize returns the space taken by a record of n bytes, rounded up
+// to whole write blocks.
+func (s *LogStore) recordSize(n int) int64 {
+	size := int64(headerSize + n)
+	return (size + s.writeSize - 1) / s.writeSize * s.writeSize
+}
+
+// encodeRecord builds a record padded with 0xFF to size.
+func (s *LogStore) encodeRecord(seq uint32, data []byte, size int64) []byte {
+	rec := make([]byte, size)
+	binary.LittleEndian.PutUint16(rec[0:], recordMagic)
+	binary.LittleEndian.PutUint16(rec[2:], uint16(len(data)))
+	binary.LittleEndian.PutUint32(rec[4:], seq)
+	copy(rec[headerSize:], data)
+	binary.LittleEndian.PutUint32(rec[8:], recordCRC(rec[2:8], data))
+	for i := headerSize + len(data); i < len(rec); i++ {
+		rec[i] = 0xFF
+	}
+	return rec
+}
+
+// recordCRC returns the CRC-32 of the length, sequence number and data.
+func recordCRC(header, data []byte) uint32 {
+	crc := crc32.Update(0, crc32.IEEETable, header)
+	return crc32.Update(crc, crc32.IEEETable, data)
+}
+
+// readHeader reads the header at off. erased reports an unwritten header.
+func (s *LogStore) readHeader(off int64) (length int, seq uint32, erased, ok bool, err error) {
+	var h [headerSize]byte
+	if _, err := s.dev.ReadAt(h[:], off); err != nil {
+		return 0, 0, false, false, err
+	}
+	erased = true
+	for _, b := range h {
+		if b != 0xFF {
+			erased = false
+			break
+		}
+	}
+	length = int(binary.LittleEndian.Uint16(h[2:]))
+	seq = binary.LittleEndian.Uint32(h[4:])
+	ok = binary.LittleEndian.Uint16(h[0:]) == recordMagic
+	return length, seq, erased, ok, nil
+}
+
+// readRecord reads the record at off and reports whether it is complete.
+func (s *LogStore) readRecord(off int64) ([]byte, bool, error) {
+	length, _, _, ok, err := s.readHeader(off)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	if off%s.sectorSize+s.recordSize(length) > s.sectorSize {
+		return nil, false, nil
+	}
+	buf := make([]byte, headerSize+length)
+	if _, err := s.dev.ReadAt(buf, off); err != nil {
+		return nil, false, err
+	}
+	data := buf[headerSize:]
+	if binary.LittleEndian.Uint32(buf[8:]) != recordCRC(buf[2:8], data) {
+		return nil, false, nil
+	}
+	return data, true, nil
+}
+
+// mount scans all sectors once for the latest complete record and where
+// to append the next one.
+//
+// mountは、全セクターを一度走査し、最新の完全なレコードと次のレコードを
+// 追記する位置を探す。
+func (s *LogStore) mount() error {
+	if s.mounted {
+		return nil
+	}
+	if s.sectors == 0 {
+		return ErrNoSpace
+	}
+	s.seq, s.latest, s.sector, s.next = 0, -1, -1, 0
+
+	for sector := int64(0); sector < s.sectors; sector++ {
+		start := s.base + sector*s.sectorSize
+		off := int64(0)
+		for off+headerSize <= s.sectorSize {
+			length, seq, erased, _, err := s.readHeader(start + off)
+			if err != nil {
+				return err
+			}
+			if erased {
+				break
+			}
+			_, ok, err := s.readRecord(start + off)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				// A torn record: nothing after it can be trusted, so
+				// this sector takes no more records.
+				// 途切れたレコード。その後ろは信用できないので、このセク
+				// ターにはもう追記しない。
+				off = s.sectorSize
+				break
+			}
+			if s.latest < 0 || seq > s.seq {
+				s.seq, s.latest, s.sector = seq, start+off, sector
+			}
+			off += s.recordSize(length)
+		}
+		if sector == s.sector {
+			s.next = off
+		}
+	}
+	s.mounted = true
+	return nil
+}
@@ -0,0 +1,159 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// Note: tinygo test ./settings
+
+// 256バイトのセクター4つ、16バイト単位で書き込む小さなフラッシュ
+func newTestFlash() *MemFlash {
+	return NewMemFlash(4*256, 16, 256)
+}
+
+// 1レコードが64バイトになる内容
+func payload(name string) []byte {
+	return []byte(fmt.Sprintf("%-40s", name))
+}
+
+func TestLogStore_SaveLoad(t *testing.T) {
+	flash := newTestFlash()
+	st := NewLogStore(flash, 4)
+
+	if _, err := st.Load(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("期待するエラーは %v 、実際は %v で異なる", ErrNotFound, err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := st.Save(payload(fmt.Sprint("v", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 作り直しても(再起動しても)最新の内容が読める
+	for _, s := range []*LogStore{st, NewLogStore(flash, 4)} {
+		got, err := s.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(payload("v9")) {
+			t.Errorf("期待する内容は %q 、実際は %q で異なる", payload("v9"), got)
+		}
+	}
+}
+
+// 消去はすべてのセクターに均等に回る
+func TestLogStore_WearLevelling(t *testing.T) {
+	flash := newTestFlash()
+	st := NewLogStore(flash, 4)
+	for i := 0; i < 1000; i++ {
+		if err := st.Save(payload(fmt.Sprint("v", i))); err != nil {
+			t.Fatal(err)
+		}
+		// ときどき再起動する
+		if i%37 == 0 {
+			st = NewLogStore(flash, 4)
+		}
+	}
+
+	// 4レコード/セクターなので、1000回で250回消去する
+	total := 0
+	min, max := flash.EraseCount(0), flash.EraseCount(0)
+	for b := int64(0); b < 4; b++ {
+		n := flash.EraseCount(b)
+		total += n
+		if n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+	if total != 250 {
+		t.Errorf("期待する消去回数の合計は 250 、実際は %d で異なる", total)
+	}
+	if max-min > 1 {
+		t.Errorf("消去回数の偏りが大きい：最小 %d 、最大 %d", min, max)
+	}
+}
+
+func TestLogStore_Errors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		flash    *MemFlash
+		data     []byte
+		expected error
+	}{
+		{name: "セクターに収まらない", flash: newTestFlash(), data: make([]byte, 256), expected: ErrTooLarge},
+		{name: "フラッシュが小さすぎる", flash: NewMemFlash(256, 16, 256), data: payload("v"), expected: ErrNoSpace},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			st := NewLogStore(tc.flash, 4)
+			if err := st.Save(tc.data); !errors.Is(err, tc.expected) {
+				t.Errorf("期待するエラーは %v 、実際は %v で異なる", tc.expected, err)
+			}
+		})
+	}
+}
+
+// 書き込みや消去のどこで電源が切れても、直前か新しい内容のどちらかが読め、
+// その後の保存も成功する
+func TestLogStore_PowerLoss(t *testing.T) {
+	// 4レコード/セクターなので、セクターの切り替え(消去)を何度かまたぐ
+	for saved := 0; saved < 10; saved++ {
+		// 消去(256バイト)と書き込み(64バイト)のすべての位置
+		for cut := 0; cut <= 256+64; cut++ {
+			flash := newTestFlash()
+			st := NewLogStore(flash, 4)
+			for i := 0; i < saved; i++ {
+				if err := st.Save(payload(fmt.Sprint("v", i))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			flash.CutPowerAfter(cut)
+			st.Save(payload("new"))
+			flash.RestorePower()
+
+			st = NewLogStore(flash, 4)
+			got, err := st.Load()
+			old := payload(fmt.Sprint("v", saved-1))
+			switch {
+			case err == nil && (string(got) == string(payload("new")) || (saved > 0 && string(got) == string(old))):
+			case errors.Is(err, ErrNotFound) && saved == 0:
+			default:
+				t.Fatalf("保存 %d 回、%d バイト目で電源断：読めた内容は %q 、エラーは %v", saved, cut, got, err)
+			}
+
+			if err := st.Save(payload("after")); err != nil {
+				t.Fatalf("保存 %d 回、%d バイト目で電源断：その後の保存に失敗した: %v", saved, cut, err)
+			}
+			got, err = NewLogStore(flash, 4).Load()
+			if err != nil || string(got) != string(payload("after")) {
+				t.Fatalf("保存 %d 回、%d バイト目で電源断：期待する内容は %q 、実際は %q (%v) で異なる", saved, cut, payload("after"), got, err)
+			}
+		}
+	}
+}
+
+// NORフラッシュと同じく、書き込みはビットを落とすだけ
+func TestMemFlash_WriteClearsBits(t *testing.T) {
+	flash := newTestFlash()
+	flash.WriteAt([]byte{0xF0}, 0)
+	flash.WriteAt([]byte{0x3C}, 0)
+	if got := flash.Bytes()[0]; got != 0x30 {
+		t.Errorf("期待する値は 0x30 、実際は %#x で異なる", got)
+	}
+
+	flash.EraseBlocks(0, 1)
+	if got := flash.Bytes()[0]; got != 0xFF {
+		t.Errorf("消去後の期待する値は 0xff 、実際は %#x で異なる", got)
+	}
+	if _, err := flash.WriteAt([]byte{0}, 3); !errors.Is(err, ErrUnaligned) {
+		t.Errorf("期待するエラーは %v 、実際は %v で異なる", ErrUnaligned, err)
+	}
+}
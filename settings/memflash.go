@@ -0,0 +1,157 @@
+package settings
+
+import "errors"
+
+var (
+	// ErrPowerLoss is returned by a MemFlash once its power is cut.
+	// ErrPowerLossは、電源が切られたMemFlashが返す。
+	ErrPowerLoss = errors.New("settings: power loss")
+	// ErrOutOfRange is returned for accesses outside a MemFlash.
+	// ErrOutOfRangeは、MemFlashの範囲外へのアクセスに対して返す。
+	ErrOutOfRange = errors.New("settings: out of range")
+	// ErrUnaligned is returned for writes not aligned to write blocks.
+	// ErrUnalignedは、書き込みブロックに揃っていない書き込みに対して返す。
+	ErrUnaligned = errors.New("settings: unaligned write")
+)
+
+// MemFlash is an in-memory BlockDevice that behaves like NOR flash, for
+// host tests. It counts the erases of each block and can cut the power in
+// the middle of a write or erase.
+//
+// MemFlashは、NORフラッシュのように振る舞うメモリ上のBlockDeviceで、ホ
+// ストのテスト用。ブロックごとの消去回数を数え、書き込みや消去の途中で電
+// 源を切ることができる。
+type MemFlash struct {
+	data                 []byte
+	writeSize, eraseSize int64
+	erases               []int
+	// Bytes that may still be written or erased before the power goes,
+	// or -1 for no limit.
+	// 電源が切れるまでに書き込みか消去できる残りのバイト数。-1は無制限。
+	budget int
+}
+
+// NewMemFlash creates an erased MemFlash of size bytes.
+//
+// NewMemFlashは、sizeバイトの消去済みMemFlashを作る。
+func NewMemFlash(size, writeBlockSize, eraseBlockSize int64) *MemFlash {
+	f := &MemFlash{
+		data:      make([]byte, size),
+		writeSize: writeBlockSize,
+		eraseSize: eraseBlockSize,
+		erases:    make([]int, size/eraseBlockSize),
+		budget:    -1,
+	}
+	for i := range f.data {
+		f.data[i] = 0xFF
+	}
+	return f
+}
+
+// CutPowerAfter cuts the power once n more bytes have been written or
+// erased. The operation crossing the limit is left half done, and every
+// operation after it fails with ErrPowerLoss.
+//
+// CutPowerAfterは、あとnバイト書き込むか消去したら電源を切る。限度をまた
+// ぐ操作は途中までしか行われず、その後の操作はすべてErrPowerLossで失敗す
+// る。
+func (f *MemFlash) CutPowerAfter(n int) {
+	f.budget = n
+}
+
+// RestorePower turns the power back on.
+//
+// RestorePowerは、電源を入れ直す。
+func (f *MemFlash) RestorePower() {
+	f.budget = -1
+}
+
+// EraseCount returns how often block has been erased.
+//
+// EraseCountは、blockが消去された回数を返す。
+func (f *MemFlash) EraseCount(block int64) int {
+	return f.erases[block]
+}
+
+// Bytes returns the raw contents.
+//
+// Bytesは、生の内容を返す。
+func (f *MemFlash) Bytes() []byte {
+	return f.data
+}
+
+// ReadAt implements BlockDevice.
+func (f *MemFlash) ReadAt(p []byte, off int64) (int, error) {
+	if f.budget == 0 {
+		return 0, ErrPowerLoss
+	}
+	if off < 0 || off+int64(len(p)) > int64(len(f.data)) {
+		return 0, ErrOutOfRange
+	}
+	return copy(p, f.data[off:]), nil
+}
+
+// WriteAt implements BlockDevice. Like NOR flash it can only clear bits,
+// so writing over data that is not erased corrupts it.
+//
+// WriteAtは、BlockDeviceの実装。NORフラッシュと同じくビットを落とすこと
+// しかできないので、消去されていないデータに書き込むと壊れる。
+func (f *MemFlash) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(f.data)) {
+		return 0, ErrOutOfRange
+	}
+	if off%f.writeSize != 0 {
+		return 0, ErrUnaligned
+	}
+	n, err := f.spend(len(p))
+	for i := 0; i < n; i++ {
+		f.data[off+int64(i)] &= p[i]
+	}
+	return n, err
+}
+
+// Size implements BlockDevice.
+func (f *MemFlash) Size() int64 { return int64(len(f.data)) }
+
+// WriteBlockSize implements BlockDevice.
+func (f *MemFlash) WriteBlockSize() int64 { return f.writeSize }
+
+// EraseBlockSize implements BlockDevice.
+func (f *MemFlash) EraseBlockSize() int64 { return f.eraseSize }
+
+// EraseBlocks implements BlockDevice.
+func (f *MemFlash) EraseBlocks(start, length int64) error {
+	if start < 0 || start+length > int64(len(f.erases)) {
+		return ErrOutOfRange
+	}
+	for b := start; b < start+length; b++ {
+		n, err := f.spend(int(f.eraseSize))
+		off := b * f.eraseSize
+		for i := int64(0); i < int64(n); i++ {
+			f.data[off+i] = 0xFF
+		}
+		if err != nil {
+			return err
+		}
+		f.erases[b]++
+	}
+	return nil
+}
+
+// spend takes n bytes from the power budget and returns how many of them
+// happen before the power goes.
+func (f *MemFlash) spend(n int) (int, error) {
+	switch {
+	case f.budget < 0:
+		return n, nil
+	case f.budget > n || (f.budget == n && n > 0):
+		// With the budget used up exactly, the operation completes but the
+		// power goes right after.
+		// 残りをちょうど使い切った場合、操作は完了するが直後に電源が切れる。
+		f.budget -= n
+		return n, nil
+	default:
+		n, f.budget = f.budget, 0
+		return n, ErrPowerLoss
+	}
+}
@@ -0,0 +1,280 @@
+// Package settings keeps the tunables of the fan controller across power
+// cycles. Settings are encoded as versioned key/value pairs with a CRC,
+// older versions are migrated on load, and the bytes go to any Storage,
+// such as a LogStore on the RP2040 flash.
+//
+// settingsパッケージは、ファンコントローラーの調整値を電源を切っても保持
+// する。設定はバージョン付きのキーと値の組としてCRC付きで符号化し、古い
+// バージョンは読み込み時に移行する。バイト列はRP2040のフラッシュ上の
+// LogStoreなど、任意のStorageに保存する。
+package settings
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/curve"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// Version is the schema version written by Marshal.
+//
+// Versionは、Marshalが書き込むスキーマのバージョン。
+const Version = 1
+
+var (
+	// ErrNotFound is returned by a Storage that holds no settings yet.
+	// ErrNotFoundは、まだ設定を持っていないStorageが返す。
+	ErrNotFound = errors.New("settings: not found")
+	// ErrCorrupt is returned when the stored settings fail their checks.
+	// ErrCorruptは、保存された設定が検査に通らないときに返す。
+	ErrCorrupt = errors.New("settings: corrupt")
+	// ErrVersion is returned for settings written by a newer firmware.
+	// ErrVersionは、より新しいファームウェアが書いた設定に対して返す。
+	ErrVersion = errors.New("settings: unsupported version")
+	// ErrInvalid is returned for settings holding a value out of range,
+	// such as an unknown curve shape.
+	// ErrInvalidは、知らない曲線の形など、範囲外の値を持つ設定に対して返
+	// す。
+	ErrInvalid = errors.New("settings: invalid value")
+)
+
+// Storage keeps one blob of encoded settings.
+//
+// Storageは、符号化した設定のバイト列を1つ保持する。
+type Storage interface {
+	// Load returns the last saved blob, or ErrNotFound.
+	// Loadは、最後に保存したバイト列を返す。無ければErrNotFound。
+	Load() ([]byte, error)
+	Save(data []byte) error
+}
+
+// Settings holds every tunable that survives a power cycle.
+//
+// Settingsは、電源を切っても残るすべての調整値を持つ。
+type Settings struct {
+	// Potentiometer response curve.
+	// ポテンショメータの応答曲線
+	PotCurve curve.Curve
+	// Profiles of the front and rear rotors.
+	// 前側と後ろ側のローターのプロファイル
+	FrontProfile, RearProfile fan.Profile
+	// Display brightness, 0-15.
+	// ディスプレイの明るさ(0-15)
+	Brightness uint8
+	// Control mode and the target RPM of the closed loop.
+	// 制御モードと閉ループの目標RPM
+	Mode      control.Mode
+	TargetRPM uint32
+	// Results of the last characterization sweeps, or nil. Each holds up
+	// to 29 points.
+	// 直近の特性測定の結果。無ければnil。それぞれ最大29点。
+	FrontCalibration, RearCalibration *fan.Characterization
+}
+
+// Default returns the settings of a fresh controller.
+//
+// Defaultは、初期状態のコントローラーの設定を返す。
+func Default() Settings {
+	return Settings{
+		PotCurve:     curve.Default(),
+		FrontProfile: fan.DefaultProfile,
+		RearProfile:  fan.DefaultProfile,
+		Brightness:   15,
+		Mode:         control.ModeOpenLoop,
+	}
+}
+
+// Keys of the encoded settings. Keys are never reused for another
+// meaning; a migration renames or converts them instead.
+//
+// 符号化した設定のキー。キーを別の意味に使い回すことはしない。代わりに移
+// 行処理で名前を変えるか変換する。
+const (
+	keyCurveShape      = "curve.shape"
+	keyCurveK          = "curve.k"
+	keyCurveTable      = "curve.table"
+	keyCurveDeadzone   = "curve.deadzone"
+	keyCurveRescale    = "curve.rescale"
+	keyCurveSaturation = "curve.saturation"
+	keyCurveOutMin     = "curve.out_min"
+	keyCurveOutMax     = "curve.out_max"
+	keyFrontProfile    = "front.profile"
+	keyRearProfile     = "rear.profile"
+	keyBrightness      = "display.brightness"
+	keyMode            = "control.mode"
+	keyTargetRPM       = "control.target_rpm"
+	keyFrontCal        = "front.calibration"
+	keyRearCal         = "rear.calibration"
+)
+
+// migrations[i] converts the key/value pairs of version i+1 to version
+// i+2.
+//
+// migrations[i]は、バージョンi+1のキーと値の組をバージョンi+2に変換する。
+var migrations = [Version - 1]func(kv map[string][]byte){}
+
+// Marshal encodes s as: version (1 byte), key/value pairs (key length,
+// key, value length, value), then the CRC-32 of everything before it.
+//
+// Marshalは、sを次の形に符号化する：バージョン(1バイト)、キーと値の組(キー
+// の長さ、キー、値の長さ、値)、最後にそれより前すべてのCRC-32。
+func (s *Settings) Marshal() ([]byte, error) {
+	e := encoder{buf: []byte{Version}}
+
+	c := s.PotCurve
+	e.u32(keyCurveShape, uint32(c.Shape))
+	e.f32(keyCurveK, c.K)
+	if len(c.Table) > 0 {
+		v := make([]byte, 0, len(c.Table)*8)
+		for _, p := range c.Table {
+			v = binary.LittleEndian.AppendUint32(v, math.Float32bits(p.X))
+			v = binary.LittleEndian.AppendUint32(v, math.Float32bits(p.Y))
+		}
+		e.put(keyCurveTable, v)
+	}
+	e.u32(keyCurveDeadzone, uint32(c.Deadzone))
+	if c.Rescale {
+		e.u32(keyCurveRescale, 1)
+	}
+	e.u32(keyCurveSaturation, uint32(c.SaturationZone))
+	e.u32(keyCurveOutMin, c.OutMin)
+	e.u32(keyCurveOutMax, c.OutMax)
+
+	e.profile(keyFrontProfile, s.FrontProfile)
+	e.profile(keyRearProfile, s.RearProfile)
+	e.u32(keyBrightness, uint32(s.Brightness))
+	e.u32(keyMode, uint32(s.Mode))
+	e.u32(keyTargetRPM, s.TargetRPM)
+	e.calibration(keyFrontCal, s.FrontCalibration)
+	e.calibration(keyRearCal, s.RearCalibration)
+
+	if e.err != nil {
+		return nil, e.err
+	}
+	return binary.LittleEndian.AppendUint32(e.buf, crc32.ChecksumIEEE(e.buf)), nil
+}
+
+// Unmarshal decodes data written by Marshal of this or an older version.
+// Keys missing from data keep their value in s, so decode into Default()
+// to fill in settings added by later versions.
+//
+// Unmarshalは、このバージョンまたは古いバージョンのMarshalが書いたdataを
+// 復号する。dataに無いキーはsの値のまま残る。後のバージョンで増えた設定を
+// 補うため、Default()に復号すること。
+func (s *Settings) Unmarshal(data []byte) error {
+	if len(data) < 5 {
+		return ErrCorrupt
+	}
+	body := data[:len(data)-4]
+	if binary.LittleEndian.Uint32(data[len(data)-4:]) != crc32.ChecksumIEEE(body) {
+		return ErrCorrupt
+	}
+	kv, err := decode(body[1:])
+	if err != nil {
+		return err
+	}
+	if err := migrate(kv, body[0], migrations[:]); err != nil {
+		return err
+	}
+	// Check the enumerations and the brightness before s is touched.
+	// sを変える前に、列挙値と明るさを検査する。
+	if v, ok := getU32(kv, keyCurveShape); ok && v > uint32(curve.Table) {
+		return ErrInvalid
+	}
+	if v, ok := getU32(kv, keyBrightness); ok && v > 15 {
+		return ErrInvalid
+	}
+	if v, ok := getU32(kv, keyMode); ok && v > uint32(control.ModeClosedLoop) {
+		return ErrInvalid
+	}
+
+	c := &s.PotCurve
+	if v, ok := getU32(kv, keyCurveShape); ok {
+		c.Shape = curve.Shape(v)
+	}
+	if v, ok := getU32(kv, keyCurveK); ok {
+		c.K = math.Float32frombits(v)
+	}
+	if v, ok := kv[keyCurveTable]; ok && len(v)%8 == 0 {
+		c.Table = make([]curve.Point, len(v)/8)
+		for i := range c.Table {
+			c.Table[i].X = math.Float32frombits(binary.LittleEndian.Uint32(v[i*8:]))
+			c.Table[i].Y = math.Float32frombits(binary.LittleEndian.Uint32(v[i*8+4:]))
+		}
+	}
+	if v, ok := getU32(kv, keyCurveDeadzone); ok {
+		c.Deadzone = uint16(v)
+	}
+	if v, ok := getU32(kv, keyCurveRescale); ok {
+		c.Rescale = v != 0
+	}
+	if v, ok := getU32(kv, keyCurveSaturation); ok {
+		c.SaturationZone = uint16(v)
+	}
+	if v, ok := getU32(kv, keyCurveOutMin); ok {
+		c.OutMin = v
+	}
+	if v, ok := getU32(kv, keyCurveOutMax); ok {
+		c.OutMax = v
+	}
+
+	getProfile(kv, keyFrontProfile, &s.FrontProfile)
+	getProfile(kv, keyRearProfile, &s.RearProfile)
+	if v, ok := getU32(kv, keyBrightness); ok {
+		s.Brightness = uint8(v)
+	}
+	if v, ok := getU32(kv, keyMode); ok {
+		s.Mode = control.Mode(v)
+	}
+	if v, ok := getU32(kv, keyTargetRPM); ok {
+		s.TargetRPM = v
+	}
+	getCalibration(kv, keyFrontCal, &s.FrontCalibration)
+	getCalibration(kv, keyRearCal, &s.RearCalibration)
+	return nil
+}
+
+// Load reads the settings from st. If st is empty or its contents are
+// unusable, it returns Default() together with the error.
+//
+// Loadは、stから設定を読み込む。stが空か内容が使えなければ、エラーと一緒
+// にDefault()を返す。
+func Load(st Storage) (Settings, error) {
+	s := Default()
+	data, err := st.Load()
+	if err != nil {
+		return s, err
+	}
+	if err := s.Unmarshal(data); err != nil {
+		return Default(), err
+	}
+	return s, nil
+}
+
+// Save writes s to st.
+//
+// Saveは、sをstに書き込む。
+func Save(st Storage, s Settings) error {
+	data, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+	return st.Save(data)
+}
+
+// migrate brings kv from version up to len(steps)+1, one step at a time.
+//
+// migrateは、kvをversionからlen(steps)+1まで1段ずつ移行する。
+func migrate(kv map[string][]byte, version uint8, steps []func(map[string][]byte)) error {
+	if version == 0 || int(version) > len(steps)+1 {
+		return ErrVersion
+	}
+	for _, step := range steps[version-1:] {
+		step(kv)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package settings
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"testing"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/curve"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// 最後に保存した内容を持つだけのStorage
+type memStorage struct {
+	data []byte
+}
+
+func (m *memStorage) Load() ([]byte, error) {
+	if m.data == nil {
+		return nil, ErrNotFound
+	}
+	return m.data, nil
+}
+
+func (m *memStorage) Save(data []byte) error {
+	m.data = append([]byte(nil), data...)
+	return nil
+}
+
+func customSettings() Settings {
+	s := Default()
+	s.PotCurve = curve.Curve{
+		Shape:          curve.Table,
+		Table:          []curve.Point{{X: 0, Y: 0}, {X: 0.5, Y: 0.2}, {X: 1, Y: 1}},
+		Deadzone:       1000,
+		Rescale:        true,
+		SaturationZone: 500,
+		OutMin:         4000,
+		OutMax:         36000,
+	}
+	s.FrontProfile = fan.Profile{PulsesPerRevolution: 2, MaxRPM: 3000, MinStartDuty: 10000, StallRPM: 200}
+	s.RearProfile = fan.Profile{PulsesPerRevolution: 4, MaxRPM: 2800}
+	s.Brightness = 8
+	s.Mode = control.ModeClosedLoop
+	s.TargetRPM = 2400
+	s.FrontCalibration = &fan.Characterization{
+		Points:         []fan.SweepPoint{{Duty: 0, RPM: 0}, {Duty: 20000, RPM: 1500}, {Duty: fan.MaxDuty, RPM: 3000}},
+		MinStartDuty:   20000,
+		MinSustainDuty: 10000,
+		MaxRPM:         3000,
+		PPR:            2,
+		Checks:         fan.CheckNone,
+	}
+	return s
+}
+
+func TestSettings_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name     string
+		settings Settings
+	}{
+		{name: "既定値", settings: Default()},
+		{name: "すべて変更", settings: customSettings()},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			st := &memStorage{}
+			if err := Save(st, tc.settings); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Load(st)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.settings) {
+				t.Errorf("期待する設定は %+v 、実際は %+v で異なる", tc.settings, got)
+			}
+		})
+	}
+}
+
+// 指定したバージョンとキーと値の組からCRC付きのデータを作る
+func blob(version byte, pairs ...string) []byte {
+	e := encoder{buf: []byte{version}}
+	for i := 0; i < len(pairs); i += 2 {
+		e.put(pairs[i], []byte(pairs[i+1]))
+	}
+	return withCRC(e.buf)
+}
+
+func withCRC(body []byte) []byte {
+	return binary.LittleEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+}
+
+func TestSettings_Unmarshal(t *testing.T) {
+	valid, _ := func() ([]byte, error) { s := customSettings(); return s.Marshal() }()
+	flipped := append([]byte(nil), valid...)
+	flipped[10] ^= 0x01
+
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{name: "正常", data: valid, expected: nil},
+		{name: "ビット化け", data: flipped, expected: ErrCorrupt},
+		{name: "途中で切れた", data: valid[:len(valid)/2], expected: ErrCorrupt},
+		{name: "短すぎる", data: []byte{1, 2}, expected: ErrCorrupt},
+		{name: "新しいバージョン", data: blob(Version + 1), expected: ErrVersion},
+		{name: "バージョン0", data: blob(0), expected: ErrVersion},
+		{name: "キーの長さが壊れている", data: withCRC([]byte{Version, 5, 'x'}), expected: ErrCorrupt},
+		{name: "知らない曲線", data: blob(Version, keyCurveShape, "\x06\x00\x00\x00"), expected: ErrInvalid},
+		{name: "明るすぎる", data: blob(Version, keyBrightness, "\xc8\x00\x00\x00"), expected: ErrInvalid},
+		{name: "知らないモード", data: blob(Version, keyMode, "\x02\x00\x00\x00"), expected: ErrInvalid},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := Default()
+			if err := s.Unmarshal(tc.data); !errors.Is(err, tc.expected) {
+				t.Errorf("期待するエラーは %v 、実際は %v で異なる", tc.expected, err)
+			}
+			// 範囲外の値はsを変えない
+			if tc.expected == ErrInvalid && !reflect.DeepEqual(s, Default()) {
+				t.Errorf("期待する設定は既定値、実際は %+v で異なる", s)
+			}
+		})
+	}
+}
+
+// 無いキーは既定値のまま、知らないキーは無視する
+func TestSettings_MissingAndUnknownKeys(t *testing.T) {
+	st := &memStorage{data: blob(Version, keyBrightness, "\x03\x00\x00\x00", "future.key", "xyz")}
+	got, err := Load(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Default()
+	expected.Brightness = 3
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("期待する設定は %+v 、実際は %+v で異なる", expected, got)
+	}
+}
+
+// 読めなければエラーと一緒に既定値を返す
+func TestLoad_Fallback(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{name: "空", data: nil, expected: ErrNotFound},
+		{name: "壊れている", data: []byte{1, 2, 3, 4, 5, 6}, expected: ErrCorrupt},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Load(&memStorage{data: tc.data})
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("期待するエラーは %v 、実際は %v で異なる", tc.expected, err)
+			}
+			if !reflect.DeepEqual(got, Default()) {
+				t.Errorf("期待する設定は既定値、実際は %+v で異なる", got)
+			}
+		})
+	}
+}
+
+// 古いバージョンから1段ずつ移行する
+func TestMigrate(t *testing.T) {
+	steps := []func(map[string][]byte){
+		// 1→2：キーの名前を変える
+		func(kv map[string][]byte) {
+			if v, ok := kv["ppr"]; ok {
+				kv["front.ppr"] = v
+				delete(kv, "ppr")
+			}
+		},
+		// 2→3：後ろ側に前側の値を複製する
+		func(kv map[string][]byte) {
+			kv["rear.ppr"] = kv["front.ppr"]
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		version  uint8
+		kv       map[string][]byte
+		expected map[string][]byte
+	}{
+		{
+			name:     "バージョン1から",
+			version:  1,
+			kv:       map[string][]byte{"ppr": {2}},
+			expected: map[string][]byte{"front.ppr": {2}, "rear.ppr": {2}},
+		},
+		{
+			name:     "バージョン2から",
+			version:  2,
+			kv:       map[string][]byte{"front.ppr": {4}},
+			expected: map[string][]byte{"front.ppr": {4}, "rear.ppr": {4}},
+		},
+		{
+			name:     "最新",
+			version:  3,
+			kv:       map[string][]byte{"front.ppr": {4}, "rear.ppr": {1}},
+			expected: map[string][]byte{"front.ppr": {4}, "rear.ppr": {1}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := migrate(tc.kv, tc.version, steps); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.kv, tc.expected) {
+				t.Errorf("期待する内容は %v 、実際は %v で異なる", tc.expected, tc.kv)
+			}
+		})
+	}
+
+	if err := migrate(map[string][]byte{}, 4, steps); !errors.Is(err, ErrVersion) {
+		t.Errorf("期待するエラーは %v 、実際は %v で異なる", ErrVersion, err)
+	}
+}
+
+// フラッシュ上のLogStoreに保存して読み戻す
+func TestSettings_OnFlash(t *testing.T) {
+	flash := NewMemFlash(4*4096, 256, 4096)
+	s := customSettings()
+	if err := Save(NewLogStore(flash, 4), s); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(NewLogStore(flash, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("期待する設定は %+v 、実際は %+v で異なる", s, got)
+	}
+}
@@ -0,0 +1,112 @@
+// Package sim models fan rotors on the host, so control logic can be
+// tested without hardware. Everything runs against a virtual Clock and is
+// deterministic for a given seed.
+//
+// simパッケージは、ハードウェア無しで制御ロジックをテストできるよう、ホス
+// ト上でファンのローターをモデル化する。すべて仮想のClockで動き、同じシー
+// ドなら結果は決定的。
+package sim
+
+import "time"
+
+// DefaultStep is the largest time step used to advance the models.
+//
+// DefaultStepは、モデルを進めるときの最大の時間刻み。
+const DefaultStep = 1 * time.Millisecond
+
+// Model is something that evolves with virtual time.
+//
+// Modelは、仮想時間とともに変化するもの。
+type Model interface {
+	// Advance moves the model forward by dt, ending at now.
+	//
+	// Advanceは、モデルをdtだけ進める。進めた後の時刻がnow。
+	Advance(now time.Time, dt time.Duration)
+}
+
+// Clock is a virtual clock that advances the attached models as time
+// passes. It satisfies fan.Clock and app.Clock.
+//
+// Clockは、時間の経過とともに登録されたモデルを進める仮想クロック。
+// fan.Clockとapp.Clockを満たす。
+type Clock struct {
+	// Largest time step used to advance the models.
+	// モデルを進めるときの最大の時間刻み
+	Step time.Duration
+
+	start  time.Time
+	now    time.Time
+	models []Model
+}
+
+// NewClock creates a Clock starting at a fixed time.
+//
+// NewClockは、決まった時刻から始まるClockを作る。
+func NewClock() *Clock {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &Clock{
+		Step:  DefaultStep,
+		start: start,
+		now:   start,
+	}
+}
+
+// Attach registers a model to be advanced with the clock.
+//
+// Attachは、クロックとともに進めるモデルを登録する。
+func (c *Clock) Attach(m Model) {
+	c.models = append(c.models, m)
+}
+
+// Now returns the virtual time.
+//
+// Nowは、仮想時刻を返す。
+func (c *Clock) Now() time.Time {
+	return c.now
+}
+
+// Elapsed returns the virtual time since the clock was created.
+//
+// Elapsedは、クロックを作ってからの仮想時間を返す。
+func (c *Clock) Elapsed() time.Duration {
+	return c.now.Sub(c.start)
+}
+
+// Sleep advances the virtual time by d.
+//
+// Sleepは、仮想時間をdだけ進める。
+func (c *Clock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Advance moves the virtual time forward by d in steps of at most Step,
+// advancing every attached model.
+//
+// Advanceは、仮想時間を最大Step刻みでdだけ進め、登録されたすべてのモデル
+// を進める。
+func (c *Clock) Advance(d time.Duration) {
+	step := c.Step
+	if step <= 0 {
+		step = DefaultStep
+	}
+	for d > 0 {
+		dt := step
+		if d < dt {
+			dt = d
+		}
+		c.now = c.now.Add(dt)
+		for _, m := range c.models {
+			m.Advance(c.now, dt)
+		}
+		d -= dt
+	}
+}
+
+// micros returns t as a microsecond timestamp on the clock's timebase,
+// like the tach interrupts record.
+//
+// microsは、tをタコ割り込みが記録するのと同じ、クロック基準のマイクロ秒
+// のタイムスタンプとして返す。
+func (c *Clock) micros(t time.Time) uint32 {
+	return uint32(t.Sub(c.start) / time.Microsecond)
+}
@@ -0,0 +1,57 @@
+package sim
+
+import "time"
+
+// DefaultWindmill is the default fraction of the other rotor's speed an
+// unpowered rotor of a Pair spins at.
+//
+// DefaultWindmillは、Pairの駆動されていないローターが、もう一方のロー
+// ターの速度に対して空転する割合のデフォルト。
+const DefaultWindmill = 0.3
+
+// Pair is a simulated contra-rotating front/rear rotor pair. The rotors
+// share one airflow, so an unpowered rotor windmills in the flow of the
+// other. It implements app.DutyOutput.
+//
+// Pairは、シミュレーションした二重反転の前後ローターの組。ローターは1つの
+// 風の流れを共有するので、駆動されていないローターはもう一方の風で空転す
+// る。app.DutyOutputを実装する。
+type Pair struct {
+	Front, Rear *Rotor
+	// Fraction of the other rotor's speed an unpowered rotor spins at.
+	// 駆動されていないローターが、もう一方の速度に対して空転する割合
+	Windmill float64
+}
+
+// NewPair creates a Pair driven by clock. The rotors get different seeds
+// derived from seed.
+//
+// NewPairは、clockで動くPairを作る。ローターにはseedから作った別々のシー
+// ドを与える。
+func NewPair(clock *Clock, front, rear RotorConfig, seed int64) *Pair {
+	p := &Pair{
+		Front:    NewRotor(clock, front, seed),
+		Rear:     NewRotor(clock, rear, seed+1),
+		Windmill: DefaultWindmill,
+	}
+	clock.Attach(p)
+	return p
+}
+
+// SetDuty commands the front and rear duties (0-fan.MaxDuty).
+//
+// SetDutyは、前側と後ろ側のデューティ(0-fan.MaxDuty)を指令する。
+func (p *Pair) SetDuty(front, rear uint32) {
+	p.Front.SetDuty(front)
+	p.Rear.SetDuty(rear)
+}
+
+// Advance updates the airflow coupling between the rotors. The rotors
+// advance themselves.
+//
+// Advanceは、ローター間の風による結合を更新する。ローター自体はそれぞれが
+// 自分で進む。
+func (p *Pair) Advance(now time.Time, dt time.Duration) {
+	p.Front.windmill = p.Windmill * p.Rear.rpm
+	p.Rear.windmill = p.Windmill * p.Front.rpm
+}
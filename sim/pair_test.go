@@ -0,0 +1,252 @@
+package sim
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/app"
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+	"github.com/kou-tkbys/tk-fancon2/ht16k33"
+)
+
+// 駆動されていないローターはもう一方の風で空転する
+func TestPair_Windmill(t *testing.T) {
+	clock := NewClock()
+	pair := NewPair(clock, DefaultRotorConfig(), DefaultRotorConfig(), 1)
+
+	pair.SetDuty(fan.MaxDuty, 0)
+	clock.Advance(30 * time.Second)
+
+	if math.Abs(pair.Front.RPM()-3000) > 1 {
+		t.Errorf("前側の期待するRPMは 3000 、実際は %v で異なる", pair.Front.RPM())
+	}
+	expected := DefaultWindmill * 3000
+	if math.Abs(pair.Rear.RPM()-expected) > 5 {
+		t.Errorf("後ろ側の期待するRPMは %v 、実際は %v で異なる", expected, pair.Rear.RPM())
+	}
+
+	// 両方駆動すれば、それぞれのデューティで回る
+	pair.SetDuty(fan.MaxDuty, fan.MaxDuty/2)
+	clock.Advance(30 * time.Second)
+	if math.Abs(pair.Rear.RPM()-1500) > 1 {
+		t.Errorf("後ろ側の期待するRPMは 1500 、実際は %v で異なる", pair.Rear.RPM())
+	}
+}
+
+// 何もしないI2Cバス
+type nopBus struct{}
+
+func (nopBus) Tx(addr uint16, w, r []byte) error { return nil }
+
+type nopLED struct{}
+
+func (nopLED) Set(on bool) {}
+
+type constPot uint16
+
+func (p constPot) Get() uint16 { return uint16(p) }
+
+// シミュレーションしたファンの上でアプリ全体を動かす
+func TestPair_WithApp(t *testing.T) {
+	clock := NewClock()
+	pair := NewPair(clock, DefaultRotorConfig(), DefaultRotorConfig(), 1)
+
+	a := app.New(app.DefaultConfig(), nopLED{}, clock)
+	err := a.Boot(func() (app.FanHardware, error) {
+		return app.FanHardware{Name: "Sim", Output: pair, Pot: constPot(0xFFFF), Front: pair.Front, Rear: pair.Rear}, nil
+	}, func() (ht16k33.I2CBus, error) {
+		return nopBus{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for clock.Elapsed() < 20*time.Second {
+		a.Step()
+		clock.Advance(10 * time.Millisecond)
+	}
+	front, rear := a.Fans.FilteredRPMs()
+	if front < 2940 || front > 3060 || rear < 2940 || rear > 3060 {
+		t.Errorf("期待するRPMは 3000/3000 付近、実際は %d/%d で異なる", front, rear)
+	}
+	if a.Fans.HasFault() {
+		t.Errorf("異常は無いはず: %v", a.Fans.Front.Faults())
+	}
+
+	// 後ろ側をロックすると停止として検出される
+	pair.Rear.SetLocked(true)
+	for end := clock.Elapsed() + 6*time.Second; clock.Elapsed() < end; {
+		a.Step()
+		clock.Advance(10 * time.Millisecond)
+	}
+	if _, rearFault := a.Fans.Faults(); rearFault != fan.FaultStalled {
+		t.Errorf("期待する異常は %v 、実際は %v で異なる", fan.FaultStalled, rearFault)
+	}
+}
+
+// 起動デューティ未満でも、キックスタートがあれば回り始める。キックが無け
+// ればうなるだけで回らず、停止として検出される。
+func TestPair_KickStart(t *testing.T) {
+	testCases := []struct {
+		name    string
+		start   control.StartConfig
+		stalled bool
+	}{
+		{name: "キックあり", start: control.DefaultStartConfig(), stalled: false},
+		{name: "キックなし", start: control.StartConfig{}, stalled: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewClock()
+			pair := NewPair(clock, DefaultRotorConfig(), DefaultRotorConfig(), 1)
+
+			cfg := app.DefaultConfig()
+			cfg.FrontStart = tc.start
+			cfg.RearStart = tc.start
+			a := app.New(cfg, nopLED{}, clock)
+			// 約7000：回り続けられるが、停止からは回り始められない
+			err := a.Boot(func() (app.FanHardware, error) {
+				return app.FanHardware{Name: "Sim", Output: pair, Pot: constPot(28578), Front: pair.Front, Rear: pair.Rear}, nil
+			}, func() (ht16k33.I2CBus, error) {
+				return nopBus{}, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stalled := false
+			for clock.Elapsed() < 20*time.Second {
+				a.Step()
+				clock.Advance(10 * time.Millisecond)
+				front, _ := a.Fans.Faults()
+				stalled = stalled || front != fan.FaultNone
+			}
+			if stalled != tc.stalled {
+				t.Fatalf("期待する停止の検出は %v 、実際は %v で異なる", tc.stalled, stalled)
+			}
+			if tc.stalled {
+				return
+			}
+			if front, _ := a.Duties(); front < 6000 || front > 8000 {
+				t.Errorf("期待するデューティは 7000 付近、実際は %d で異なる", front)
+			}
+			if rpm := pair.Front.RPM(); rpm < 400 || rpm > 600 {
+				t.Errorf("期待するRPMは 500 付近、実際は %v で異なる", rpm)
+			}
+		})
+	}
+}
+
+// アプリから両方のローターの特性を測り、CSVで書き出す
+func TestPair_Calibrate(t *testing.T) {
+	clock := NewClock()
+	pair := NewPair(clock, DefaultRotorConfig(), DefaultRotorConfig(), 1)
+
+	a := app.New(app.DefaultConfig(), nopLED{}, clock)
+	err := a.Boot(func() (app.FanHardware, error) {
+		return app.FanHardware{Name: "Sim", Output: pair, Pot: constPot(0xFFFF), Front: pair.Front, Rear: pair.Rear}, nil
+	}, func() (ht16k33.I2CBus, error) {
+		return nopBus{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var csv bytes.Buffer
+	done := false
+	err = a.Calibrate(&csv, func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		done = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Calibrate(&csv, nil); err != app.ErrCalibrating {
+		t.Errorf("期待するエラーは %v 、実際は %v で異なる", app.ErrCalibrating, err)
+	}
+	// スイープはメインループが進める
+	for limit := 2 * app.DefaultConfig().Calibration.MaxDuration(); !done && clock.Elapsed() < limit; {
+		a.Step()
+		clock.Advance(10 * time.Millisecond)
+	}
+	if !done || a.Calibrating() {
+		t.Fatal("特性測定が終わっていない")
+	}
+
+	front, rear := a.Fans.Characterizations()
+	for _, c := range []*fan.Characterization{front, rear} {
+		if c == nil {
+			t.Fatal("特性測定の結果が無い")
+		}
+		if c.MinStartDuty != 10000 || c.MinSustainDuty != 5000 || c.Checks != fan.CheckNone {
+			t.Errorf("期待する結果は 10000/5000/none 、実際は %d/%d/%v で異なる", c.MinStartDuty, c.MinSustainDuty, c.Checks)
+		}
+	}
+	if !strings.HasPrefix(csv.String(), "rotor,duty,rpm\nSim-F,0,0\nSim-F,2500,0\n") {
+		t.Errorf("CSVの先頭が期待と異なる:\n%s", csv.String())
+	}
+	if !strings.Contains(csv.String(), "\nSim-R,10000,5000,") {
+		t.Errorf("後ろ側の要約行が無い:\n%s", csv.String())
+	}
+
+	// その後はポテンショメータの値に戻る
+	for end := clock.Elapsed() + 15*time.Second; clock.Elapsed() < end; {
+		a.Step()
+		clock.Advance(10 * time.Millisecond)
+	}
+	if f, r := a.Duties(); f != fan.MaxDuty || r != fan.MaxDuty {
+		t.Errorf("期待するデューティは %d 、実際は %d/%d で異なる", fan.MaxDuty, f, r)
+	}
+	if a.Fans.HasFault() {
+		t.Errorf("異常は無いはず: %v", a.Fans.Front.Faults())
+	}
+}
+
+// コンソールから閉ループモードにすると、前側は目標RPMに、後ろ側はその比に
+// 落ち着く
+func TestPair_ConsolePID(t *testing.T) {
+	clock := NewClock()
+	pair := NewPair(clock, DefaultRotorConfig(), DefaultRotorConfig(), 1)
+
+	a := app.New(app.DefaultConfig(), nopLED{}, clock)
+	err := a.Boot(func() (app.FanHardware, error) {
+		return app.FanHardware{Name: "Sim", Output: pair, Pot: constPot(0x8000), Front: pair.Front, Rear: pair.Rear}, nil
+	}, func() (ht16k33.I2CBus, error) {
+		return nopBus{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in, out bytes.Buffer
+	a.StartConsole(&in, &out)
+
+	for clock.Elapsed() < 10*time.Second {
+		a.Step()
+		clock.Advance(10 * time.Millisecond)
+	}
+	in.WriteString("mode pid 2400\n")
+	for end := clock.Elapsed() + 40*time.Second; clock.Elapsed() < end; {
+		a.Step()
+		clock.Advance(10 * time.Millisecond)
+	}
+	if out.String() != "ok\r\n" {
+		t.Errorf("期待する返答は %q 、実際は %q で異なる", "ok\r\n", out.String())
+	}
+	front, rear := a.Fans.FilteredRPMs()
+	if front < 2350 || front > 2450 {
+		t.Errorf("期待する前側のRPMは 2400 付近、実際は %d で異なる", front)
+	}
+	if expected := 2400 * control.DefaultRatio; math.Abs(float64(rear)-expected) > 60 {
+		t.Errorf("期待する後ろ側のRPMは %v 付近、実際は %d で異なる", expected, rear)
+	}
+	if a.Fans.HasFault() {
+		t.Errorf("異常は無いはず: %v", a.Fans.Front.Faults())
+	}
+}
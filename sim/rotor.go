@@ -0,0 +1,226 @@
+package sim
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// CurvePoint is one point of a duty-to-RPM curve.
+//
+// CurvePointは、デューティからRPMへの曲線の1点。
+type CurvePoint struct {
+	Duty uint32
+	RPM  float64
+}
+
+// RotorConfig describes a simulated rotor.
+//
+// RotorConfigは、シミュレーションするローターを表す。
+type RotorConfig struct {
+	// Steady-state RPM at full duty.
+	// 最大デューティでの定常RPM
+	MaxRPM float64
+	// Optional duty-to-RPM curve, sorted by duty. If nil, the RPM is
+	// proportional to the duty.
+	// 任意のデューティからRPMへの曲線(デューティ順)。nilならRPMはデューティ
+	// に比例する。
+	Curve []CurvePoint
+	// Duty needed to start from rest, and duty below which a spinning
+	// rotor stops.
+	// 停止状態から回り始めるのに必要なデューティと、回っているローターが止
+	// まってしまうデューティ
+	MinStartDuty, MinRunDuty uint32
+	// Time constants of speeding up (inertia) and coasting down.
+	// 加速(慣性)と惰性での減速の時定数
+	SpinUp, SpinDown time.Duration
+	// Tach pulses per revolution.
+	// 1回転あたりのタコパルス数
+	PulsesPerRevolution uint32
+	// Standard deviation of the edge timing jitter, as a fraction of the
+	// pulse period.
+	// エッジのタイミングの揺らぎの標準偏差(パルス周期に対する割合)
+	Jitter float64
+	// Probability that a tach pulse is lost.
+	// タコパルスが失われる確率
+	MissProbability float64
+}
+
+// DefaultRotorConfig returns a typical 3000 RPM, 2-PPR PC fan.
+//
+// DefaultRotorConfigは、典型的な3000 RPM、2PPRのPCファンを返す。
+func DefaultRotorConfig() RotorConfig {
+	return RotorConfig{
+		MaxRPM:              3000,
+		MinStartDuty:        fan.MaxDuty / 4,
+		MinRunDuty:          fan.MaxDuty / 8,
+		SpinUp:              800 * time.Millisecond,
+		SpinDown:            3 * time.Second,
+		PulsesPerRevolution: 2,
+	}
+}
+
+// stoppedRPM is the speed below which a rotor counts as at rest.
+const stoppedRPM = 1
+
+// Rotor is a simulated fan rotor. It accepts duty commands and implements
+// fan.PulseCounter and fan.EdgeCounter through its tach output.
+//
+// Rotorは、シミュレーションしたファンのローター。デューティの指令を受け、
+// タコ出力を通してfan.PulseCounterとfan.EdgeCounterを実装する。
+type Rotor struct {
+	fan.EdgeBuffer
+	Config RotorConfig
+
+	clock *Clock
+	rng   *rand.Rand
+	duty  uint32
+	rpm   float64
+	// RPM the rotor windmills at in the airflow of a coupled rotor.
+	// 結合したローターの風で空転するときのRPM
+	windmill float64
+	// Fraction of the way to the next tach pulse.
+	// 次のタコパルスまでの進み具合
+	phase float64
+	// Set while the rotor is held stopped, e.g. a locked rotor.
+	// ロックなどで止められている間は設定される。
+	locked bool
+}
+
+// NewRotor creates a Rotor driven by clock. The seed makes the tach noise
+// reproducible.
+//
+// NewRotorは、clockで動くRotorを作る。seedでタコのノイズを再現できる。
+func NewRotor(clock *Clock, cfg RotorConfig, seed int64) *Rotor {
+	if cfg.PulsesPerRevolution == 0 {
+		cfg.PulsesPerRevolution = 2
+	}
+	r := &Rotor{
+		Config: cfg,
+		clock:  clock,
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+	clock.Attach(r)
+	return r
+}
+
+// SetDuty commands a duty (0-fan.MaxDuty).
+//
+// SetDutyは、デューティ(0-fan.MaxDuty)を指令する。
+func (r *Rotor) SetDuty(duty uint32) {
+	if duty > fan.MaxDuty {
+		duty = fan.MaxDuty
+	}
+	r.duty = duty
+}
+
+// Duty returns the commanded duty.
+//
+// Dutyは、指令されたデューティを返す。
+func (r *Rotor) Duty() uint32 {
+	return r.duty
+}
+
+// RPM returns the true speed of the rotor.
+//
+// RPMは、ローターの本当の速度を返す。
+func (r *Rotor) RPM() float64 {
+	return r.rpm
+}
+
+// SetLocked holds the rotor stopped while locked is true, like a jammed
+// blade.
+//
+// SetLockedは、lockedがtrueの間、羽根が詰まったようにローターを止めておく。
+func (r *Rotor) SetLocked(locked bool) {
+	r.locked = locked
+	if locked {
+		r.rpm = 0
+	}
+}
+
+// SteadyRPM returns the RPM the rotor settles at for duty when spinning.
+//
+// SteadyRPMは、回っているときにdutyで落ち着くRPMを返す。
+func (r *Rotor) SteadyRPM(duty uint32) float64 {
+	cfg := r.Config
+	if len(cfg.Curve) == 0 {
+		return cfg.MaxRPM * float64(duty) / fan.MaxDuty
+	}
+	if duty <= cfg.Curve[0].Duty {
+		return cfg.Curve[0].RPM
+	}
+	for i := 1; i < len(cfg.Curve); i++ {
+		a, b := cfg.Curve[i-1], cfg.Curve[i]
+		if duty <= b.Duty {
+			return a.RPM + (b.RPM-a.RPM)*float64(duty-a.Duty)/float64(b.Duty-a.Duty)
+		}
+	}
+	return cfg.Curve[len(cfg.Curve)-1].RPM
+}
+
+// target returns the RPM the rotor is heading for right now.
+func (r *Rotor) target() float64 {
+	cfg := r.Config
+	// A rotor merely creeping, e.g. windmilling in a weak airflow, has too
+	// little momentum to run on at MinRunDuty.
+	// 弱い風で空転しているなど、ゆっくり動いているだけのローターは、
+	// MinRunDutyで回り続けるだけの勢いが無い。
+	spinning := r.rpm >= stoppedRPM && r.rpm >= r.SteadyRPM(cfg.MinRunDuty)/2
+	driven := r.duty >= cfg.MinStartDuty || (spinning && r.duty >= cfg.MinRunDuty)
+	if !driven || r.duty == 0 {
+		return r.windmill
+	}
+	return math.Max(r.SteadyRPM(r.duty), r.windmill)
+}
+
+// Advance moves the rotor forward by dt and records its tach edges.
+//
+// Advanceは、ローターをdtだけ進め、タコのエッジを記録する。
+func (r *Rotor) Advance(now time.Time, dt time.Duration) {
+	if r.locked {
+		return
+	}
+
+	target := r.target()
+	tau := r.Config.SpinUp
+	if target < r.rpm {
+		tau = r.Config.SpinDown
+	}
+	prev := r.rpm
+	if tau <= 0 {
+		r.rpm = target
+	} else {
+		r.rpm += (target - r.rpm) * (1 - math.Exp(-dt.Seconds()/tau.Seconds()))
+	}
+	if r.rpm < stoppedRPM && target < stoppedRPM {
+		r.rpm = 0
+	}
+
+	// Emit a tach edge each time the phase wraps, timed within this step.
+	// 位相が一周するたびに、このステップ内の時刻でタコのエッジを出す。
+	pulsesPerSecond := (prev + r.rpm) / 2 / 60 * float64(r.Config.PulsesPerRevolution)
+	perStep := pulsesPerSecond * dt.Seconds()
+	stepStart := now.Add(-dt)
+	used := 0.0 // このステップのうち消化した割合
+	for perStep > 0 && r.phase+perStep*(1-used) >= 1 {
+		used += (1 - r.phase) / perStep
+		r.phase = 0
+		r.emit(stepStart.Add(time.Duration(used*float64(dt))), pulsesPerSecond)
+	}
+	r.phase += perStep * (1 - used)
+}
+
+// emit records one tach edge at t, applying jitter and lost pulses.
+func (r *Rotor) emit(t time.Time, pulsesPerSecond float64) {
+	if r.Config.MissProbability > 0 && r.rng.Float64() < r.Config.MissProbability {
+		return
+	}
+	if r.Config.Jitter > 0 && pulsesPerSecond > 0 {
+		period := time.Second.Seconds() / pulsesPerSecond
+		t = t.Add(time.Duration(r.rng.NormFloat64() * r.Config.Jitter * period * float64(time.Second)))
+	}
+	r.Record(r.clock.micros(t))
+}
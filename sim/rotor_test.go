@@ -0,0 +1,195 @@
+package sim
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// Note: tinygo test ./sim
+
+// 比較に使う直近のエッジの数
+const edgeSamples = 8
+
+func TestRotor_SteadyState(t *testing.T) {
+	testCases := []struct {
+		name     string
+		duty     uint32
+		expected float64
+	}{
+		{name: "最大", duty: fan.MaxDuty, expected: 3000},
+		{name: "半分", duty: fan.MaxDuty / 2, expected: 1500},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := NewClock()
+			rotor := NewRotor(clock, DefaultRotorConfig(), 1)
+			f := fan.NewFan("Sim", rotor)
+			f.SetClock(clock)
+
+			rotor.SetDuty(tc.duty)
+			clock.Advance(10 * time.Second)
+			if math.Abs(rotor.RPM()-tc.expected) > 1 {
+				t.Errorf("期待するRPMは %v 、実際は %v で異なる", tc.expected, rotor.RPM())
+			}
+
+			// タコ出力をfan.Fanで計測しても同じ値になる
+			f.CalculateRPM()
+			clock.Advance(2 * time.Second)
+			if rpm := f.CalculateRPM(); math.Abs(float64(rpm)-tc.expected) > 30 {
+				t.Errorf("期待する計測RPMは %v 、実際は %d で異なる", tc.expected, rpm)
+			}
+		})
+	}
+}
+
+// 止まっている状態からはMinStartDuty以上でないと回り出さず、回っていれば
+// MinRunDutyまでは回り続ける
+func TestRotor_StartAndRunDuty(t *testing.T) {
+	clock := NewClock()
+	cfg := DefaultRotorConfig()
+	rotor := NewRotor(clock, cfg, 1)
+
+	steps := []struct {
+		duty     uint32
+		spinning bool
+	}{
+		{duty: cfg.MinStartDuty - 1, spinning: false},
+		{duty: cfg.MinStartDuty, spinning: true},
+		{duty: cfg.MinRunDuty, spinning: true},
+		{duty: cfg.MinRunDuty - 1, spinning: false},
+		{duty: cfg.MinRunDuty, spinning: false},
+	}
+	for i, step := range steps {
+		rotor.SetDuty(step.duty)
+		clock.Advance(30 * time.Second)
+		if spinning := rotor.RPM() > 0; spinning != step.spinning {
+			t.Errorf("%d番目(デューティ %d)で期待する回転は %v 、実際は %v RPM", i, step.duty, step.spinning, rotor.RPM())
+		}
+	}
+}
+
+// 慣性：SpinUpとSpinDownの時定数で追従する
+func TestRotor_Inertia(t *testing.T) {
+	clock := NewClock()
+	cfg := DefaultRotorConfig()
+	rotor := NewRotor(clock, cfg, 1)
+
+	rotor.SetDuty(fan.MaxDuty)
+	clock.Advance(cfg.SpinUp)
+	if got, want := rotor.RPM(), 3000*(1-math.Exp(-1)); math.Abs(got-want) > 5 {
+		t.Errorf("SpinUp後の期待するRPMは %v 、実際は %v で異なる", want, got)
+	}
+
+	clock.Advance(10 * time.Second)
+	rotor.SetDuty(0)
+	clock.Advance(cfg.SpinDown)
+	if got, want := rotor.RPM(), 3000*math.Exp(-1); math.Abs(got-want) > 5 {
+		t.Errorf("SpinDown後の期待するRPMは %v 、実際は %v で異なる", want, got)
+	}
+}
+
+// 1秒あたりのパルス数はPPRに比例する
+func TestRotor_PulsesPerRevolution(t *testing.T) {
+	for _, ppr := range []uint32{1, 2, 3, 4} {
+		clock := NewClock()
+		cfg := DefaultRotorConfig()
+		cfg.PulsesPerRevolution = ppr
+		rotor := NewRotor(clock, cfg, 1)
+
+		rotor.SetDuty(fan.MaxDuty)
+		clock.Advance(10 * time.Second)
+		rotor.ReadAndReset()
+		clock.Advance(time.Second)
+
+		expected := 3000 / 60 * ppr
+		if got := rotor.ReadAndReset(); got < expected-1 || got > expected+1 {
+			t.Errorf("PPR %d で期待するパルス数は %d 、実際は %d で異なる", ppr, expected, got)
+		}
+	}
+}
+
+func TestRotor_Curve(t *testing.T) {
+	cfg := DefaultRotorConfig()
+	cfg.Curve = []CurvePoint{
+		{Duty: 10000, RPM: 600},
+		{Duty: 20000, RPM: 2000},
+		{Duty: 40000, RPM: 2600},
+	}
+	rotor := NewRotor(NewClock(), cfg, 1)
+
+	testCases := []struct {
+		duty     uint32
+		expected float64
+	}{
+		{duty: 0, expected: 600},
+		{duty: 15000, expected: 1300},
+		{duty: 30000, expected: 2300},
+		{duty: 40000, expected: 2600},
+	}
+	for _, tc := range testCases {
+		if got := rotor.SteadyRPM(tc.duty); got != tc.expected {
+			t.Errorf("デューティ %d で期待するRPMは %v 、実際は %v で異なる", tc.duty, tc.expected, got)
+		}
+	}
+}
+
+// 同じシードならノイズも含めて同じエッジ列になる
+func TestRotor_Deterministic(t *testing.T) {
+	run := func(seed int64) [edgeSamples]uint32 {
+		clock := NewClock()
+		cfg := DefaultRotorConfig()
+		cfg.Jitter = 0.05
+		cfg.MissProbability = 0.05
+		rotor := NewRotor(clock, cfg, seed)
+		rotor.SetDuty(fan.MaxDuty)
+		clock.Advance(5 * time.Second)
+		var edges [edgeSamples]uint32
+		rotor.ReadEdges(edges[:])
+		return edges
+	}
+
+	if run(42) != run(42) {
+		t.Error("同じシードなら同じエッジ列になるはず")
+	}
+	if run(42) == run(43) {
+		t.Error("違うシードなら違うエッジ列になるはず")
+	}
+}
+
+// ノイズがあっても計測RPMはおおよそ正しい
+func TestRotor_Noise(t *testing.T) {
+	clock := NewClock()
+	cfg := DefaultRotorConfig()
+	cfg.Jitter = 0.1
+	cfg.MissProbability = 0.02
+	rotor := NewRotor(clock, cfg, 7)
+	f := fan.NewFan("Sim", rotor)
+	f.SetClock(clock)
+
+	rotor.SetDuty(fan.MaxDuty)
+	clock.Advance(10 * time.Second)
+	f.CalculateRPM()
+	clock.Advance(4 * time.Second)
+	if rpm := f.CalculateRPM(); rpm < 2850 || rpm > 3030 {
+		t.Errorf("期待するRPMは 3000 付近、実際は %d で異なる", rpm)
+	}
+}
+
+// ロックしたローターはパルスを出さない
+func TestRotor_Locked(t *testing.T) {
+	clock := NewClock()
+	rotor := NewRotor(clock, DefaultRotorConfig(), 1)
+	rotor.SetDuty(fan.MaxDuty)
+	clock.Advance(5 * time.Second)
+
+	rotor.SetLocked(true)
+	rotor.ReadAndReset()
+	clock.Advance(time.Second)
+	if n := rotor.ReadAndReset(); n != 0 || rotor.RPM() != 0 {
+		t.Errorf("ロック中の期待するパルス数とRPMは 0/0 、実際は %d/%v で異なる", n, rotor.RPM())
+	}
+}
@@ -0,0 +1,208 @@
+package telemetry
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// FrameSync starts every binary frame.
+//
+// FrameSyncは、すべてのバイナリフレームの先頭のバイト。
+const FrameSync = 0xA5
+
+var (
+	// ErrShortFrame means more bytes are needed to decode the frame.
+	// ErrShortFrameは、フレームの復号にさらにバイトが必要なことを表す。
+	ErrShortFrame = errors.New("telemetry: short frame")
+	// ErrBadFrame means the bytes are not a valid frame.
+	// ErrBadFrameは、バイト列が正しいフレームではないことを表す。
+	ErrBadFrame = errors.New("telemetry: bad frame")
+)
+
+// fieldSizes are the encoded sizes of the fields, in bit order.
+var fieldSizes = [numFields]int{4, 2, 2, 2, 2, 1, 1, 1, 2, 2}
+
+// AppendFrame appends r as a binary frame to b:
+//
+//	sync(0xA5) length fields(2) values... CRC-16(2)
+//
+// length counts the fields and values, which are as written by
+// AppendValues. The CRC-16/CCITT covers length to the last value.
+//
+// AppendFrameは、rをバイナリフレームとしてbに追加する。lengthはfieldsと
+// 値のバイト数で、それらはAppendValuesが書く形式。CRC-16/CCITTはlengthか
+// ら最後の値までにかかる。
+func AppendFrame(b []byte, r Record, fields Field) []byte {
+	start := len(b)
+	b = append(b, FrameSync, 0)
+	b = AppendValues(b, r, fields)
+	b[start+1] = byte(len(b) - start - 2)
+	return binary.LittleEndian.AppendUint16(b, CRC16(b[start+1:]))
+}
+
+// AppendValues appends the fields of r in binary to b: the fields (2
+// bytes), then the values, little-endian in field order: time in ms (4
+// bytes), RPMs and duties (2 bytes each), faults and mode (1 byte each),
+// loop and late in µs (2 bytes each). Values too large for their size are
+// clamped.
+//
+// AppendValuesは、rのフィールドをバイナリでbに追加する。fields(2バイト)
+// の後に値がフィールドの順にリトルエンディアンで並ぶ：時間(ms、4バイト)、
+// RPMとデューティ(各2バイト)、異常とモード(各1バイト)、ループと遅れ(µs、
+// 各2バイト)。大きさに収まらない値は制限する。
+func AppendValues(b []byte, r Record, fields Field) []byte {
+	fields &= FieldAll
+	b = binary.LittleEndian.AppendUint16(b, uint16(fields))
+	for i := 0; i < numFields; i++ {
+		f := Field(1 << i)
+		if fields&f == 0 {
+			continue
+		}
+		switch f {
+		case FieldTime:
+			b = binary.LittleEndian.AppendUint32(b, uint32(r.Time.Milliseconds()))
+		case FieldFrontRPM:
+			b = appendU16(b, uint64(r.FrontRPM))
+		case FieldRearRPM:
+			b = appendU16(b, uint64(r.RearRPM))
+		case FieldFrontDuty:
+			b = appendU16(b, uint64(r.FrontDuty))
+		case FieldRearDuty:
+			b = appendU16(b, uint64(r.RearDuty))
+		case FieldFrontFault:
+			b = append(b, byte(r.FrontFault))
+		case FieldRearFault:
+			b = append(b, byte(r.RearFault))
+		case FieldMode:
+			b = append(b, byte(r.Mode))
+		case FieldLoop:
+			b = appendU16(b, uint64(r.Loop.Microseconds()))
+		case FieldLate:
+			b = appendU16(b, uint64(r.Late.Microseconds()))
+		}
+	}
+	return b
+}
+
+func appendU16(b []byte, v uint64) []byte {
+	if v > 0xFFFF {
+		v = 0xFFFF
+	}
+	return binary.LittleEndian.AppendUint16(b, uint16(v))
+}
+
+// DecodeFrame decodes the frame at the start of b and returns the record,
+// its fields and the number of bytes used. Fields not in the frame are
+// zero.
+//
+// DecodeFrameは、bの先頭のフレームを復号し、レコード、そのフィールド、使っ
+// たバイト数を返す。フレームに無いフィールドはゼロ値。
+func DecodeFrame(b []byte) (Record, Field, int, error) {
+	if len(b) < 2 {
+		return Record{}, 0, 0, ErrShortFrame
+	}
+	if b[0] != FrameSync {
+		return Record{}, 0, 0, ErrBadFrame
+	}
+	n := int(b[1])
+	if len(b) < 2+n+2 {
+		return Record{}, 0, 0, ErrShortFrame
+	}
+	if binary.LittleEndian.Uint16(b[2+n:]) != CRC16(b[1:2+n]) {
+		return Record{}, 0, 0, ErrBadFrame
+	}
+	r, fields, err := DecodeValues(b[2 : 2+n])
+	if err != nil {
+		return Record{}, 0, 0, err
+	}
+	return r, fields, 2 + n + 2, nil
+}
+
+// DecodeValues decodes values written by AppendValues, which must fill b
+// exactly, and returns the record and its fields. Fields not in b are
+// zero.
+//
+// DecodeValuesは、AppendValuesが書いた値を復号し、レコードとそのフィー
+// ルドを返す。値はbをちょうど埋めていなければならない。bに無いフィールド
+// はゼロ値。
+func DecodeValues(b []byte) (Record, Field, error) {
+	var r Record
+	if len(b) < 2 {
+		return r, 0, ErrBadFrame
+	}
+	fields := Field(binary.LittleEndian.Uint16(b))
+	if fields&^FieldAll != 0 {
+		return r, 0, ErrBadFrame
+	}
+	v := b[2:]
+	size := 0
+	for i := 0; i < numFields; i++ {
+		if fields&(1<<i) != 0 {
+			size += fieldSizes[i]
+		}
+	}
+	if len(v) != size {
+		return r, 0, ErrBadFrame
+	}
+
+	for i := 0; i < numFields; i++ {
+		f := Field(1 << i)
+		if fields&f == 0 {
+			continue
+		}
+		switch f {
+		case FieldTime:
+			r.Time = time.Duration(binary.LittleEndian.Uint32(v)) * time.Millisecond
+		case FieldFrontRPM:
+			r.FrontRPM = uint32(binary.LittleEndian.Uint16(v))
+		case FieldRearRPM:
+			r.RearRPM = uint32(binary.LittleEndian.Uint16(v))
+		case FieldFrontDuty:
+			r.FrontDuty = uint32(binary.LittleEndian.Uint16(v))
+		case FieldRearDuty:
+			r.RearDuty = uint32(binary.LittleEndian.Uint16(v))
+		case FieldFrontFault:
+			r.FrontFault = fan.Fault(v[0])
+		case FieldRearFault:
+			r.RearFault = fan.Fault(v[0])
+		case FieldMode:
+			r.Mode = control.Mode(v[0])
+		case FieldLoop:
+			r.Loop = time.Duration(binary.LittleEndian.Uint16(v)) * time.Microsecond
+		case FieldLate:
+			r.Late = time.Duration(binary.LittleEndian.Uint16(v)) * time.Microsecond
+		}
+		v = v[fieldSizes[i]:]
+	}
+	return r, fields, nil
+}
+
+// CRC16 returns the CRC-16/CCITT-FALSE of b.
+//
+// CRC16は、bのCRC-16/CCITT-FALSEを返す。
+func CRC16(b []byte) uint16 {
+	return UpdateCRC16(0xFFFF, b)
+}
+
+// UpdateCRC16 continues the CRC-16/CCITT-FALSE crc over b, so a CRC can
+// be taken over several slices. Start from 0xFFFF.
+//
+// UpdateCRC16は、CRC-16/CCITT-FALSEのcrcをbに続けて計算する。これで複数
+// のスライスにまたがるCRCを取れる。0xFFFFから始めること。
+func UpdateCRC16(crc uint16, b []byte) uint16 {
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,90 @@
+package telemetry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFrame_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fields   Field
+		record   Record
+		expected Record
+	}{
+		{name: "全フィールド", fields: FieldAll, record: sample, expected: sample},
+		{
+			name:     "一部のフィールド",
+			fields:   FieldFrontRPM | FieldRearFault,
+			record:   sample,
+			expected: Record{FrontRPM: sample.FrontRPM, RearFault: sample.RearFault},
+		},
+		{
+			name:     "大きすぎる値は制限",
+			fields:   FieldFrontRPM | FieldLoop,
+			record:   Record{FrontRPM: 70000, Loop: time.Second},
+			expected: Record{FrontRPM: 0xFFFF, Loop: 0xFFFF * time.Microsecond},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			frame := AppendFrame(nil, tc.record, tc.fields)
+			got, fields, n, err := DecodeFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(frame) || fields != tc.fields {
+				t.Errorf("期待する長さとフィールドは %d 、 %v 、実際は %d 、 %v で異なる", len(frame), tc.fields, n, fields)
+			}
+			if got != tc.expected {
+				t.Errorf("期待するレコードは %+v 、実際は %+v で異なる", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestDecodeFrame_Errors(t *testing.T) {
+	frame := AppendFrame(nil, sample, FieldAll)
+	flipped := append([]byte(nil), frame...)
+	flipped[6] ^= 0x40
+	wrongSize := AppendFrame(nil, sample, FieldFrontRPM)
+	// フィールドを書き換えてCRCを付け直す
+	wrongSize[2] = byte(FieldFrontFault)
+	wrongSize = frameWithCRC(wrongSize[1 : len(wrongSize)-2])
+
+	testCases := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{name: "空", data: nil, expected: ErrShortFrame},
+		{name: "途中まで", data: frame[:len(frame)-1], expected: ErrShortFrame},
+		{name: "同期バイトが違う", data: frame[1:], expected: ErrBadFrame},
+		{name: "ビット化け", data: flipped, expected: ErrBadFrame},
+		{name: "フィールドと長さが合わない", data: wrongSize, expected: ErrBadFrame},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, _, err := DecodeFrame(tc.data); !errors.Is(err, tc.expected) {
+				t.Errorf("期待するエラーは %v 、実際は %v で異なる", tc.expected, err)
+			}
+		})
+	}
+}
+
+// frameWithCRCは、長さからの内容に同期バイトとCRCを付ける
+func frameWithCRC(body []byte) []byte {
+	b := append([]byte{FrameSync}, body...)
+	c := CRC16(body)
+	return append(b, byte(c), byte(c>>8))
+}
+
+func TestCRC16(t *testing.T) {
+	// CRC-16/CCITT-FALSEのチェック値
+	if got := CRC16([]byte("123456789")); got != 0x29B1 {
+		t.Errorf("期待するCRCは 0x29b1 、実際は %#x で異なる", got)
+	}
+}
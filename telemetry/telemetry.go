@@ -0,0 +1,337 @@
+// Package telemetry streams timestamped records of the fan controller,
+// such as the RPMs, duties, faults, control mode and loop timing, as CSV,
+// JSON lines or compact binary frames, so runs can be logged and plotted
+// from a host.
+//
+// telemetryパッケージは、RPM、デューティ、異常、制御モード、ループのタイ
+// ミングなど、ファンコントローラーのタイムスタンプ付きレコードをCSV、JSON
+// Lines、またはコンパクトなバイナリフレームで送り出す。これでホストから
+// 動作を記録してグラフにできる。
+package telemetry
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// Record is one sample of the controller state.
+//
+// Recordは、コントローラーの状態の1サンプル。
+type Record struct {
+	// Time since boot.
+	// 起動からの時間
+	Time                  time.Duration
+	FrontRPM, RearRPM     uint32
+	FrontDuty, RearDuty   uint32
+	FrontFault, RearFault fan.Fault
+	Mode                  control.Mode
+	// Longest time spent running the ticks, and longest delay of a tick
+	// past its due time, since the previous record.
+	// 前回のレコード以降で、周期処理の実行にかかった最長の時間と、周期処理
+	// が予定時刻から遅れた最長の時間
+	Loop, Late time.Duration
+}
+
+// Field is a set of record fields.
+//
+// Fieldは、レコードのフィールドの集合。
+type Field uint16
+
+const (
+	FieldTime Field = 1 << iota
+	FieldFrontRPM
+	FieldRearRPM
+	FieldFrontDuty
+	FieldRearDuty
+	FieldFrontFault
+	FieldRearFault
+	FieldMode
+	FieldLoop
+	FieldLate
+
+	// FieldAll selects every field.
+	// FieldAllは、すべてのフィールドを選ぶ。
+	FieldAll Field = 1<<numFields - 1
+
+	numFields = 10
+)
+
+// fieldNames are the column and key names of the fields, in bit order.
+var fieldNames = [numFields]string{
+	"time_ms", "front_rpm", "rear_rpm", "front_duty", "rear_duty",
+	"front_fault", "rear_fault", "mode", "loop_us", "late_us",
+}
+
+// String returns the names of the set fields joined with ",".
+func (f Field) String() string {
+	s := ""
+	for i := 0; i < numFields; i++ {
+		if f&(1<<i) != 0 {
+			if s != "" {
+				s += ","
+			}
+			s += fieldNames[i]
+		}
+	}
+	return s
+}
+
+// ParseFields returns the fields named in a comma-separated list, as
+// returned by Field.String. "all" selects every field.
+//
+// ParseFieldsは、Field.Stringが返すようなカンマ区切りの名前の並びに対応す
+// るフィールドを返す。"all"はすべてのフィールドを選ぶ。
+func ParseFields(list string) (Field, bool) {
+	var f Field
+	for len(list) > 0 {
+		name := list
+		if i := indexByte(list, ','); i >= 0 {
+			name, list = list[:i], list[i+1:]
+		} else {
+			list = ""
+		}
+		if name == "all" {
+			f |= FieldAll
+			continue
+		}
+		found := false
+		for i, n := range fieldNames {
+			if n == name {
+				f |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return f, true
+}
+
+func indexByte(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// Format is the encoding of a telemetry stream.
+//
+// Formatは、テレメトリーの符号化方式。
+type Format uint8
+
+const (
+	// FormatCSV writes a header row, then one row per record.
+	// FormatCSVは、ヘッダー行の後、レコードごとに1行書く。
+	FormatCSV Format = iota
+	// FormatJSON writes one JSON object per line.
+	// FormatJSONは、1行に1つのJSONオブジェクトを書く。
+	FormatJSON
+	// FormatBinary writes one frame per record; see AppendFrame.
+	// FormatBinaryは、レコードごとに1つのフレームを書く。AppendFrameを参照。
+	FormatBinary
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case FormatCSV:
+		return "csv"
+	case FormatJSON:
+		return "json"
+	case FormatBinary:
+		return "binary"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseFormat returns the format with the given name, as returned by
+// Format.String.
+//
+// ParseFormatは、Format.Stringが返す名前に対応する符号化方式を返す。
+func ParseFormat(name string) (Format, bool) {
+	for f := FormatCSV; f <= FormatBinary; f++ {
+		if f.String() == name {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// Config selects the format, fields and rate of a Stream.
+//
+// Configは、Streamの符号化方式、フィールド、頻度を選ぶ。
+type Config struct {
+	Format Format
+	Fields Field
+	// Time between records. Zero writes a record on every call to Due.
+	// レコードの間隔。0ならDueを呼ぶたびにレコードを書く。
+	Interval time.Duration
+}
+
+// DefaultConfig returns CSV with every field once a second.
+//
+// DefaultConfigは、すべてのフィールドを1秒ごとにCSVで書く設定を返す。
+func DefaultConfig() Config {
+	return Config{
+		Format:   FormatCSV,
+		Fields:   FieldAll,
+		Interval: 1 * time.Second,
+	}
+}
+
+// Stream writes records to an io.Writer at the configured rate, reusing
+// one buffer for the encoding.
+//
+// Streamは、設定された頻度でレコードをio.Writerに書く。符号化にはバッファ
+// を1つ使い回す。
+type Stream struct {
+	Config Config
+	w      io.Writer
+	buf    []byte
+	// Whether the CSV header has been written.
+	// CSVのヘッダーを書いたかどうか
+	header bool
+	// Time the next record is due; zero before the first.
+	// 次のレコードの予定時刻。最初のレコードの前はゼロ値。
+	next time.Time
+}
+
+// NewStream creates a Stream writing to w.
+//
+// NewStreamは、wに書き込むStreamを作る。
+func NewStream(w io.Writer, cfg Config) *Stream {
+	return &Stream{Config: cfg, w: w, buf: make([]byte, 0, 160)}
+}
+
+// Due reports whether a record is due at now, and if so schedules the
+// next one. Build and Write the record only when it returns true.
+//
+// Dueは、nowでレコードを書く予定かどうかを返し、そうなら次の予定を立て
+// る。trueのときだけレコードを作ってWriteすること。
+func (s *Stream) Due(now time.Time) bool {
+	if !s.next.IsZero() && now.Before(s.next) {
+		return false
+	}
+	if s.next.IsZero() || s.Config.Interval <= 0 {
+		s.next = now.Add(s.Config.Interval)
+	} else {
+		// Like the app ticks, drop records missed while running late.
+		// appの周期処理と同じく、遅れている間に逃したレコードは捨てる。
+		s.next = s.next.Add(s.Config.Interval)
+		if !s.next.After(now) {
+			s.next = now.Add(s.Config.Interval)
+		}
+	}
+	return true
+}
+
+// Write writes r in the configured format.
+//
+// Writeは、rを設定された符号化方式で書く。
+func (s *Stream) Write(r Record) error {
+	b := s.buf[:0]
+	switch s.Config.Format {
+	case FormatJSON:
+		b = AppendJSON(b, r, s.Config.Fields)
+	case FormatBinary:
+		b = AppendFrame(b, r, s.Config.Fields)
+	default:
+		if !s.header {
+			b = AppendCSVHeader(b, s.Config.Fields)
+			s.header = true
+		}
+		b = AppendCSV(b, r, s.Config.Fields)
+	}
+	s.buf = b
+	_, err := s.w.Write(b)
+	return err
+}
+
+// AppendCSVHeader appends the CSV header row of fields to b.
+//
+// AppendCSVHeaderは、fieldsのCSVのヘッダー行をbに追加する。
+func AppendCSVHeader(b []byte, fields Field) []byte {
+	b = append(b, fields.String()...)
+	return append(b, '\n')
+}
+
+// AppendCSV appends r as a CSV row to b.
+//
+// AppendCSVは、rをCSVの1行としてbに追加する。
+func AppendCSV(b []byte, r Record, fields Field) []byte {
+	first := true
+	for i := 0; i < numFields; i++ {
+		if fields&(1<<i) == 0 {
+			continue
+		}
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = appendValue(b, r, Field(1<<i), false)
+	}
+	return append(b, '\n')
+}
+
+// AppendJSON appends r as one line of JSON to b.
+//
+// AppendJSONは、rをJSONの1行としてbに追加する。
+func AppendJSON(b []byte, r Record, fields Field) []byte {
+	b = append(b, '{')
+	first := true
+	for i := 0; i < numFields; i++ {
+		if fields&(1<<i) == 0 {
+			continue
+		}
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		b = append(b, '"')
+		b = append(b, fieldNames[i]...)
+		b = append(b, '"', ':')
+		b = appendValue(b, r, Field(1<<i), true)
+	}
+	return append(b, '}', '\n')
+}
+
+// appendValue appends the value of one field. Names are quoted for JSON.
+func appendValue(b []byte, r Record, f Field, quote bool) []byte {
+	var name string
+	switch f {
+	case FieldTime:
+		return strconv.AppendInt(b, r.Time.Milliseconds(), 10)
+	case FieldFrontRPM:
+		return strconv.AppendUint(b, uint64(r.FrontRPM), 10)
+	case FieldRearRPM:
+		return strconv.AppendUint(b, uint64(r.RearRPM), 10)
+	case FieldFrontDuty:
+		return strconv.AppendUint(b, uint64(r.FrontDuty), 10)
+	case FieldRearDuty:
+		return strconv.AppendUint(b, uint64(r.RearDuty), 10)
+	case FieldLoop:
+		return strconv.AppendInt(b, r.Loop.Microseconds(), 10)
+	case FieldLate:
+		return strconv.AppendInt(b, r.Late.Microseconds(), 10)
+	case FieldFrontFault:
+		name = r.FrontFault.String()
+	case FieldRearFault:
+		name = r.RearFault.String()
+	case FieldMode:
+		name = r.Mode.String()
+	}
+	if quote {
+		b = append(b, '"')
+		b = append(b, name...)
+		return append(b, '"')
+	}
+	return append(b, name...)
+}
@@ -0,0 +1,140 @@
+package telemetry
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kou-tkbys/tk-fancon2/control"
+	"github.com/kou-tkbys/tk-fancon2/fan"
+)
+
+// Note: tinygo test ./telemetry
+
+var sample = Record{
+	Time:       12345 * time.Millisecond,
+	FrontRPM:   2400,
+	RearRPM:    2040,
+	FrontDuty:  30000,
+	RearDuty:   26000,
+	FrontFault: fan.FaultNone,
+	RearFault:  fan.FaultStalled | fan.FaultUnderspeed,
+	Mode:       control.ModeClosedLoop,
+	Loop:       180 * time.Microsecond,
+	Late:       2 * time.Millisecond,
+}
+
+func TestStream_Formats(t *testing.T) {
+	testCases := []struct {
+		name     string
+		format   Format
+		fields   Field
+		expected string
+	}{
+		{
+			name:   "CSV：全フィールド",
+			format: FormatCSV,
+			fields: FieldAll,
+			expected: "time_ms,front_rpm,rear_rpm,front_duty,rear_duty,front_fault,rear_fault,mode,loop_us,late_us\n" +
+				"12345,2400,2040,30000,26000,none,stalled|underspeed,closed,180,2000\n" +
+				"12345,2400,2040,30000,26000,none,stalled|underspeed,closed,180,2000\n",
+		},
+		{
+			name:     "CSV：RPMだけ",
+			format:   FormatCSV,
+			fields:   FieldTime | FieldFrontRPM | FieldRearRPM,
+			expected: "time_ms,front_rpm,rear_rpm\n12345,2400,2040\n12345,2400,2040\n",
+		},
+		{
+			name:   "JSON：異常とモード",
+			format: FormatJSON,
+			fields: FieldRearFault | FieldMode,
+			expected: `{"rear_fault":"stalled|underspeed","mode":"closed"}` + "\n" +
+				`{"rear_fault":"stalled|underspeed","mode":"closed"}` + "\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			s := NewStream(&out, Config{Format: tc.format, Fields: tc.fields})
+			s.Write(sample)
+			s.Write(sample)
+			if out.String() != tc.expected {
+				t.Errorf("期待する出力は\n%s実際は\n%sで異なる", tc.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestStream_Due(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewStream(&bytes.Buffer{}, Config{Interval: time.Second})
+
+	testCases := []struct {
+		at       time.Duration
+		expected bool
+	}{
+		{at: 0, expected: true},
+		{at: 500 * time.Millisecond, expected: false},
+		{at: 1000 * time.Millisecond, expected: true},
+		{at: 1999 * time.Millisecond, expected: false},
+		{at: 2050 * time.Millisecond, expected: true},
+		// 遅れても予定はずれない
+		{at: 3000 * time.Millisecond, expected: true},
+		// 大きく遅れたら逃した分は捨てる
+		{at: 6500 * time.Millisecond, expected: true},
+		{at: 7000 * time.Millisecond, expected: false},
+		{at: 7500 * time.Millisecond, expected: true},
+	}
+	for _, tc := range testCases {
+		if got := s.Due(base.Add(tc.at)); got != tc.expected {
+			t.Errorf("%v で期待する結果は %v 、実際は %v で異なる", tc.at, tc.expected, got)
+		}
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	testCases := []struct {
+		name     string
+		list     string
+		expected Field
+		ok       bool
+	}{
+		{name: "1つ", list: "front_rpm", expected: FieldFrontRPM, ok: true},
+		{name: "複数", list: "time_ms,rear_duty,mode", expected: FieldTime | FieldRearDuty | FieldMode, ok: true},
+		{name: "全部", list: "all", expected: FieldAll, ok: true},
+		{name: "知らない名前", list: "front_rpm,speed", ok: false},
+		{name: "Stringと往復", list: FieldAll.String(), expected: FieldAll, ok: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := ParseFields(tc.list)
+			if ok != tc.ok || got != tc.expected {
+				t.Errorf("期待する結果は %v (%v)、実際は %v (%v) で異なる", tc.expected, tc.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, f := range []Format{FormatCSV, FormatJSON, FormatBinary} {
+		if got, ok := ParseFormat(f.String()); !ok || got != f {
+			t.Errorf("期待する形式は %v 、実際は %v (%v) で異なる", f, got, ok)
+		}
+	}
+	if _, ok := ParseFormat("xml"); ok {
+		t.Error("xmlは知らない形式のはず")
+	}
+}
+
+func ExampleStream() {
+	s := NewStream(os.Stdout, Config{
+		Format: FormatJSON,
+		Fields: FieldTime | FieldFrontRPM | FieldRearRPM,
+	})
+	s.Write(Record{Time: 1500 * time.Millisecond, FrontRPM: 2400, RearRPM: 2040})
+	// Output: {"time_ms":1500,"front_rpm":2400,"rear_rpm":2040}
+}